@@ -0,0 +1,157 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/auth"
+)
+
+var (
+	// ErrNoRecoveryCode indicates that there is no unused recovery code.
+	ErrNoRecoveryCode = errs.Class("recovery code does not exist")
+	// ErrNoPasswordToken indicates that there is no unused password token.
+	ErrNoPasswordToken = errs.Class("password token does not exist")
+)
+
+// DB exposes methods to manage authentication related data of managers.
+//
+// architecture: Database
+type DB interface {
+	// SetRecoveryCodes replaces all recovery codes of the manager.
+	SetRecoveryCodes(ctx context.Context, managerID uuid.UUID, hashes [][]byte) error
+	// UseRecoveryCode marks unused recovery code as used, returns ErrNoRecoveryCode if there is no such code.
+	UseRecoveryCode(ctx context.Context, managerID uuid.UUID, hash []byte, usedAt time.Time) error
+
+	// GetLoginThrottle returns throttling state of the key, zero state if there were no failures.
+	GetLoginThrottle(ctx context.Context, key string) (LoginThrottle, error)
+	// RecordLoginFailure increments failures counter of the key and returns updated state,
+	// counter starts over if the last failure happened before resetBefore.
+	RecordLoginFailure(ctx context.Context, key string, failedAt, resetBefore time.Time) (LoginThrottle, error)
+	// LockLogin prohibits login attempts for the key until specified time.
+	LockLogin(ctx context.Context, key string, lockedUntil time.Time) error
+	// ResetLoginThrottle removes throttling state of the key.
+	ResetLoginThrottle(ctx context.Context, key string) error
+	// AddLoginAttempt records login attempt for auditing.
+	AddLoginAttempt(ctx context.Context, attempt LoginAttempt) error
+	// ListFailedLoginIPs returns distinct IP addresses of failed login attempts of the manager since specified time.
+	ListFailedLoginIPs(ctx context.Context, managerID uuid.UUID, since time.Time) ([]string, error)
+
+	// AddPasswordToken saves password token.
+	AddPasswordToken(ctx context.Context, token PasswordToken) error
+	// GetPasswordToken returns password token by hash, returns ErrNoPasswordToken if there is no such token.
+	GetPasswordToken(ctx context.Context, hash []byte) (PasswordToken, error)
+	// UsePasswordToken marks unused password token as used, returns ErrNoPasswordToken if there is no such token.
+	UsePasswordToken(ctx context.Context, hash []byte, usedAt time.Time) error
+	// DeletePasswordTokens deletes all password tokens of the manager.
+	DeletePasswordTokens(ctx context.Context, managerID uuid.UUID) error
+}
+
+// Config contains configuration of managers authentication.
+type Config struct {
+	// Issuer is a name of the service shown in authenticator apps.
+	Issuer string
+	// SecondFactorRoles lists roles for which two-factor authentication is mandatory.
+	SecondFactorRoles []managers.Role
+	// Throttle defines brute-force protection, DefaultThrottleConfig is used if it is empty.
+	Throttle ThrottleConfig
+	// PortalURL is an external address of admin portal used in links sent by email.
+	PortalURL string
+	// SSO configures login with OpenID Connect identity provider.
+	SSO SSOConfig
+}
+
+// LoginThrottle holds failed login attempts of single email or IP address.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// LoginAttempt describes single login attempt recorded for auditing.
+type LoginAttempt struct {
+	ID        uuid.UUID
+	Email     string
+	IP        string
+	ManagerID uuid.UUID
+	Success   bool
+	Reason    string
+	CreatedAt time.Time
+}
+
+// PasswordTokenPurpose defines what password token is issued for.
+type PasswordTokenPurpose string
+
+const (
+	// PurposeInvite marks token sent to invited manager to set the first password.
+	PurposeInvite PasswordTokenPurpose = "invite"
+	// PurposeReset marks token sent to manager who forgot password.
+	PurposeReset PasswordTokenPurpose = "reset"
+)
+
+// PasswordToken is a single-use token which allows to set password of the manager.
+// Only hash of the token is stored.
+type PasswordToken struct {
+	Hash      []byte
+	ManagerID uuid.UUID
+	Purpose   PasswordTokenPurpose
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// ThrottleConfig defines how failed login attempts are throttled.
+type ThrottleConfig struct {
+	// FreeAttempts is a number of failed attempts allowed without any delay.
+	FreeAttempts int
+	// BaseDelay is a delay after first throttled attempt, it doubles with every next failure.
+	BaseDelay time.Duration
+	// MaxDelay limits exponential delay.
+	MaxDelay time.Duration
+	// LockoutAttempts is a number of failed attempts after which login is locked.
+	LockoutAttempts int
+	// LockoutDuration is a duration of temporary lockout.
+	LockoutDuration time.Duration
+}
+
+// DefaultThrottleConfig is used when throttling is not configured.
+var DefaultThrottleConfig = ThrottleConfig{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 30 * time.Minute,
+}
+
+// Step defines which step of login manager has to pass next.
+type Step string
+
+const (
+	// StepDone means that manager is authenticated and auth token is issued.
+	StepDone Step = "done"
+	// StepSecondFactor means that manager has to enter TOTP or recovery code.
+	StepSecondFactor Step = "second-factor"
+	// StepEnrollment means that two-factor authentication is mandatory and manager has to enroll first.
+	StepEnrollment Step = "enrollment"
+)
+
+// Authentication is a result of login step.
+type Authentication struct {
+	Step Step
+	// Token is an auth token on StepDone or a short-lived challenge token on other steps.
+	Token auth.Token
+}
+
+// Enrollment holds data needed to add TOTP secret to authenticator app.
+type Enrollment struct {
+	Secret string
+	URI    string
+}
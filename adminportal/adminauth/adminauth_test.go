@@ -0,0 +1,384 @@
+package adminauth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/internal/mail"
+	"cleanmasters/internal/oidc/oidctest"
+	"cleanmasters/internal/password"
+	"cleanmasters/internal/totp"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.AdminAuth()
+
+		manager := managers.Manager{
+			ID:           uuid.New(),
+			FirstName:    "Aslan",
+			LastName:     "Maslan",
+			Email:        "am@qwe.com",
+			PasswordHash: []byte("qwerty123"),
+			Role:         managers.RoleAdmin,
+		}
+		require.NoError(t, db.Managers().Add(ctx, manager))
+
+		err := repo.SetRecoveryCodes(ctx, manager.ID, [][]byte{[]byte("first"), []byte("second")})
+		require.NoError(t, err)
+
+		err = repo.UseRecoveryCode(ctx, manager.ID, []byte("first"), time.Now())
+		require.NoError(t, err)
+
+		err = repo.UseRecoveryCode(ctx, manager.ID, []byte("first"), time.Now())
+		assert.True(t, adminauth.ErrNoRecoveryCode.Has(err))
+
+		err = repo.SetRecoveryCodes(ctx, manager.ID, [][]byte{[]byte("third")})
+		require.NoError(t, err)
+
+		err = repo.UseRecoveryCode(ctx, manager.ID, []byte("second"), time.Now())
+		assert.True(t, adminauth.ErrNoRecoveryCode.Has(err))
+
+		err = repo.UseRecoveryCode(ctx, manager.ID, []byte("third"), time.Now())
+		require.NoError(t, err)
+	})
+}
+
+func TestLoginThrottle(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.AdminAuth()
+		key := "email:am@qwe.com"
+
+		throttle, err := repo.GetLoginThrottle(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, 0, throttle.Failures)
+		assert.True(t, throttle.LockedUntil.IsZero())
+
+		now := time.Now().UTC()
+		for i := 1; i <= 3; i++ {
+			throttle, err = repo.RecordLoginFailure(ctx, key, now, now.Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, i, throttle.Failures)
+		}
+
+		lockedUntil := now.Add(time.Hour)
+		err = repo.LockLogin(ctx, key, lockedUntil)
+		require.NoError(t, err)
+
+		throttle, err = repo.GetLoginThrottle(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, 3, throttle.Failures)
+		assert.WithinDuration(t, lockedUntil, throttle.LockedUntil, time.Second)
+
+		throttle, err = repo.RecordLoginFailure(ctx, key, now.Add(2*time.Hour), now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, throttle.Failures)
+		assert.True(t, throttle.LockedUntil.IsZero())
+
+		err = repo.ResetLoginThrottle(ctx, key)
+		require.NoError(t, err)
+
+		throttle, err = repo.GetLoginThrottle(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, 0, throttle.Failures)
+
+		err = repo.AddLoginAttempt(ctx, adminauth.LoginAttempt{
+			ID:        uuid.New(),
+			Email:     "am@qwe.com",
+			IP:        "127.0.0.1",
+			Reason:    "unknown email",
+			CreatedAt: now,
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestThrottleAfterLockout(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		hasher := password.NewHasher(password.HasherConfig{})
+		managersService := managers.NewService(db.Managers(), password.DefaultPolicy, hasher, cleanmasters.ManagersTransaction(db))
+
+		config := adminauth.Config{
+			Throttle: adminauth.ThrottleConfig{
+				BaseDelay:       time.Minute,
+				MaxDelay:        time.Hour,
+				LockoutAttempts: 3,
+				LockoutDuration: 30 * time.Minute,
+			},
+		}
+		service := adminauth.NewService(config, db.AdminAuth(), auth.NewTokenSigner("secret"), managersService,
+			totp.New(totp.Config{}, time.Now), mail.NewLogMailer(zaplog.NewLog()), hasher)
+
+		// manager was locked out by failures which happened before the lockout duration.
+		repo := db.AdminAuth()
+		key := "email:am@qwe.com"
+		failedAt := time.Now().UTC().Add(-31 * time.Minute)
+		for i := 0; i < 3; i++ {
+			_, err := repo.RecordLoginFailure(ctx, key, failedAt, failedAt.Add(-time.Hour))
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.LockLogin(ctx, key, failedAt.Add(30*time.Minute)))
+
+		lockedUntil, err := service.LockedUntil(ctx, "am@qwe.com")
+		require.NoError(t, err)
+		require.True(t, lockedUntil.IsZero())
+
+		_, err = service.Token(ctx, "am@qwe.com", "wrong password", "127.0.0.1")
+		require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+
+		lockedUntil, err = service.LockedUntil(ctx, "am@qwe.com")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), lockedUntil, 5*time.Second)
+	})
+}
+
+func TestThrottleReset(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		hasher := password.NewHasher(password.HasherConfig{})
+		managersService := managers.NewService(db.Managers(), password.DefaultPolicy, hasher, cleanmasters.ManagersTransaction(db))
+
+		config := adminauth.Config{
+			Throttle: adminauth.ThrottleConfig{
+				FreeAttempts:    1,
+				BaseDelay:       time.Minute,
+				MaxDelay:        time.Hour,
+				LockoutAttempts: 10,
+				LockoutDuration: 30 * time.Minute,
+			},
+		}
+		service := adminauth.NewService(config, db.AdminAuth(), auth.NewTokenSigner("secret"), managersService,
+			totp.New(totp.Config{}, time.Now), mail.NewLogMailer(zaplog.NewLog()), hasher)
+
+		manager, err := managersService.Create(ctx, "Correct-Horse-Battery-42", "Aslan", "Maslan", "am@qwe.com", managers.RoleManager)
+		require.NoError(t, err)
+
+		failures := func(t *testing.T, key string) int {
+			throttle, err := db.AdminAuth().GetLoginThrottle(ctx, key)
+			require.NoError(t, err)
+			return throttle.Failures
+		}
+
+		t.Run("successful login", func(t *testing.T) {
+			_, err := service.Token(ctx, "am@qwe.com", "wrong password", "10.0.0.1")
+			require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+			require.Equal(t, 1, failures(t, "ip:10.0.0.1"))
+
+			_, err = service.Token(ctx, "am@qwe.com", "Correct-Horse-Battery-42", "10.0.0.1")
+			require.NoError(t, err)
+			assert.Equal(t, 0, failures(t, "email:am@qwe.com"))
+			assert.Equal(t, 0, failures(t, "ip:10.0.0.1"))
+		})
+
+		t.Run("unlock", func(t *testing.T) {
+			for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+				_, err := service.Token(ctx, "am@qwe.com", "wrong password", ip)
+				require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+			}
+			_, err := service.Token(ctx, "other@qwe.com", "wrong password", "10.0.0.4")
+			require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+
+			lockedUntil, err := service.LockedUntil(ctx, "am@qwe.com")
+			require.NoError(t, err)
+			require.False(t, lockedUntil.IsZero())
+
+			require.NoError(t, service.Unlock(ctx, manager.ID))
+
+			lockedUntil, err = service.LockedUntil(ctx, "am@qwe.com")
+			require.NoError(t, err)
+			assert.True(t, lockedUntil.IsZero())
+			assert.Equal(t, 0, failures(t, "ip:10.0.0.2"))
+			assert.Equal(t, 0, failures(t, "ip:10.0.0.3"))
+			assert.Equal(t, 1, failures(t, "ip:10.0.0.4"))
+		})
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		hasher := password.NewHasher(password.HasherConfig{})
+		managersService := managers.NewService(db.Managers(), password.DefaultPolicy, hasher, cleanmasters.ManagersTransaction(db))
+
+		config := adminauth.Config{
+			Throttle: adminauth.ThrottleConfig{
+				FreeAttempts:    1,
+				BaseDelay:       time.Minute,
+				MaxDelay:        time.Hour,
+				LockoutAttempts: 10,
+				LockoutDuration: 30 * time.Minute,
+			},
+		}
+		service := adminauth.NewService(config, db.AdminAuth(), auth.NewTokenSigner("secret"), managersService,
+			totp.New(totp.Config{}, time.Now), mail.NewLogMailer(zaplog.NewLog()), hasher)
+
+		manager, err := managersService.Create(ctx, "Correct-Horse-Battery-42", "Aslan", "Maslan", "am@qwe.com", managers.RoleManager)
+		require.NoError(t, err)
+
+		now := time.Now().UTC()
+		token := adminauth.PasswordToken{
+			Hash:      []byte("hash"),
+			ManagerID: manager.ID,
+			Purpose:   adminauth.PurposeReset,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		}
+		require.NoError(t, db.AdminAuth().AddPasswordToken(ctx, token))
+
+		err = service.ChangePassword(ctx, manager.ID, "wrong password", "Battery-Staple-Horse-43", "127.0.0.1")
+		require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+
+		err = service.ChangePassword(ctx, manager.ID, "Correct-Horse-Battery-42", "Battery-Staple-Horse-43", "127.0.0.1")
+		require.NoError(t, err)
+
+		_, err = db.AdminAuth().GetPasswordToken(ctx, token.Hash)
+		assert.True(t, adminauth.ErrNoPasswordToken.Has(err))
+
+		for i := 0; i < 2; i++ {
+			err = service.ChangePassword(ctx, manager.ID, "wrong password", "Correct-Horse-Battery-42", "127.0.0.1")
+			require.True(t, adminauth.ErrInvalidCredentials.Has(err))
+		}
+
+		err = service.ChangePassword(ctx, manager.ID, "Battery-Staple-Horse-43", "Correct-Horse-Battery-42", "127.0.0.1")
+		assert.True(t, adminauth.ErrTooManyAttempts.Has(err))
+	})
+}
+
+func TestPasswordTokens(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.AdminAuth()
+
+		manager := managers.Manager{
+			ID:           uuid.New(),
+			FirstName:    "Aslan",
+			LastName:     "Maslan",
+			Email:        "am@qwe.com",
+			PasswordHash: []byte{},
+			Role:         managers.RoleManager,
+		}
+		require.NoError(t, db.Managers().Add(ctx, manager))
+
+		now := time.Now().UTC()
+		token := adminauth.PasswordToken{
+			Hash:      []byte("hash"),
+			ManagerID: manager.ID,
+			Purpose:   adminauth.PurposeInvite,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		}
+		require.NoError(t, repo.AddPasswordToken(ctx, token))
+
+		stored, err := repo.GetPasswordToken(ctx, token.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, manager.ID, stored.ManagerID)
+		assert.Equal(t, adminauth.PurposeInvite, stored.Purpose)
+		assert.Nil(t, stored.UsedAt)
+
+		_, err = repo.GetPasswordToken(ctx, []byte("unknown"))
+		assert.True(t, adminauth.ErrNoPasswordToken.Has(err))
+
+		require.NoError(t, repo.UsePasswordToken(ctx, token.Hash, now))
+
+		err = repo.UsePasswordToken(ctx, token.Hash, now)
+		assert.True(t, adminauth.ErrNoPasswordToken.Has(err))
+
+		stored, err = repo.GetPasswordToken(ctx, token.Hash)
+		require.NoError(t, err)
+		require.NotNil(t, stored.UsedAt)
+	})
+}
+
+func TestSSO(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		idp := oidctest.NewIdP("portal", "secret")
+		defer idp.Close()
+
+		hasher := password.NewHasher(password.HasherConfig{})
+		managersService := managers.NewService(db.Managers(), password.DefaultPolicy, hasher, cleanmasters.ManagersTransaction(db))
+
+		config := adminauth.Config{
+			SSO: adminauth.SSOConfig{
+				OIDC: idp.Config("http://portal.test/authorize/sso/callback"),
+				GroupRoles: map[string]managers.Role{
+					"support":  managers.RoleSupport,
+					"admins":   managers.RoleAdmin,
+					"managers": managers.RoleManager,
+				},
+			},
+		}
+		service := adminauth.NewService(config, db.AdminAuth(), auth.NewTokenSigner("secret"), managersService,
+			totp.New(totp.Config{}, time.Now), mail.NewLogMailer(zaplog.NewLog()), hasher)
+
+		login := func(t *testing.T) (auth.Token, error) {
+			redirectURL, request, err := service.BeginSSO(ctx)
+			require.NoError(t, err)
+
+			callback, err := idp.Login(redirectURL)
+			require.NoError(t, err)
+
+			return service.CompleteSSO(ctx, request, callback.Query().Get("state"), callback.Query().Get("code"), "127.0.0.1")
+		}
+
+		idp.User = map[string]interface{}{
+			"sub":            "user-1",
+			"email":          "sso@qwe.com",
+			"email_verified": true,
+			"name":           "Single Sign",
+			"groups":         []string{"support", "admins"},
+		}
+
+		t.Run("unknown manager", func(t *testing.T) {
+			_, err := login(t)
+			require.True(t, adminauth.ErrSSO.Has(err))
+		})
+
+		manager, err := managersService.Invite(ctx, "Single", "Sign", "sso@qwe.com", managers.RoleSupport)
+		require.NoError(t, err)
+
+		t.Run("role is synced with groups", func(t *testing.T) {
+			token, err := login(t)
+			require.NoError(t, err)
+			require.NotEmpty(t, token.String())
+
+			updated, err := managersService.Get(ctx, manager.ID)
+			require.NoError(t, err)
+			assert.Equal(t, managers.RoleAdmin, updated.Role)
+		})
+
+		t.Run("no mapped group", func(t *testing.T) {
+			idp.User["groups"] = []string{"everyone"}
+			defer func() { idp.User["groups"] = []string{"support", "admins"} }()
+
+			_, err := login(t)
+			require.True(t, adminauth.ErrSSO.Has(err))
+		})
+
+		t.Run("unverified email", func(t *testing.T) {
+			idp.User["email_verified"] = false
+			defer func() { idp.User["email_verified"] = true }()
+
+			_, err := login(t)
+			require.True(t, adminauth.ErrSSO.Has(err))
+		})
+
+		t.Run("forged state", func(t *testing.T) {
+			redirectURL, request, err := service.BeginSSO(ctx)
+			require.NoError(t, err)
+
+			callback, err := idp.Login(redirectURL)
+			require.NoError(t, err)
+
+			_, err = service.CompleteSSO(ctx, request, "forged", callback.Query().Get("code"), "127.0.0.1")
+			require.True(t, adminauth.ErrSSO.Has(err))
+		})
+	})
+}
@@ -0,0 +1,226 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/mail"
+)
+
+const (
+	// InviteTokenDuration is an expiration duration for invitation link.
+	InviteTokenDuration = 7 * 24 * time.Hour
+	// ResetTokenDuration is an expiration duration for password reset link.
+	ResetTokenDuration = time.Hour
+
+	// passwordTokenLength is a number of random bytes in password token.
+	passwordTokenLength = 32
+)
+
+// Invite creates manager without password and sends invitation link to set the password.
+func (service *Service) Invite(ctx context.Context, firstName, lastName, email string, role managers.Role) (managers.Manager, error) {
+	manager, err := service.managers.Invite(ctx, firstName, lastName, email, role)
+	if err != nil {
+		return managers.Manager{}, err
+	}
+
+	token, err := service.issuePasswordToken(ctx, manager.ID, PurposeInvite, InviteTokenDuration)
+	if err != nil {
+		return managers.Manager{}, Error.Wrap(err)
+	}
+
+	err = service.mailer.Send(ctx, mail.Message{
+		To:      manager.Email,
+		Subject: "Invitation to admin portal",
+		Body: fmt.Sprintf("You were invited to admin portal.\r\nFollow the link to set your password: %s\r\nThe link expires in %s.",
+			service.link("/invite/", token), InviteTokenDuration),
+	})
+
+	return manager, Error.Wrap(err)
+}
+
+// ForgotPassword sends password reset link to the manager.
+// It does not report whether manager exists, so it could not be used to enumerate registered emails.
+func (service *Service) ForgotPassword(ctx context.Context, email string) error {
+	manager, err := service.managers.GetByEmail(ctx, email)
+	if err != nil {
+		if managers.ErrNoManager.Has(err) {
+			return nil
+		}
+		return Error.Wrap(err)
+	}
+
+	token, err := service.issuePasswordToken(ctx, manager.ID, PurposeReset, ResetTokenDuration)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = service.mailer.Send(ctx, mail.Message{
+		To:      manager.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Follow the link to reset your password: %s\r\nThe link expires in %s. "+
+			"If you did not request password reset, ignore this message.",
+			service.link("/password/reset/", token), ResetTokenDuration),
+	})
+
+	return Error.Wrap(err)
+}
+
+// CheckPasswordToken returns ErrNoPasswordToken if token is unknown, used, expired or issued for other purpose.
+func (service *Service) CheckPasswordToken(ctx context.Context, token string, purpose PasswordTokenPurpose) error {
+	_, err := service.passwordToken(ctx, token, purpose)
+	return err
+}
+
+// ResetPassword sets new password of the manager using token from invitation or password reset link.
+// Token could be used only once, other links of the manager stop working as well,
+// lockout caused by failed login attempts is removed.
+func (service *Service) ResetPassword(ctx context.Context, token string, purpose PasswordTokenPurpose, password, ip string) error {
+	passwordToken, err := service.passwordToken(ctx, token, purpose)
+	if err != nil {
+		return err
+	}
+
+	// policy is checked before token is used, so manager could try another password with the same link.
+	err = service.managers.ValidatePassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = service.db.UsePasswordToken(ctx, passwordToken.Hash, time.Now().UTC())
+	if err != nil {
+		if ErrNoPasswordToken.Has(err) {
+			return err
+		}
+		return Error.Wrap(err)
+	}
+
+	err = service.managers.SetPassword(ctx, passwordToken.ManagerID, password)
+	if err != nil {
+		return err
+	}
+
+	err = service.db.DeletePasswordTokens(ctx, passwordToken.ManagerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	manager, err := service.managers.Get(ctx, passwordToken.ManagerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return service.resetThrottle(ctx, manager.Email, ip)
+}
+
+// ChangePassword replaces password of logged in manager, current password has to be confirmed.
+// Wrong current passwords are throttled in the same way as failed logins, password reset links stop working.
+func (service *Service) ChangePassword(ctx context.Context, managerID uuid.UUID, current, password, ip string) (err error) {
+	err = service.managers.ValidatePassword(password)
+	if err != nil {
+		return err
+	}
+
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	now := time.Now().UTC()
+	keys := throttleKeys(manager.Email, ip)
+
+	attempt := LoginAttempt{Email: manager.Email, IP: ip, ManagerID: manager.ID, CreatedAt: now}
+	defer func() { err = errs.Combine(err, service.recordAttempt(ctx, attempt)) }()
+
+	err = service.checkThrottle(ctx, now, keys)
+	if err != nil {
+		attempt.Reason = reasonThrottled
+		return err
+	}
+
+	err = service.hasher.Compare(manager.PasswordHash, current)
+	if err != nil {
+		attempt.Reason = reasonInvalidPassword
+		return service.fail(ctx, now, keys)
+	}
+
+	err = service.managers.SetPassword(ctx, managerID, password)
+	if err != nil {
+		return err
+	}
+	attempt.Success, attempt.Reason = true, reasonPasswordChanged
+
+	err = service.db.DeletePasswordTokens(ctx, managerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return service.resetThrottle(ctx, manager.Email, ip)
+}
+
+// issuePasswordToken generates new password token and saves its hash.
+func (service *Service) issuePasswordToken(ctx context.Context, managerID uuid.UUID, purpose PasswordTokenPurpose, duration time.Duration) (string, error) {
+	random := make([]byte, passwordTokenLength)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(random)
+	now := time.Now().UTC()
+
+	err = service.db.AddPasswordToken(ctx, PasswordToken{
+		Hash:      hashPasswordToken(token),
+		ManagerID: managerID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	})
+
+	return token, err
+}
+
+// passwordToken returns valid unused password token.
+func (service *Service) passwordToken(ctx context.Context, token string, purpose PasswordTokenPurpose) (PasswordToken, error) {
+	passwordToken, err := service.db.GetPasswordToken(ctx, hashPasswordToken(token))
+	if err != nil {
+		if ErrNoPasswordToken.Has(err) {
+			return PasswordToken{}, err
+		}
+		return PasswordToken{}, Error.Wrap(err)
+	}
+
+	switch {
+	case passwordToken.Purpose != purpose:
+		return PasswordToken{}, ErrNoPasswordToken.New("invalid purpose")
+	case passwordToken.UsedAt != nil:
+		return PasswordToken{}, ErrNoPasswordToken.New("token is already used")
+	case passwordToken.ExpiresAt.Before(time.Now()):
+		return PasswordToken{}, ErrNoPasswordToken.New("token expired")
+	}
+
+	return passwordToken, nil
+}
+
+// link returns absolute link to admin portal page.
+func (service *Service) link(path, token string) string {
+	return strings.TrimSuffix(service.config.PortalURL, "/") + path + token
+}
+
+// hashPasswordToken returns hash of password token which is stored in database.
+func hashPasswordToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"strings"
+)
+
+const (
+	// recoveryCodesCount is a number of recovery codes issued at once.
+	recoveryCodesCount = 10
+	// recoveryCodePartLength is a length of each of two parts of recovery code.
+	recoveryCodePartLength = 5
+	// recoveryCodeAlphabet excludes similar looking characters.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// generateRecoveryCodes generates one-time recovery codes and their hashes.
+func generateRecoveryCodes() (codes []string, hashes [][]byte, err error) {
+	for i := 0; i < recoveryCodesCount; i++ {
+		random := make([]byte, 2*recoveryCodePartLength)
+		_, err = rand.Read(random)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var code strings.Builder
+		for j, b := range random {
+			if j == recoveryCodePartLength {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+
+		codes = append(codes, code.String())
+		hashes = append(hashes, hashRecoveryCode(code.String()))
+	}
+
+	return codes, hashes, nil
+}
+
+// isRecoveryCode distinguishes recovery codes from TOTP codes.
+func isRecoveryCode(code string) bool {
+	return strings.Contains(code, "-")
+}
+
+// hashRecoveryCode returns hash of recovery code which is stored in database.
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
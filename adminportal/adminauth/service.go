@@ -6,57 +6,335 @@ package adminauth
 import (
 	"context"
 	"crypto/subtle"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/zeebo/errs"
-	"golang.org/x/crypto/bcrypt"
 
 	"cleanmasters/adminportal/managers"
 	"cleanmasters/internal/auth"
+	"cleanmasters/internal/mail"
+	"cleanmasters/internal/oidc"
+	"cleanmasters/internal/password"
+	"cleanmasters/internal/totp"
 )
 
 var (
 	// Error in an internal error for admin service.
 	Error = errs.Class("admin service error")
+	// ErrSecondFactor indicates that TOTP or recovery code is not valid.
+	ErrSecondFactor = errs.Class("second factor verification error")
+)
+
+const (
+	// TokenDuration is an expiration duration for auth token.
+	TokenDuration = 24 * time.Hour
+	// ChallengeDuration is an expiration duration for token issued between login steps.
+	ChallengeDuration = 5 * time.Minute
+
+	// purposeSecondFactor marks challenge token which could be exchanged for auth token with valid TOTP code.
+	purposeSecondFactor = "second-factor"
+	// purposeEnrollment marks challenge token which could be used only to enroll into two-factor authentication.
+	purposeEnrollment = "enrollment"
 )
 
 // Service is exposing all business logic of managers portal.
 //
 // architecture: Service
 type Service struct {
+	config   Config
+	db       DB
 	signer   *auth.TokenSigner
 	managers *managers.Service
+	totp     *totp.TOTP
+	mailer   mail.Mailer
+	hasher   *password.Hasher
+
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+
+	ssoMu sync.Mutex
+	sso   *oidc.Provider
 }
 
 // NewService is a constructor for admin Service.
-func NewService(signer *auth.TokenSigner, managers *managers.Service) *Service {
+func NewService(config Config, db DB, signer *auth.TokenSigner, managers *managers.Service, totp *totp.TOTP, mailer mail.Mailer, hasher *password.Hasher) *Service {
+	if config.Throttle == (ThrottleConfig{}) {
+		config.Throttle = DefaultThrottleConfig
+	}
+
 	return &Service{
+		config:   config,
+		db:       db,
 		signer:   signer,
 		managers: managers,
+		totp:     totp,
+		mailer:   mailer,
+		hasher:   hasher,
 	}
 }
 
-// Token authenticates manager by credentials and returns auth token.
-func (service *Service) Token(ctx context.Context, email string, password string) (token auth.Token, err error) {
+// Token authenticates manager by credentials and returns auth token,
+// or a challenge token if manager has to pass two-factor authentication.
+// Failed attempts are throttled per email and per IP address and every attempt is recorded.
+func (service *Service) Token(ctx context.Context, email, password, ip string) (_ Authentication, err error) {
+	now := time.Now().UTC()
+	keys := throttleKeys(email, ip)
+
+	attempt := LoginAttempt{Email: email, IP: ip, CreatedAt: now}
+	defer func() { err = errs.Combine(err, service.recordAttempt(ctx, attempt)) }()
+
+	err = service.checkThrottle(ctx, now, keys)
+	if err != nil {
+		attempt.Reason = reasonThrottled
+		return Authentication{}, err
+	}
+
 	manager, err := service.managers.GetByEmail(ctx, email)
+	if err != nil {
+		if !managers.ErrNoManager.Has(err) {
+			return Authentication{}, Error.Wrap(err)
+		}
+
+		service.compareDummyHash(password)
+		attempt.Reason = reasonUnknownEmail
+		return Authentication{}, service.fail(ctx, now, keys)
+	}
+	attempt.ManagerID = manager.ID
+
+	err = service.hasher.Compare(manager.PasswordHash, password)
+	if err != nil {
+		attempt.Reason = reasonInvalidPassword
+		return Authentication{}, service.fail(ctx, now, keys)
+	}
+
+	// password is known only at login, so hashes with outdated algorithm or parameters are upgraded here.
+	if service.hasher.NeedsRehash(manager.PasswordHash) {
+		err = service.managers.RehashPassword(ctx, manager.ID, password)
+		if err != nil {
+			return Authentication{}, Error.Wrap(err)
+		}
+	}
+
+	step := StepDone
+	purpose := ""
+	switch {
+	case manager.SecondFactor.Enabled:
+		step, purpose = StepSecondFactor, purposeSecondFactor
+	case service.SecondFactorRequired(manager.Role):
+		step, purpose = StepEnrollment, purposeEnrollment
+	}
+
+	if step == StepDone {
+		attempt.Success, attempt.Reason = true, reasonSuccess
+
+		token, err := service.token(ctx, manager.ID)
+		if err != nil {
+			return Authentication{}, Error.Wrap(err)
+		}
+
+		return Authentication{Step: StepDone, Token: token}, service.resetThrottle(ctx, email, ip)
+	}
+
+	attempt.Reason = reasonSecondFactorRequired
+
+	challenge, err := service.signer.CreateToken(ctx, auth.Claims{
+		ID:        manager.ID,
+		ExpiresAt: time.Now().Add(ChallengeDuration),
+		Purpose:   purpose,
+	})
+
+	return Authentication{Step: step, Token: challenge}, Error.Wrap(err)
+}
+
+// VerifySecondFactor exchanges challenge token and TOTP or recovery code for auth token.
+// Invalid codes are throttled in the same way as invalid passwords.
+func (service *Service) VerifySecondFactor(ctx context.Context, challenge, code, ip string) (_ auth.Token, err error) {
+	claims, err := service.challenge(challenge, purposeSecondFactor)
 	if err != nil {
 		return auth.Token{}, Error.Wrap(err)
 	}
 
-	err = bcrypt.CompareHashAndPassword(manager.PasswordHash, []byte(password))
+	manager, err := service.managers.Get(ctx, claims.ID)
 	if err != nil {
 		return auth.Token{}, Error.Wrap(err)
 	}
 
-	claims := auth.Claims{
-		ID: manager.ID,
-		// TODO: place duration to some const
-		ExpiresAt: time.Now().Add(time.Hour * 24),
+	now := time.Now().UTC()
+	keys := throttleKeys(manager.Email, ip)
+
+	attempt := LoginAttempt{Email: manager.Email, IP: ip, ManagerID: manager.ID, CreatedAt: now}
+	defer func() { err = errs.Combine(err, service.recordAttempt(ctx, attempt)) }()
+
+	err = service.checkThrottle(ctx, now, keys)
+	if err != nil {
+		attempt.Reason = reasonThrottled
+		return auth.Token{}, err
+	}
+
+	if isRecoveryCode(code) {
+		err = service.db.UseRecoveryCode(ctx, manager.ID, hashRecoveryCode(code), now)
+		if err != nil && !ErrNoRecoveryCode.Has(err) {
+			return auth.Token{}, Error.Wrap(err)
+		}
+	} else {
+		err = service.validateCode(ctx, manager, code)
+	}
+	if err != nil {
+		attempt.Reason = reasonInvalidSecondFactor
+		return auth.Token{}, errs.Combine(ErrSecondFactor.New("invalid code"), service.fail(ctx, now, keys))
+	}
+
+	attempt.Success, attempt.Reason = true, reasonSuccess
+
+	token, err := service.token(ctx, manager.ID)
+	if err != nil {
+		return auth.Token{}, Error.Wrap(err)
+	}
+
+	return token, service.resetThrottle(ctx, manager.Email, ip)
+}
+
+// ChallengeManager returns id of the manager who has to enroll into two-factor authentication during login.
+func (service *Service) ChallengeManager(ctx context.Context, challenge string) (uuid.UUID, error) {
+	claims, err := service.challenge(challenge, purposeEnrollment)
+	if err != nil {
+		return uuid.UUID{}, Error.Wrap(err)
+	}
+
+	return claims.ID, nil
+}
+
+// CompleteEnrollment confirms enrollment started during login and returns auth token with recovery codes.
+func (service *Service) CompleteEnrollment(ctx context.Context, challenge, code, ip string) (_ auth.Token, recoveryCodes []string, err error) {
+	managerID, err := service.ChallengeManager(ctx, challenge)
+	if err != nil {
+		return auth.Token{}, nil, err
+	}
+
+	recoveryCodes, err = service.ConfirmEnrollment(ctx, managerID, code)
+	if err != nil {
+		return auth.Token{}, nil, err
+	}
+
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return auth.Token{}, nil, Error.Wrap(err)
+	}
+
+	err = service.resetThrottle(ctx, manager.Email, ip)
+	if err != nil {
+		return auth.Token{}, nil, err
+	}
+
+	token, err := service.token(ctx, managerID)
+
+	return token, recoveryCodes, Error.Wrap(err)
+}
+
+// BeginEnrollment generates new TOTP secret for the manager.
+// Two-factor authentication becomes enabled only after confirmation with valid code.
+func (service *Service) BeginEnrollment(ctx context.Context, managerID uuid.UUID) (Enrollment, error) {
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return Enrollment{}, Error.Wrap(err)
+	}
+
+	if manager.SecondFactor.Enabled {
+		return Enrollment{}, ErrSecondFactor.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, Error.Wrap(err)
+	}
+
+	err = service.managers.UpdateSecondFactor(ctx, managerID, managers.SecondFactor{Secret: secret})
+	if err != nil {
+		return Enrollment{}, Error.Wrap(err)
+	}
+
+	return Enrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    service.totp.KeyURI(service.config.Issuer, manager.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication if code is valid and returns new recovery codes.
+func (service *Service) ConfirmEnrollment(ctx context.Context, managerID uuid.UUID, code string) (_ []string, err error) {
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	if manager.SecondFactor.Enabled {
+		return nil, ErrSecondFactor.New("two-factor authentication is already enabled")
+	}
+	if len(manager.SecondFactor.Secret) == 0 {
+		return nil, ErrSecondFactor.New("enrollment is not started")
+	}
+
+	counter, ok := service.totp.Validate(manager.SecondFactor.Secret, code)
+	if !ok {
+		return nil, ErrSecondFactor.New("invalid code")
+	}
+
+	err = service.managers.UpdateSecondFactor(ctx, managerID, managers.SecondFactor{
+		Secret:      manager.SecondFactor.Secret,
+		Enabled:     true,
+		LastCounter: counter,
+	})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return service.RegenerateRecoveryCodes(ctx, managerID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the manager with new ones.
+func (service *Service) RegenerateRecoveryCodes(ctx context.Context, managerID uuid.UUID) (_ []string, err error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	err = service.db.SetRecoveryCodes(ctx, managerID, hashes)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return codes, nil
+}
+
+// DisableSecondFactor turns off two-factor authentication if it is not mandatory for manager's role.
+func (service *Service) DisableSecondFactor(ctx context.Context, managerID uuid.UUID) error {
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	if service.SecondFactorRequired(manager.Role) {
+		return ErrSecondFactor.New("two-factor authentication is mandatory for %s role", manager.Role)
 	}
 
-	token, err = service.signer.CreateToken(ctx, claims)
+	err = service.managers.UpdateSecondFactor(ctx, managerID, managers.SecondFactor{})
+	if err != nil {
+		return Error.Wrap(err)
+	}
 
-	return token, Error.Wrap(err)
+	return Error.Wrap(service.db.SetRecoveryCodes(ctx, managerID, nil))
+}
+
+// SecondFactorRequired returns true if two-factor authentication is mandatory for the role.
+func (service *Service) SecondFactorRequired(role managers.Role) bool {
+	for _, required := range service.config.SecondFactorRoles {
+		if required == role {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Authorize validates token from context and returns authorized Authorization.
@@ -84,6 +362,51 @@ func (service *Service) Authorize(ctx context.Context) (auth.Claims, error) {
 	return *claims, nil
 }
 
+// token issues auth token for the manager.
+func (service *Service) token(ctx context.Context, managerID uuid.UUID) (auth.Token, error) {
+	claims := auth.Claims{
+		ID:        managerID,
+		ExpiresAt: time.Now().Add(TokenDuration),
+	}
+
+	return service.signer.CreateToken(ctx, claims)
+}
+
+// challenge validates challenge token issued between login steps.
+func (service *Service) challenge(challenge, purpose string) (*auth.Claims, error) {
+	token, err := auth.FromBase64URLString(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := service.authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, Error.New("invalid challenge purpose")
+	}
+	if claims.ExpiresAt.Before(time.Now()) {
+		return nil, Error.New("challenge expired")
+	}
+
+	return claims, nil
+}
+
+// validateCode checks TOTP code and remembers its time step, so the same code could not be used twice.
+func (service *Service) validateCode(ctx context.Context, manager managers.Manager, code string) error {
+	counter, ok := service.totp.Validate(manager.SecondFactor.Secret, code)
+	if !ok || counter <= manager.SecondFactor.LastCounter {
+		return ErrSecondFactor.New("invalid code")
+	}
+
+	secondFactor := manager.SecondFactor
+	secondFactor.LastCounter = counter
+
+	return Error.Wrap(service.managers.UpdateSecondFactor(ctx, manager.ID, secondFactor))
+}
+
 // authenticate validates token signature.
 func (service *Service) authenticate(token auth.Token) (_ *auth.Claims, err error) {
 	signature := token.Signature
@@ -103,7 +426,11 @@ func (service *Service) authenticate(token auth.Token) (_ *auth.Claims, err erro
 // authorize checks claims.
 func (service *Service) authorize(ctx context.Context, claims *auth.Claims) (err error) {
 	if !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(time.Now()) {
-		return Error.Wrap(err)
+		return Error.New("token expired")
+	}
+
+	if claims.Purpose != "" {
+		return Error.New("token could not be used for authorization")
 	}
 
 	_, err = service.managers.Get(ctx, claims.ID)
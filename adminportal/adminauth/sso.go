@@ -0,0 +1,173 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminauth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/oidc"
+)
+
+var (
+	// ErrSSODisabled indicates that single sign-on is not configured.
+	ErrSSODisabled = errs.Class("single sign-on is not configured")
+	// ErrSSO indicates that identity provider did not authenticate manager or manager is not allowed to login.
+	ErrSSO = errs.Class("single sign-on failed")
+)
+
+// Reasons of recorded single sign-on attempts.
+const (
+	reasonSSO          = "sso"
+	reasonSSORejected  = "sso rejected"
+	reasonSSONoRole    = "sso no role"
+	reasonSSONoManager = "sso unknown email"
+)
+
+// SSOConfig contains configuration of login with OpenID Connect identity provider.
+type SSOConfig struct {
+	// OIDC is a client registration at identity provider, single sign-on is disabled if issuer is empty.
+	OIDC oidc.Config
+	// GroupRoles maps identity provider groups to manager roles, the most privileged matching role is granted.
+	GroupRoles map[string]managers.Role
+	// AutoProvision creates manager on first login, otherwise manager has to be invited or created first.
+	AutoProvision bool
+}
+
+// SSOEnabled returns true if login with identity provider is configured.
+func (service *Service) SSOEnabled() bool {
+	return service.config.SSO.OIDC.Issuer != ""
+}
+
+// BeginSSO starts login with identity provider.
+// It returns URL where user agent has to be redirected and request secrets which have to be kept until callback.
+func (service *Service) BeginSSO(ctx context.Context) (string, oidc.Request, error) {
+	provider, err := service.ssoProvider(ctx)
+	if err != nil {
+		return "", oidc.Request{}, err
+	}
+
+	request, err := oidc.NewRequest()
+	if err != nil {
+		return "", oidc.Request{}, Error.Wrap(err)
+	}
+
+	return provider.AuthCodeURL(request), request, nil
+}
+
+// CompleteSSO exchanges authorization code from identity provider callback for auth token.
+// Role of the manager is synced with identity provider groups on every login.
+// Second factor is not asked, identity provider is responsible for it.
+func (service *Service) CompleteSSO(ctx context.Context, request oidc.Request, state, code, ip string) (_ auth.Token, err error) {
+	provider, err := service.ssoProvider(ctx)
+	if err != nil {
+		return auth.Token{}, err
+	}
+
+	attempt := LoginAttempt{IP: ip, CreatedAt: time.Now().UTC()}
+	defer func() { err = errs.Combine(err, service.recordAttempt(ctx, attempt)) }()
+
+	claims, err := provider.Exchange(ctx, request, state, code)
+	if err != nil {
+		attempt.Reason = reasonSSORejected
+		return auth.Token{}, ErrSSO.Wrap(err)
+	}
+	attempt.Email = claims.Email
+
+	if claims.Email == "" || !claims.EmailVerified {
+		attempt.Reason = reasonSSORejected
+		return auth.Token{}, ErrSSO.New("identity provider did not return verified email")
+	}
+
+	role, ok := service.ssoRole(claims.Groups)
+	if !ok {
+		attempt.Reason = reasonSSONoRole
+		return auth.Token{}, ErrSSO.New("none of groups is mapped to manager role")
+	}
+
+	manager, err := service.managers.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if manager.Role != role {
+			if err = service.managers.SetRole(ctx, manager.ID, role); err != nil {
+				return auth.Token{}, Error.Wrap(err)
+			}
+		}
+	case managers.ErrNoManager.Has(err) && service.config.SSO.AutoProvision:
+		firstName, lastName := splitName(claims.Name)
+		manager, err = service.managers.Invite(ctx, firstName, lastName, claims.Email, role)
+		if err != nil {
+			return auth.Token{}, Error.Wrap(err)
+		}
+	case managers.ErrNoManager.Has(err):
+		attempt.Reason = reasonSSONoManager
+		return auth.Token{}, ErrSSO.New("manager is not registered")
+	default:
+		return auth.Token{}, Error.Wrap(err)
+	}
+
+	attempt.ManagerID = manager.ID
+	attempt.Success, attempt.Reason = true, reasonSSO
+
+	token, err := service.token(ctx, manager.ID)
+
+	return token, Error.Wrap(err)
+}
+
+// ssoRole returns the most privileged role mapped from groups.
+func (service *Service) ssoRole(groups []string) (managers.Role, bool) {
+	granted := make(map[managers.Role]bool)
+	for _, group := range groups {
+		if role, ok := service.config.SSO.GroupRoles[group]; ok {
+			granted[role] = true
+		}
+	}
+
+	// managers.Roles is ordered from the most privileged role.
+	for _, role := range managers.Roles {
+		if granted[role] {
+			return role, true
+		}
+	}
+
+	return "", false
+}
+
+// ssoProvider returns identity provider client, discovery document is fetched on first use,
+// so admin portal starts even if identity provider is not available.
+func (service *Service) ssoProvider(ctx context.Context) (*oidc.Provider, error) {
+	if !service.SSOEnabled() {
+		return nil, ErrSSODisabled.New("")
+	}
+
+	service.ssoMu.Lock()
+	defer service.ssoMu.Unlock()
+
+	if service.sso != nil {
+		return service.sso, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, service.config.SSO.OIDC, nil)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	service.sso = provider
+
+	return provider, nil
+}
+
+// splitName splits full name from identity provider into first and last names.
+func splitName(name string) (firstName, lastName string) {
+	parts := strings.SplitN(strings.TrimSpace(name), " ", 2)
+	if len(parts) == 2 {
+		return parts[0], strings.TrimSpace(parts[1])
+	}
+
+	return parts[0], ""
+}
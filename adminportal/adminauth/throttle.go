@@ -0,0 +1,168 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/mail"
+)
+
+var (
+	// ErrInvalidCredentials is returned for every failed login, so it does not reveal whether manager exists.
+	ErrInvalidCredentials = errs.Class("invalid email or password")
+	// ErrTooManyAttempts indicates that login is temporarily locked after failed attempts.
+	ErrTooManyAttempts = errs.Class("too many failed login attempts, try again later")
+)
+
+// Reasons of recorded login attempts.
+const (
+	reasonSuccess              = "success"
+	reasonSecondFactorRequired = "second factor required"
+	reasonThrottled            = "throttled"
+	reasonUnknownEmail         = "unknown email"
+	reasonInvalidPassword      = "invalid password"
+	reasonInvalidSecondFactor  = "invalid second factor"
+	reasonPasswordChanged      = "password changed"
+)
+
+// compareDummyHash spends the same time as password check of existing manager,
+// so response time does not reveal whether email is registered.
+func (service *Service) compareDummyHash(password string) {
+	service.dummyHashOnce.Do(func() {
+		service.dummyHash, _ = service.hasher.Hash("dummy password")
+	})
+
+	_ = service.hasher.Compare(service.dummyHash, password)
+}
+
+// throttleKeys returns keys by which failed attempts are counted.
+func throttleKeys(email, ip string) []string {
+	return []string{emailThrottleKey(email), ipThrottleKey(ip)}
+}
+
+// ipThrottleKey returns key by which failed attempts from IP address are counted.
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// emailThrottleKey returns key by which failed attempts for email are counted.
+func emailThrottleKey(email string) string {
+	return "email:" + mail.NormalizeAddress(email)
+}
+
+// lockedUntil calculates till when login is prohibited after the failures.
+func (config ThrottleConfig) lockedUntil(throttle LoginThrottle) time.Time {
+	switch {
+	case throttle.Failures >= config.LockoutAttempts:
+		return throttle.LastFailureAt.Add(config.LockoutDuration)
+	case throttle.Failures > config.FreeAttempts:
+		delay := config.BaseDelay << uint(throttle.Failures-config.FreeAttempts-1)
+		if delay <= 0 || delay > config.MaxDelay {
+			delay = config.MaxDelay
+		}
+		return throttle.LastFailureAt.Add(delay)
+	default:
+		return time.Time{}
+	}
+}
+
+// checkThrottle returns ErrTooManyAttempts if login is locked for any of the keys.
+func (service *Service) checkThrottle(ctx context.Context, now time.Time, keys []string) error {
+	for _, key := range keys {
+		throttle, err := service.db.GetLoginThrottle(ctx, key)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		if throttle.LockedUntil.After(now) {
+			return ErrTooManyAttempts.New("")
+		}
+	}
+
+	return nil
+}
+
+// fail counts failed attempt for all keys and returns generic error.
+// Failures older than lockout duration are forgotten, so counting starts over once lockout has passed.
+func (service *Service) fail(ctx context.Context, now time.Time, keys []string) error {
+	resetBefore := now.Add(-service.config.Throttle.LockoutDuration)
+
+	var group errs.Group
+	for _, key := range keys {
+		throttle, err := service.db.RecordLoginFailure(ctx, key, now, resetBefore)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+
+		lockedUntil := service.config.Throttle.lockedUntil(throttle)
+		if !lockedUntil.IsZero() {
+			group.Add(service.db.LockLogin(ctx, key, lockedUntil))
+		}
+	}
+
+	return errs.Combine(ErrInvalidCredentials.New(""), Error.Wrap(group.Err()))
+}
+
+// resetThrottle removes throttling state of the email and IP address after successful login.
+func (service *Service) resetThrottle(ctx context.Context, email, ip string) error {
+	var group errs.Group
+	for _, key := range throttleKeys(email, ip) {
+		group.Add(service.db.ResetLoginThrottle(ctx, key))
+	}
+
+	return Error.Wrap(group.Err())
+}
+
+// recordAttempt saves login attempt for auditing.
+func (service *Service) recordAttempt(ctx context.Context, attempt LoginAttempt) error {
+	attempt.ID = uuid.New()
+	return Error.Wrap(service.db.AddLoginAttempt(ctx, attempt))
+}
+
+// Unlock removes lockout of the manager caused by failed login attempts,
+// including lockouts of IP addresses from which the manager failed to login during lockout duration.
+func (service *Service) Unlock(ctx context.Context, managerID uuid.UUID) error {
+	manager, err := service.managers.Get(ctx, managerID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	since := time.Now().UTC().Add(-service.config.Throttle.LockoutDuration)
+	ips, err := service.db.ListFailedLoginIPs(ctx, managerID, since)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	keys := []string{emailThrottleKey(manager.Email)}
+	for _, ip := range ips {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+
+	var group errs.Group
+	for _, key := range keys {
+		group.Add(service.db.ResetLoginThrottle(ctx, key))
+	}
+
+	return Error.Wrap(group.Err())
+}
+
+// LockedUntil returns till when login of the manager is locked, zero time if it is not locked.
+func (service *Service) LockedUntil(ctx context.Context, email string) (time.Time, error) {
+	throttle, err := service.db.GetLoginThrottle(ctx, emailThrottleKey(email))
+	if err != nil {
+		return time.Time{}, Error.Wrap(err)
+	}
+
+	if throttle.LockedUntil.Before(time.Now()) {
+		return time.Time{}, nil
+	}
+
+	return throttle.LockedUntil, nil
+}
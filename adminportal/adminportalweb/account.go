@@ -0,0 +1,286 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrAccount is an internal error type for account controller.
+	ErrAccount = errs.Class("account controller error")
+)
+
+// AccountTemplates holds templates needed for account controller.
+type AccountTemplates struct {
+	TwoFactor     *template.Template
+	RecoveryCodes *template.Template
+	Password      *template.Template
+}
+
+// Account is a web api controller.
+// Exposes web views where logged in manager manages own account.
+type Account struct {
+	log    logger.Logger
+	config Config
+
+	authentication *adminauth.Service
+	managers       *managers.Service
+
+	templates AccountTemplates
+}
+
+// TwoFactorPage holds data for two-factor authentication settings page.
+type TwoFactorPage struct {
+	Enabled  bool
+	Required bool
+	Error    string
+	Secret   string
+	URI      string
+	QR       template.URL
+}
+
+// ChangePasswordPage holds data for change password page.
+type ChangePasswordPage struct {
+	Changed bool
+	Error   string
+}
+
+// NewAccount is a constructor for account controller.
+func NewAccount(log logger.Logger, config Config, authentication *adminauth.Service, managers *managers.Service) (*Account, error) {
+	controller := &Account{
+		log:            log,
+		config:         config,
+		authentication: authentication,
+		managers:       managers,
+	}
+
+	err := controller.initializeTemplates()
+	if err != nil {
+		return nil, ErrAccount.Wrap(err)
+	}
+
+	return controller, nil
+}
+
+// initializeTemplates initializes and caches templates for account controller.
+func (controller *Account) initializeTemplates() (err error) {
+	controller.templates.TwoFactor, err = parseTemplate(filepath.Join(controller.config.StaticDir, "account", "two_factor.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.RecoveryCodes, err = parseTemplate(filepath.Join(controller.config.StaticDir, "account", "recovery_codes.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Password, err = parseTemplate(filepath.Join(controller.config.StaticDir, "account", "password.html"))
+
+	return err
+}
+
+// TwoFactor is an endpoint that shows two-factor authentication settings on GET request,
+// starting enrollment if it is not enabled yet, and confirms enrollment on POST request.
+func (controller *Account) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusUnauthorized)
+		return
+	}
+
+	manager, err := controller.managers.Get(ctx, claims.ID)
+	if err != nil {
+		controller.log.Error("could not get manager", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := TwoFactorPage{
+		Enabled:  manager.SecondFactor.Enabled,
+		Required: controller.authentication.SecondFactorRequired(manager.Role),
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !page.Enabled {
+			enrollment, err := controller.authentication.BeginEnrollment(ctx, manager.ID)
+			if err != nil {
+				controller.log.Error("could not begin enrollment", ErrAccount.Wrap(err))
+				http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			page.Secret, page.URI = enrollment.Secret, enrollment.URI
+		}
+	case http.MethodPost:
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		recoveryCodes, err := controller.authentication.ConfirmEnrollment(ctx, manager.ID, r.Form.Get("code"))
+		if err != nil {
+			if !adminauth.ErrSecondFactor.Has(err) {
+				controller.log.Error("could not confirm enrollment", ErrAccount.Wrap(err))
+				http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			page.Secret, page.URI = r.Form.Get("secret"), r.Form.Get("uri")
+			page.Error = "Invalid code, try again."
+			break
+		}
+
+		controller.serveRecoveryCodes(w, r, recoveryCodes)
+		return
+	}
+
+	page.QR, err = qrDataURI(page.URI)
+	if err != nil {
+		controller.log.Error("could not render qr code", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = executeTemplate(w, r, controller.templates.TwoFactor, page)
+	if err != nil {
+		controller.log.Error("could not execute two factor template", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DisableTwoFactor is an endpoint that turns off two-factor authentication.
+func (controller *Account) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusUnauthorized)
+		return
+	}
+
+	err = controller.authentication.DisableSecondFactor(ctx, claims.ID)
+	if err != nil {
+		if adminauth.ErrSecondFactor.Has(err) {
+			http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusForbidden)
+			return
+		}
+
+		controller.log.Error("could not disable two factor authentication", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r = r.Clone(ctx)
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/account/two-factor", http.StatusMovedPermanently)
+}
+
+// RecoveryCodes is an endpoint that replaces recovery codes with new ones.
+func (controller *Account) RecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusUnauthorized)
+		return
+	}
+
+	manager, err := controller.managers.Get(ctx, claims.ID)
+	if err != nil {
+		controller.log.Error("could not get manager", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !manager.SecondFactor.Enabled {
+		http.Error(w, ErrAccount.New("two-factor authentication is not enabled").Error(), http.StatusBadRequest)
+		return
+	}
+
+	recoveryCodes, err := controller.authentication.RegenerateRecoveryCodes(ctx, manager.ID)
+	if err != nil {
+		controller.log.Error("could not regenerate recovery codes", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller.serveRecoveryCodes(w, r, recoveryCodes)
+}
+
+// Password is an endpoint that shows change password page on GET request and changes password on POST request.
+func (controller *Account) Password(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	page := ChangePasswordPage{}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		password := r.Form.Get("password")
+		switch {
+		case password != r.Form.Get("confirm-password"):
+			page.Error = "Passwords do not match."
+		default:
+			err = controller.authentication.ChangePassword(ctx, claims.ID, r.Form.Get("current-password"), password, remoteIP(r))
+			switch {
+			case err == nil:
+				page.Changed = true
+			case adminauth.ErrInvalidCredentials.Has(err):
+				page.Error = "Current password is incorrect."
+			case adminauth.ErrTooManyAttempts.Has(err):
+				page.Error = "Too many failed attempts, try again later."
+			case managers.ValidationError.Has(err):
+				page.Error = errs.Unwrap(err).Error()
+			default:
+				controller.log.Error("could not change password", ErrAccount.Wrap(err))
+				http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if page.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	err = executeTemplate(w, r, controller.templates.Password, page)
+	if err != nil {
+		controller.log.Error("could not execute password template", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveRecoveryCodes renders page with recovery codes which are shown only once.
+func (controller *Account) serveRecoveryCodes(w http.ResponseWriter, r *http.Request, recoveryCodes []string) {
+	err := executeTemplate(w, r, controller.templates.RecoveryCodes, recoveryCodes)
+	if err != nil {
+		controller.log.Error("could not execute recovery codes template", ErrAccount.Wrap(err))
+		http.Error(w, ErrAccount.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
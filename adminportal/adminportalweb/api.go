@@ -0,0 +1,185 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/fielderr"
+	"cleanmasters/internal/logger"
+)
+
+// ErrAPI is an internal error type for admin JSON API.
+var ErrAPI = errs.Class("admin api error")
+
+// apiPrefix is a path prefix of versioned admin JSON API.
+const apiPrefix = "/api/admin/v1"
+
+// Error codes of admin JSON API, clients should rely on codes rather than messages.
+const (
+	apiCodeBadRequest           = "bad_request"
+	apiCodeValidation           = "validation_failed"
+	apiCodeUnauthorized         = "unauthorized"
+	apiCodeForbidden            = "forbidden"
+	apiCodeSecondFactorRequired = "second_factor_required"
+	apiCodeEnrollmentRequired   = "enrollment_required"
+	apiCodeTooManyAttempts      = "too_many_attempts"
+	apiCodeNotFound             = "not_found"
+	apiCodeConflict             = "conflict"
+	apiCodeTaken                = "already_taken"
+	apiCodeInternal             = "internal"
+)
+
+// APIError is an error body of admin JSON API.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Field is a name of the request field which value is rejected, if error is about single field.
+	Field string `json:"field,omitempty"`
+}
+
+// APIPagination holds opaque cursors of neighbouring pages, cursor is empty if there is no such page.
+type APIPagination struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// APIList is a body of list responses of admin JSON API.
+type APIList struct {
+	Data       interface{}   `json:"data"`
+	Pagination APIPagination `json:"pagination"`
+}
+
+// serveJSON writes value as JSON response with the status.
+func serveJSON(log logger.Logger, w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Error("could not write json response", ErrAPI.Wrap(err))
+	}
+}
+
+// serveAPIError writes JSON error response, internal errors are logged and their messages are not exposed.
+func serveAPIError(log logger.Logger, w http.ResponseWriter, status int, code string, err error) {
+	message := http.StatusText(status)
+	if status == http.StatusInternalServerError {
+		log.Error("admin api request failed", ErrAPI.Wrap(err))
+	} else if err != nil {
+		message = errs.Unwrap(err).Error()
+	}
+
+	var response struct {
+		Error APIError `json:"error"`
+	}
+	response.Error = APIError{Code: code, Message: message}
+
+	serveJSON(log, w, status, response)
+}
+
+// serveAPIFieldError writes JSON error response about rejected field value,
+// values which are taken by other entities conflict with them.
+func serveAPIFieldError(log logger.Logger, w http.ResponseWriter, fieldErr *fielderr.Error) {
+	status, code := http.StatusBadRequest, apiCodeValidation
+	if fieldErr.Kind == fielderr.KindTaken {
+		status, code = http.StatusConflict, apiCodeTaken
+	}
+
+	var response struct {
+		Error APIError `json:"error"`
+	}
+	response.Error = APIError{Code: code, Message: fieldErr.Error(), Field: fieldErr.Field}
+
+	serveJSON(log, w, status, response)
+}
+
+// decodeJSON decodes JSON request body into value, unknown fields are rejected.
+func decodeJSON(r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	return ErrAPI.Wrap(decoder.Decode(value))
+}
+
+// withAPIAuth authorizes admin JSON API requests in the same way as withAuth does.
+// Scripts send auth token in "Authorization: Bearer" header, browser apps rely on auth cookie and
+// have to send CSRF token from X-CSRF-Token response header with state-changing requests.
+func (server *Server) withAPIAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		token, fromCookie := bearerToken(r), false
+		if token == "" {
+			var err error
+			token, err = server.cookieAuth.GetToken(r)
+			if err != nil || token == "" {
+				serveAPIError(server.log, w, http.StatusUnauthorized, apiCodeUnauthorized, nil)
+				return
+			}
+			fromCookie = true
+		}
+
+		ctx = auth.SetToken(ctx, []byte(token))
+
+		authorization, err := server.service.Authorize(ctx)
+		if err != nil {
+			serveAPIError(server.log, w, http.StatusUnauthorized, apiCodeUnauthorized, nil)
+			return
+		}
+
+		ctx = auth.SetClaims(ctx, authorization)
+
+		if fromCookie {
+			w.Header().Set(csrfHeaderName, csrfToken(ctx))
+		}
+
+		handler.ServeHTTP(w, r.Clone(ctx))
+	})
+}
+
+// withAPIPermission allows API request only if authorized manager's role grants the permission.
+func (server *Server) withAPIPermission(permission managers.Permission, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		claims, err := auth.GetClaims(ctx)
+		if err != nil {
+			serveAPIError(server.log, w, http.StatusUnauthorized, apiCodeUnauthorized, nil)
+			return
+		}
+
+		manager, err := server.managers.Get(ctx, claims.ID)
+		if err != nil {
+			serveAPIError(server.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+			return
+		}
+
+		if !manager.Role.Can(permission) {
+			serveAPIError(server.log, w, http.StatusForbidden, apiCodeForbidden, ErrAPI.New("role %q does not allow this action", manager.Role))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// bearerPrefix is a prefix of Authorization header with bearer token.
+const bearerPrefix = "Bearer "
+
+// bearerToken returns token from Authorization header, empty if there is no bearer token.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+}
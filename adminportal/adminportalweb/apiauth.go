@@ -0,0 +1,94 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"net/http"
+
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/internal/logger"
+)
+
+// APIAuth is an admin JSON API controller which issues bearer tokens.
+type APIAuth struct {
+	log            logger.Logger
+	authentication *adminauth.Service
+}
+
+// NewAPIAuth is a constructor for API auth controller.
+func NewAPIAuth(log logger.Logger, authentication *adminauth.Service) *APIAuth {
+	return &APIAuth{
+		log:            log,
+		authentication: authentication,
+	}
+}
+
+// TokenRequest holds manager credentials.
+type TokenRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Code is a TOTP or recovery code, it is required if manager has two-factor authentication enabled.
+	Code string `json:"code,omitempty"`
+}
+
+// TokenResponse holds issued bearer token.
+type TokenResponse struct {
+	Token     string `json:"token"`
+	TokenType string `json:"tokenType"`
+	ExpiresIn int64  `json:"expiresIn"`
+}
+
+// Token is an endpoint that exchanges manager credentials for bearer token.
+// Login is throttled and recorded in the same way as login to the portal.
+func (controller *APIAuth) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request TokenRequest
+	if err := decodeJSON(r, &request); err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+
+	authentication, err := controller.authentication.Token(ctx, request.Email, request.Password, remoteIP(r))
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	token := authentication.Token
+	switch authentication.Step {
+	case adminauth.StepSecondFactor:
+		if request.Code == "" {
+			serveAPIError(controller.log, w, http.StatusUnauthorized, apiCodeSecondFactorRequired, ErrAPI.New("code is required"))
+			return
+		}
+
+		token, err = controller.authentication.VerifySecondFactor(ctx, authentication.Token.String(), request.Code, remoteIP(r))
+		if err != nil {
+			controller.serveError(w, err)
+			return
+		}
+	case adminauth.StepEnrollment:
+		serveAPIError(controller.log, w, http.StatusForbidden, apiCodeEnrollmentRequired, ErrAPI.New("two-factor authentication has to be enabled in the portal"))
+		return
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, TokenResponse{
+		Token:     token.String(),
+		TokenType: "Bearer",
+		ExpiresIn: int64(adminauth.TokenDuration.Seconds()),
+	})
+}
+
+// serveError writes JSON error of failed login.
+func (controller *APIAuth) serveError(w http.ResponseWriter, err error) {
+	switch {
+	case adminauth.ErrTooManyAttempts.Has(err):
+		serveAPIError(controller.log, w, http.StatusTooManyRequests, apiCodeTooManyAttempts, ErrAPI.New("too many failed login attempts, try again later"))
+	case adminauth.ErrInvalidCredentials.Has(err), adminauth.ErrSecondFactor.Has(err):
+		serveAPIError(controller.log, w, http.StatusUnauthorized, apiCodeUnauthorized, ErrAPI.New("invalid credentials"))
+	default:
+		serveAPIError(controller.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"cleanmasters/clients"
+	"cleanmasters/internal/fielderr"
+	"cleanmasters/internal/logger"
+)
+
+// APIClients is an admin JSON API controller for clients.
+type APIClients struct {
+	log     logger.Logger
+	clients *clients.Service
+}
+
+// NewAPIClients is a constructor for API clients controller.
+func NewAPIClients(log logger.Logger, clients *clients.Service) *APIClients {
+	return &APIClients{
+		log:     log,
+		clients: clients,
+	}
+}
+
+// APIClient is a client in admin JSON API.
+type APIClient struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	CreatedAt time.Time `json:"createdAt"`
+	Version   int64     `json:"version"`
+}
+
+// ClientRequest holds client fields to create or update.
+type ClientRequest struct {
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	// Version is a version of the client which is updated, update fails with conflict if client was changed since.
+	// It is required to update client and ignored on create.
+	Version int64 `json:"version,omitempty"`
+}
+
+// newAPIClient converts client to admin JSON API representation.
+func newAPIClient(client clients.Client) APIClient {
+	return APIClient{
+		ID:        client.ID,
+		Email:     client.Email,
+		Phone:     client.Phone,
+		FirstName: client.FirstName,
+		LastName:  client.LastName,
+		CreatedAt: client.CreatedAt,
+		Version:   client.Version,
+	}
+}
+
+// List is an endpoint that returns page of clients which match the filter.
+// It accepts the same query parameters as clients list page.
+func (controller *APIClients) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := r.URL.Query()
+	query, err := parseClientsQuery(newClientsPage(params), params)
+	if err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+
+	page, err := controller.clients.List(ctx, query)
+	if err != nil {
+		serveAPIError(controller.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+		return
+	}
+
+	data := make([]APIClient, 0, len(page.Clients))
+	for _, client := range page.Clients {
+		data = append(data, newAPIClient(client))
+	}
+
+	response := APIList{Data: data}
+	if page.Next != nil {
+		response.Pagination.Next = page.Next.Encode()
+	}
+	if page.Prev != nil {
+		response.Pagination.Prev = page.Prev.Encode()
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, response)
+}
+
+// Get is an endpoint that returns client by id.
+func (controller *APIClients) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := controller.clients.Get(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, newAPIClient(client))
+}
+
+// Create is an endpoint that creates client.
+func (controller *APIClients) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request ClientRequest
+	if err := decodeJSON(r, &request); err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+
+	client, err := controller.clients.Create(ctx, request.Email, request.Phone, request.FirstName, request.LastName)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	client, err = controller.clients.Get(ctx, client.ID)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", apiPrefix+"/clients/"+client.ID.String())
+	serveJSON(controller.log, w, http.StatusCreated, newAPIClient(client))
+}
+
+// Update is an endpoint that replaces client fields.
+func (controller *APIClients) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	var request ClientRequest
+	if err := decodeJSON(r, &request); err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+	if request.Version <= 0 {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("version is required"))
+		return
+	}
+
+	err := controller.clients.Update(ctx, clients.Client{
+		ID:        id,
+		Email:     request.Email,
+		Phone:     request.Phone,
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Version:   request.Version,
+	})
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	client, err := controller.clients.Get(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, newAPIClient(client))
+}
+
+// Delete is an endpoint that deletes client.
+func (controller *APIClients) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	err := controller.clients.Delete(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// id parses client id from the path, error response is written if it is not valid.
+func (controller *APIClients) id(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("id is not valid"))
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
+
+// serveError writes JSON error of failed clients service call.
+func (controller *APIClients) serveError(w http.ResponseWriter, err error) {
+	if fieldErr, ok := fielderr.As(err); ok {
+		serveAPIFieldError(controller.log, w, fieldErr)
+		return
+	}
+
+	switch {
+	case clients.ErrNotExist.Has(err):
+		serveAPIError(controller.log, w, http.StatusNotFound, apiCodeNotFound, ErrAPI.New("client does not exist"))
+	case clients.ErrVersionRequired.Has(err):
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("version is required"))
+	case clients.ErrConflict.Has(err):
+		serveAPIError(controller.log, w, http.StatusConflict, apiCodeConflict, ErrAPI.New("client was changed, get it and apply changes again"))
+	default:
+		serveAPIError(controller.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrAPIKeys is an internal error type for API keys controller.
+	ErrAPIKeys = errs.Class("api keys controller error")
+)
+
+// apiKeyDateLayout is a layout of expiration date in API key form.
+const apiKeyDateLayout = "2006-01-02"
+
+// APIKeysTemplates holds templates needed for API keys controller.
+type APIKeysTemplates struct {
+	List    *template.Template
+	Create  *template.Template
+	Created *template.Template
+}
+
+// APIKeys is a web api controller.
+// Exposes web views to issue and revoke console API keys.
+type APIKeys struct {
+	log    logger.Logger
+	config Config
+
+	consoleAuth *consoleauth.Service
+
+	templates APIKeysTemplates
+}
+
+// APIKeysPage holds data for API keys list page.
+type APIKeysPage struct {
+	Keys []consoleauth.APIKey
+	Now  time.Time
+}
+
+// CreateAPIKeyPage holds data for API key form.
+type CreateAPIKeyPage struct {
+	Scopes     []consoleauth.Scope
+	Name       string
+	AllowedIPs string
+	ExpiresAt  string
+	Error      string
+}
+
+// CreatedAPIKeyPage holds issued API key which is shown once.
+type CreatedAPIKeyPage struct {
+	Key    consoleauth.APIKey
+	Secret string
+}
+
+// NewAPIKeys is a constructor for API keys controller.
+func NewAPIKeys(log logger.Logger, config Config, consoleAuth *consoleauth.Service) (*APIKeys, error) {
+	controller := &APIKeys{
+		log:         log,
+		config:      config,
+		consoleAuth: consoleAuth,
+	}
+
+	err := controller.initializeTemplates()
+	if err != nil {
+		return nil, ErrAPIKeys.Wrap(err)
+	}
+
+	return controller, nil
+}
+
+// initializeTemplates initializes and caches templates for API keys controller.
+func (controller *APIKeys) initializeTemplates() (err error) {
+	controller.templates.List, err = parseTemplate(filepath.Join(controller.config.StaticDir, "apikeys", "list.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Create, err = parseTemplate(filepath.Join(controller.config.StaticDir, "apikeys", "create.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Created, err = parseTemplate(filepath.Join(controller.config.StaticDir, "apikeys", "created.html"))
+
+	return err
+}
+
+// List is an endpoint that shows all issued API keys.
+func (controller *APIKeys) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	keys, err := controller.consoleAuth.APIKeys(ctx)
+	if err != nil {
+		controller.log.Error("could not list api keys", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = executeTemplate(w, r, controller.templates.List, APIKeysPage{Keys: keys, Now: time.Now()})
+	if err != nil {
+		controller.log.Error("could not execute api keys template", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// Create is an endpoint that shows API key form on GET request and issues API key on POST request.
+func (controller *APIKeys) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	page := CreateAPIKeyPage{
+		Scopes:    consoleauth.Scopes,
+		ExpiresAt: time.Now().AddDate(1, 0, 0).Format(apiKeyDateLayout),
+	}
+
+	if r.Method == http.MethodGet {
+		controller.serveCreate(w, r, page)
+		return
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, ErrAPIKeys.Wrap(err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	page.Name = r.Form.Get("name")
+	page.AllowedIPs = r.Form.Get("allowed-ips")
+	page.ExpiresAt = r.Form.Get("expires-at")
+
+	request := consoleauth.NewAPIKey{
+		Name:       page.Name,
+		AllowedIPs: strings.Fields(strings.ReplaceAll(page.AllowedIPs, ",", " ")),
+	}
+	for _, scope := range r.Form["scopes"] {
+		request.Scopes = append(request.Scopes, consoleauth.Scope(scope))
+	}
+
+	request.ExpiresAt, err = time.Parse(apiKeyDateLayout, page.ExpiresAt)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		page.Error = "Expiration date is not valid."
+		controller.serveCreate(w, r, page)
+		return
+	}
+
+	key, secret, err := controller.consoleAuth.CreateAPIKey(ctx, claims.ID, request)
+	if err != nil {
+		if consoleauth.ErrAPIKeyValidation.Has(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			page.Error = errs.Unwrap(err).Error()
+			controller.serveCreate(w, r, page)
+			return
+		}
+
+		controller.log.Error("could not create api key", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// secret is shown once and must not be cached by browser.
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = executeTemplate(w, r, controller.templates.Created, CreatedAPIKeyPage{Key: key, Secret: secret})
+	if err != nil {
+		controller.log.Error("could not execute created api key template", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// Revoke is an endpoint that revokes API key.
+func (controller *APIKeys) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, ErrAPIKeys.New("id is not valid").Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = controller.consoleAuth.RevokeAPIKey(ctx, id)
+	if err != nil {
+		if consoleauth.ErrNoAPIKey.Has(err) {
+			http.NotFound(w, r)
+			return
+		}
+
+		controller.log.Error("could not revoke api key", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	r = r.Clone(ctx)
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/api-keys", http.StatusMovedPermanently)
+}
+
+// serveCreate renders API key form.
+func (controller *APIKeys) serveCreate(w http.ResponseWriter, r *http.Request, page CreateAPIKeyPage) {
+	err := executeTemplate(w, r, controller.templates.Create, page)
+	if err != nil {
+		controller.log.Error("could not execute create api key template", ErrAPIKeys.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/fielderr"
+	"cleanmasters/internal/logger"
+)
+
+const (
+	// defaultManagersLimit is a number of managers on page if limit is not specified.
+	defaultManagersLimit = 50
+	// maxManagersLimit is a maximal number of managers on page.
+	maxManagersLimit = 500
+)
+
+// APIManagers is an admin JSON API controller for managers.
+type APIManagers struct {
+	log      logger.Logger
+	managers *managers.Service
+}
+
+// NewAPIManagers is a constructor for API managers controller.
+func NewAPIManagers(log logger.Logger, managers *managers.Service) *APIManagers {
+	return &APIManagers{
+		log:      log,
+		managers: managers,
+	}
+}
+
+// APIManager is a manager in admin JSON API, credentials are never exposed.
+type APIManager struct {
+	ID               uuid.UUID     `json:"id"`
+	Email            string        `json:"email"`
+	FirstName        string        `json:"firstName"`
+	LastName         string        `json:"lastName"`
+	Role             managers.Role `json:"role"`
+	TwoFactorEnabled bool          `json:"twoFactorEnabled"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	Version          int64         `json:"version"`
+}
+
+// ManagerRequest holds manager fields to create or update.
+type ManagerRequest struct {
+	Email     string        `json:"email"`
+	FirstName string        `json:"firstName"`
+	LastName  string        `json:"lastName"`
+	Role      managers.Role `json:"role"`
+	// Password is required to create manager, password is not changed on update if it is empty.
+	Password string `json:"password,omitempty"`
+	// Version is a version of the manager which is updated, update fails with conflict if manager was changed since.
+	// It is required to update manager and ignored on create.
+	Version int64 `json:"version,omitempty"`
+}
+
+// newAPIManager converts manager to admin JSON API representation.
+func newAPIManager(manager managers.Manager) APIManager {
+	return APIManager{
+		ID:               manager.ID,
+		Email:            manager.Email,
+		FirstName:        manager.FirstName,
+		LastName:         manager.LastName,
+		Role:             manager.Role,
+		TwoFactorEnabled: manager.SecondFactor.Enabled,
+		CreatedAt:        manager.CreatedAt,
+		Version:          manager.Version,
+	}
+}
+
+// List is an endpoint that returns page of managers ordered by creation time.
+// There are few managers, so cursor is an offset in the list.
+func (controller *APIManagers) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	limit, offset := defaultManagersLimit, 0
+	var err error
+	if value := params.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("limit is not valid"))
+			return
+		}
+		if limit > maxManagersLimit {
+			limit = maxManagersLimit
+		}
+	}
+	if value := params.Get("cursor"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("cursor is not valid"))
+			return
+		}
+	}
+
+	list, err := controller.managers.List(ctx)
+	if err != nil {
+		serveAPIError(controller.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+		return
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+
+	response := APIList{}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		response.Pagination.Prev = strconv.Itoa(prev)
+	}
+	if offset > len(list) {
+		offset = len(list)
+	}
+
+	end := offset + limit
+	if end < len(list) {
+		response.Pagination.Next = strconv.Itoa(end)
+	} else {
+		end = len(list)
+	}
+
+	data := make([]APIManager, 0, end-offset)
+	for _, manager := range list[offset:end] {
+		data = append(data, newAPIManager(manager))
+	}
+	response.Data = data
+
+	serveJSON(controller.log, w, http.StatusOK, response)
+}
+
+// Get is an endpoint that returns manager by id.
+func (controller *APIManagers) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	manager, err := controller.managers.Get(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, newAPIManager(manager))
+}
+
+// Create is an endpoint that creates manager.
+func (controller *APIManagers) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request ManagerRequest
+	if err := decodeJSON(r, &request); err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+
+	manager, err := controller.managers.Create(ctx, request.Password, request.FirstName, request.LastName, request.Email, request.Role)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", apiPrefix+"/managers/"+manager.ID.String())
+	serveJSON(controller.log, w, http.StatusCreated, newAPIManager(manager))
+}
+
+// Update is an endpoint that replaces manager fields.
+func (controller *APIManagers) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	var request ManagerRequest
+	if err := decodeJSON(r, &request); err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, err)
+		return
+	}
+	if request.Version <= 0 {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("version is required"))
+		return
+	}
+
+	err := controller.managers.Update(ctx, id, managers.ManagerUpdateFields{
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Email:     request.Email,
+		Password:  request.Password,
+		Role:      request.Role,
+		Version:   request.Version,
+	})
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	manager, err := controller.managers.Get(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	serveJSON(controller.log, w, http.StatusOK, newAPIManager(manager))
+}
+
+// Delete is an endpoint that deletes manager.
+func (controller *APIManagers) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := controller.id(w, r)
+	if !ok {
+		return
+	}
+
+	err := controller.managers.Delete(ctx, id)
+	if err != nil {
+		controller.serveError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// id parses manager id from the path, error response is written if it is not valid.
+func (controller *APIManagers) id(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeBadRequest, ErrAPI.New("id is not valid"))
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
+
+// serveError writes JSON error of failed managers service call.
+func (controller *APIManagers) serveError(w http.ResponseWriter, err error) {
+	if fieldErr, ok := fielderr.As(err); ok {
+		serveAPIFieldError(controller.log, w, fieldErr)
+		return
+	}
+
+	switch {
+	case managers.ErrNoManager.Has(err):
+		serveAPIError(controller.log, w, http.StatusNotFound, apiCodeNotFound, ErrAPI.New("manager does not exist"))
+	case managers.ValidationError.Has(err):
+		serveAPIError(controller.log, w, http.StatusBadRequest, apiCodeValidation, err)
+	case managers.ErrPermissionDenied.Has(err):
+		serveAPIError(controller.log, w, http.StatusForbidden, apiCodeForbidden, err)
+	case managers.ErrConflict.Has(err):
+		serveAPIError(controller.log, w, http.StatusConflict, apiCodeConflict, ErrAPI.New("manager was changed, get it and apply changes again"))
+	default:
+		serveAPIError(controller.log, w, http.StatusInternalServerError, apiCodeInternal, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrAudit is an internal error type for audit controller.
+	ErrAudit = errs.Class("audit controller error")
+)
+
+// auditPageLimit is a maximal number of entries shown on audit page.
+const auditPageLimit = 200
+
+// auditDateLayout is a layout of dates in audit filter form.
+const auditDateLayout = "2006-01-02"
+
+// AuditTemplates holds templates needed for audit controller.
+type AuditTemplates struct {
+	List *template.Template
+}
+
+// Audit is a web api controller.
+// Exposes web views to browse and export audit log.
+type Audit struct {
+	log    logger.Logger
+	config Config
+
+	audit *audit.Service
+
+	templates AuditTemplates
+}
+
+// AuditPage holds data for audit log page.
+type AuditPage struct {
+	Query    AuditQuery
+	Entries  []audit.Entry
+	Limit    int
+	Verified bool
+	Error    string
+}
+
+// AuditQuery holds raw values of audit filter form.
+type AuditQuery struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	From       string
+	To         string
+	// ExportURL is a link to csv export with the same filter.
+	ExportURL template.URL
+}
+
+// NewAudit is a constructor for audit controller.
+func NewAudit(log logger.Logger, config Config, audit *audit.Service) (*Audit, error) {
+	controller := &Audit{
+		log:    log,
+		config: config,
+		audit:  audit,
+	}
+
+	err := controller.initializeTemplates()
+	if err != nil {
+		return nil, ErrAudit.Wrap(err)
+	}
+
+	return controller, nil
+}
+
+// initializeTemplates initializes and caches templates for audit controller.
+func (controller *Audit) initializeTemplates() (err error) {
+	controller.templates.List, err = parseTemplate(filepath.Join(controller.config.StaticDir, "audit", "list.html"))
+
+	return err
+}
+
+// List is an endpoint that shows filtered audit log and result of chain verification.
+func (controller *Audit) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query, filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, ErrAudit.Wrap(err).Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Limit = auditPageLimit
+
+	page := AuditPage{Query: query, Limit: auditPageLimit}
+
+	page.Entries, err = controller.audit.List(ctx, filter)
+	if err != nil {
+		controller.log.Error("could not list audit log", ErrAudit.Wrap(err))
+		http.Error(w, ErrAudit.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = controller.audit.Verify(ctx)
+	switch {
+	case err == nil:
+		page.Verified = true
+	case audit.ErrBrokenChain.Has(err):
+		page.Error = err.Error()
+	default:
+		controller.log.Error("could not verify audit log", ErrAudit.Wrap(err))
+		http.Error(w, ErrAudit.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = executeTemplate(w, r, controller.templates.List, page)
+	if err != nil {
+		controller.log.Error("could not execute audit template", ErrAudit.Wrap(err))
+		http.Error(w, ErrAudit.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// Export is an endpoint that downloads filtered audit log in csv format.
+func (controller *Audit) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, ErrAudit.Wrap(err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+
+	err = controller.audit.ExportCSV(ctx, w, filter)
+	if err != nil {
+		controller.log.Error("could not export audit log", ErrAudit.Wrap(err))
+	}
+}
+
+// parseAuditFilter parses audit filter from query parameters.
+func parseAuditFilter(r *http.Request) (query AuditQuery, filter audit.Filter, err error) {
+	values := r.URL.Query()
+	query = AuditQuery{
+		ActorID:    values.Get("actor"),
+		Action:     values.Get("action"),
+		EntityType: values.Get("entity-type"),
+		EntityID:   values.Get("entity-id"),
+		From:       values.Get("from"),
+		To:         values.Get("to"),
+	}
+	// #nosec query parameters are encoded.
+	query.ExportURL = template.URL("/audit/export.csv?" + values.Encode())
+
+	filter = audit.Filter{
+		Action:     audit.Action(query.Action),
+		EntityType: query.EntityType,
+		EntityID:   query.EntityID,
+	}
+
+	if query.ActorID != "" {
+		filter.ActorID, err = uuid.Parse(query.ActorID)
+		if err != nil {
+			return query, filter, err
+		}
+	}
+	if query.From != "" {
+		filter.From, err = time.Parse(auditDateLayout, query.From)
+		if err != nil {
+			return query, filter, err
+		}
+	}
+	if query.To != "" {
+		filter.To, err = time.Parse(auditDateLayout, query.To)
+		if err != nil {
+			return query, filter, err
+		}
+		// the whole day is included.
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	return query, filter, nil
+}
@@ -4,11 +4,13 @@
 package adminportalweb
 
 import (
+	"encoding/base64"
 	"html/template"
 	"net/http"
 	"path/filepath"
 
 	"github.com/zeebo/errs"
+	"rsc.io/qr"
 
 	"cleanmasters/adminportal/adminauth"
 	"cleanmasters/internal/auth"
@@ -20,6 +22,15 @@ var (
 	ErrAuth = errs.Class("auth controller error")
 )
 
+// AuthTemplates holds templates needed for auth controller.
+type AuthTemplates struct {
+	Authorize     *template.Template
+	SecondFactor  *template.Template
+	Enroll        *template.Template
+	RecoveryCodes *template.Template
+	SignedIn      *template.Template
+}
+
 // Auth is a web api controller.
 // Exposes functionality and web views to authorize in admin portal.
 type Auth struct {
@@ -29,11 +40,27 @@ type Auth struct {
 	authentication *adminauth.Service
 	cookieAuth     *auth.Cookie
 
-	authorizeTemplate *template.Template
+	templates AuthTemplates
+}
+
+// AuthorizePage holds data for login page.
+type AuthorizePage struct {
+	Error string
+	// SSO is true if login with identity provider is available.
+	SSO bool
+}
+
+// SecondFactorPage holds data for second factor and enrollment pages.
+type SecondFactorPage struct {
+	Challenge string
+	Error     string
+	Secret    string
+	URI       string
+	QR        template.URL
 }
 
 // NewAuth is a constructor for auth controller.
-func NewAuth(log logger.Logger, config Config, service *adminauth.Service, cookieAuth *auth.Cookie) *Auth {
+func NewAuth(log logger.Logger, config Config, service *adminauth.Service, cookieAuth *auth.Cookie) (*Auth, error) {
 	authController := &Auth{
 		log:            log,
 		config:         config,
@@ -43,20 +70,37 @@ func NewAuth(log logger.Logger, config Config, service *adminauth.Service, cooki
 
 	err := authController.initializeTemplates()
 	if err != nil {
-		panic(err)
+		return nil, ErrAuth.Wrap(err)
 	}
 
-	return authController
+	return authController, nil
 }
 
 // initializeTemplates initializes and caches templates for managers controller.
 func (controller *Auth) initializeTemplates() (err error) {
-	controller.authorizeTemplate, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "authorize", "authorize.html"))
+	controller.templates.Authorize, err = parseTemplate(filepath.Join(controller.config.StaticDir, "authorize", "authorize.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.SecondFactor, err = parseTemplate(filepath.Join(controller.config.StaticDir, "authorize", "second_factor.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Enroll, err = parseTemplate(filepath.Join(controller.config.StaticDir, "authorize", "enroll.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.RecoveryCodes, err = parseTemplate(filepath.Join(controller.config.StaticDir, "account", "recovery_codes.html"))
 	if err != nil {
 		return err
 	}
 
-	return nil
+	controller.templates.SignedIn, err = parseTemplate(filepath.Join(controller.config.StaticDir, "authorize", "signed_in.html"))
+
+	return err
 }
 
 // Authorize is an endpoint to authorize admin and set auth cookie in browser.
@@ -66,12 +110,7 @@ func (controller *Auth) Authorize(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		err = controller.authorizeTemplate.Execute(w, nil)
-		if err != nil {
-			controller.log.Error("could not execute authorize template", ErrAuth.Wrap(err))
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+		controller.serveAuthorize(w, r, "")
 	case http.MethodPost:
 		err = r.ParseForm()
 		if err != nil {
@@ -83,17 +122,274 @@ func (controller *Auth) Authorize(w http.ResponseWriter, r *http.Request) {
 		// TODO: process form in a better way
 		email := r.Form["email"]
 		password := r.Form["password"]
-		response, err := controller.authentication.Token(ctx, email[0], password[0])
+		response, err := controller.authentication.Token(ctx, email[0], password[0], remoteIP(r))
 		if err != nil {
+			switch {
+			case adminauth.ErrTooManyAttempts.Has(err):
+				w.WriteHeader(http.StatusTooManyRequests)
+				controller.serveAuthorize(w, r, "Too many failed login attempts, try again later.")
+				return
+			case adminauth.ErrInvalidCredentials.Has(err):
+				w.WriteHeader(http.StatusUnauthorized)
+				controller.serveAuthorize(w, r, "Invalid email or password.")
+				return
+			}
+
 			controller.log.Error("could not issue auth token", ErrAuth.Wrap(err))
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 
-		controller.cookieAuth.SetToken(w, response.String())
+		switch response.Step {
+		case adminauth.StepSecondFactor:
+			controller.serveSecondFactor(w, r, SecondFactorPage{Challenge: response.Token.String()})
+			return
+		case adminauth.StepEnrollment:
+			controller.beginEnrollment(w, r, response.Token.String())
+			return
+		}
+
+		controller.cookieAuth.SetToken(w, response.Token.String())
 
 		r = r.Clone(ctx)
 		r.Method = http.MethodGet
 		http.Redirect(w, r, "/managers", http.StatusMovedPermanently)
 	}
 }
+
+// SSO is an endpoint that redirects to identity provider to login.
+// State, nonce and PKCE verifier are kept in short-lived cookie until callback.
+func (controller *Auth) SSO(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	redirectURL, request, err := controller.authentication.BeginSSO(ctx)
+	if err != nil {
+		if adminauth.ErrSSODisabled.Has(err) {
+			http.NotFound(w, r)
+			return
+		}
+
+		controller.log.Error("could not begin single sign-on", ErrAuth.Wrap(err))
+		w.WriteHeader(http.StatusBadGateway)
+		controller.serveAuthorize(w, r, "Identity provider is not available, try again later.")
+		return
+	}
+
+	err = setSSOCookie(w, request)
+	if err != nil {
+		controller.log.Error("could not set single sign-on cookie", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// SSOCallback is an endpoint where identity provider redirects after login.
+// It exchanges authorization code for auth cookie.
+func (controller *Auth) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	request, err := getSSOCookie(r)
+	removeSSOCookie(w)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		controller.serveAuthorize(w, r, "Single sign-on session expired, try again.")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		controller.serveAuthorize(w, r, "Identity provider declined login.")
+		return
+	}
+
+	token, err := controller.authentication.CompleteSSO(ctx, request, query.Get("state"), query.Get("code"), remoteIP(r))
+	if err != nil {
+		if adminauth.ErrSSO.Has(err) {
+			controller.log.Debug("single sign-on rejected: " + err.Error())
+			w.WriteHeader(http.StatusUnauthorized)
+			controller.serveAuthorize(w, r, "Single sign-on failed, you are not allowed to access admin portal.")
+			return
+		}
+
+		controller.log.Error("could not complete single sign-on", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	controller.cookieAuth.SetToken(w, token.String())
+
+	// auth cookie is strict, so it is not sent with redirect which continues navigation started by identity provider.
+	// Page which navigates further is rendered instead.
+	err = executeTemplate(w, r, controller.templates.SignedIn, nil)
+	if err != nil {
+		controller.log.Error("could not execute signed in template", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SecondFactor is an endpoint that exchanges challenge and TOTP or recovery code for auth cookie.
+func (controller *Auth) SecondFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := r.ParseForm()
+	if err != nil {
+		controller.log.Error("could not parse second factor form", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	challenge := r.Form.Get("challenge")
+	token, err := controller.authentication.VerifySecondFactor(ctx, challenge, r.Form.Get("code"), remoteIP(r))
+	if err != nil {
+		if adminauth.ErrTooManyAttempts.Has(err) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			controller.serveSecondFactor(w, r, SecondFactorPage{Challenge: challenge, Error: "Too many failed login attempts, try again later."})
+			return
+		}
+		if adminauth.ErrSecondFactor.Has(err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			controller.serveSecondFactor(w, r, SecondFactorPage{Challenge: challenge, Error: "Invalid code, try again."})
+			return
+		}
+
+		controller.log.Error("could not verify second factor", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	controller.cookieAuth.SetToken(w, token.String())
+
+	r = r.Clone(ctx)
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/managers", http.StatusMovedPermanently)
+}
+
+// Enroll is an endpoint that confirms mandatory enrollment started during login.
+func (controller *Auth) Enroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := r.ParseForm()
+	if err != nil {
+		controller.log.Error("could not parse enrollment form", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	challenge := r.Form.Get("challenge")
+	token, recoveryCodes, err := controller.authentication.CompleteEnrollment(ctx, challenge, r.Form.Get("code"), remoteIP(r))
+	if err != nil {
+		if adminauth.ErrSecondFactor.Has(err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			page := SecondFactorPage{
+				Challenge: challenge,
+				Secret:    r.Form.Get("secret"),
+				URI:       r.Form.Get("uri"),
+				Error:     "Invalid code, try again.",
+			}
+			page.QR, err = qrDataURI(page.URI)
+			if err != nil {
+				controller.log.Error("could not render qr code", ErrAuth.Wrap(err))
+			}
+			controller.serveEnroll(w, r, page)
+			return
+		}
+
+		controller.log.Error("could not complete enrollment", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	controller.cookieAuth.SetToken(w, token.String())
+
+	err = executeTemplate(w, r, controller.templates.RecoveryCodes, recoveryCodes)
+	if err != nil {
+		controller.log.Error("could not execute recovery codes template", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// beginEnrollment generates TOTP secret for manager who has to enroll during login.
+func (controller *Auth) beginEnrollment(w http.ResponseWriter, r *http.Request, challenge string) {
+	ctx := r.Context()
+
+	managerID, err := controller.authentication.ChallengeManager(ctx, challenge)
+	if err != nil {
+		controller.log.Error("could not validate challenge", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := controller.authentication.BeginEnrollment(ctx, managerID)
+	if err != nil {
+		controller.log.Error("could not begin enrollment", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := SecondFactorPage{
+		Challenge: challenge,
+		Secret:    enrollment.Secret,
+		URI:       enrollment.URI,
+	}
+
+	page.QR, err = qrDataURI(enrollment.URI)
+	if err != nil {
+		controller.log.Error("could not render qr code", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	controller.serveEnroll(w, r, page)
+}
+
+// serveAuthorize renders login page with optional error message.
+func (controller *Auth) serveAuthorize(w http.ResponseWriter, r *http.Request, message string) {
+	page := AuthorizePage{
+		Error: message,
+		SSO:   controller.authentication.SSOEnabled(),
+	}
+
+	err := executeTemplate(w, r, controller.templates.Authorize, page)
+	if err != nil {
+		controller.log.Error("could not execute authorize template", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// serveSecondFactor renders page asking for TOTP or recovery code.
+func (controller *Auth) serveSecondFactor(w http.ResponseWriter, r *http.Request, page SecondFactorPage) {
+	err := executeTemplate(w, r, controller.templates.SecondFactor, page)
+	if err != nil {
+		controller.log.Error("could not execute second factor template", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// serveEnroll renders page with TOTP secret and confirmation form.
+func (controller *Auth) serveEnroll(w http.ResponseWriter, r *http.Request, page SecondFactorPage) {
+	err := executeTemplate(w, r, controller.templates.Enroll, page)
+	if err != nil {
+		controller.log.Error("could not execute enroll template", ErrAuth.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// qrDataURI encodes text as QR code png image embedded into data uri.
+func qrDataURI(text string) (template.URL, error) {
+	if text == "" {
+		return "", nil
+	}
+
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	// #nosec data uri consists only of base64 encoded png image generated above.
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG())), nil
+}
@@ -4,16 +4,25 @@
 package adminportalweb
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/zeebo/errs"
 
 	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/fielderr"
 	"cleanmasters/internal/logger"
+	"cleanmasters/internal/spreadsheet"
 )
 
 var (
@@ -26,47 +35,117 @@ type ClientTemplates struct {
 	List   *template.Template
 	Add    *template.Template
 	Update *template.Template
+	Delete *template.Template
+
+	Impersonate   *template.Template
+	Impersonation *template.Template
+
+	Import *template.Template
 }
 
 // Clients is a web api controller.
 // Exposes functionality and web views to manage client entity.
 type Clients struct {
-	log       logger.Logger
-	config    Config
-	clients   *clients.Service
-	templates ClientTemplates
+	log         logger.Logger
+	config      Config
+	clients     *clients.Service
+	consoleAuth *consoleauth.Service
+	templates   ClientTemplates
+}
+
+// ImpersonatePage holds data for impersonation confirmation page.
+type ImpersonatePage struct {
+	Client clients.Client
+	Error  string
+}
+
+// ImpersonationPage holds console token issued for impersonation.
+type ImpersonationPage struct {
+	Client    clients.Client
+	Token     string
+	ExpiresAt time.Time
+}
+
+// ClientUpdatePage holds data for update client page.
+type ClientUpdatePage struct {
+	// Client holds form values, form is submitted with its version.
+	Client clients.Client
+	// Conflict is true if client was changed by someone else while the form was being edited,
+	// Client holds submitted values with the latest version then, so they could be applied again.
+	Conflict bool
+	// Conflicts lists fields which saved values differ from the submitted ones.
+	Conflicts []FieldConflict
+	// FieldErrors holds messages about rejected values, Client holds submitted values then.
+	FieldErrors FieldErrors
+}
+
+// ClientCreatePage holds data for create client page.
+type ClientCreatePage struct {
+	// Client holds form values, they are empty unless submitted values were rejected.
+	Client      clients.Client
+	FieldErrors FieldErrors
+}
+
+// ImportPage holds data for clients import page.
+type ImportPage struct {
+	Fields []string
+	// Mapping holds column names by import fields.
+	Mapping clients.ColumnMapping
+	DryRun  bool
+	Report  *clients.ImportReport
+	Error   string
 }
 
 // NewClients is a constructor for clients controller.
-func NewClients(log logger.Logger, config Config, clients *clients.Service) *Clients {
+func NewClients(log logger.Logger, config Config, clients *clients.Service, consoleAuth *consoleauth.Service) (*Clients, error) {
 	controller := &Clients{
-		log:     log,
-		clients: clients,
-		config:  config,
+		log:         log,
+		clients:     clients,
+		consoleAuth: consoleAuth,
+		config:      config,
 	}
 
-	// TODO: process error.
 	err := controller.InitializeTemplates()
 	if err != nil {
-		panic(err)
+		return nil, ClientsError.Wrap(err)
 	}
 
-	return controller
+	return controller, nil
 }
 
 // InitializeTemplates initializes and caches templates for clients controller.
 func (controller *Clients) InitializeTemplates() (err error) {
-	controller.templates.List, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "clients", "list.html"))
+	controller.templates.List, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "list.html"))
 	if err != nil {
 		return err
 	}
 
-	controller.templates.Add, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "clients", "create.html"))
+	controller.templates.Add, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "create.html"))
 	if err != nil {
 		return err
 	}
 
-	controller.templates.Update, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "clients", "update.html"))
+	controller.templates.Update, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "update.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Delete, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "delete.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Impersonate, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "impersonate.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Impersonation, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "impersonation.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Import, err = parseTemplate(filepath.Join(controller.config.StaticDir, "clients", "import.html"))
 	if err != nil {
 		return err
 	}
@@ -81,7 +160,7 @@ func (controller *Clients) Create(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		err := controller.templates.Add.Execute(w, nil)
+		err := executeTemplate(w, r, controller.templates.Add, ClientCreatePage{})
 		if err != nil {
 			controller.log.Error("can not execute list clients template", ClientsError.Wrap(err))
 			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
@@ -116,8 +195,22 @@ func (controller *Clients) Create(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = controller.clients.Create(ctx, email[0], phone[0], firstName[0], lastName[0])
+		_, err = controller.clients.Create(ctx, email[0], phone[0], firstName[0], lastName[0])
 		if err != nil {
+			if fieldErr, ok := fielderr.As(err); ok {
+				page := ClientCreatePage{
+					Client: clients.Client{Email: email[0], Phone: phone[0], FirstName: firstName[0], LastName: lastName[0]},
+				}
+
+				var status int
+				page.FieldErrors, status = newFieldErrors(fieldErr)
+				w.WriteHeader(status)
+				if err = executeTemplate(w, r, controller.templates.Add, page); err != nil {
+					controller.log.Error("can not execute create client template", ClientsError.Wrap(err))
+				}
+				return
+			}
+
 			controller.log.Error("can not create client", ClientsError.Wrap(err))
 			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
 			return
@@ -156,7 +249,7 @@ func (controller *Clients) Update(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = controller.templates.Update.Execute(w, client)
+		err = executeTemplate(w, r, controller.templates.Update, ClientUpdatePage{Client: client})
 		if err != nil {
 			controller.log.Error("can not execute list clients template", ClientsError.Wrap(err))
 			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
@@ -175,15 +268,37 @@ func (controller *Clients) Update(w http.ResponseWriter, r *http.Request) {
 		email := r.Form["email"][0]
 		phone := r.Form["phone"][0]
 
+		version, err := strconv.ParseInt(r.Form.Get("version"), 10, 64)
+		if err != nil || version <= 0 {
+			http.Error(w, ClientsError.New("version is not valid").Error(), http.StatusBadRequest)
+			return
+		}
+
 		client := clients.Client{
 			ID:        clientID,
 			FirstName: firstName,
 			LastName:  lastName,
 			Email:     email,
 			Phone:     phone,
+			Version:   version,
 		}
 
 		err = controller.clients.Update(ctx, client)
+		if clients.ErrConflict.Has(err) {
+			controller.serveUpdateConflict(w, r, client)
+			return
+		}
+		if fieldErr, ok := fielderr.As(err); ok {
+			page := ClientUpdatePage{Client: client}
+
+			var status int
+			page.FieldErrors, status = newFieldErrors(fieldErr)
+			w.WriteHeader(status)
+			if err = executeTemplate(w, r, controller.templates.Update, page); err != nil {
+				controller.log.Error("can not execute update client template", ClientsError.Wrap(err))
+			}
+			return
+		}
 		if err != nil {
 			controller.log.Error("can not update client", ClientsError.Wrap(err))
 			//if adminportal.ValidationError.Has(err) {
@@ -201,26 +316,366 @@ func (controller *Clients) Update(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// List is an endpoint that will provide a web page with all clients.
+// serveUpdateConflict shows changes saved by someone else next to the submitted ones, so user could apply them again.
+func (controller *Clients) serveUpdateConflict(w http.ResponseWriter, r *http.Request, submitted clients.Client) {
+	saved, err := controller.clients.Get(r.Context(), submitted.ID)
+	if err != nil {
+		controller.log.Error("could not get client", ClientsError.Wrap(err))
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusNotFound)
+		return
+	}
+
+	fields := func(client clients.Client) map[string]string {
+		return map[string]string{
+			"email":      client.Email,
+			"first name": client.FirstName,
+			"last name":  client.LastName,
+			"phone":      client.Phone,
+		}
+	}
+
+	submitted.Version = saved.Version
+	page := ClientUpdatePage{
+		Client:    submitted,
+		Conflict:  true,
+		Conflicts: fieldConflicts([]string{"email", "first name", "last name", "phone"}, fields(saved), fields(submitted)),
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	err = executeTemplate(w, r, controller.templates.Update, page)
+	if err != nil {
+		controller.log.Error("can not execute update client template", ClientsError.Wrap(err))
+	}
+}
+
+// listDateLayout is a layout of creation dates in clients list filter.
+const listDateLayout = "2006-01-02"
+
+// ClientsPage holds data for clients list page.
+type ClientsPage struct {
+	Clients []clients.Client
+	Sorts   []clients.SortField
+
+	// Search holds search text, clients are listed by relevance without pages if it is not empty.
+	Search string
+	// Sort, Order, CreatedFrom, CreatedTo and Email hold filter form values.
+	Sort        string
+	Order       string
+	CreatedFrom string
+	CreatedTo   string
+	Email       string
+
+	NextURL template.URL
+	PrevURL template.URL
+	// ExportURLs are links to exports of clients which match the filter, by format.
+	ExportURLs map[spreadsheet.Format]template.URL
+}
+
+// List is an endpoint that will provide a web page with a page of clients which match the filter.
 func (controller *Clients) List(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	clients, err := controller.clients.List(ctx)
+	params := r.URL.Query()
+	page := newClientsPage(params)
+
+	if strings.TrimSpace(page.Search) != "" {
+		results, err := controller.clients.Search(ctx, page.Search, clients.DefaultPageLimit)
+		if err != nil {
+			controller.log.Error("can not search clients", ClientsError.Wrap(err))
+			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, result := range results {
+			page.Clients = append(page.Clients, result.Client)
+		}
+
+		controller.serveList(w, r, page)
+		return
+	}
+
+	query, err := parseClientsQuery(page, params)
+	if err != nil {
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := controller.clients.List(ctx, query)
 	if err != nil {
 		controller.log.Error("can not list clients", ClientsError.Wrap(err))
 		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
 		return
 	}
 
-	err = controller.templates.List.Execute(w, clients)
+	page.Clients = list.Clients
+	page.ExportURLs = exportURLs(params)
+	if list.Next != nil {
+		page.NextURL = pageURL(params, *list.Next)
+	}
+	if list.Prev != nil {
+		page.PrevURL = pageURL(params, *list.Prev)
+	}
+
+	controller.serveList(w, r, page)
+}
+
+// serveList renders clients list page.
+func (controller *Clients) serveList(w http.ResponseWriter, r *http.Request, page ClientsPage) {
+	err := executeTemplate(w, r, controller.templates.List, page)
 	if err != nil {
 		controller.log.Error("can not execute list clients template", ClientsError.Wrap(err))
 		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// SearchResult is a client found by search in JSON response.
+type SearchResult struct {
+	ID        uuid.UUID `json:"id"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Phone     string    `json:"phone"`
+	Email     string    `json:"email"`
+	Rank      float64   `json:"rank"`
+}
+
+// Search is an endpoint that returns clients matching query text as JSON, most relevant first.
+// It is used for type-ahead, so it returns a short list.
+func (controller *Clients) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := r.URL.Query()
+
+	limit := clients.DefaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, ClientsError.New("limit is not valid").Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := controller.clients.Search(ctx, params.Get("q"), limit)
+	if err != nil {
+		controller.log.Error("can not search clients", ClientsError.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]SearchResult, 0, len(results))
+	for _, result := range results {
+		response = append(response, SearchResult{
+			ID:        result.ID,
+			FirstName: result.FirstName,
+			LastName:  result.LastName,
+			Phone:     result.Phone,
+			Email:     result.Email,
+			Rank:      result.Rank,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		controller.log.Error("can not encode search results", ClientsError.Wrap(err))
+	}
+}
+
+// newClientsPage returns clients list page with filter form values taken from query parameters.
+func newClientsPage(params url.Values) ClientsPage {
+	return ClientsPage{
+		Sorts:       clients.SortFields,
+		Search:      params.Get("q"),
+		Sort:        params.Get("sort"),
+		Order:       params.Get("order"),
+		CreatedFrom: params.Get("created_from"),
+		CreatedTo:   params.Get("created_to"),
+		Email:       params.Get("email"),
+	}
+}
+
+// parseClientsQuery returns clients list query defined by filter form values, page cursor and limit.
+func parseClientsQuery(page ClientsPage, params url.Values) (query clients.ListQuery, err error) {
+	query, err = page.query()
+	if err != nil {
+		return clients.ListQuery{}, err
+	}
+
+	if value := params.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return clients.ListQuery{}, ClientsError.New("limit is not valid")
+		}
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := clients.DecodeCursor(value)
+		if err != nil {
+			return clients.ListQuery{}, err
+		}
+		query.Cursor = &cursor
+	}
+
+	return query, nil
+}
+
+// query returns clients list query defined by filter form values.
+func (page ClientsPage) query() (query clients.ListQuery, err error) {
+	query.Sort = clients.SortField(page.Sort)
+	if query.Sort != "" && !query.Sort.IsValid() {
+		return clients.ListQuery{}, ClientsError.New("sort %q is not valid", page.Sort)
+	}
+
+	switch page.Order {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return clients.ListQuery{}, ClientsError.New("order %q is not valid", page.Order)
+	}
+
+	if page.CreatedFrom != "" {
+		query.Filter.CreatedFrom, err = time.Parse(listDateLayout, page.CreatedFrom)
+		if err != nil {
+			return clients.ListQuery{}, ClientsError.New("created from date is not valid")
+		}
+	}
+	if page.CreatedTo != "" {
+		createdTo, err := time.Parse(listDateLayout, page.CreatedTo)
+		if err != nil {
+			return clients.ListQuery{}, ClientsError.New("created to date is not valid")
+		}
+		// the whole last day is included.
+		query.Filter.CreatedTo = createdTo.AddDate(0, 0, 1)
+	}
+
+	query.Filter.Email = clients.EmailPresence(page.Email)
+	switch query.Filter.Email {
+	case clients.EmailAny, clients.EmailPresent, clients.EmailMissing:
+	default:
+		return clients.ListQuery{}, ClientsError.New("email filter %q is not valid", page.Email)
+	}
+
+	return query, nil
+}
+
+// Export is an endpoint that downloads clients which match the filter as spreadsheet.
+func (controller *Clients) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	params := r.URL.Query()
+
+	query, err := newClientsPage(params).query()
+	if err != nil {
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusBadRequest)
 		return
 	}
+
+	format := spreadsheet.Format(params.Get("format"))
+	if !format.IsValid() {
+		http.Error(w, ClientsError.New("format %q is not valid", format).Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="clients.`+string(format)+`"`)
+
+	err = controller.clients.Export(ctx, w, format, query)
+	if err != nil {
+		controller.log.Error("could not export clients", ClientsError.Wrap(err))
+	}
+}
+
+// Import is an endpoint that shows import form on GET request and imports uploaded csv file on POST request.
+// Report of dry run lists rows which would be skipped, so file could be fixed before the real import.
+func (controller *Clients) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	page := ImportPage{
+		Fields:  clients.ImportFields,
+		Mapping: clients.ColumnMapping{},
+		DryRun:  true,
+	}
+	for _, field := range clients.ImportFields {
+		page.Mapping[field] = field
+	}
+
+	if r.Method == http.MethodGet {
+		controller.serveImport(w, r, page)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		page.Error = "File is required."
+		controller.serveImport(w, r, page)
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	for _, field := range clients.ImportFields {
+		page.Mapping[field] = r.FormValue("column-" + field)
+	}
+	page.DryRun = r.FormValue("dry-run") != ""
+
+	report, err := controller.clients.Import(ctx, file, clients.ImportOptions{Mapping: page.Mapping, DryRun: page.DryRun})
+	if err != nil {
+		if clients.ErrImport.Has(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			page.Error = errs.Unwrap(err).Error()
+			controller.serveImport(w, r, page)
+			return
+		}
+
+		controller.log.Error("could not import clients", ClientsError.Wrap(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		page.Error = "Import failed, clients of the batches listed below are saved."
+	}
+
+	page.Report = &report
+	controller.serveImport(w, r, page)
+}
+
+// serveImport renders clients import page.
+func (controller *Clients) serveImport(w http.ResponseWriter, r *http.Request, page ImportPage) {
+	err := executeTemplate(w, r, controller.templates.Import, page)
+	if err != nil {
+		controller.log.Error("can not execute import clients template", ClientsError.Wrap(err))
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// exportURLs returns links to clients exports which keep filters of current request.
+func exportURLs(params url.Values) map[spreadsheet.Format]template.URL {
+	values := url.Values{}
+	for _, key := range []string{"sort", "order", "created_from", "created_to", "email"} {
+		if value := params.Get(key); value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	urls := make(map[spreadsheet.Format]template.URL, len(spreadsheet.Formats))
+	for _, format := range spreadsheet.Formats {
+		values.Set("format", string(format))
+		urls[format] = template.URL("/clients/export?" + values.Encode())
+	}
+
+	return urls
+}
+
+// pageURL returns clients list URL which keeps filters of current request and points to the cursor.
+func pageURL(params url.Values, cursor clients.Cursor) template.URL {
+	values := url.Values{}
+	for key, value := range params {
+		values[key] = value
+	}
+	values.Set("cursor", cursor.Encode())
+
+	return template.URL("/clients?" + values.Encode())
 }
 
-// Delete is an endpoint that will delete client.
+// Delete is an endpoint that shows delete confirmation page on GET request and
+// deletes client on POST request.
 func (controller *Clients) Delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -237,6 +692,22 @@ func (controller *Clients) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodGet {
+		client, err := controller.clients.Get(ctx, clientID)
+		if err != nil {
+			controller.log.Error("could not get client", ClientsError.Wrap(err))
+			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusNotFound)
+			return
+		}
+
+		err = executeTemplate(w, r, controller.templates.Delete, client)
+		if err != nil {
+			controller.log.Error("can not execute delete clients template", ClientsError.Wrap(err))
+			http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	err = controller.clients.Delete(ctx, clientID)
 	if err != nil {
 		controller.log.Error("could not delete client", ClientsError.Wrap(err))
@@ -248,3 +719,74 @@ func (controller *Clients) Delete(w http.ResponseWriter, r *http.Request) {
 	r.Method = http.MethodGet
 	http.Redirect(w, r, "/clients", http.StatusMovedPermanently)
 }
+
+// Impersonate is an endpoint that asks for impersonation reason on GET request and
+// issues short-lived console token for the client on POST request.
+func (controller *Clients) Impersonate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	clientID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, ClientsError.New("error parsing segment parameters. Id is not valid.").Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, err := controller.clients.Get(ctx, clientID)
+	if err != nil {
+		controller.log.Error("could not get client", ClientsError.Wrap(err))
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		controller.serveImpersonate(w, r, ImpersonatePage{Client: client})
+		return
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := controller.consoleAuth.Impersonate(ctx, clientID, claims.ID, r.Form.Get("reason"))
+	if err != nil {
+		if consoleauth.ErrImpersonation.Has(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			controller.serveImpersonate(w, r, ImpersonatePage{Client: client, Error: errs.Unwrap(err).Error()})
+			return
+		}
+
+		controller.log.Error("could not impersonate client", ClientsError.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// token is shown once and must not be cached by browser.
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = executeTemplate(w, r, controller.templates.Impersonation, ImpersonationPage{
+		Client:    client,
+		Token:     tokens.AccessToken.String(),
+		ExpiresAt: tokens.ExpiresAt,
+	})
+	if err != nil {
+		controller.log.Error("can not execute impersonation template", ClientsError.Wrap(err))
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveImpersonate renders impersonation confirmation page.
+func (controller *Clients) serveImpersonate(w http.ResponseWriter, r *http.Request, page ImpersonatePage) {
+	err := executeTemplate(w, r, controller.templates.Impersonate, page)
+	if err != nil {
+		controller.log.Error("can not execute impersonate template", ClientsError.Wrap(err))
+		http.Error(w, ClientsError.Wrap(err).Error(), http.StatusInternalServerError)
+	}
+}
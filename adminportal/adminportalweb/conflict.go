@@ -0,0 +1,25 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+// FieldConflict describes field which was changed by someone else while the form was being edited.
+type FieldConflict struct {
+	Field string
+	// Saved is a value which is saved now.
+	Saved string
+	// Submitted is a value of the submitted form.
+	Submitted string
+}
+
+// fieldConflicts returns fields which values differ between saved entity and submitted form, in fields order.
+func fieldConflicts(fields []string, saved, submitted map[string]string) []FieldConflict {
+	var conflicts []FieldConflict
+	for _, field := range fields {
+		if saved[field] != submitted[field] {
+			conflicts = append(conflicts, FieldConflict{Field: field, Saved: saved[field], Submitted: submitted[field]})
+		}
+	}
+
+	return conflicts
+}
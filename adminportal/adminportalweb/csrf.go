@@ -0,0 +1,167 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/zeebo/errs"
+)
+
+// ErrCSRF is an error class for CSRF protection errors.
+var ErrCSRF = errs.Class("csrf protection error")
+
+const (
+	// csrfCookieName is a name of cookie which holds random browser session id the token is bound to.
+	csrfCookieName = "cleanmasters_csrf"
+	// csrfFieldName is a name of hidden form field with CSRF token.
+	csrfFieldName = "csrf_token"
+	// csrfHeaderName is a name of header with CSRF token for requests sent by scripts.
+	csrfHeaderName = "X-CSRF-Token"
+	// csrfSessionLength is a number of random bytes in browser session id.
+	csrfSessionLength = 32
+)
+
+// csrfKey is a context key for CSRF token of the request.
+type csrfKey struct{}
+
+// CSRF issues and validates tokens which protect state-changing requests from cross-site request forgery.
+// Token is a HMAC of browser session id and auth cookie, so it changes with every login.
+type CSRF struct {
+	key        []byte
+	authCookie func(r *http.Request) (string, error)
+	// exempt holds paths which do not rely on cookies, so they could not be forged.
+	exempt map[string]bool
+}
+
+// NewCSRF is a constructor for CSRF protection, random key is generated if secret is empty.
+func NewCSRF(secret string, authCookie func(r *http.Request) (string, error)) (*CSRF, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, ErrCSRF.Wrap(err)
+		}
+	}
+
+	return &CSRF{key: key, authCookie: authCookie, exempt: map[string]bool{}}, nil
+}
+
+// Exempt disables protection of the path, it must be used only for endpoints which do not use cookies.
+func (csrf *CSRF) Exempt(path string) {
+	csrf.exempt[path] = true
+}
+
+// Protect rejects state-changing requests without valid token and puts token of the request into the context.
+// Requests authorized with bearer token and exempt paths are not checked.
+func (csrf *CSRF) Protect(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := ""
+		if cookie, err := r.Cookie(csrfCookieName); err == nil {
+			session = cookie.Value
+		}
+
+		if session == "" {
+			var err error
+			session, err = csrf.newSession(w)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		token := csrf.token(r, session)
+
+		switch {
+		case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		// browsers never attach bearer tokens by themselves, so such requests are not forged.
+		case bearerToken(r) != "", csrf.exempt[r.URL.Path]:
+		default:
+			received := r.Header.Get(csrfHeaderName)
+			if received == "" {
+				received = r.PostFormValue(csrfFieldName)
+			}
+
+			if !hmac.Equal([]byte(received), []byte(token)) {
+				http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
+
+// newSession generates browser session id and sets it into cookie.
+func (csrf *CSRF) newSession(w http.ResponseWriter) (string, error) {
+	random := make([]byte, csrfSessionLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	session := base64.RawURLEncoding.EncodeToString(random)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return session, nil
+}
+
+// token calculates CSRF token bound to browser session and auth cookie of the request.
+func (csrf *CSRF) token(r *http.Request, session string) string {
+	authToken, _ := csrf.authCookie(r)
+
+	mac := hmac.New(sha256.New, csrf.key)
+	_, _ = mac.Write([]byte(session))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(authToken))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken returns CSRF token of the request.
+func csrfToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+// parseTemplate parses template files.
+// Templates render hidden field with CSRF token inside forms with {{csrfField}}.
+func parseTemplate(filenames ...string) (*template.Template, error) {
+	return template.New(filepath.Base(filenames[0])).Funcs(template.FuncMap{
+		"csrfField": func() template.HTML { return "" },
+	}).ParseFiles(filenames...)
+}
+
+// executeTemplate executes a copy of the template bound to CSRF token of the request.
+// Original template is never executed, so it could be cloned for every request.
+func executeTemplate(w io.Writer, r *http.Request, tmpl *template.Template, data interface{}) error {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+
+	token := csrfToken(r.Context())
+	clone.Funcs(template.FuncMap{
+		"csrfField": func() template.HTML {
+			// #nosec token is base64 url encoded and escaped.
+			return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	})
+
+	return clone.Execute(w, data)
+}
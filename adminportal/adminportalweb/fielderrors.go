@@ -0,0 +1,24 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"net/http"
+
+	"cleanmasters/internal/fielderr"
+)
+
+// FieldErrors holds messages about rejected form values by field names, e.g. "phone" or "firstName".
+type FieldErrors map[string]string
+
+// newFieldErrors returns messages and response status of the field error,
+// values which are taken by other entities conflict with them.
+func newFieldErrors(fieldErr *fielderr.Error) (FieldErrors, int) {
+	status := http.StatusBadRequest
+	if fieldErr.Kind == fielderr.KindTaken {
+		status = http.StatusConflict
+	}
+
+	return FieldErrors{fieldErr.Field: fieldErr.Error()}, status
+}
@@ -7,13 +7,17 @@ import (
 	"html/template"
 	"net/http"
 	"path/filepath"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/zeebo/errs"
 
+	"cleanmasters/adminportal/adminauth"
 	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/fielderr"
 	"cleanmasters/internal/logger"
+	"cleanmasters/internal/spreadsheet"
 )
 
 var (
@@ -26,47 +30,81 @@ type ManagerTemplates struct {
 	List   *template.Template
 	Add    *template.Template
 	Update *template.Template
+	Delete *template.Template
+	Invite *template.Template
 }
 
 // Managers is a web api controller.
 // Exposes functionality and web views to manage manager entity.
 type Managers struct {
-	log       logger.Logger
-	config    Config
-	managers  *managers.Service
-	templates ManagerTemplates
+	log            logger.Logger
+	config         Config
+	managers       *managers.Service
+	authentication *adminauth.Service
+	templates      ManagerTemplates
+}
+
+// ManagerUpdatePage holds data for update manager page.
+type ManagerUpdatePage struct {
+	// Manager holds form values, form is submitted with its version.
+	Manager managers.Manager
+	// Conflict is true if manager was changed by someone else while the form was being edited,
+	// Manager holds submitted values with the latest version then, so they could be applied again.
+	// Submitted password is not shown back and has to be entered again.
+	Conflict bool
+	// Conflicts lists fields which saved values differ from the submitted ones.
+	Conflicts []FieldConflict
+	// FieldErrors holds messages about rejected values, Manager holds submitted values then.
+	FieldErrors FieldErrors
+}
+
+// ManagerCreatePage holds data for create and invite manager pages.
+type ManagerCreatePage struct {
+	// Manager holds form values, submitted values are shown back if they were rejected.
+	Manager     managers.Manager
+	FieldErrors FieldErrors
 }
 
 // NewManagers is a constructor for managers controller.
-func NewManagers(log logger.Logger, config Config, managers *managers.Service) *Managers {
+func NewManagers(log logger.Logger, config Config, managers *managers.Service, authentication *adminauth.Service) (*Managers, error) {
 	managersController := &Managers{
-		log:      log,
-		managers: managers,
-		config:   config,
+		log:            log,
+		managers:       managers,
+		authentication: authentication,
+		config:         config,
 	}
 
-	// TODO: process error.
 	err := managersController.initializeTemplates()
 	if err != nil {
-		panic(err)
+		return nil, ManagersError.Wrap(err)
 	}
 
-	return managersController
+	return managersController, nil
 }
 
 // initializeTemplates initializes and caches templates for managers controller.
 func (controller *Managers) initializeTemplates() (err error) {
-	controller.templates.List, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "managers", "list.html"))
+	controller.templates.List, err = parseTemplate(filepath.Join(controller.config.StaticDir, "managers", "list.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Add, err = parseTemplate(filepath.Join(controller.config.StaticDir, "managers", "create.html"))
 	if err != nil {
 		return err
 	}
 
-	controller.templates.Add, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "managers", "create.html"))
+	controller.templates.Update, err = parseTemplate(filepath.Join(controller.config.StaticDir, "managers", "update.html"))
 	if err != nil {
 		return err
 	}
 
-	controller.templates.Update, err = template.ParseFiles(filepath.Join(controller.config.StaticDir, "managers", "update.html"))
+	controller.templates.Invite, err = parseTemplate(filepath.Join(controller.config.StaticDir, "managers", "invite.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Delete, err = parseTemplate(filepath.Join(controller.config.StaticDir, "managers", "delete.html"))
 
 	return err
 }
@@ -78,7 +116,7 @@ func (controller *Managers) Create(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		err := controller.templates.Add.Execute(w, nil)
+		err := executeTemplate(w, r, controller.templates.Add, ManagerCreatePage{Manager: managers.Manager{Role: managers.RoleManager}})
 		if err != nil {
 			controller.log.Error("can not execute add managers template", ManagersError.Wrap(err))
 			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
@@ -113,9 +151,31 @@ func (controller *Managers) Create(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, ClientsError.New("email parameter is not found").Error(), http.StatusBadRequest)
 			return
 		}
+		role := r.Form["role"]
+		if len(role) == 0 {
+			http.Error(w, ClientsError.New("role parameter is not found").Error(), http.StatusBadRequest)
+			return
+		}
 
-		err = controller.managers.Create(ctx, password[0], firstName[0], lastName[0], email[0])
+		_, err = controller.managers.Create(ctx, password[0], firstName[0], lastName[0], email[0], managers.Role(role[0]))
 		if err != nil {
+			if fieldErr, ok := fielderr.As(err); ok {
+				page := ManagerCreatePage{
+					Manager: managers.Manager{Email: email[0], FirstName: firstName[0], LastName: lastName[0], Role: managers.Role(role[0])},
+				}
+				controller.serveFieldError(w, r, controller.templates.Add, page, fieldErr)
+				return
+			}
+
+			if managers.ValidationError.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
+				return
+			}
+			if managers.ErrPermissionDenied.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusForbidden)
+				return
+			}
+
 			//if adminportal.ValidationError.Has(err) {
 			//	controller.log.Error("can not create manager", zap.Error(ManagersError.Wrap(err)))
 			//	http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
@@ -133,6 +193,60 @@ func (controller *Managers) Create(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Invite is an endpoint that handles invite manager web page on GET request and
+// creates manager without password and sends invitation link on POST request.
+func (controller *Managers) Invite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		err := executeTemplate(w, r, controller.templates.Invite, ManagerCreatePage{Manager: managers.Manager{Role: managers.RoleManager}})
+		if err != nil {
+			controller.log.Error("can not execute invite managers template", ManagersError.Wrap(err))
+			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		manager := managers.Manager{
+			Email:     r.Form.Get("email"),
+			FirstName: r.Form.Get("first-name"),
+			LastName:  r.Form.Get("last-name"),
+			Role:      managers.Role(r.Form.Get("role")),
+		}
+
+		_, err = controller.authentication.Invite(ctx, manager.FirstName, manager.LastName, manager.Email, manager.Role)
+		if err != nil {
+			if fieldErr, ok := fielderr.As(err); ok {
+				controller.serveFieldError(w, r, controller.templates.Invite, ManagerCreatePage{Manager: manager}, fieldErr)
+				return
+			}
+
+			if managers.ValidationError.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
+				return
+			}
+			if managers.ErrPermissionDenied.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusForbidden)
+				return
+			}
+
+			controller.log.Error("can not invite manager", ManagersError.Wrap(err))
+			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		r = r.Clone(ctx)
+		r.Method = http.MethodGet
+		http.Redirect(w, r, "/managers", http.StatusMovedPermanently)
+	}
+}
+
 // Update is an endpoint that handles update manager web page on GET request and
 // tries to update manager on POST request.
 func (controller *Managers) Update(w http.ResponseWriter, r *http.Request) {
@@ -160,7 +274,7 @@ func (controller *Managers) Update(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = controller.templates.Update.Execute(w, manager)
+		err = executeTemplate(w, r, controller.templates.Update, ManagerUpdatePage{Manager: manager})
 		if err != nil {
 			controller.log.Error("can not execute update managers template", ManagersError.Wrap(err))
 			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
@@ -179,16 +293,58 @@ func (controller *Managers) Update(w http.ResponseWriter, r *http.Request) {
 		firstName := r.Form["first-name"][0]
 		lastName := r.Form["last-name"][0]
 		email := r.Form["email"][0]
+		role := r.Form.Get("role")
+
+		version, err := strconv.ParseInt(r.Form.Get("version"), 10, 64)
+		if err != nil || version <= 0 {
+			http.Error(w, ManagersError.New("version is not valid").Error(), http.StatusBadRequest)
+			return
+		}
 
 		manager := managers.ManagerUpdateFields{
 			FirstName: firstName,
 			LastName:  lastName,
 			Email:     email,
 			Password:  password,
+			Role:      managers.Role(role),
+			Version:   version,
 		}
 
 		err = controller.managers.Update(ctx, managerID, manager)
+		if managers.ErrConflict.Has(err) {
+			controller.serveUpdateConflict(w, r, managerID, manager)
+			return
+		}
+		if fieldErr, ok := fielderr.As(err); ok {
+			page := ManagerUpdatePage{
+				Manager: managers.Manager{
+					ID:        managerID,
+					FirstName: firstName,
+					LastName:  lastName,
+					Email:     email,
+					Role:      managers.Role(role),
+					Version:   version,
+				},
+			}
+
+			var status int
+			page.FieldErrors, status = newFieldErrors(fieldErr)
+			w.WriteHeader(status)
+			if err = executeTemplate(w, r, controller.templates.Update, page); err != nil {
+				controller.log.Error("can not execute update managers template", ManagersError.Wrap(err))
+			}
+			return
+		}
 		if err != nil {
+			if managers.ValidationError.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
+				return
+			}
+			if managers.ErrPermissionDenied.Has(err) {
+				http.Error(w, ManagersError.Wrap(err).Error(), http.StatusForbidden)
+				return
+			}
+
 			controller.log.Error("can not update manager", ManagersError.Wrap(err))
 			//if adminportal.ValidationError.Has(err) {
 			//	http.Error(w, ManagersError.Wrap(err).Error(), http.StatusBadRequest)
@@ -205,6 +361,56 @@ func (controller *Managers) Update(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveFieldError shows create or invite manager form with submitted values and the message about rejected one.
+// Submitted password is not shown back.
+func (controller *Managers) serveFieldError(w http.ResponseWriter, r *http.Request, tmpl *template.Template, page ManagerCreatePage, fieldErr *fielderr.Error) {
+	var status int
+	page.FieldErrors, status = newFieldErrors(fieldErr)
+
+	w.WriteHeader(status)
+	err := executeTemplate(w, r, tmpl, page)
+	if err != nil {
+		controller.log.Error("can not execute manager form template", ManagersError.Wrap(err))
+	}
+}
+
+// serveUpdateConflict shows changes saved by someone else next to the submitted ones, so user could apply them again.
+func (controller *Managers) serveUpdateConflict(w http.ResponseWriter, r *http.Request, id uuid.UUID, fields managers.ManagerUpdateFields) {
+	saved, err := controller.managers.Get(r.Context(), id)
+	if err != nil {
+		controller.log.Error("could not get manager", ManagersError.Wrap(err))
+		http.Error(w, ManagersError.Wrap(err).Error(), http.StatusNotFound)
+		return
+	}
+
+	submitted := saved
+	submitted.FirstName = fields.FirstName
+	submitted.LastName = fields.LastName
+	submitted.Email = fields.Email
+	submitted.Role = fields.Role
+
+	values := func(manager managers.Manager) map[string]string {
+		return map[string]string{
+			"email":      manager.Email,
+			"first name": manager.FirstName,
+			"last name":  manager.LastName,
+			"role":       string(manager.Role),
+		}
+	}
+
+	page := ManagerUpdatePage{
+		Manager:   submitted,
+		Conflict:  true,
+		Conflicts: fieldConflicts([]string{"email", "first name", "last name", "role"}, values(saved), values(submitted)),
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	err = executeTemplate(w, r, controller.templates.Update, page)
+	if err != nil {
+		controller.log.Error("can not execute update managers template", ManagersError.Wrap(err))
+	}
+}
+
 // List is an endpoint that will provide a web page with all managers.
 func (controller *Managers) List(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -216,7 +422,7 @@ func (controller *Managers) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = controller.templates.List.Execute(w, managers)
+	err = executeTemplate(w, r, controller.templates.List, managers)
 	if err != nil {
 		controller.log.Error("can not execute list managers template", ManagersError.Wrap(err))
 		http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
@@ -224,7 +430,27 @@ func (controller *Managers) List(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Delete is an endpoint that will delete manager.
+// Export is an endpoint that downloads all managers as spreadsheet.
+func (controller *Managers) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format := spreadsheet.Format(r.URL.Query().Get("format"))
+	if !format.IsValid() {
+		http.Error(w, ManagersError.New("format %q is not valid", format).Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="managers.`+string(format)+`"`)
+
+	err := controller.managers.Export(ctx, w, format)
+	if err != nil {
+		controller.log.Error("could not export managers", ManagersError.Wrap(err))
+	}
+}
+
+// Delete is an endpoint that shows delete confirmation page on GET request and
+// deletes manager on POST request.
 func (controller *Managers) Delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -241,6 +467,22 @@ func (controller *Managers) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodGet {
+		manager, err := controller.managers.Get(ctx, managerID)
+		if err != nil {
+			controller.log.Error("could not get manager", ManagersError.Wrap(err))
+			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusNotFound)
+			return
+		}
+
+		err = executeTemplate(w, r, controller.templates.Delete, manager)
+		if err != nil {
+			controller.log.Error("can not execute delete managers template", ManagersError.Wrap(err))
+			http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	err = controller.managers.Delete(ctx, managerID)
 	if err != nil {
 		controller.log.Error("could not delete manager", ManagersError.Wrap(err))
@@ -252,3 +494,25 @@ func (controller *Managers) Delete(w http.ResponseWriter, r *http.Request) {
 	r.Method = http.MethodGet
 	http.Redirect(w, r, "/managers", http.StatusMovedPermanently)
 }
+
+// Unlock is an endpoint that removes lockout of manager caused by failed login attempts.
+func (controller *Managers) Unlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	managerID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, ManagersError.New("error parsing segment parameters. Id is not valid.").Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = controller.authentication.Unlock(ctx, managerID)
+	if err != nil {
+		controller.log.Error("could not unlock manager", ManagersError.Wrap(err))
+		http.Error(w, ManagersError.Wrap(err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r = r.Clone(ctx)
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/managers", http.StatusMovedPermanently)
+}
@@ -0,0 +1,186 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrPasswords is an internal error type for passwords controller.
+	ErrPasswords = errs.Class("passwords controller error")
+)
+
+// PasswordsTemplates holds templates needed for passwords controller.
+type PasswordsTemplates struct {
+	Forgot *template.Template
+	Reset  *template.Template
+}
+
+// Passwords is a web api controller.
+// Exposes web views where manager sets password from invitation or password reset link.
+type Passwords struct {
+	log    logger.Logger
+	config Config
+
+	authentication *adminauth.Service
+
+	templates PasswordsTemplates
+}
+
+// ForgotPasswordPage holds data for forgot password page.
+type ForgotPasswordPage struct {
+	Sent bool
+}
+
+// ResetPasswordPage holds data for page where new password is set.
+type ResetPasswordPage struct {
+	Action string
+	Invite bool
+	Error  string
+}
+
+// NewPasswords is a constructor for passwords controller.
+func NewPasswords(log logger.Logger, config Config, authentication *adminauth.Service) (*Passwords, error) {
+	controller := &Passwords{
+		log:            log,
+		config:         config,
+		authentication: authentication,
+	}
+
+	err := controller.initializeTemplates()
+	if err != nil {
+		return nil, ErrPasswords.Wrap(err)
+	}
+
+	return controller, nil
+}
+
+// initializeTemplates initializes and caches templates for passwords controller.
+func (controller *Passwords) initializeTemplates() (err error) {
+	controller.templates.Forgot, err = parseTemplate(filepath.Join(controller.config.StaticDir, "password", "forgot.html"))
+	if err != nil {
+		return err
+	}
+
+	controller.templates.Reset, err = parseTemplate(filepath.Join(controller.config.StaticDir, "password", "reset.html"))
+
+	return err
+}
+
+// Forgot is an endpoint that shows forgot password page on GET request and sends password reset link on POST request.
+// The same response is returned whether email is registered or not.
+func (controller *Passwords) Forgot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	page := ForgotPasswordPage{}
+
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, ErrPasswords.Wrap(err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = controller.authentication.ForgotPassword(ctx, r.Form.Get("email"))
+		if err != nil {
+			controller.log.Error("could not send password reset link", ErrPasswords.Wrap(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		page.Sent = true
+	}
+
+	err := executeTemplate(w, r, controller.templates.Forgot, page)
+	if err != nil {
+		controller.log.Error("could not execute forgot password template", ErrPasswords.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// Reset is an endpoint that sets new password using password reset link.
+func (controller *Passwords) Reset(w http.ResponseWriter, r *http.Request) {
+	controller.setPassword(w, r, adminauth.PurposeReset)
+}
+
+// Invite is an endpoint that sets first password using invitation link.
+func (controller *Passwords) Invite(w http.ResponseWriter, r *http.Request) {
+	controller.setPassword(w, r, adminauth.PurposeInvite)
+}
+
+// setPassword shows new password form on GET request and sets password on POST request.
+func (controller *Passwords) setPassword(w http.ResponseWriter, r *http.Request, purpose adminauth.PasswordTokenPurpose) {
+	ctx := r.Context()
+	token := mux.Vars(r)["token"]
+
+	page := ResetPasswordPage{
+		Action: r.URL.Path,
+		Invite: purpose == adminauth.PurposeInvite,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		err := controller.authentication.CheckPasswordToken(ctx, token, purpose)
+		if err != nil {
+			controller.serveInvalidToken(w, err)
+			return
+		}
+	case http.MethodPost:
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, ErrPasswords.Wrap(err).Error(), http.StatusBadRequest)
+			return
+		}
+
+		password := r.Form.Get("password")
+		if password != r.Form.Get("confirm-password") {
+			w.WriteHeader(http.StatusBadRequest)
+			page.Error = "Passwords do not match."
+			break
+		}
+
+		err = controller.authentication.ResetPassword(ctx, token, purpose, password, remoteIP(r))
+		if err != nil {
+			if managers.ValidationError.Has(err) {
+				w.WriteHeader(http.StatusBadRequest)
+				page.Error = errs.Unwrap(err).Error()
+				break
+			}
+
+			controller.serveInvalidToken(w, err)
+			return
+		}
+
+		r = r.Clone(ctx)
+		r.Method = http.MethodGet
+		http.Redirect(w, r, "/authorize", http.StatusMovedPermanently)
+		return
+	}
+
+	err := executeTemplate(w, r, controller.templates.Reset, page)
+	if err != nil {
+		controller.log.Error("could not execute reset password template", ErrPasswords.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// serveInvalidToken responds with error when link is unknown, used or expired.
+func (controller *Passwords) serveInvalidToken(w http.ResponseWriter, err error) {
+	if adminauth.ErrNoPasswordToken.Has(err) {
+		http.Error(w, "link is invalid or expired", http.StatusNotFound)
+		return
+	}
+
+	controller.log.Error("could not check password token", ErrPasswords.Wrap(err))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
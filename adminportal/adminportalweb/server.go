@@ -15,7 +15,9 @@ import (
 
 	"cleanmasters/adminportal/adminauth"
 	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
 	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
 	"cleanmasters/internal/auth"
 	"cleanmasters/internal/logger"
 )
@@ -29,6 +31,8 @@ var (
 type Config struct {
 	Address   string
 	StaticDir string
+	// CSRFSecret is a key for CSRF tokens, random key is used if it is empty.
+	CSRFSecret string
 }
 
 // Server represents main admin portal http server with all endpoints.
@@ -38,17 +42,19 @@ type Server struct {
 	log    logger.Logger
 	config Config
 
-	managers   *managers.Service
-	clients    *clients.Service
-	service    *adminauth.Service
-	cookieAuth *auth.Cookie
+	managers    *managers.Service
+	clients     *clients.Service
+	audit       *audit.Service
+	service     *adminauth.Service
+	consoleAuth *consoleauth.Service
+	cookieAuth  *auth.Cookie
 
 	server   http.Server
 	listener net.Listener
 }
 
 // NewServer returns new instance of Admin Portal HTTP Server.
-func NewServer(log logger.Logger, config Config, authService *adminauth.Service, clients *clients.Service, managers *managers.Service, listener net.Listener) *Server {
+func NewServer(log logger.Logger, config Config, authService *adminauth.Service, clients *clients.Service, managersService *managers.Service, auditService *audit.Service, consoleAuth *consoleauth.Service, listener net.Listener) (*Server, error) {
 	// TODO: take this values from config.
 	cookieAuth := auth.NewCookie(
 		auth.CookieSettings{
@@ -58,42 +64,142 @@ func NewServer(log logger.Logger, config Config, authService *adminauth.Service,
 	)
 
 	server := Server{
-		log:        log,
-		config:     config,
-		service:    authService,
-		clients:    clients,
-		managers:   managers,
-		cookieAuth: cookieAuth,
-		listener:   listener,
+		log:         log,
+		config:      config,
+		service:     authService,
+		clients:     clients,
+		managers:    managersService,
+		audit:       auditService,
+		consoleAuth: consoleAuth,
+		cookieAuth:  cookieAuth,
+		listener:    listener,
+	}
+
+	csrf, err := NewCSRF(config.CSRFSecret, cookieAuth.GetToken)
+	if err != nil {
+		return nil, Error.Wrap(err)
 	}
 
 	router := mux.NewRouter()
+	router.Use(csrf.Protect)
+	router.Use(withAuditRequest)
 
 	managersRouter := router.PathPrefix("/managers").Subrouter()
 	managersRouter.Use(server.withAuth)
-	managersController := NewManagers(log, config, server.managers)
+	managersController, err := NewManagers(log, config, server.managers, server.service)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
 	managersRouter.HandleFunc("", managersController.List).Methods(http.MethodGet, http.MethodPost)
-	managersRouter.HandleFunc("/create", managersController.Create).Methods(http.MethodGet, http.MethodPost)
-	managersRouter.HandleFunc("/{id}/update", managersController.Update).Methods(http.MethodGet, http.MethodPost)
-	managersRouter.HandleFunc("/{id}/delete", managersController.Delete).Methods(http.MethodGet)
+	managersRouter.HandleFunc("/export", managersController.Export).Methods(http.MethodGet)
+	managersRouter.Handle("/create", server.withPermission(managers.PermissionManageManagers, http.HandlerFunc(managersController.Create))).Methods(http.MethodGet, http.MethodPost)
+	managersRouter.Handle("/invite", server.withPermission(managers.PermissionManageManagers, http.HandlerFunc(managersController.Invite))).Methods(http.MethodGet, http.MethodPost)
+	managersRouter.Handle("/{id}/update", server.withPermission(managers.PermissionManageManagers, http.HandlerFunc(managersController.Update))).Methods(http.MethodGet, http.MethodPost)
+	managersRouter.Handle("/{id}/delete", server.withPermission(managers.PermissionManageManagers, http.HandlerFunc(managersController.Delete))).Methods(http.MethodGet, http.MethodPost)
+	managersRouter.Handle("/{id}/unlock", server.withPermission(managers.PermissionUnlockManagers, http.HandlerFunc(managersController.Unlock))).Methods(http.MethodPost)
 
 	authRouter := router.PathPrefix("/authorize").Subrouter()
-	authController := NewAuth(log, config, server.service, server.cookieAuth)
+	authController, err := NewAuth(log, config, server.service, server.cookieAuth)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
 	authRouter.HandleFunc("", authController.Authorize).Methods(http.MethodGet, http.MethodPost)
+	authRouter.HandleFunc("/second-factor", authController.SecondFactor).Methods(http.MethodPost)
+	authRouter.HandleFunc("/enroll", authController.Enroll).Methods(http.MethodPost)
+	authRouter.HandleFunc("/sso", authController.SSO).Methods(http.MethodGet)
+	authRouter.HandleFunc("/sso/callback", authController.SSOCallback).Methods(http.MethodGet)
+
+	accountRouter := router.PathPrefix("/account").Subrouter()
+	accountRouter.Use(server.withAuth)
+	accountController, err := NewAccount(log, config, server.service, server.managers)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	accountRouter.HandleFunc("/two-factor", accountController.TwoFactor).Methods(http.MethodGet, http.MethodPost)
+	accountRouter.HandleFunc("/two-factor/disable", accountController.DisableTwoFactor).Methods(http.MethodPost)
+	accountRouter.HandleFunc("/two-factor/recovery-codes", accountController.RecoveryCodes).Methods(http.MethodPost)
+	accountRouter.HandleFunc("/password", accountController.Password).Methods(http.MethodGet, http.MethodPost)
+
+	passwordsController, err := NewPasswords(log, config, server.service)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	router.HandleFunc("/password/forgot", passwordsController.Forgot).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/password/reset/{token}", passwordsController.Reset).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/invite/{token}", passwordsController.Invite).Methods(http.MethodGet, http.MethodPost)
 
 	clientsRouter := router.PathPrefix("/clients").Subrouter()
 	clientsRouter.Use(server.withAuth)
-	clientsController := NewClients(log, server.config, server.clients)
+	clientsController, err := NewClients(log, server.config, server.clients, server.consoleAuth)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
 	clientsRouter.HandleFunc("", clientsController.List).Methods(http.MethodGet)
+	clientsRouter.HandleFunc("/search", clientsController.Search).Methods(http.MethodGet)
+	clientsRouter.HandleFunc("/export", clientsController.Export).Methods(http.MethodGet)
+	clientsRouter.HandleFunc("/import", clientsController.Import).Methods(http.MethodGet, http.MethodPost)
 	clientsRouter.HandleFunc("/create", clientsController.Create).Methods(http.MethodGet, http.MethodPost)
 	clientsRouter.HandleFunc("/{id}/update", clientsController.Update).Methods(http.MethodGet, http.MethodPost)
-	clientsRouter.HandleFunc("/{id}/delete", clientsController.Delete).Methods(http.MethodGet)
+	clientsRouter.HandleFunc("/{id}/delete", clientsController.Delete).Methods(http.MethodGet, http.MethodPost)
+	clientsRouter.Handle("/{id}/impersonate", server.withPermission(managers.PermissionImpersonateClients, http.HandlerFunc(clientsController.Impersonate))).Methods(http.MethodGet, http.MethodPost)
+
+	auditRouter := router.PathPrefix("/audit").Subrouter()
+	auditRouter.Use(server.withAuth)
+	auditController, err := NewAudit(log, server.config, server.audit)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	auditRouter.Handle("", server.withPermission(managers.PermissionViewAudit, http.HandlerFunc(auditController.List))).Methods(http.MethodGet)
+	auditRouter.Handle("/export.csv", server.withPermission(managers.PermissionViewAudit, http.HandlerFunc(auditController.Export))).Methods(http.MethodGet)
+
+	apiKeysRouter := router.PathPrefix("/api-keys").Subrouter()
+	apiKeysRouter.Use(server.withAuth)
+	apiKeysController, err := NewAPIKeys(log, server.config, server.consoleAuth)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	apiKeysRouter.Handle("", server.withPermission(managers.PermissionManageAPIKeys, http.HandlerFunc(apiKeysController.List))).Methods(http.MethodGet)
+	apiKeysRouter.Handle("/create", server.withPermission(managers.PermissionManageAPIKeys, http.HandlerFunc(apiKeysController.Create))).Methods(http.MethodGet, http.MethodPost)
+	apiKeysRouter.Handle("/{id}/revoke", server.withPermission(managers.PermissionManageAPIKeys, http.HandlerFunc(apiKeysController.Revoke))).Methods(http.MethodPost)
+
+	trashRouter := router.PathPrefix("/trash").Subrouter()
+	trashRouter.Use(server.withAuth)
+	trashController, err := NewTrash(log, server.config, server.clients, server.managers)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	trashRouter.Handle("", server.withPermission(managers.PermissionManageTrash, http.HandlerFunc(trashController.List))).Methods(http.MethodGet)
+	trashRouter.Handle("/clients/{id}/restore", server.withPermission(managers.PermissionManageTrash, http.HandlerFunc(trashController.RestoreClient))).Methods(http.MethodPost)
+	trashRouter.Handle("/managers/{id}/restore", server.withPermission(managers.PermissionManageTrash, http.HandlerFunc(trashController.RestoreManager))).Methods(http.MethodPost)
+
+	apiRouter := router.PathPrefix(apiPrefix).Subrouter()
+	apiAuthController := NewAPIAuth(log, server.service)
+	csrf.Exempt(apiPrefix + "/token")
+	apiRouter.HandleFunc("/token", apiAuthController.Token).Methods(http.MethodPost)
+
+	apiClientsRouter := apiRouter.PathPrefix("/clients").Subrouter()
+	apiClientsRouter.Use(server.withAPIAuth)
+	apiClientsController := NewAPIClients(log, server.clients)
+	apiClientsRouter.HandleFunc("", apiClientsController.List).Methods(http.MethodGet)
+	apiClientsRouter.HandleFunc("", apiClientsController.Create).Methods(http.MethodPost)
+	apiClientsRouter.HandleFunc("/{id}", apiClientsController.Get).Methods(http.MethodGet)
+	apiClientsRouter.HandleFunc("/{id}", apiClientsController.Update).Methods(http.MethodPut)
+	apiClientsRouter.HandleFunc("/{id}", apiClientsController.Delete).Methods(http.MethodDelete)
+
+	apiManagersRouter := apiRouter.PathPrefix("/managers").Subrouter()
+	apiManagersRouter.Use(server.withAPIAuth)
+	apiManagersController := NewAPIManagers(log, server.managers)
+	apiManagersRouter.HandleFunc("", apiManagersController.List).Methods(http.MethodGet)
+	apiManagersRouter.Handle("", server.withAPIPermission(managers.PermissionManageManagers, http.HandlerFunc(apiManagersController.Create))).Methods(http.MethodPost)
+	apiManagersRouter.HandleFunc("/{id}", apiManagersController.Get).Methods(http.MethodGet)
+	apiManagersRouter.Handle("/{id}", server.withAPIPermission(managers.PermissionManageManagers, http.HandlerFunc(apiManagersController.Update))).Methods(http.MethodPut)
+	apiManagersRouter.Handle("/{id}", server.withAPIPermission(managers.PermissionManageManagers, http.HandlerFunc(apiManagersController.Delete))).Methods(http.MethodDelete)
 
 	server.server = http.Server{
 		Handler: router,
 	}
 
-	return &server
+	return &server, nil
 }
 
 // Run starts the server that host webapp and api endpoints.
@@ -150,3 +256,53 @@ func (server *Server) withAuth(handler http.Handler) http.Handler {
 		handler.ServeHTTP(w, r.Clone(ctx))
 	})
 }
+
+// withPermission allows request only if authorized manager's role grants the permission.
+func (server *Server) withPermission(permission managers.Permission, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		claims, err := auth.GetClaims(ctx)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		manager, err := server.managers.Get(ctx, claims.ID)
+		if err != nil {
+			server.log.Error("could not get authorized manager", Error.Wrap(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !manager.Role.Can(permission) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// withAuditRequest puts information about request into context, so changes made by managers are attributed in audit log.
+func withAuditRequest(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithRequest(r.Context(), audit.Request{
+			ActorType: audit.ActorManager,
+			IP:        remoteIP(r),
+			UserAgent: r.UserAgent(),
+		})
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// remoteIP returns IP address of the client which sent the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
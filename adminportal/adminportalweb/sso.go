@@ -0,0 +1,72 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"cleanmasters/internal/oidc"
+)
+
+const (
+	// ssoCookieName is a name of cookie which keeps single sign-on request until callback.
+	ssoCookieName = "cleanmasters_sso"
+	// ssoCookiePath limits single sign-on cookie to its endpoints.
+	ssoCookiePath = "/authorize/sso"
+	// ssoCookieDuration is a time given to login at identity provider.
+	ssoCookieDuration = 10 * time.Minute
+)
+
+// setSSOCookie saves single sign-on request in cookie.
+// Lax mode is required, cookie has to be sent with top-level navigation from identity provider.
+func setSSOCookie(w http.ResponseWriter, request oidc.Request) error {
+	value, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     ssoCookiePath,
+		Expires:  time.Now().Add(ssoCookieDuration),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// getSSOCookie returns single sign-on request saved in cookie.
+func getSSOCookie(r *http.Request) (oidc.Request, error) {
+	cookie, err := r.Cookie(ssoCookieName)
+	if err != nil {
+		return oidc.Request{}, err
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return oidc.Request{}, err
+	}
+
+	var request oidc.Request
+	err = json.Unmarshal(value, &request)
+
+	return request, err
+}
+
+// removeSSOCookie removes single sign-on cookie, so request could not be used twice.
+func removeSSOCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    "",
+		Path:     ssoCookiePath,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package adminportalweb
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/clients"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrTrash is an internal error type for trash controller.
+	ErrTrash = errs.Class("trash controller error")
+)
+
+// TrashTemplates holds templates needed for trash controller.
+type TrashTemplates struct {
+	List *template.Template
+}
+
+// Trash is a web api controller.
+// Exposes web views to browse and restore deleted clients and managers.
+type Trash struct {
+	log    logger.Logger
+	config Config
+
+	clients  *clients.Service
+	managers *managers.Service
+
+	templates TrashTemplates
+}
+
+// TrashPage holds data for trash page.
+type TrashPage struct {
+	Clients  []clients.Client
+	Managers []managers.Manager
+}
+
+// NewTrash is a constructor for trash controller.
+func NewTrash(log logger.Logger, config Config, clients *clients.Service, managers *managers.Service) (*Trash, error) {
+	controller := &Trash{
+		log:      log,
+		config:   config,
+		clients:  clients,
+		managers: managers,
+	}
+
+	err := controller.initializeTemplates()
+	if err != nil {
+		return nil, ErrTrash.Wrap(err)
+	}
+
+	return controller, nil
+}
+
+// initializeTemplates initializes and caches templates for trash controller.
+func (controller *Trash) initializeTemplates() (err error) {
+	controller.templates.List, err = parseTemplate(filepath.Join(controller.config.StaticDir, "trash", "list.html"))
+
+	return err
+}
+
+// List is an endpoint that shows deleted clients and managers which are not purged yet.
+func (controller *Trash) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var page TrashPage
+	var err error
+
+	page.Clients, err = controller.clients.ListDeleted(ctx)
+	if err != nil {
+		controller.log.Error("could not list deleted clients", ErrTrash.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page.Managers, err = controller.managers.ListDeleted(ctx)
+	if err != nil {
+		controller.log.Error("could not list deleted managers", ErrTrash.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = executeTemplate(w, r, controller.templates.List, page)
+	if err != nil {
+		controller.log.Error("could not execute trash template", ErrTrash.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// RestoreClient is an endpoint that restores deleted client.
+func (controller *Trash) RestoreClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, ErrTrash.New("id is not valid").Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = controller.clients.Restore(ctx, id)
+	if err != nil {
+		if clients.ErrNotExist.Has(err) {
+			http.NotFound(w, r)
+			return
+		}
+
+		controller.log.Error("could not restore client", ErrTrash.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	controller.redirect(w, r)
+}
+
+// RestoreManager is an endpoint that restores deleted manager.
+func (controller *Trash) RestoreManager(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, ErrTrash.New("id is not valid").Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = controller.managers.Restore(ctx, id)
+	if err != nil {
+		if managers.ErrNoManager.Has(err) {
+			http.NotFound(w, r)
+			return
+		}
+
+		controller.log.Error("could not restore manager", ErrTrash.Wrap(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	controller.redirect(w, r)
+}
+
+// redirect sends manager back to the trash page.
+func (controller *Trash) redirect(w http.ResponseWriter, r *http.Request) {
+	r = r.Clone(r.Context())
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/trash", http.StatusMovedPermanently)
+}
@@ -9,23 +9,46 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/fielderr"
 )
 
 // ErrNoManager special error class that indicates that manager not exist.
 var ErrNoManager = errs.Class("manager does not exist")
 
+// ErrConflict indicates that manager was changed by someone else since it was read.
+var ErrConflict = errs.Class("manager was changed concurrently")
+
+// ErrPermissionDenied indicates that role of the authorized manager does not allow the change.
+var ErrPermissionDenied = errs.Class("permission denied")
+
+// ErrEmailTaken indicates that email is already used by another manager.
+var ErrEmailTaken = fielderr.New("email", fielderr.KindTaken)
+
 // DB exposes methods to manage Managers database.
 //
 // architecture: Database
 type DB interface {
 	// Add is a method for inserting new Manager to the database.
+	// ErrEmailTaken is returned if email is already used by another manager.
 	Add(ctx context.Context, manager Manager) error
-	// Remove is a method for deleting a Manager from the database.
+	// Remove marks manager as deleted, deleted managers are not listed and could not be got until they are restored.
 	Remove(ctx context.Context, id uuid.UUID) error
+	// ListDeleted is used to return deleted managers which are not purged yet, recently deleted first.
+	ListDeleted(ctx context.Context) ([]Manager, error)
+	// Restore makes deleted manager visible again.
+	Restore(ctx context.Context, id uuid.UUID) error
+	// Purge permanently deletes managers which were deleted before the time, ids of purged managers are returned.
+	Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
 	// Update is a method for updating a Manager in the database.
+	// Manager is updated only if it has the same version in the database, version is incremented then.
+	// ErrEmailTaken is returned if email is already used by another manager.
 	Update(ctx context.Context, manager Manager) error
 	// List is used to return all managers.
 	List(ctx context.Context) ([]Manager, error)
+	// Iterate calls fn for every manager ordered by creation time, password hash and second factor secret are not selected.
+	// Managers are streamed without loading all of them in memory, iteration stops on the first error returned by fn.
+	Iterate(ctx context.Context, fn func(Manager) error) error
 	// Get is used to return manager by id.
 	Get(ctx context.Context, id uuid.UUID) (Manager, error)
 	// GetByEmail is used to return manager by email.
@@ -42,7 +65,49 @@ type Manager struct {
 	LastName     string
 	Email        string
 	PasswordHash []byte
+	Role         Role
+	SecondFactor SecondFactor
 	CreatedAt    time.Time
+	// Version is incremented on every update, it detects concurrent changes.
+	Version int64
+	// DeletedAt is set only for deleted managers.
+	DeletedAt *time.Time
+}
+
+// Role defines set of actions available to the manager.
+type Role string
+
+const (
+	// RoleAdmin has full access to the admin portal.
+	RoleAdmin Role = "admin"
+	// RoleManager manages clients and orders.
+	RoleManager Role = "manager"
+	// RoleSupport helps clients with their accounts.
+	RoleSupport Role = "support"
+)
+
+// Roles contains all available roles.
+var Roles = []Role{RoleAdmin, RoleManager, RoleSupport}
+
+// IsValid checks that role is one of known roles.
+func (role Role) IsValid() bool {
+	for _, known := range Roles {
+		if role == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SecondFactor holds TOTP two-factor authentication settings of the manager.
+type SecondFactor struct {
+	// Secret is a shared TOTP secret, it is set during enrollment before confirmation.
+	Secret []byte
+	// Enabled is true when manager confirmed enrollment with valid code.
+	Enabled bool
+	// LastCounter is the last accepted time step, codes from it and earlier steps are rejected.
+	LastCounter int64
 }
 
 // TODO: create IsValid method for Manager and use it in admin service.
@@ -53,4 +118,7 @@ type ManagerUpdateFields struct {
 	LastName  string
 	Email     string
 	Password  string
+	Role      Role
+	// Version is a version of the manager which is updated, it is required.
+	Version int64
 }
@@ -3,6 +3,7 @@ package managers_test
 import (
 	"cleanmasters"
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -12,6 +13,8 @@ import (
 
 	"cleanmasters/adminportal/managers"
 	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/password"
 )
 
 func TestAccounts(t *testing.T) {
@@ -90,6 +93,17 @@ func TestAccounts(t *testing.T) {
 		assert.Equal(t, id, list[1].ID)
 		assert.Equal(t, id2, list[0].ID)
 
+		var iterated []managers.Manager
+		err = repo.Iterate(ctx, func(manager managers.Manager) error {
+			iterated = append(iterated, manager)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, iterated, 2)
+		for _, manager := range iterated {
+			assert.Empty(t, manager.PasswordHash)
+		}
+
 		err = repo.Remove(ctx, id)
 		require.NoError(t, err)
 
@@ -97,3 +111,123 @@ func TestAccounts(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestUpdateConflict(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Managers()
+
+		manager := managers.Manager{ID: uuid.New(), FirstName: "Aslan", Email: "am@qwe.com", PasswordHash: []byte{}, Role: managers.RoleManager, Version: 1}
+		require.NoError(t, repo.Add(ctx, manager))
+
+		first, second := manager, manager
+		first.FirstName = "Baslan"
+		second.Role = managers.RoleAdmin
+
+		require.NoError(t, repo.Update(ctx, first))
+
+		err := repo.Update(ctx, second)
+		require.True(t, managers.ErrConflict.Has(err), err)
+
+		saved, err := repo.Get(ctx, manager.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Baslan", saved.FirstName)
+		assert.Equal(t, managers.RoleManager, saved.Role)
+		assert.EqualValues(t, 2, saved.Version)
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Managers()
+
+		manager := managers.Manager{ID: uuid.New(), FirstName: "Aslan", Email: "am@qwe.com", PasswordHash: []byte{}, Role: managers.RoleManager, Version: 1}
+		require.NoError(t, repo.Add(ctx, manager))
+		require.NoError(t, repo.Remove(ctx, manager.ID))
+
+		_, err := repo.Get(ctx, manager.ID)
+		require.True(t, managers.ErrNoManager.Has(err), err)
+
+		_, err = repo.GetByEmail(ctx, manager.Email)
+		require.True(t, managers.ErrNoManager.Has(err), err)
+
+		deleted, err := repo.ListDeleted(ctx)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, manager.ID, deleted[0].ID)
+
+		require.NoError(t, repo.Restore(ctx, manager.ID))
+		restored, err := repo.Get(ctx, manager.ID)
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+
+		require.NoError(t, repo.Remove(ctx, manager.ID))
+		purged, err := repo.Purge(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{manager.ID}, purged)
+
+		deleted, err = repo.ListDeleted(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+}
+
+func TestEmailTaken(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Managers()
+
+		manager := managers.Manager{ID: uuid.New(), Email: "am@qwe.com", PasswordHash: []byte{}, Role: managers.RoleManager, Version: 1}
+		require.NoError(t, repo.Add(ctx, manager))
+
+		err := repo.Add(ctx, managers.Manager{ID: uuid.New(), Email: "AM@qwe.com", PasswordHash: []byte{}, Role: managers.RoleManager, Version: 1})
+		require.True(t, errors.Is(err, managers.ErrEmailTaken), err)
+
+		// email of deleted manager is free to use.
+		require.NoError(t, repo.Remove(ctx, manager.ID))
+		require.NoError(t, repo.Add(ctx, managers.Manager{ID: uuid.New(), Email: manager.Email, PasswordHash: []byte{}, Role: managers.RoleManager, Version: 1}))
+
+		err = repo.Restore(ctx, manager.ID)
+		require.True(t, errors.Is(err, managers.ErrEmailTaken), err)
+	})
+}
+
+func TestRoleChanges(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := managers.NewService(db.Managers(), password.Policy{}, password.NewHasher(password.HasherConfig{}), cleanmasters.ManagersTransaction(db))
+
+		// the first admin is created by the system without auth claims.
+		admin, err := service.Invite(ctx, "Aslan", "Maslan", "admin@qwe.com", managers.RoleAdmin)
+		require.NoError(t, err)
+
+		adminCtx := auth.SetClaims(ctx, auth.Claims{ID: admin.ID})
+		manager, err := service.Invite(adminCtx, "Baslan", "Haslan", "manager@qwe.com", managers.RoleManager)
+		require.NoError(t, err)
+
+		managerCtx := auth.SetClaims(ctx, auth.Claims{ID: manager.ID})
+		_, err = service.Invite(managerCtx, "Caslan", "Gaslan", "other@qwe.com", managers.RoleAdmin)
+		require.True(t, managers.ErrPermissionDenied.Has(err), err)
+
+		promote := managers.ManagerUpdateFields{FirstName: manager.FirstName, LastName: manager.LastName, Email: manager.Email, Role: managers.RoleAdmin, Version: manager.Version}
+		err = service.Update(managerCtx, manager.ID, promote)
+		require.True(t, managers.ErrPermissionDenied.Has(err), err)
+
+		// fields other than role are changed by the manager itself, but only with version it was read with.
+		rename := promote
+		rename.Role, rename.FirstName, rename.Version = managers.RoleManager, "Daslan", 0
+		err = service.Update(managerCtx, manager.ID, rename)
+		require.True(t, managers.ValidationError.Has(err), err)
+		rename.Version = manager.Version
+		require.NoError(t, service.Update(managerCtx, manager.ID, rename))
+
+		demote := managers.ManagerUpdateFields{FirstName: admin.FirstName, LastName: admin.LastName, Email: admin.Email, Role: managers.RoleManager, Version: admin.Version}
+		err = service.Update(adminCtx, admin.ID, demote)
+		require.True(t, managers.ErrPermissionDenied.Has(err), err)
+
+		promote.Version++
+		require.NoError(t, service.Update(adminCtx, manager.ID, promote))
+
+		saved, err := service.Get(ctx, manager.ID)
+		require.NoError(t, err)
+		assert.Equal(t, managers.RoleAdmin, saved.Role)
+		assert.Equal(t, "Baslan", saved.FirstName)
+	})
+}
@@ -0,0 +1,49 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package managers
+
+// Permission defines single action which requires special rights.
+type Permission string
+
+const (
+	// PermissionManageManagers allows to create, invite, update and delete managers and to grant roles.
+	PermissionManageManagers Permission = "managers:manage"
+	// PermissionUnlockManagers allows to unlock managers locked out after failed logins.
+	PermissionUnlockManagers Permission = "managers:unlock"
+	// PermissionViewAudit allows to view and export audit log.
+	PermissionViewAudit Permission = "audit:view"
+	// PermissionImpersonateClients allows to act on behalf of the client in console.
+	PermissionImpersonateClients Permission = "clients:impersonate"
+	// PermissionManageAPIKeys allows to issue and revoke console API keys.
+	PermissionManageAPIKeys Permission = "api_keys:manage"
+	// PermissionManageTrash allows to view and restore deleted clients and managers.
+	PermissionManageTrash Permission = "trash:manage"
+)
+
+// rolePermissions maps roles to the permissions they grant.
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionManageManagers,
+		PermissionUnlockManagers,
+		PermissionViewAudit,
+		PermissionImpersonateClients,
+		PermissionManageAPIKeys,
+		PermissionManageTrash,
+	},
+	RoleManager: {},
+	RoleSupport: {
+		PermissionImpersonateClients,
+	},
+}
+
+// Can returns true if role grants the permission.
+func (role Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,12 +4,19 @@
 package managers
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zeebo/errs"
-	"golang.org/x/crypto/bcrypt"
+
+	"cleanmasters/audit"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/password"
+	"cleanmasters/internal/spreadsheet"
 )
 
 var (
@@ -19,42 +26,65 @@ var (
 	ValidationError = errs.Class("managers service validation error")
 )
 
+// Transaction runs fn atomically: managers repository and audit service passed to fn share one database transaction,
+// which is committed if fn returns nil and rolled back otherwise. fn could be called several times if transaction is retried.
+type Transaction func(ctx context.Context, fn func(db DB, auditLog *audit.Service) error) error
+
 // Service exposes all managers related functionality.
 //
 // architecture: Service
 type Service struct {
-	db DB
+	db          DB
+	policy      password.Policy
+	hasher      *password.Hasher
+	transaction Transaction
 }
 
 // NewService initializes new instance of managers service.
-func NewService(db DB) *Service {
+// password.DefaultPolicy is used if policy is empty.
+func NewService(db DB, policy password.Policy, hasher *password.Hasher, transaction Transaction) *Service {
+	if policy == (password.Policy{}) {
+		policy = password.DefaultPolicy
+	}
+
 	return &Service{
-		db: db,
+		db:          db,
+		policy:      policy,
+		hasher:      hasher,
+		transaction: transaction,
 	}
 }
 
-// Create is used to create new manager.
-func (service *Service) Create(ctx context.Context, password, firstName, lastName, email string) error {
+// Create is used to create new manager, created manager is returned.
+// ErrPermissionDenied is returned if authorized manager is not allowed to grant roles.
+func (service *Service) Create(ctx context.Context, password, firstName, lastName, email string, role Role) (Manager, error) {
 	// TODO: validate manager
-	if password == "" {
-		return ValidationError.New("password is incorrect")
+	if !role.IsValid() {
+		return Manager{}, ValidationError.New("role %q is unknown", role)
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	id := uuid.New()
+	if err := service.authorizeRoleChange(ctx, id); err != nil {
+		return Manager{}, err
+	}
+
+	passwordHash, err := service.hashPassword(password)
 	if err != nil {
-		return Error.Wrap(err)
+		return Manager{}, err
 	}
 
 	manager := Manager{
-		ID:           uuid.New(),
+		ID:           id,
 		FirstName:    firstName,
 		LastName:     lastName,
 		Email:        email,
 		PasswordHash: passwordHash,
+		Role:         role,
 		CreatedAt:    time.Now().UTC(),
+		Version:      1,
 	}
 
-	return Error.Wrap(service.db.Add(ctx, manager))
+	return manager, service.add(ctx, manager)
 }
 
 // Get returns manager by ID.
@@ -71,20 +101,161 @@ func (service *Service) GetByEmail(ctx context.Context, email string) (Manager,
 	return manager, Error.Wrap(err)
 }
 
-// Update is used to update manager.
-func (service *Service) Update(ctx context.Context, id uuid.UUID, fields ManagerUpdateFields) error {
-	manager, err := service.db.Get(ctx, id)
+// Update is used to update manager, fields.Version is required and ErrConflict is returned
+// if manager was changed after that version. ErrPermissionDenied is returned if role is changed
+// by manager whose role does not allow it or by the manager itself.
+func (service *Service) Update(ctx context.Context, id uuid.UUID, fields ManagerUpdateFields) (err error) {
+	if !fields.Role.IsValid() {
+		return ValidationError.New("role %q is unknown", fields.Role)
+	}
+	if fields.Version <= 0 {
+		return ValidationError.New("version is required")
+	}
+
+	// role read here could be changed concurrently only together with version, so such update fails with conflict.
+	current, err := service.db.Get(ctx, id)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	if current.Role != fields.Role {
+		if err = service.authorizeRoleChange(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	// password is changed only when new one is provided.
+	var passwordHash []byte
+	if fields.Password != "" {
+		passwordHash, err = service.hashPassword(fields.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	return service.modify(ctx, id, fields.Version, func(manager *Manager) {
+		if passwordHash != nil {
+			manager.PasswordHash = passwordHash
+		}
+		manager.LastName = fields.LastName
+		manager.FirstName = fields.FirstName
+		manager.Email = fields.Email
+		manager.Role = fields.Role
+	})
+}
+
+// Invite creates manager without password, manager sets password by following invitation link.
+// ErrPermissionDenied is returned if authorized manager is not allowed to grant roles.
+func (service *Service) Invite(ctx context.Context, firstName, lastName, email string, role Role) (Manager, error) {
+	if email == "" {
+		return Manager{}, ValidationError.New("email is required")
+	}
+	if !role.IsValid() {
+		return Manager{}, ValidationError.New("role %q is unknown", role)
+	}
+
+	id := uuid.New()
+	if err := service.authorizeRoleChange(ctx, id); err != nil {
+		return Manager{}, err
+	}
+
+	manager := Manager{
+		ID:        id,
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		// empty hash never matches any password, so manager could not login until password is set.
+		PasswordHash: []byte{},
+		Role:         role,
+		CreatedAt:    time.Now().UTC(),
+		Version:      1,
+	}
+
+	return manager, service.add(ctx, manager)
+}
+
+// SetPassword replaces password of the manager.
+func (service *Service) SetPassword(ctx context.Context, id uuid.UUID, password string) error {
+	passwordHash, err := service.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return service.modifyLatest(ctx, id, func(manager *Manager) {
+		manager.PasswordHash = passwordHash
+	})
+}
+
+// RehashPassword hashes password with current algorithm and parameters.
+// It is used after successful login, so password policy is not checked.
+func (service *Service) RehashPassword(ctx context.Context, id uuid.UUID, password string) error {
+	passwordHash, err := service.hasher.Hash(password)
 	if err != nil {
 		return Error.Wrap(err)
 	}
 
-	// TODO: generate and check password string in fields.
+	return service.modifyLatest(ctx, id, func(manager *Manager) {
+		manager.PasswordHash = passwordHash
+	})
+}
 
-	manager.LastName = fields.LastName
-	manager.FirstName = fields.FirstName
-	manager.Email = fields.Email
+// SetRole changes role of the manager, it is used to sync roles granted by identity provider.
+func (service *Service) SetRole(ctx context.Context, id uuid.UUID, role Role) error {
+	if !role.IsValid() {
+		return ValidationError.New("role %q is unknown", role)
+	}
 
-	return Error.Wrap(service.db.Update(ctx, manager))
+	return service.modifyLatest(ctx, id, func(manager *Manager) {
+		manager.Role = role
+	})
+}
+
+// authorizeRoleChange checks that manager authorized in context is allowed to grant role to the manager with id.
+// Managers never change their own role. Changes without auth claims are made by the system and are allowed.
+func (service *Service) authorizeRoleChange(ctx context.Context, id uuid.UUID) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return nil
+	}
+
+	if claims.ID == id {
+		return ErrPermissionDenied.New("manager could not change own role")
+	}
+
+	caller, err := service.db.Get(ctx, claims.ID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	if !caller.Role.Can(PermissionManageManagers) {
+		return ErrPermissionDenied.New("role %q does not allow to grant roles", caller.Role)
+	}
+
+	return nil
+}
+
+// ValidatePassword checks that password satisfies password policy.
+func (service *Service) ValidatePassword(password string) error {
+	return ValidationError.Wrap(service.policy.Validate(password))
+}
+
+// hashPassword validates password against policy and hashes it.
+func (service *Service) hashPassword(password string) ([]byte, error) {
+	if err := service.ValidatePassword(password); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := service.hasher.Hash(password)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return passwordHash, nil
+}
+
+// UpdateSecondFactor is used to update two-factor authentication settings of the manager.
+func (service *Service) UpdateSecondFactor(ctx context.Context, id uuid.UUID, secondFactor SecondFactor) error {
+	return service.modifyLatest(ctx, id, func(manager *Manager) {
+		manager.SecondFactor = secondFactor
+	})
 }
 
 // List is used to return all managers.
@@ -94,7 +265,165 @@ func (service *Service) List(ctx context.Context) (result []Manager, err error)
 	return result, Error.Wrap(err)
 }
 
-// Delete will remove manager from DB by id.
+// Export writes all managers as spreadsheet in the format, password hashes and second factor secrets are not exported.
+// Managers are streamed from the database.
+func (service *Service) Export(ctx context.Context, w io.Writer, format spreadsheet.Format) error {
+	writer, err := spreadsheet.NewWriter(format, w)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = writer.WriteRow([]string{"id", "first_name", "last_name", "email", "role", "two_factor", "created_at"})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = service.db.Iterate(ctx, func(manager Manager) error {
+		return writer.WriteRow([]string{
+			manager.ID.String(),
+			manager.FirstName,
+			manager.LastName,
+			manager.Email,
+			string(manager.Role),
+			strconv.FormatBool(manager.SecondFactor.Enabled),
+			manager.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return Error.Wrap(writer.Close())
+}
+
+// Delete moves manager to trash, it could be restored until it is purged.
 func (service *Service) Delete(ctx context.Context, id uuid.UUID) error {
-	return Error.Wrap(service.db.Remove(ctx, id))
+	return Error.Wrap(service.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		manager, err := db.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		err = db.Remove(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return record(ctx, auditLog, audit.ActionDelete, manager, Manager{ID: id})
+	}))
+}
+
+// ListDeleted returns managers in trash, recently deleted first.
+func (service *Service) ListDeleted(ctx context.Context) ([]Manager, error) {
+	list, err := service.db.ListDeleted(ctx)
+
+	return list, Error.Wrap(err)
+}
+
+// Restore moves manager back from trash.
+func (service *Service) Restore(ctx context.Context, id uuid.UUID) error {
+	return Error.Wrap(service.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		err := db.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		manager, err := db.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return record(ctx, auditLog, audit.ActionRestore, Manager{}, manager)
+	}))
+}
+
+// Purge permanently deletes managers which are in trash since before the time, number of purged managers is returned.
+func (service *Service) Purge(ctx context.Context, deletedBefore time.Time) (purged int, err error) {
+	err = service.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		ids, err := db.Purge(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err = auditLog.Record(ctx, audit.ActionPurge, audit.EntityManager, id, nil); err != nil {
+				return err
+			}
+		}
+
+		purged = len(ids)
+		return nil
+	})
+
+	return purged, Error.Wrap(err)
+}
+
+// add saves new manager and records it in audit log in a single transaction.
+func (service *Service) add(ctx context.Context, manager Manager) error {
+	return Error.Wrap(service.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		if err := db.Add(ctx, manager); err != nil {
+			return err
+		}
+
+		return record(ctx, auditLog, audit.ActionCreate, Manager{}, manager)
+	}))
+}
+
+// modifyLatest applies change to the latest version of the manager. It is used by system writes of fields
+// which are not edited in manager form, like password hash, second factor and role synced from identity provider.
+func (service *Service) modifyLatest(ctx context.Context, id uuid.UUID, change func(manager *Manager)) error {
+	return service.modify(ctx, id, 0, change)
+}
+
+// modify reads manager, applies change to it, saves it and records changes in audit log in a single transaction,
+// so concurrent changes of other fields are not lost. ErrConflict is returned if version is not zero and
+// manager was changed after that version, zero version is passed only by modifyLatest.
+func (service *Service) modify(ctx context.Context, id uuid.UUID, version int64, change func(manager *Manager)) error {
+	return Error.Wrap(service.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		manager, err := db.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != manager.Version {
+			return ErrConflict.New("version %d is changed to %d", version, manager.Version)
+		}
+		before := manager
+
+		change(&manager)
+
+		err = db.Update(ctx, manager)
+		if err != nil {
+			return err
+		}
+
+		return record(ctx, auditLog, audit.ActionUpdate, before, manager)
+	}))
+}
+
+// auditFields lists manager fields recorded in audit log.
+var auditFields = []string{"email", "first_name", "last_name", "role", "two_factor_enabled"}
+
+// record writes changes of the manager to audit log.
+// Secrets are never recorded, password change is recorded without values.
+func record(ctx context.Context, auditLog *audit.Service, action audit.Action, before, after Manager) error {
+	fields := func(manager Manager) map[string]string {
+		if manager.Email == "" {
+			return map[string]string{}
+		}
+
+		return map[string]string{
+			"email":              manager.Email,
+			"first_name":         manager.FirstName,
+			"last_name":          manager.LastName,
+			"role":               string(manager.Role),
+			"two_factor_enabled": strconv.FormatBool(manager.SecondFactor.Enabled),
+		}
+	}
+
+	changes := audit.Diff(auditFields, fields(before), fields(after))
+	if action == audit.ActionUpdate && !bytes.Equal(before.PasswordHash, after.PasswordHash) {
+		changes = append(changes, audit.Change{Field: "password", Before: "[redacted]", After: "[redacted]"})
+	}
+
+	return Error.Wrap(auditLog.Record(ctx, action, audit.EntityManager, after.ID, changes))
 }
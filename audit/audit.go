@@ -0,0 +1,168 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DB exposes methods to manage audit log database.
+// Audit log is append-only, entries could not be changed or removed.
+//
+// architecture: Database
+type DB interface {
+	// Append links entry to the last entry of the chain, calculates its hash and saves it.
+	// Appends are serialized, so the chain does not fork.
+	Append(ctx context.Context, entry Entry) (Entry, error)
+	// List returns entries which match the filter ordered by sequence number, newest first.
+	List(ctx context.Context, filter Filter) ([]Entry, error)
+	// Chain returns all entries ordered by sequence number, oldest first.
+	Chain(ctx context.Context) ([]Entry, error)
+}
+
+// Action describes what was done with the entity.
+type Action string
+
+const (
+	// ActionCreate is recorded when entity is created.
+	ActionCreate Action = "create"
+	// ActionUpdate is recorded when entity is updated.
+	ActionUpdate Action = "update"
+	// ActionDelete is recorded when entity is deleted.
+	ActionDelete Action = "delete"
+	// ActionRestore is recorded when deleted entity is restored.
+	ActionRestore Action = "restore"
+	// ActionPurge is recorded when deleted entity is permanently deleted after retention period.
+	ActionPurge Action = "purge"
+	// ActionImpersonate is recorded when manager starts acting on behalf of the client.
+	ActionImpersonate Action = "impersonate"
+)
+
+// Entity types which changes are recorded.
+const (
+	EntityClient  = "client"
+	EntityManager = "manager"
+	EntityAPIKey  = "api_key"
+)
+
+// Actor types.
+const (
+	// ActorManager is a manager authorized in admin portal.
+	ActorManager = "manager"
+	// ActorClient is a client authorized in console.
+	ActorClient = "client"
+	// ActorSystem is recorded when change is not made by authorized user, e.g. by cli.
+	ActorSystem = "system"
+	// ActorAPIKey is a service which calls console with API key.
+	ActorAPIKey = "api_key"
+)
+
+// Entry is a single record of audit log.
+type Entry struct {
+	// Sequence is a position of the entry in the chain, it is assigned on append.
+	Sequence   int64
+	ID         uuid.UUID
+	ActorID    uuid.UUID
+	ActorType  string
+	Action     Action
+	EntityType string
+	EntityID   string
+	Changes    []Change
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	// PrevHash is a hash of the previous entry, empty for the first entry.
+	PrevHash []byte
+	// Hash covers all fields of the entry and PrevHash, so changing any entry breaks the chain.
+	Hash []byte
+}
+
+// Change holds value of the field before and after the action.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Filter defines which entries are listed, zero fields match everything.
+type Filter struct {
+	ActorID    uuid.UUID
+	Action     Action
+	EntityType string
+	EntityID   string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// CalculateHash returns hash of the entry linked to PrevHash.
+func (entry Entry) CalculateHash() []byte {
+	changes, _ := json.Marshal(entry.Changes)
+
+	hash := sha256.New()
+	var sequence [8]byte
+	binary.BigEndian.PutUint64(sequence[:], uint64(entry.Sequence))
+
+	for _, field := range [][]byte{
+		entry.PrevHash,
+		sequence[:],
+		entry.ID[:],
+		entry.ActorID[:],
+		[]byte(entry.ActorType),
+		[]byte(entry.Action),
+		[]byte(entry.EntityType),
+		[]byte(entry.EntityID),
+		changes,
+		[]byte(entry.IP),
+		[]byte(entry.UserAgent),
+		[]byte(entry.CreatedAt.UTC().Format(time.RFC3339Nano)),
+	} {
+		// length prefix keeps boundaries between fields unambiguous.
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+		_, _ = hash.Write(length[:])
+		_, _ = hash.Write(field)
+	}
+
+	return hash.Sum(nil)
+}
+
+// Diff returns changed fields, fields are compared in order of the keys.
+func Diff(keys []string, before, after map[string]string) []Change {
+	var changes []Change
+	for _, key := range keys {
+		if before[key] != after[key] {
+			changes = append(changes, Change{Field: key, Before: before[key], After: after[key]})
+		}
+	}
+
+	return changes
+}
+
+// Request holds information about request in which change was made.
+type Request struct {
+	ActorType string
+	IP        string
+	UserAgent string
+}
+
+// requestKey is a context key for Request.
+type requestKey struct{}
+
+// WithRequest returns context with information about request.
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// GetRequest returns information about request from context.
+func GetRequest(ctx context.Context) (Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(Request)
+	return request, ok
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/audit"
+	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/auth"
+)
+
+func TestAuditLog(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := audit.NewService(db.Audit())
+
+		managerID, clientID := uuid.New(), uuid.New()
+
+		ctx = audit.WithRequest(ctx, audit.Request{ActorType: audit.ActorManager, IP: "127.0.0.1", UserAgent: "test"})
+		managerCtx := auth.SetClaims(ctx, auth.Claims{ID: managerID})
+
+		require.NoError(t, service.Record(managerCtx, audit.ActionCreate, audit.EntityClient, clientID, []audit.Change{
+			{Field: "phone", After: "0930000000"},
+		}))
+		require.NoError(t, service.Record(managerCtx, audit.ActionUpdate, audit.EntityClient, clientID, nil))
+		require.NoError(t, service.Record(ctx, audit.ActionDelete, audit.EntityClient, clientID, []audit.Change{
+			{Field: "phone", Before: "0930000000"},
+		}))
+
+		entries, err := service.List(ctx, audit.Filter{EntityType: audit.EntityClient, EntityID: clientID.String()})
+		require.NoError(t, err)
+		require.Len(t, entries, 2, "update without changes is not recorded")
+
+		assert.Equal(t, int64(2), entries[0].Sequence)
+		assert.Equal(t, audit.ActionDelete, entries[0].Action)
+		assert.Equal(t, audit.ActorSystem, entries[0].ActorType)
+		assert.Equal(t, entries[1].Hash, entries[0].PrevHash)
+
+		assert.Equal(t, managerID, entries[1].ActorID)
+		assert.Equal(t, audit.ActorManager, entries[1].ActorType)
+		assert.Equal(t, "127.0.0.1", entries[1].IP)
+		assert.Equal(t, []audit.Change{{Field: "phone", After: "0930000000"}}, entries[1].Changes)
+
+		entries, err = service.List(ctx, audit.Filter{ActorID: managerID, From: time.Now().Add(-time.Hour)})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		require.NoError(t, service.Verify(ctx))
+	})
+}
+
+func TestRecordWithoutRequest(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := audit.NewService(db.Audit())
+
+		managerID, clientID := uuid.New(), uuid.New()
+		require.NoError(t, service.Record(auth.SetClaims(ctx, auth.Claims{ID: managerID}), audit.ActionDelete, audit.EntityClient, clientID, nil))
+
+		entries, err := service.List(ctx, audit.Filter{EntityType: audit.EntityClient, EntityID: clientID.String()})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, managerID, entries[0].ActorID)
+		assert.Equal(t, audit.ActorSystem, entries[0].ActorType)
+	})
+}
+
+func TestCalculateHash(t *testing.T) {
+	entry := audit.Entry{
+		Sequence:   1,
+		ID:         uuid.New(),
+		Action:     audit.ActionUpdate,
+		EntityType: audit.EntityClient,
+		EntityID:   uuid.New().String(),
+		Changes:    []audit.Change{{Field: "email", Before: "a@b.c", After: "b@c.d"}},
+		CreatedAt:  time.Now(),
+	}
+
+	hash := entry.CalculateHash()
+	assert.Equal(t, hash, entry.CalculateHash())
+
+	tampered := entry
+	tampered.Changes = []audit.Change{{Field: "email", Before: "a@b.c", After: "x@c.d"}}
+	assert.NotEqual(t, hash, tampered.CalculateHash())
+
+	relinked := entry
+	relinked.PrevHash = []byte("other")
+	assert.NotEqual(t, hash, relinked.CalculateHash())
+}
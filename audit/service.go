@@ -0,0 +1,155 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/spreadsheet"
+)
+
+var (
+	// Error is an internal error for audit service.
+	Error = errs.Class("audit service error")
+	// ErrBrokenChain indicates that audit log was tampered with.
+	ErrBrokenChain = errs.Class("audit log chain is broken")
+)
+
+// Service records changes made by managers and clients.
+//
+// architecture: Service
+type Service struct {
+	db DB
+}
+
+// NewService is a constructor for audit service.
+func NewService(db DB) *Service {
+	return &Service{
+		db: db,
+	}
+}
+
+// Record appends entry to audit log. Actor is taken from auth claims and
+// request information from context, entry is attributed to system if there are no claims
+// or request does not tell which kind of actor the claims belong to.
+// Updates without changes are not recorded.
+func (service *Service) Record(ctx context.Context, action Action, entityType string, entityID uuid.UUID, changes []Change) error {
+	if action == ActionUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	entry := Entry{
+		ID:         uuid.New(),
+		ActorType:  ActorSystem,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID.String(),
+		Changes:    changes,
+		// database keeps microseconds, hash has to be calculated from the same value.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	request, ok := GetRequest(ctx)
+	if ok {
+		entry.IP, entry.UserAgent = request.IP, request.UserAgent
+	}
+
+	if claims, err := auth.GetClaims(ctx); err == nil {
+		entry.ActorID = claims.ID
+		if ok && request.ActorType != "" {
+			entry.ActorType = request.ActorType
+		}
+
+		// changes made under impersonation are attributed to the manager, not to the client.
+		if claims.IsImpersonation() {
+			entry.ActorID = claims.ImpersonatorID
+			entry.ActorType = ActorManager
+		}
+		if claims.APIKeyID != uuid.Nil {
+			entry.ActorID = claims.APIKeyID
+			entry.ActorType = ActorAPIKey
+		}
+	}
+
+	_, err := service.db.Append(ctx, entry)
+
+	return Error.Wrap(err)
+}
+
+// List returns entries which match the filter, newest first.
+func (service *Service) List(ctx context.Context, filter Filter) ([]Entry, error) {
+	entries, err := service.db.List(ctx, filter)
+	return entries, Error.Wrap(err)
+}
+
+// Verify recalculates hashes of all entries and returns ErrBrokenChain
+// with sequence number of the first entry which does not match.
+func (service *Service) Verify(ctx context.Context) error {
+	entries, err := service.db.Chain(ctx)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	var prevHash []byte
+	for _, entry := range entries {
+		if !bytes.Equal(entry.PrevHash, prevHash) || !bytes.Equal(entry.Hash, entry.CalculateHash()) {
+			return ErrBrokenChain.New("entry %d does not match", entry.Sequence)
+		}
+
+		prevHash = entry.Hash
+	}
+
+	return nil
+}
+
+// ExportCSV writes entries which match the filter in csv format, cells which look like formulas are escaped.
+func (service *Service) ExportCSV(ctx context.Context, w io.Writer, filter Filter) error {
+	entries, err := service.db.List(ctx, filter)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	writer := spreadsheet.NewCSVWriter(w)
+
+	err = writer.WriteRow([]string{"sequence", "created_at", "actor_type", "actor_id", "action", "entity_type", "entity_id", "changes", "ip", "user_agent", "hash"})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+
+		err = writer.WriteRow([]string{
+			strconv.FormatInt(entry.Sequence, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+			entry.ActorType,
+			entry.ActorID.String(),
+			string(entry.Action),
+			entry.EntityType,
+			entry.EntityID,
+			string(changes),
+			entry.IP,
+			entry.UserAgent,
+			hex.EncodeToString(entry.Hash),
+		})
+		if err != nil {
+			return Error.Wrap(err)
+		}
+	}
+
+	return Error.Wrap(writer.Close())
+}
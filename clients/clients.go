@@ -9,11 +9,21 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/fielderr"
 )
 
 var (
 	// ErrNotExist indicates that client is not exist in database.
 	ErrNotExist = errs.Class("client does not exist")
+	// ErrConflict indicates that client was changed by someone else since it was read.
+	ErrConflict = errs.Class("client was changed concurrently")
+	// ErrVersionRequired indicates that client is updated without version it was read with.
+	ErrVersionRequired = errs.Class("client version is required")
+	// ErrPhoneTaken indicates that phone is already used by another client.
+	ErrPhoneTaken = fielderr.New("phone", fielderr.KindTaken)
+	// ErrEmailTaken indicates that email is already used by another client.
+	ErrEmailTaken = fielderr.New("email", fielderr.KindTaken)
 )
 
 // DB exposes methods to manage Clients database.
@@ -21,19 +31,49 @@ var (
 // architecture: Database
 type DB interface {
 	// Add is a method for inserting new Client to the database.
+	// ErrPhoneTaken or ErrEmailTaken is returned if contact is already used by another client.
 	Add(ctx context.Context, client Client) error
 	// Register is a method for inserting new Client to the database.
 	Register(ctx context.Context, phone string) (uuid.UUID, error)
 	// Update is a method for updating a Client in the database.
+	// Client is updated only if it has the same version in the database, version is incremented then.
+	// ErrPhoneTaken or ErrEmailTaken is returned if contact is already used by another client.
+	// Email verification is reset if email is changed.
 	Update(ctx context.Context, client Client) error
-	// List is used to return all clients.
-	List(ctx context.Context) ([]Client, error)
+	// List is used to return at most query.Limit clients which match the filter, in query order.
+	// Clients right after the cursor are returned, or right before it if cursor is backward.
+	List(ctx context.Context, query ListQuery) ([]Client, error)
+	// Iterate calls fn for every client which matches the filter, in query order, cursor and limit are ignored.
+	// Clients are streamed without loading all of them in memory, iteration stops on the first error returned by fn.
+	Iterate(ctx context.Context, query ListQuery, fn func(Client) error) error
+	// Search is used to return at most limit clients which match the query, most relevant first.
+	Search(ctx context.Context, query SearchQuery, limit int) ([]SearchResult, error)
+	// ListByContacts is used to return clients which have one of the phones, compared by digits,
+	// or, case-insensitively, one of the emails.
+	ListByContacts(ctx context.Context, phones, emails []string) ([]Client, error)
 	// Get is used to return Client by id.
 	Get(ctx context.Context, id uuid.UUID) (Client, error)
 	// GetByPhone is used to return Client by phone number.
 	GetByPhone(ctx context.Context, phone string) (Client, error)
-	// Delete deletes specified client.
+	// GetByEmail is used to return Client by email, emails are compared in normalized form.
+	GetByEmail(ctx context.Context, email string) (Client, error)
+	// Delete marks client as deleted, deleted clients are not listed and could not be got until they are restored.
 	Delete(ctx context.Context, id uuid.UUID) error
+	// ListDeleted is used to return deleted clients which are not purged yet, recently deleted first.
+	ListDeleted(ctx context.Context) ([]Client, error)
+	// Restore makes deleted client visible again.
+	Restore(ctx context.Context, id uuid.UUID) error
+	// Purge permanently deletes clients which were deleted before the time, ids of purged clients are returned.
+	Purge(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
+
+	// SetEmailVerification saves email verification, pending verification of the client is replaced.
+	SetEmailVerification(ctx context.Context, verification EmailVerification) error
+	// GetEmailVerification returns pending email verification of the client, returns ErrNoEmailVerification if there is none.
+	GetEmailVerification(ctx context.Context, clientID uuid.UUID) (EmailVerification, error)
+	// AddEmailVerificationAttempt increments number of wrong codes entered for pending email verification.
+	AddEmailVerificationAttempt(ctx context.Context, clientID uuid.UUID) error
+	// VerifyEmail marks current email of the client as verified and removes pending email verification.
+	VerifyEmail(ctx context.Context, clientID uuid.UUID, verifiedAt time.Time) error
 }
 
 // Client describes cleanmasters client.
@@ -44,6 +84,12 @@ type Client struct {
 	FirstName string
 	LastName  string
 	CreatedAt time.Time
+	// Version is incremented on every update, it detects concurrent changes.
+	Version int64
+	// DeletedAt is set only for deleted clients.
+	DeletedAt *time.Time
+	// EmailVerifiedAt is set if current email is verified, it is loaded only with single client.
+	EmailVerifiedAt *time.Time
 }
 
 // ClientUpdateFields contains all fields that could be updated in Client entity.
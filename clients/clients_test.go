@@ -2,7 +2,10 @@ package clients_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -11,6 +14,9 @@ import (
 	"cleanmasters"
 	"cleanmasters/clients"
 	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/fielderr"
+	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/internal/mail"
 )
 
 func TestAccounts(t *testing.T) {
@@ -78,11 +84,39 @@ func TestAccounts(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, clientCheck.ID, id1)
 
-		list, err := repo.List(ctx)
+		list, err := repo.List(ctx, clients.ListQuery{Sort: clients.SortByPhone, Limit: 10})
 		require.NoError(t, err)
-		assert.NotNil(t, list)
+		require.Len(t, list, 3)
 		assert.Equal(t, id1, list[2].ID)
 
+		list, err = repo.List(ctx, clients.ListQuery{Sort: clients.SortByPhone, Limit: 10, Filter: clients.ListFilter{Email: clients.EmailMissing}})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, id, list[0].ID)
+
+		var phones []string
+		err = repo.Iterate(ctx, clients.ListQuery{Sort: clients.SortByPhone, Desc: true, Limit: 1}, func(client clients.Client) error {
+			phones = append(phones, client.Phone)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"5051228", "228", "14882288"}, phones)
+
+		results, err := repo.Search(ctx, clients.NewSearchQuery("maslanowich"), 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		assert.Equal(t, id1, results[0].ID)
+
+		results, err = repo.Search(ctx, clients.NewSearchQuery("8822"), 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, id2, results[0].ID)
+
+		results, err = repo.Search(ctx, clients.NewSearchQuery("bh@q"), 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		assert.Equal(t, id2, results[0].ID)
+
 		err = repo.Delete(ctx, id1)
 		require.NoError(t, err)
 
@@ -90,3 +124,269 @@ func TestAccounts(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestUpdateConflict(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Clients()
+
+		client := clients.Client{ID: uuid.New(), Phone: "380501112233", FirstName: "Aslan", Version: 1}
+		require.NoError(t, repo.Add(ctx, client))
+
+		first, second := client, client
+		first.FirstName = "Baslan"
+		second.LastName = "Maslan"
+
+		require.NoError(t, repo.Update(ctx, first))
+
+		err := repo.Update(ctx, second)
+		require.True(t, clients.ErrConflict.Has(err), err)
+
+		saved, err := repo.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Baslan", saved.FirstName)
+		assert.Equal(t, "", saved.LastName)
+		assert.EqualValues(t, 2, saved.Version)
+
+		// changes are applied again on top of the saved version.
+		second.Version = saved.Version
+		require.NoError(t, repo.Update(ctx, second))
+
+		err = repo.Update(ctx, clients.Client{ID: uuid.New(), Version: 1})
+		require.True(t, clients.ErrNotExist.Has(err), err)
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Clients()
+
+		client := clients.Client{ID: uuid.New(), Phone: "380501112233", FirstName: "Aslan", Version: 1}
+		require.NoError(t, repo.Add(ctx, client))
+		require.NoError(t, repo.Delete(ctx, client.ID))
+
+		_, err := repo.Get(ctx, client.ID)
+		require.True(t, clients.ErrNotExist.Has(err), err)
+
+		err = repo.Delete(ctx, client.ID)
+		require.True(t, clients.ErrNotExist.Has(err), err)
+
+		deleted, err := repo.ListDeleted(ctx)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, client.ID, deleted[0].ID)
+		require.NotNil(t, deleted[0].DeletedAt)
+
+		// phone of deleted client is free to use.
+		other := clients.Client{ID: uuid.New(), Phone: client.Phone, Version: 1}
+		require.NoError(t, repo.Add(ctx, other))
+		require.NoError(t, repo.Delete(ctx, other.ID))
+
+		require.NoError(t, repo.Restore(ctx, client.ID))
+		restored, err := repo.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		assert.EqualValues(t, 2, restored.Version)
+
+		purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, purged)
+
+		purged, err = repo.Purge(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{other.ID}, purged)
+
+		err = repo.Restore(ctx, other.ID)
+		require.True(t, clients.ErrNotExist.Has(err), err)
+	})
+}
+
+func TestUpdateVersionRequired(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db))
+
+		client, err := service.Create(ctx, "am@qwe.com", "0930000000", "Aslan", "Maslan")
+		require.NoError(t, err)
+
+		client.FirstName, client.Version = "Baslan", 0
+		err = service.Update(ctx, client)
+		require.True(t, clients.ErrVersionRequired.Has(err), err)
+
+		client.Version = 1
+		require.NoError(t, service.Update(ctx, client))
+
+		// client updates own account without version.
+		client.FirstName, client.Version = "Caslan", 0
+		require.NoError(t, service.UpdatePersonalData(ctx, client))
+
+		saved, err := service.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Caslan", saved.FirstName)
+		assert.EqualValues(t, 3, saved.Version)
+	})
+}
+
+func TestPhoneTaken(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Clients()
+
+		client := clients.Client{ID: uuid.New(), Phone: "380501112233", Version: 1}
+		require.NoError(t, repo.Add(ctx, client))
+
+		err := repo.Add(ctx, clients.Client{ID: uuid.New(), Phone: client.Phone, Version: 1})
+		require.True(t, errors.Is(err, clients.ErrPhoneTaken), err)
+
+		_, err = repo.Register(ctx, client.Phone)
+		require.True(t, errors.Is(err, clients.ErrPhoneTaken), err)
+
+		other := clients.Client{ID: uuid.New(), Phone: "380501112244", Version: 1}
+		require.NoError(t, repo.Add(ctx, other))
+
+		other.Phone = client.Phone
+		err = repo.Update(ctx, other)
+		require.True(t, errors.Is(err, clients.ErrPhoneTaken), err)
+
+		fieldErr, ok := fielderr.As(err)
+		require.True(t, ok)
+		assert.Equal(t, "phone", fieldErr.Field)
+	})
+}
+
+func TestSearchFormattedPhone(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Clients()
+
+		client := clients.Client{ID: uuid.New(), Phone: "+1 (555) 123-4567", FirstName: "Aslan", Version: 1}
+		require.NoError(t, repo.Add(ctx, client))
+
+		results, err := repo.Search(ctx, clients.NewSearchQuery("555-1234"), 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, client.ID, results[0].ID)
+		assert.Equal(t, client.Phone, results[0].Phone)
+
+		results, err = repo.Search(ctx, clients.NewSearchQuery("1234567"), 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, 1.0, results[0].Rank)
+	})
+}
+
+func TestGetByEmail(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.Clients()
+
+		client := clients.Client{ID: uuid.New(), Phone: "380501112233", Email: "Aslan@Qwe.com", Version: 1}
+		require.NoError(t, repo.Add(ctx, client))
+
+		found, err := repo.GetByEmail(ctx, " aslan@qwe.COM")
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, found.ID)
+		assert.Equal(t, client.Email, found.Email)
+
+		err = repo.Add(ctx, clients.Client{ID: uuid.New(), Phone: "380501112244", Email: "ASLAN@qwe.com", Version: 1})
+		require.True(t, errors.Is(err, clients.ErrEmailTaken), err)
+
+		// clients without email do not conflict.
+		require.NoError(t, repo.Add(ctx, clients.Client{ID: uuid.New(), Phone: "380501112255", Version: 1}))
+		_, err = repo.Register(ctx, "380501112266")
+		require.NoError(t, err)
+
+		_, err = repo.GetByEmail(ctx, "")
+		require.True(t, clients.ErrNotExist.Has(err), err)
+
+		list, err := repo.ListByContacts(ctx, nil, []string{"ASLAN@QWE.COM"})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, client.ID, list[0].ID)
+	})
+}
+
+func TestListPages(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db))
+
+		// last names repeat, so clients with equal sort keys are ordered by the rest of the key.
+		lastNames := []string{"Maslan", "Haslan", "Maslan", "Baslan", "Haslan"}
+		withEmail := map[uuid.UUID]bool{}
+		for i := 0; i < 11; i++ {
+			client := clients.Client{
+				ID:        uuid.New(),
+				Phone:     fmt.Sprintf("38050%07d", (i*7)%11),
+				FirstName: fmt.Sprintf("Aslan%d", i%3),
+				LastName:  lastNames[i%len(lastNames)],
+				Version:   1,
+			}
+			// every third client has no email and is filtered out.
+			if i%3 != 0 {
+				client.Email = fmt.Sprintf("client%d@qwe.com", i)
+				withEmail[client.ID] = true
+			}
+			require.NoError(t, db.Clients().Add(ctx, client))
+		}
+
+		for _, sort := range clients.SortFields {
+			for _, desc := range []bool{false, true} {
+				query := clients.ListQuery{Filter: clients.ListFilter{Email: clients.EmailPresent}, Sort: sort, Desc: desc, Limit: 3}
+
+				var forward []clients.Page
+				seen := map[uuid.UUID]int{}
+				for cursor := (*clients.Cursor)(nil); ; {
+					query.Cursor = cursor
+					page, err := service.List(ctx, query)
+					require.NoError(t, err)
+					if len(forward) == 0 {
+						require.Nil(t, page.Prev, "%s desc=%t", sort, desc)
+					} else {
+						require.NotNil(t, page.Prev, "%s desc=%t", sort, desc)
+					}
+					for _, client := range page.Clients {
+						seen[client.ID]++
+					}
+					forward = append(forward, page)
+
+					if page.Next == nil {
+						break
+					}
+					require.Less(t, len(forward), len(withEmail), "%s desc=%t pages do not end", sort, desc)
+					cursor = page.Next
+				}
+
+				require.Len(t, seen, len(withEmail), "%s desc=%t", sort, desc)
+				for id, count := range seen {
+					assert.True(t, withEmail[id], "%s desc=%t: client without email is listed", sort, desc)
+					assert.Equal(t, 1, count, "%s desc=%t: client is listed %d times", sort, desc, count)
+				}
+				require.Len(t, forward, 3, "%s desc=%t", sort, desc)
+
+				// pages got backward from the last one are the same as pages got forward.
+				for i := len(forward) - 1; i > 0; i-- {
+					query.Cursor = forward[i].Prev
+					page, err := service.List(ctx, query)
+					require.NoError(t, err)
+					assert.Equal(t, ids(forward[i-1].Clients), ids(page.Clients), "%s desc=%t page %d", sort, desc, i-1)
+					require.NotNil(t, page.Next, "%s desc=%t page %d", sort, desc, i-1)
+					if i-1 == 0 {
+						assert.Nil(t, page.Prev, "%s desc=%t", sort, desc)
+					} else {
+						assert.NotNil(t, page.Prev, "%s desc=%t page %d", sort, desc, i-1)
+					}
+
+					query.Cursor = page.Next
+					next, err := service.List(ctx, query)
+					require.NoError(t, err)
+					assert.Equal(t, ids(forward[i].Clients), ids(next.Clients), "%s desc=%t page %d", sort, desc, i)
+				}
+			}
+		}
+	})
+}
+
+// ids returns ids of the clients in the same order.
+func ids(list []clients.Client) []uuid.UUID {
+	result := make([]uuid.UUID, 0, len(list))
+	for _, client := range list {
+		result = append(result, client.ID)
+	}
+
+	return result
+}
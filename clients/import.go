@@ -0,0 +1,379 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	netmail "net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+	"cleanmasters/internal/mail"
+)
+
+// ErrImport indicates that import file could not be processed at all, e.g. it has no phone column.
+var ErrImport = errs.Class("clients import error")
+
+const (
+	// DefaultImportBatchSize is a number of rows written in one transaction if batch size is not specified.
+	DefaultImportBatchSize = 500
+	// maxNameLength is a maximal length of imported first and last names in characters.
+	maxNameLength = 100
+)
+
+// Import fields which could be mapped to file columns.
+const (
+	FieldPhone     = "phone"
+	FieldEmail     = "email"
+	FieldFirstName = "first_name"
+	FieldLastName  = "last_name"
+)
+
+// ImportFields contains all fields which could be imported, phone is required.
+var ImportFields = []string{FieldPhone, FieldEmail, FieldFirstName, FieldLastName}
+
+// phonePattern matches normalized phone number: optional plus and 7 to 15 digits.
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// ColumnMapping maps import fields to column headers of the file.
+// Fields which are not mapped are read from columns named as the field.
+type ColumnMapping map[string]string
+
+// ParseColumnMapping parses mapping in "field=Column,field=Column" format.
+func ParseColumnMapping(value string) (ColumnMapping, error) {
+	mapping := ColumnMapping{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, ErrImport.New("mapping %q has to be in field=column format", pair)
+		}
+
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return mapping, nil
+}
+
+// ImportOptions defines how import file is read and written.
+type ImportOptions struct {
+	Mapping ColumnMapping
+	// DryRun validates the file and reports what would be changed without writing anything.
+	DryRun bool
+	// BatchSize is a number of rows written in one transaction.
+	BatchSize int
+}
+
+// ImportRowError describes why the row of import file was skipped.
+type ImportRowError struct {
+	// Row is a line number in the file, header is the first line.
+	Row     int
+	Field   string
+	Message string
+}
+
+// ImportReport holds result of the import.
+// Counts of dry run are the changes which would be made by the real import.
+type ImportReport struct {
+	DryRun  bool
+	Created int
+	Updated int
+	// Skipped counts rows which are not valid or do not change existing clients.
+	Skipped int
+	Errors  []ImportRowError
+}
+
+// importRow is a validated row of import file.
+type importRow struct {
+	line   int
+	client Client
+}
+
+// Import reads clients from csv file, phone identifies the client: clients with new phones are created,
+// existing ones are updated with non-empty cells. Rows are written in batches, each batch in a single transaction.
+// On the first failed batch import stops, report keeps counts of batches written before.
+func (clients *Service) Import(ctx context.Context, r io.Reader, options ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: options.DryRun}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return report, ErrImport.New("file is empty")
+		}
+		return report, ErrImport.Wrap(err)
+	}
+
+	columns, err := options.Mapping.columns(header)
+	if err != nil {
+		return report, err
+	}
+
+	// phones and emails seen in previous rows, to report duplicates within the file,
+	// phones are keyed by digits and emails in normalized form.
+	seenPhones, seenEmails := map[string]int{}, map[string]int{}
+
+	var batch []importRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return report, ErrImport.Wrap(err)
+			}
+			report.skip(line, "", parseErr.Err.Error())
+			continue
+		}
+
+		row, rowErr := parseImportRow(line, record, columns)
+		phone, email := PhoneDigits(row.client.Phone), mail.NormalizeAddress(row.client.Email)
+		switch {
+		case rowErr != nil:
+			report.skip(line, rowErr.Field, rowErr.Message)
+			continue
+		case seenPhones[phone] != 0:
+			report.skip(line, FieldPhone, "phone is duplicated in row "+strconv.Itoa(seenPhones[phone]))
+			continue
+		case email != "" && seenEmails[email] != 0:
+			report.skip(line, FieldEmail, "email is duplicated in row "+strconv.Itoa(seenEmails[email]))
+			continue
+		}
+
+		seenPhones[phone] = line
+		if email != "" {
+			seenEmails[email] = line
+		}
+
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			if err = clients.importBatch(ctx, batch, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err = clients.importBatch(ctx, batch, &report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// importBatch checks rows against existing clients and writes them in a single transaction unless it is a dry run.
+func (clients *Service) importBatch(ctx context.Context, batch []importRow, report *ImportReport) error {
+	phones := make([]string, 0, len(batch))
+	emails := make([]string, 0, len(batch))
+	for _, row := range batch {
+		phones = append(phones, row.client.Phone)
+		if row.client.Email != "" {
+			emails = append(emails, row.client.Email)
+		}
+	}
+
+	existing, err := clients.db.ListByContacts(ctx, phones, emails)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	byPhone, byEmail := map[string]Client{}, map[string]Client{}
+	for _, client := range existing {
+		byPhone[PhoneDigits(client.Phone)] = client
+		if client.Email != "" {
+			byEmail[mail.NormalizeAddress(client.Email)] = client
+		}
+	}
+
+	var created, updated, before []Client
+	for _, row := range batch {
+		current, exists := byPhone[PhoneDigits(row.client.Phone)]
+		if owner, taken := byEmail[mail.NormalizeAddress(row.client.Email)]; row.client.Email != "" && taken && (!exists || owner.ID != current.ID) {
+			report.skip(row.line, FieldEmail, "email is used by another client")
+			continue
+		}
+
+		if !exists {
+			row.client.ID = uuid.New()
+			row.client.Version = 1
+			created = append(created, row.client)
+			continue
+		}
+
+		// empty cells keep existing values.
+		client := current
+		if row.client.Email != "" {
+			client.Email = row.client.Email
+		}
+		if row.client.FirstName != "" {
+			client.FirstName = row.client.FirstName
+		}
+		if row.client.LastName != "" {
+			client.LastName = row.client.LastName
+		}
+		if len(client.diff(current)) == 0 {
+			report.Skipped++
+			continue
+		}
+
+		updated = append(updated, client)
+		before = append(before, current)
+	}
+
+	if !report.DryRun {
+		err = clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+			for _, client := range created {
+				if err := db.Add(ctx, client); err != nil {
+					return err
+				}
+				err := auditLog.Record(ctx, audit.ActionCreate, audit.EntityClient, client.ID, client.diff(Client{}))
+				if err != nil {
+					return err
+				}
+			}
+			for i, client := range updated {
+				if err := db.Update(ctx, client); err != nil {
+					return err
+				}
+				err := auditLog.Record(ctx, audit.ActionUpdate, audit.EntityClient, client.ID, client.diff(before[i]))
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return Error.Wrap(err)
+		}
+	}
+
+	report.Created += len(created)
+	report.Updated += len(updated)
+
+	return nil
+}
+
+// skip counts row as skipped because of the error.
+func (report *ImportReport) skip(line int, field, message string) {
+	report.Skipped++
+	report.Errors = append(report.Errors, ImportRowError{Row: line, Field: field, Message: message})
+}
+
+// columns returns indexes of file columns by import fields.
+func (mapping ColumnMapping) columns(header []string) (map[string]int, error) {
+	for field := range mapping {
+		if !isImportField(field) {
+			return nil, ErrImport.New("field %q is unknown", field)
+		}
+	}
+
+	columns := map[string]int{}
+	for _, field := range ImportFields {
+		name, mapped := mapping[field]
+		if !mapped || name == "" {
+			name = field
+		}
+
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")), name) {
+				columns[field] = i
+				break
+			}
+		}
+
+		if _, found := columns[field]; !found && (mapped || field == FieldPhone) {
+			return nil, ErrImport.New("column %q is not found", name)
+		}
+	}
+
+	return columns, nil
+}
+
+// parseImportRow normalizes and validates record of import file.
+func parseImportRow(line int, record []string, columns map[string]int) (importRow, *ImportRowError) {
+	value := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := importRow{
+		line: line,
+		client: Client{
+			Phone:     NormalizePhone(value(FieldPhone)),
+			Email:     value(FieldEmail),
+			FirstName: value(FieldFirstName),
+			LastName:  value(FieldLastName),
+		},
+	}
+
+	if !phonePattern.MatchString(row.client.Phone) {
+		return row, &ImportRowError{Row: line, Field: FieldPhone, Message: "phone has to contain 7 to 15 digits"}
+	}
+
+	if row.client.Email != "" {
+		address, err := netmail.ParseAddress(row.client.Email)
+		if err != nil || address.Address != row.client.Email {
+			return row, &ImportRowError{Row: line, Field: FieldEmail, Message: "email is not valid"}
+		}
+	}
+
+	if len([]rune(row.client.FirstName)) > maxNameLength {
+		return row, &ImportRowError{Row: line, Field: FieldFirstName, Message: "first name is too long"}
+	}
+	if len([]rune(row.client.LastName)) > maxNameLength {
+		return row, &ImportRowError{Row: line, Field: FieldLastName, Message: "last name is too long"}
+	}
+
+	return row, nil
+}
+
+// NormalizePhone removes formatting characters from phone number.
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		default:
+			return r
+		}
+	}, phone)
+}
+
+// isImportField checks that field could be imported.
+func isImportField(field string) bool {
+	for _, known := range ImportFields {
+		if field == known {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/clients"
+	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/internal/mail"
+)
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := clients.ParseColumnMapping("phone=Phone number, email = E-mail,")
+	require.NoError(t, err)
+	assert.Equal(t, clients.ColumnMapping{"phone": "Phone number", "email": "E-mail"}, mapping)
+
+	_, err = clients.ParseColumnMapping("phone")
+	assert.True(t, clients.ErrImport.Has(err))
+
+	assert.Equal(t, "+380931234567", clients.NormalizePhone("+38 (093) 123-45.67"))
+}
+
+func TestImport(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db))
+
+		_, err := service.Create(ctx, "old@example.com", "0930000001", "Ivan", "Petrov")
+		require.NoError(t, err)
+		_, err = service.Create(ctx, "taken@example.com", "0930000002", "Anna", "Ivanova")
+		require.NoError(t, err)
+
+		file := "Phone number,E-mail,first_name,last_name\n" +
+			"093 000 0001,,Ivan,Petrenko\n" +
+			"0930000002,,Anna,Ivanova\n" +
+			"0930000003,New@Example.com,Oleg,\n" +
+			"0930000003,other@example.com,Oleg,\n" +
+			"0930000004,TAKEN@example.com,Olga,\n" +
+			"12,,Bad,Phone\n" +
+			"0930000005,not an email,Bad,Email\n"
+		options := clients.ImportOptions{
+			Mapping:   clients.ColumnMapping{clients.FieldPhone: "phone number", clients.FieldEmail: "E-mail"},
+			DryRun:    true,
+			BatchSize: 2,
+		}
+
+		report, err := service.Import(ctx, strings.NewReader(file), options)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 5, report.Skipped)
+
+		rows := map[int]string{}
+		for _, rowErr := range report.Errors {
+			rows[rowErr.Row] = rowErr.Field
+		}
+		assert.Equal(t, map[int]string{5: clients.FieldPhone, 6: clients.FieldEmail, 7: clients.FieldPhone, 8: clients.FieldEmail}, rows)
+
+		_, err = db.Clients().GetByPhone(ctx, "0930000003")
+		require.Error(t, err)
+
+		options.DryRun = false
+		report, err = service.Import(ctx, strings.NewReader(file), options)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Updated)
+
+		client, err := db.Clients().GetByPhone(ctx, "0930000001")
+		require.NoError(t, err)
+		assert.Equal(t, "Petrenko", client.LastName)
+		assert.Equal(t, "old@example.com", client.Email)
+
+		client, err = db.Clients().GetByPhone(ctx, "0930000003")
+		require.NoError(t, err)
+		assert.Equal(t, "New@Example.com", client.Email)
+
+		_, err = service.Import(ctx, strings.NewReader("email\nx@example.com\n"), options)
+		assert.True(t, clients.ErrImport.Has(err))
+	})
+}
+
+func TestImportFormattedPhone(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		service := clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db))
+
+		formatted := []clients.Client{
+			{ID: uuid.New(), Phone: "+1 (555) 123-4567", FirstName: "Ivan", Version: 1},
+			{ID: uuid.New(), Phone: "(555) 123-4568", FirstName: "Anna", Version: 1},
+		}
+		for _, client := range formatted {
+			require.NoError(t, db.Clients().Add(ctx, client))
+		}
+
+		file := "phone,last_name\n" +
+			"+15551234567,Petrenko\n" +
+			"5551234568,Ivanova\n"
+
+		report, err := service.Import(ctx, strings.NewReader(file), clients.ImportOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Created)
+		assert.Equal(t, 2, report.Updated)
+
+		for i, lastName := range []string{"Petrenko", "Ivanova"} {
+			client, err := db.Clients().Get(ctx, formatted[i].ID)
+			require.NoError(t, err)
+			assert.Equal(t, lastName, client.LastName)
+			assert.Equal(t, formatted[i].Phone, client.Phone)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+)
+
+// ErrInvalidCursor indicates that page cursor could not be decoded.
+var ErrInvalidCursor = errs.Class("invalid page cursor")
+
+const (
+	// DefaultPageLimit is a number of clients on page if limit is not specified.
+	DefaultPageLimit = 50
+	// MaxPageLimit is a maximal number of clients on page.
+	MaxPageLimit = 500
+)
+
+// SortField defines by which field clients are ordered.
+type SortField string
+
+const (
+	// SortByName orders clients by last name and first name.
+	SortByName SortField = "name"
+	// SortByCreatedAt orders clients by registration time.
+	SortByCreatedAt SortField = "created_at"
+	// SortByPhone orders clients by phone number.
+	SortByPhone SortField = "phone"
+)
+
+// SortFields contains all available sort fields.
+var SortFields = []SortField{SortByCreatedAt, SortByName, SortByPhone}
+
+// IsValid checks that sort field is one of known fields.
+func (field SortField) IsValid() bool {
+	for _, known := range SortFields {
+		if field == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EmailPresence filters clients by whether they have email.
+type EmailPresence string
+
+const (
+	// EmailAny does not filter by email.
+	EmailAny EmailPresence = ""
+	// EmailPresent selects clients with email.
+	EmailPresent EmailPresence = "present"
+	// EmailMissing selects clients without email.
+	EmailMissing EmailPresence = "missing"
+)
+
+// ListFilter defines which clients are listed, zero fields match everything.
+type ListFilter struct {
+	// CreatedFrom selects clients created at or after the time.
+	CreatedFrom time.Time
+	// CreatedTo selects clients created before the time.
+	CreatedTo time.Time
+	Email     EmailPresence
+}
+
+// ListQuery defines filter, order and page of clients list.
+type ListQuery struct {
+	Filter ListFilter
+	Sort   SortField
+	Desc   bool
+	// Cursor points to the client next to which page starts, first page is returned if it is nil.
+	Cursor *Cursor
+	Limit  int
+}
+
+// Cursor is a position in ordered clients list.
+// It holds sort key of the client on the page boundary, so the next page is selected by index without offset.
+type Cursor struct {
+	ID        uuid.UUID `json:"id"`
+	LastName  string    `json:"lastName,omitempty"`
+	FirstName string    `json:"firstName,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Backward is true if page ends right before the client, otherwise page starts right after it.
+	Backward bool `json:"backward,omitempty"`
+}
+
+// NewCursor returns cursor pointing to the client.
+func NewCursor(client Client, backward bool) Cursor {
+	return Cursor{
+		ID:        client.ID,
+		LastName:  client.LastName,
+		FirstName: client.FirstName,
+		Phone:     client.Phone,
+		CreatedAt: client.CreatedAt,
+		Backward:  backward,
+	}
+}
+
+// Encode returns opaque string representation of the cursor.
+func (cursor Cursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses cursor encoded with Encode.
+func DecodeCursor(value string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor.Wrap(err)
+	}
+
+	var cursor Cursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor.Wrap(err)
+	}
+
+	return cursor, nil
+}
+
+// Page is a single page of clients list.
+type Page struct {
+	Clients []Client
+	// Next is a cursor of the next page, nil if this page is the last one.
+	Next *Cursor
+	// Prev is a cursor of the previous page, nil if this page is the first one.
+	Prev *Cursor
+}
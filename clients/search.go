@@ -0,0 +1,90 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultSearchLimit is a number of search results if limit is not specified.
+	DefaultSearchLimit = 10
+	// MaxSearchLimit is a maximal number of search results.
+	MaxSearchLimit = 100
+	// MaxSearchLength is a maximal length of search text in characters, the rest is ignored.
+	MaxSearchLength = 100
+)
+
+// SearchQuery is a normalized text to search clients by.
+type SearchQuery struct {
+	// Text is a trimmed lower case search text, it is matched against names and email.
+	Text string
+	// Digits holds digits of the search text, it is matched against phone number.
+	// It is empty if there are too few digits to look like a phone fragment.
+	Digits string
+}
+
+// minPhoneDigits is a minimal number of digits matched against phone number.
+const minPhoneDigits = 3
+
+// NewSearchQuery normalizes search text.
+func NewSearchQuery(text string) SearchQuery {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	if utf8.RuneCountInString(text) > MaxSearchLength {
+		text = string([]rune(text)[:MaxSearchLength])
+	}
+
+	var digits strings.Builder
+	for _, r := range text {
+		if unicode.IsDigit(r) {
+			digits.WriteRune(r)
+		}
+	}
+
+	query := SearchQuery{Text: text}
+	if digits.Len() >= minPhoneDigits {
+		query.Digits = digits.String()
+	}
+
+	return query
+}
+
+// PhoneDigits returns digits of phone number, phones are matched by digits so their formatting does not matter.
+func PhoneDigits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, phone)
+}
+
+// SearchResult is a client found by search.
+type SearchResult struct {
+	Client
+	// Rank is a relevance of the client from 0 to 1, results with higher rank match better.
+	Rank float64
+}
+
+// Search returns clients whose phone contains digits of the text, or whose names or email
+// match the text approximately, most relevant first.
+func (clients *Service) Search(ctx context.Context, text string, limit int) ([]SearchResult, error) {
+	query := NewSearchQuery(text)
+	if query.Text == "" {
+		return nil, nil
+	}
+
+	switch {
+	case limit <= 0:
+		limit = DefaultSearchLimit
+	case limit > MaxSearchLimit:
+		limit = MaxSearchLimit
+	}
+
+	results, err := clients.db.Search(ctx, query, limit)
+	return results, Error.Wrap(err)
+}
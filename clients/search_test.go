@@ -0,0 +1,24 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cleanmasters/clients"
+)
+
+func TestNewSearchQuery(t *testing.T) {
+	assert.Equal(t, clients.SearchQuery{Text: "ivan petrov"}, clients.NewSearchQuery("  Ivan   PETROV "))
+	assert.Equal(t, clients.SearchQuery{Text: "+38 093-12", Digits: "3809312"}, clients.NewSearchQuery("+38 093-12"))
+	assert.Equal(t, clients.SearchQuery{Text: "a1"}, clients.NewSearchQuery("a1"))
+	assert.Equal(t, clients.SearchQuery{}, clients.NewSearchQuery("   "))
+}
+
+func TestPhoneDigits(t *testing.T) {
+	assert.Equal(t, "15551234567", clients.PhoneDigits("+1 (555) 123-4567"))
+	assert.Equal(t, "", clients.PhoneDigits("n/a"))
+}
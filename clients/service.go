@@ -5,9 +5,15 @@ package clients
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+	"cleanmasters/internal/mail"
+	"cleanmasters/internal/spreadsheet"
 )
 
 var (
@@ -15,59 +21,208 @@ var (
 	Error = errs.Class("clients service error")
 )
 
+// Transaction runs fn atomically: clients repository and audit service passed to fn share one database transaction,
+// which is committed if fn returns nil and rolled back otherwise. fn could be called several times if transaction is retried.
+type Transaction func(ctx context.Context, fn func(db DB, auditLog *audit.Service) error) error
+
 // Service exposes all clients related functionality.
 //
 // architecture: Service
 type Service struct {
-	db DB
+	db          DB
+	mailer      mail.Mailer
+	transaction Transaction
 }
 
 // NewService is a constructor for clients service.
-func NewService(db DB) *Service {
+func NewService(db DB, mailer mail.Mailer, transaction Transaction) *Service {
 	return &Service{
-		db: db,
+		db:          db,
+		mailer:      mailer,
+		transaction: transaction,
 	}
 }
 
-// Create is used by manager to create new client.
-func (clients *Service) Create(ctx context.Context, email, phone, firstName, lastName string) error {
+// Create is used by manager to create new client, created client is returned.
+func (clients *Service) Create(ctx context.Context, email, phone, firstName, lastName string) (Client, error) {
 	client := Client{
 		ID:        uuid.New(),
 		Email:     email,
 		Phone:     phone,
 		FirstName: firstName,
 		LastName:  lastName,
+		Version:   1,
 	}
 
-	return Error.Wrap(clients.db.Add(ctx, client))
+	err := clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		if err := db.Add(ctx, client); err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionCreate, audit.EntityClient, client.ID, client.diff(Client{}))
+	})
+	if err != nil {
+		return Client{}, Error.Wrap(err)
+	}
+
+	return client, nil
 }
 
 // Register is used by client to register an account.
-func (clients *Service) Register(ctx context.Context, phone string) (uuid.UUID, error) {
-	id, err := clients.db.Register(ctx, phone)
-	return id, Error.Wrap(err)
+func (clients *Service) Register(ctx context.Context, phone string) (id uuid.UUID, err error) {
+	err = clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		id, err = db.Register(ctx, phone)
+		if err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionCreate, audit.EntityClient, id, Client{Phone: phone}.diff(Client{}))
+	})
+	if err != nil {
+		return uuid.UUID{}, Error.Wrap(err)
+	}
+
+	return id, nil
 }
 
-// Update is used to update client.
+// Update is used to update client, ErrVersionRequired is returned if newClient.Version is not positive
+// and ErrConflict is returned if client was changed after that version.
 func (clients *Service) Update(ctx context.Context, newClient Client) error {
-	client, err := clients.db.Get(ctx, newClient.ID)
+	if newClient.Version <= 0 {
+		return ErrVersionRequired.New("client %s is updated without version", newClient.ID)
+	}
+
+	return clients.update(ctx, newClient)
+}
+
+// UpdatePersonalData is used by client to update own account in console.
+// Console does not expose versions and client is the only editor there, so the latest version is updated.
+func (clients *Service) UpdatePersonalData(ctx context.Context, newClient Client) error {
+	newClient.Version = 0
+
+	return clients.update(ctx, newClient)
+}
+
+// update saves client fields and records changes in audit log in a single transaction.
+// ErrConflict is returned if newClient.Version is not zero and client was changed after that version.
+func (clients *Service) update(ctx context.Context, newClient Client) error {
+	return Error.Wrap(clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		client, err := db.Get(ctx, newClient.ID)
+		if err != nil {
+			return err
+		}
+		if newClient.Version != 0 && newClient.Version != client.Version {
+			return ErrConflict.New("version %d is changed to %d", newClient.Version, client.Version)
+		}
+		before := client
+
+		client.LastName = newClient.LastName
+		client.FirstName = newClient.FirstName
+		client.Email = newClient.Email
+		client.Phone = newClient.Phone
+
+		err = db.Update(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionUpdate, audit.EntityClient, client.ID, client.diff(before))
+	}))
+}
+
+// List returns page of clients which match the filter, newest clients first if sort is not specified.
+func (clients *Service) List(ctx context.Context, query ListQuery) (Page, error) {
+	if query.Sort == "" {
+		query.Sort, query.Desc = SortByCreatedAt, true
+	}
+	if !query.Sort.IsValid() {
+		return Page{}, Error.New("unknown sort field %q", query.Sort)
+	}
+
+	limit := query.Limit
+	switch {
+	case limit <= 0:
+		limit = DefaultPageLimit
+	case limit > MaxPageLimit:
+		limit = MaxPageLimit
+	}
+
+	// one more client is selected to find out whether there is another page.
+	query.Limit = limit + 1
+	list, err := clients.db.List(ctx, query)
 	if err != nil {
-		return Error.Wrap(err)
+		return Page{}, Error.Wrap(err)
+	}
+
+	backward := query.Cursor != nil && query.Cursor.Backward
+	hasMore := len(list) > limit
+	if hasMore {
+		if backward {
+			list = list[1:]
+		} else {
+			list = list[:limit]
+		}
+	}
+
+	page := Page{Clients: list}
+	if len(list) == 0 {
+		return page, nil
 	}
 
-	client.LastName = newClient.LastName
-	client.FirstName = newClient.FirstName
-	client.Email = newClient.Email
-	client.Phone = newClient.Phone
+	first, last := NewCursor(list[0], true), NewCursor(list[len(list)-1], false)
+	switch {
+	case backward:
+		page.Next = &last
+		if hasMore {
+			page.Prev = &first
+		}
+	default:
+		if hasMore {
+			page.Next = &last
+		}
+		if query.Cursor != nil {
+			page.Prev = &first
+		}
+	}
 
-	return Error.Wrap(clients.db.Update(ctx, newClient))
+	return page, nil
 }
 
-// List is used to return all clients.
-func (clients *Service) List(ctx context.Context) ([]Client, error) {
-	result, err := clients.db.List(ctx)
+// Export writes all clients which match the filter as spreadsheet in the format, in query order.
+// Clients are streamed from the database, cursor and limit of the query are ignored.
+func (clients *Service) Export(ctx context.Context, w io.Writer, format spreadsheet.Format, query ListQuery) error {
+	if query.Sort == "" {
+		query.Sort, query.Desc = SortByCreatedAt, true
+	}
+	if !query.Sort.IsValid() {
+		return Error.New("unknown sort field %q", query.Sort)
+	}
+
+	writer, err := spreadsheet.NewWriter(format, w)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = writer.WriteRow([]string{"id", "first_name", "last_name", "phone", "email", "created_at"})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = clients.db.Iterate(ctx, query, func(client Client) error {
+		return writer.WriteRow([]string{
+			client.ID.String(),
+			client.FirstName,
+			client.LastName,
+			client.Phone,
+			client.Email,
+			client.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return Error.Wrap(err)
+	}
 
-	return result, Error.Wrap(err)
+	return Error.Wrap(writer.Close())
 }
 
 // Get returns client by ID.
@@ -84,7 +239,88 @@ func (clients *Service) GetByPhone(ctx context.Context, phone string) (Client, e
 	return client, Error.Wrap(err)
 }
 
-// Delete deletes specified client.
+// GetByEmail returns client by email, emails are compared in normalized form.
+func (clients *Service) GetByEmail(ctx context.Context, email string) (Client, error) {
+	client, err := clients.db.GetByEmail(ctx, email)
+
+	return client, Error.Wrap(err)
+}
+
+// Delete moves specified client to trash, it could be restored until it is purged.
 func (clients *Service) Delete(ctx context.Context, id uuid.UUID) error {
-	return Error.Wrap(clients.db.Delete(ctx, id))
+	return Error.Wrap(clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		client, err := db.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		err = db.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionDelete, audit.EntityClient, id, Client{}.diff(client))
+	}))
+}
+
+// ListDeleted returns clients in trash, recently deleted first.
+func (clients *Service) ListDeleted(ctx context.Context) ([]Client, error) {
+	list, err := clients.db.ListDeleted(ctx)
+
+	return list, Error.Wrap(err)
+}
+
+// Restore moves client back from trash.
+func (clients *Service) Restore(ctx context.Context, id uuid.UUID) error {
+	return Error.Wrap(clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		err := db.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		client, err := db.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionRestore, audit.EntityClient, id, client.diff(Client{}))
+	}))
+}
+
+// Purge permanently deletes clients which are in trash since before the time, number of purged clients is returned.
+func (clients *Service) Purge(ctx context.Context, deletedBefore time.Time) (purged int, err error) {
+	err = clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		ids, err := db.Purge(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err = auditLog.Record(ctx, audit.ActionPurge, audit.EntityClient, id, nil); err != nil {
+				return err
+			}
+		}
+
+		purged = len(ids)
+		return nil
+	})
+
+	return purged, Error.Wrap(err)
+}
+
+// auditFields lists client fields recorded in audit log.
+var auditFields = []string{"phone", "email", "first_name", "last_name"}
+
+// diff returns changes made to the client compared to previous state.
+func (client Client) diff(before Client) []audit.Change {
+	fields := func(client Client) map[string]string {
+		return map[string]string{
+			"phone":      client.Phone,
+			"email":      client.Email,
+			"first_name": client.FirstName,
+			"last_name":  client.LastName,
+		}
+	}
+
+	return audit.Diff(auditFields, fields(before), fields(client))
 }
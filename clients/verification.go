@@ -0,0 +1,156 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+	"cleanmasters/internal/mail"
+)
+
+var (
+	// ErrNoEmailVerification indicates that client has no pending email verification.
+	ErrNoEmailVerification = errs.Class("email verification does not exist")
+	// ErrEmailVerification indicates that email could not be verified.
+	ErrEmailVerification = errs.Class("email verification error")
+)
+
+const (
+	// EmailVerificationDuration is an expiration duration of email verification code.
+	EmailVerificationDuration = 15 * time.Minute
+	// MaxEmailVerificationAttempts is a number of wrong codes after which new code has to be requested.
+	MaxEmailVerificationAttempts = 5
+
+	// emailVerificationCodeDigits is a number of digits in email verification code.
+	emailVerificationCodeDigits = 6
+)
+
+// EmailVerification is a pending verification of client email with the code sent to it.
+type EmailVerification struct {
+	ClientID uuid.UUID
+	// Email is a normalized address the code was sent to.
+	Email     string
+	CodeHash  []byte
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SendEmailVerification sends new verification code to the client email, previously sent code could not be used then.
+func (clients *Service) SendEmailVerification(ctx context.Context, clientID uuid.UUID) error {
+	client, err := clients.db.Get(ctx, clientID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	email := mail.NormalizeAddress(client.Email)
+	switch {
+	case email == "":
+		return ErrEmailVerification.New("client has no email")
+	case client.EmailVerifiedAt != nil:
+		return ErrEmailVerification.New("email is already verified")
+	}
+
+	code, err := newEmailVerificationCode()
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	now := time.Now().UTC()
+	err = clients.db.SetEmailVerification(ctx, EmailVerification{
+		ClientID:  clientID,
+		Email:     email,
+		CodeHash:  hashEmailVerificationCode(clientID, code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(EmailVerificationDuration),
+	})
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	err = clients.mailer.Send(ctx, mail.Message{
+		To:      client.Email,
+		Subject: "Email verification",
+		Body: fmt.Sprintf("Your email verification code is %s.\r\nThe code expires in %s. "+
+			"If you did not request it, ignore this message.", code, EmailVerificationDuration),
+	})
+
+	return Error.Wrap(err)
+}
+
+// VerifyEmail marks client email as verified if the code is the one which was sent to it.
+func (clients *Service) VerifyEmail(ctx context.Context, clientID uuid.UUID, code string) error {
+	verification, err := clients.db.GetEmailVerification(ctx, clientID)
+	if err != nil {
+		if ErrNoEmailVerification.Has(err) {
+			return ErrEmailVerification.New("code was not requested")
+		}
+		return Error.Wrap(err)
+	}
+
+	switch {
+	case verification.ExpiresAt.Before(time.Now()):
+		return ErrEmailVerification.New("code expired, request new code")
+	case verification.Attempts >= MaxEmailVerificationAttempts:
+		return ErrEmailVerification.New("too many attempts, request new code")
+	}
+
+	hash := hashEmailVerificationCode(clientID, strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare(hash, verification.CodeHash) != 1 {
+		if err = clients.db.AddEmailVerificationAttempt(ctx, clientID); err != nil {
+			return Error.Wrap(err)
+		}
+		return ErrEmailVerification.New("code is not valid")
+	}
+
+	return Error.Wrap(clients.transaction(ctx, func(db DB, auditLog *audit.Service) error {
+		client, err := db.Get(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if mail.NormalizeAddress(client.Email) != verification.Email {
+			return ErrEmailVerification.New("email was changed, request new code")
+		}
+
+		err = db.VerifyEmail(ctx, clientID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		return auditLog.Record(ctx, audit.ActionUpdate, audit.EntityClient, clientID,
+			[]audit.Change{{Field: "email_verified", Before: "false", After: "true"}})
+	}))
+}
+
+// newEmailVerificationCode generates random numeric code.
+func newEmailVerificationCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < emailVerificationCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", emailVerificationCodeDigits, n), nil
+}
+
+// hashEmailVerificationCode returns hash of the code which is stored in database, client id salts short codes.
+func hashEmailVerificationCode(clientID uuid.UUID, code string) []byte {
+	hash := sha256.Sum256(append(clientID[:], code...))
+	return hash[:]
+}
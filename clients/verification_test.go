@@ -0,0 +1,117 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package clients_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/clients"
+	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/mail"
+)
+
+// mailbox keeps sent messages.
+type mailbox []mail.Message
+
+// Send saves message to the mailbox.
+func (box *mailbox) Send(ctx context.Context, message mail.Message) error {
+	*box = append(*box, message)
+	return nil
+}
+
+// code returns verification code from the last message.
+func (box *mailbox) code(t *testing.T) string {
+	require.NotEmpty(t, *box)
+	code := regexp.MustCompile(`\d{6}`).FindString((*box)[len(*box)-1].Body)
+	require.NotEmpty(t, code)
+	return code
+}
+
+func TestEmailVerification(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		var box mailbox
+		service := clients.NewService(db.Clients(), &box, cleanmasters.ClientsTransaction(db))
+
+		client, err := service.Create(ctx, " Ivan@Example.com", "0930000001", "Ivan", "Petrov")
+		require.NoError(t, err)
+
+		found, err := service.GetByEmail(ctx, "IVAN@example.COM ")
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, found.ID)
+		assert.Nil(t, found.EmailVerifiedAt)
+
+		err = service.VerifyEmail(ctx, client.ID, "000000")
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+
+		require.NoError(t, service.SendEmailVerification(ctx, client.ID))
+		assert.Equal(t, client.Email, box[0].To)
+		code := box.code(t)
+
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		err = service.VerifyEmail(ctx, client.ID, wrong)
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+
+		require.NoError(t, service.VerifyEmail(ctx, client.ID, code))
+		verified, err := service.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, verified.EmailVerifiedAt)
+
+		// code could be used only once and verified email does not need another one.
+		err = service.VerifyEmail(ctx, client.ID, code)
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+		err = service.SendEmailVerification(ctx, client.ID)
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+
+		// changing email resets verification, code sent to previous email is rejected.
+		require.NoError(t, service.UpdatePersonalData(ctx, clients.Client{ID: client.ID, Email: "IVAN@example.com", Phone: client.Phone}))
+		verified, err = service.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, verified.EmailVerifiedAt)
+
+		require.NoError(t, service.UpdatePersonalData(ctx, clients.Client{ID: client.ID, Email: "petrov@example.com", Phone: client.Phone}))
+		changed, err := service.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Nil(t, changed.EmailVerifiedAt)
+
+		require.NoError(t, service.SendEmailVerification(ctx, client.ID))
+		code = box.code(t)
+		require.NoError(t, service.UpdatePersonalData(ctx, clients.Client{ID: client.ID, Email: "ivan.petrov@example.com", Phone: client.Phone}))
+		err = service.VerifyEmail(ctx, client.ID, code)
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+	})
+}
+
+func TestEmailVerificationAttempts(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		var box mailbox
+		service := clients.NewService(db.Clients(), &box, cleanmasters.ClientsTransaction(db))
+
+		client, err := service.Create(ctx, "ivan@example.com", "0930000001", "Ivan", "Petrov")
+		require.NoError(t, err)
+
+		require.NoError(t, service.SendEmailVerification(ctx, client.ID))
+		code := box.code(t)
+
+		for i := 0; i < clients.MaxEmailVerificationAttempts; i++ {
+			err = service.VerifyEmail(ctx, client.ID, "wrong")
+			require.True(t, clients.ErrEmailVerification.Has(err), err)
+		}
+
+		err = service.VerifyEmail(ctx, client.ID, code)
+		require.True(t, clients.ErrEmailVerification.Has(err), err)
+
+		// new code could be used.
+		require.NoError(t, service.SendEmailVerification(ctx, client.ID))
+		require.NoError(t, service.VerifyEmail(ctx, client.ID, box.code(t)))
+	})
+}
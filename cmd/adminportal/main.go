@@ -4,9 +4,12 @@
 package main
 
 import (
-	"cleanmasters/adminportal/managers"
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -15,20 +18,24 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/spf13/cobra"
 	"github.com/zeebo/errs"
 
 	"cleanmasters"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/clients"
 	"cleanmasters/database"
+	"cleanmasters/database/migrate"
 	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/internal/mail"
+	"cleanmasters/internal/password"
 )
 
 // Config defines cleanmansters configuration.
 type Config struct {
 	Database string `help:"cleanmasters database connection string" releaseDefault:"postgres://" devDefault:"postgres://"`
+	// DatabasePool configures connections of Postgres database, defaults are used for empty fields.
+	DatabasePool database.Config
 
 	cleanmasters.Config
 }
@@ -44,9 +51,41 @@ var (
 		RunE:  cmdRun,
 	}
 	createSchemaCmd = &cobra.Command{
-		Use:   "create-schema",
-		Short: "Create schemas for cleanmasters databases",
-		RunE:  cmdCreateSchema,
+		Use:        "create-schema",
+		Short:      "Create schemas for cleanmasters databases",
+		Deprecated: "use \"migrate up\" instead",
+		RunE:       cmdMigrateUp,
+	}
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage cleanmasters database schema migrations",
+	}
+	migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		RunE:  cmdMigrateUp,
+	}
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show applied and pending migrations",
+		RunE:  cmdMigrateStatus,
+	}
+	migrateVersionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "Show current schema version",
+		RunE:  cmdMigrateVersion,
+	}
+	createAdminCmd = &cobra.Command{
+		Use:   "create-admin [email]",
+		Short: "Create manager with admin role, password is read from standard input",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdCreateAdmin,
+	}
+	importClientsCmd = &cobra.Command{
+		Use:   "import-clients [file.csv]",
+		Short: "Import clients from csv file",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdImportClients,
 	}
 	setupCmd = &cobra.Command{
 		Use:         "setup",
@@ -55,8 +94,20 @@ var (
 		Annotations: map[string]string{"type": "setup"},
 	}
 
-	runCfg           Config
-	setupCfg         Config
+	runCfg   Config
+	setupCfg Config
+	runFlags struct {
+		DB string
+	}
+	createAdminCfg struct {
+		FirstName string
+		LastName  string
+	}
+	importCfg struct {
+		DryRun    bool
+		Mapping   string
+		BatchSize int
+	}
 	defaultConfigDir = applicationDir("cleanmasters", "admin")
 )
 
@@ -71,6 +122,19 @@ func init() {
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(setupCmd)
 	rootCmd.AddCommand(createSchemaCmd)
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateVersionCmd)
+	rootCmd.AddCommand(createAdminCmd)
+	rootCmd.AddCommand(importClientsCmd)
+
+	runCmd.Flags().StringVar(&runFlags.DB, "db", "", "database connection string which overrides configured one, \"memory\" keeps all data in memory until exit, \"file:path\" keeps it in the single file")
+	createAdminCmd.Flags().StringVar(&createAdminCfg.FirstName, "first-name", "", "first name of the admin")
+	createAdminCmd.Flags().StringVar(&createAdminCfg.LastName, "last-name", "", "last name of the admin")
+	importClientsCmd.Flags().BoolVar(&importCfg.DryRun, "dry-run", false, "validate file and report rows which would be skipped without importing")
+	importClientsCmd.Flags().StringVar(&importCfg.Mapping, "map", "", "column mapping in field=Column format separated by commas, e.g. phone=Phone number")
+	importClientsCmd.Flags().IntVar(&importCfg.BatchSize, "batch-size", clients.DefaultImportBatchSize, "number of rows written in one transaction")
 }
 
 func cmdSetup(cmd *cobra.Command, args []string) (err error) {
@@ -121,7 +185,12 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	db, err := database.Open(runCfg.Database)
+	databaseURL := runCfg.Database
+	if runFlags.DB != "" {
+		databaseURL = runFlags.DB
+	}
+
+	db, err := database.Open(ctx, databaseURL, runCfg.DatabasePool)
 	if err != nil {
 		log.Error("Error starting master database on cleanmasters admin panel", err)
 		return err
@@ -131,21 +200,10 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 		err = errs.Combine(err, db.Close())
 	}()
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte("qwe"), bcrypt.DefaultCost)
+	err = db.MigrateToLatest(ctx)
 	if err != nil {
-		log.Error("Error hashing", err)
-	}
-
-	err = db.Managers().Add(ctx, managers.Manager{
-		ID:           uuid.New(),
-		FirstName:    "Chechen",
-		LastName:     "Alan",
-		Email:        "qwe@ukr.net",
-		PasswordHash: passwordHash,
-		CreatedAt:    time.Now(),
-	})
-	if err != nil {
-		log.Error("Error creating manager", err)
+		log.Error("Error migrating database schema", err)
+		return err
 	}
 
 	peer, err := cleanmasters.NewPeer(log, db, runCfg.Config)
@@ -160,7 +218,62 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 	return errs.Combine(runError, closeError)
 }
 
-func cmdCreateSchema(cmd *cobra.Command, args []string) (err error) {
+func cmdMigrateUp(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+
+	return withMigrator(func(migrator *migrate.Migrator) error {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("applied %d migrations, schema version %d\n", applied, version)
+		return nil
+	})
+}
+
+func cmdMigrateStatus(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+
+	return withMigrator(func(migrator *migrate.Migrator) error {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied at " + status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-40s  %s\n", status.Version, status.Description, applied)
+		}
+
+		return nil
+	})
+}
+
+func cmdMigrateVersion(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+
+	return withMigrator(func(migrator *migrate.Migrator) error {
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(version)
+		return nil
+	})
+}
+
+// withMigrator opens database from config and calls fn with its migrator.
+func withMigrator(fn func(migrator *migrate.Migrator) error) (err error) {
 	ctx := context.Background()
 	log := zaplog.NewLog()
 
@@ -170,7 +283,7 @@ func cmdCreateSchema(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	db, err := database.Open(runCfg.Database)
+	db, err := database.Open(ctx, runCfg.Database, runCfg.DatabasePool)
 	if err != nil {
 		return errs.New("error connecting to master database on cleanmasters admin panel: %+v", err)
 	}
@@ -178,15 +291,113 @@ func cmdCreateSchema(cmd *cobra.Command, args []string) (err error) {
 		err = errs.Combine(err, db.Close())
 	}()
 
-	err = db.CreateSchema(ctx)
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	err = fn(migrator)
 	if err != nil {
-		log.Error("error creating schema", err)
-		return errs.New("error creating database schemas for cleanmasters db: %+v", err)
+		log.Error("error migrating database", err)
 	}
 
+	return err
+}
+
+func cmdCreateAdmin(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+	log := zaplog.NewLog()
+
+	fmt.Print("password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	adminPassword := strings.TrimRight(line, "\r\n")
+
+	runCfg, err = readConfig()
+	if err != nil {
+		log.Error("Could not read config from default place", err)
+		return err
+	}
+
+	db, err := database.Open(ctx, runCfg.Database, runCfg.DatabasePool)
+	if err != nil {
+		return errs.New("error connecting to master database on cleanmasters admin panel: %+v", err)
+	}
+	defer func() {
+		err = errs.Combine(err, db.Close())
+	}()
+
+	err = db.MigrateToLatest(ctx)
+	if err != nil {
+		return err
+	}
+
+	service := managers.NewService(
+		db.Managers(),
+		runCfg.AdminPortal.PasswordPolicy,
+		password.NewHasher(runCfg.AdminPortal.PasswordHasher),
+		cleanmasters.ManagersTransaction(db),
+	)
+	manager, err := service.Create(ctx, adminPassword, createAdminCfg.FirstName, createAdminCfg.LastName, args[0], managers.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s\n", manager.ID)
 	return nil
 }
 
+func cmdImportClients(cmd *cobra.Command, args []string) (err error) {
+	ctx := context.Background()
+	log := zaplog.NewLog()
+
+	mapping, err := clients.ParseColumnMapping(importCfg.Mapping)
+	if err != nil {
+		return err
+	}
+
+	runCfg, err = readConfig()
+	if err != nil {
+		log.Error("Could not read config from default place", err)
+		return err
+	}
+
+	db, err := database.Open(ctx, runCfg.Database, runCfg.DatabasePool)
+	if err != nil {
+		return errs.New("error connecting to master database on cleanmasters admin panel: %+v", err)
+	}
+	defer func() {
+		err = errs.Combine(err, db.Close())
+	}()
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errs.Combine(err, file.Close())
+	}()
+
+	service := clients.NewService(db.Clients(), mail.New(log, runCfg.AdminPortal.Mail), cleanmasters.ClientsTransaction(db))
+	report, err := service.Import(ctx, file, clients.ImportOptions{
+		Mapping:   mapping,
+		DryRun:    importCfg.DryRun,
+		BatchSize: importCfg.BatchSize,
+	})
+
+	for _, rowErr := range report.Errors {
+		fmt.Printf("row %d: %s: %s\n", rowErr.Row, rowErr.Field, rowErr.Message)
+	}
+	if report.DryRun {
+		fmt.Print("dry run, nothing is saved: ")
+	}
+	fmt.Printf("created %d, updated %d, skipped %d\n", report.Created, report.Updated, report.Skipped)
+
+	return err
+}
+
 // applicationDir returns best base directory for specific OS.
 func applicationDir(subdir ...string) string {
 	for i := range subdir {
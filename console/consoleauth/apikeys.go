@@ -0,0 +1,321 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package consoleauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+)
+
+var (
+	// ErrNoAPIKey indicates that API key does not exist.
+	ErrNoAPIKey = errs.Class("api key does not exist")
+	// ErrAPIKeyValidation indicates that API key request is not valid.
+	ErrAPIKeyValidation = errs.Class("api key validation error")
+)
+
+const (
+	// apiKeyPrefix marks API keys, so they are easy to recognize, e.g. by secret scanners.
+	apiKeyPrefix = "cmk_"
+	// apiKeySecretLength is a length of random part of API key in bytes.
+	apiKeySecretLength = 32
+	// apiKeyTouchInterval limits how often last usage time of API key is updated.
+	apiKeyTouchInterval = time.Minute
+)
+
+// Scope defines which console API endpoints API key is allowed to call.
+type Scope string
+
+const (
+	// ScopeClientsWrite allows to update personal data of clients.
+	ScopeClientsWrite Scope = "clients:write"
+	// ScopeDevicesRead allows to list signed in devices of clients.
+	ScopeDevicesRead Scope = "devices:read"
+	// ScopeDevicesWrite allows to sign out devices of clients.
+	ScopeDevicesWrite Scope = "devices:write"
+)
+
+// Scopes contains all available scopes.
+var Scopes = []Scope{ScopeClientsWrite, ScopeDevicesRead, ScopeDevicesWrite}
+
+// IsValid checks that scope is one of known scopes.
+func (scope Scope) IsValid() bool {
+	for _, known := range Scopes {
+		if scope == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// APIKey describes key which allows services to call console API without client login.
+// Only hash of the secret is stored, the key is shown once when it is issued.
+type APIKey struct {
+	ID         uuid.UUID
+	Name       string
+	SecretHash []byte
+	Scopes     []Scope
+	// AllowedIPs lists addresses or CIDR ranges the key could be used from, any address is allowed if it is empty.
+	AllowedIPs []string
+	// CreatedBy is an id of the manager who issued the key.
+	CreatedBy  uuid.UUID
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// HasScope returns true if the key is granted the scope.
+func (key APIKey) HasScope(scope Scope) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsActive returns true if the key is neither revoked nor expired.
+func (key APIKey) IsActive(now time.Time) bool {
+	return key.RevokedAt == nil && now.Before(key.ExpiresAt)
+}
+
+// AllowsIP returns true if the key could be used from the address.
+func (key APIKey) AllowsIP(ip string) bool {
+	if len(key.AllowedIPs) == 0 {
+		return true
+	}
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return false
+	}
+
+	for _, allowed := range key.AllowedIPs {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(address) {
+				return true
+			}
+			continue
+		}
+
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewAPIKey holds parameters of API key to issue.
+type NewAPIKey struct {
+	Name       string
+	Scopes     []Scope
+	AllowedIPs []string
+	ExpiresAt  time.Time
+}
+
+// CreateAPIKey issues API key and returns it with the secret which is not stored and could not be shown again.
+func (service *Service) CreateAPIKey(ctx context.Context, createdBy uuid.UUID, request NewAPIKey) (APIKey, string, error) {
+	now := time.Now().UTC()
+
+	err := request.validate(now)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	secret := make([]byte, apiKeySecretLength)
+	if _, err = rand.Read(secret); err != nil {
+		return APIKey{}, "", Error.Wrap(err)
+	}
+
+	key := APIKey{
+		ID:         uuid.New(),
+		Name:       strings.TrimSpace(request.Name),
+		SecretHash: hashAPIKeySecret(secret),
+		Scopes:     request.Scopes,
+		AllowedIPs: request.AllowedIPs,
+		CreatedBy:  createdBy,
+		CreatedAt:  now,
+		ExpiresAt:  request.ExpiresAt.UTC(),
+	}
+
+	err = service.sessions.CreateAPIKey(ctx, key)
+	if err != nil {
+		return APIKey{}, "", Error.Wrap(err)
+	}
+
+	err = service.audit.Record(ctx, audit.ActionCreate, audit.EntityAPIKey, key.ID, []audit.Change{
+		{Field: "name", After: key.Name},
+		{Field: "scopes", After: joinScopes(key.Scopes)},
+		{Field: "allowed_ips", After: strings.Join(key.AllowedIPs, ",")},
+		{Field: "expires_at", After: key.ExpiresAt.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return APIKey{}, "", Error.Wrap(err)
+	}
+
+	return key, apiKeyPrefix + key.ID.String() + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// APIKeys returns all issued API keys, newest first.
+func (service *Service) APIKeys(ctx context.Context) ([]APIKey, error) {
+	keys, err := service.sessions.ListAPIKeys(ctx)
+	return keys, Error.Wrap(err)
+}
+
+// RevokeAPIKey revokes API key, so it could not be used anymore.
+func (service *Service) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	key, err := service.sessions.GetAPIKey(ctx, id)
+	if err != nil {
+		if ErrNoAPIKey.Has(err) {
+			return err
+		}
+		return Error.Wrap(err)
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	err = service.sessions.RevokeAPIKey(ctx, id, time.Now().UTC())
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return Error.Wrap(service.audit.Record(ctx, audit.ActionUpdate, audit.EntityAPIKey, id, []audit.Change{
+		{Field: "revoked", Before: "false", After: "true"},
+	}))
+}
+
+// AuthenticateAPIKey returns active API key which could be used from the address.
+// All failures are reported as ErrUnauthorized, so response does not reveal which check failed.
+func (service *Service) AuthenticateAPIKey(ctx context.Context, rawKey, ip string) (APIKey, error) {
+	id, secret, err := parseAPIKey(rawKey)
+	if err != nil {
+		return APIKey{}, ErrUnauthorized.Wrap(err)
+	}
+
+	key, err := service.sessions.GetAPIKey(ctx, id)
+	if err != nil {
+		if ErrNoAPIKey.Has(err) {
+			return APIKey{}, ErrUnauthorized.Wrap(err)
+		}
+		return APIKey{}, Error.Wrap(err)
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case subtle.ConstantTimeCompare(key.SecretHash, hashAPIKeySecret(secret)) != 1:
+		return APIKey{}, ErrUnauthorized.New("invalid api key")
+	case !key.IsActive(now):
+		return APIKey{}, ErrUnauthorized.New("api key is revoked or expired")
+	case !key.AllowsIP(ip):
+		return APIKey{}, ErrUnauthorized.New("api key is not allowed from %s", ip)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		err = service.sessions.TouchAPIKey(ctx, key.ID, now)
+		if err != nil {
+			return APIKey{}, Error.Wrap(err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
+
+// validate checks API key parameters.
+func (request *NewAPIKey) validate(now time.Time) error {
+	if strings.TrimSpace(request.Name) == "" {
+		return ErrAPIKeyValidation.New("name is required")
+	}
+
+	if len(request.Scopes) == 0 {
+		return ErrAPIKeyValidation.New("at least one scope is required")
+	}
+	for _, scope := range request.Scopes {
+		if !scope.IsValid() {
+			return ErrAPIKeyValidation.New("scope %q is unknown", scope)
+		}
+	}
+
+	for i, allowed := range request.AllowedIPs {
+		allowed = strings.TrimSpace(allowed)
+		if _, _, err := net.ParseCIDR(allowed); err != nil && net.ParseIP(allowed) == nil {
+			return ErrAPIKeyValidation.New("%q is neither IP address nor CIDR range", allowed)
+		}
+		request.AllowedIPs[i] = allowed
+	}
+
+	if !request.ExpiresAt.After(now) {
+		return ErrAPIKeyValidation.New("expiration has to be in the future")
+	}
+
+	return nil
+}
+
+// parseAPIKey splits API key into id and secret.
+func parseAPIKey(rawKey string) (uuid.UUID, []byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(rawKey, apiKeyPrefix), ".", 2)
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) || len(parts) != 2 {
+		return uuid.UUID{}, nil, Error.New("malformed api key")
+	}
+
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.UUID{}, nil, Error.New("malformed api key")
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(secret) != apiKeySecretLength {
+		return uuid.UUID{}, nil, Error.New("malformed api key")
+	}
+
+	return id, secret, nil
+}
+
+// hashAPIKeySecret returns hash of API key secret which is stored in database.
+// Secret is random, so fast hash is sufficient.
+func hashAPIKeySecret(secret []byte) []byte {
+	hash := sha256.Sum256(secret)
+	return hash[:]
+}
+
+// joinScopes returns comma separated list of scopes.
+func joinScopes(scopes []Scope) string {
+	values := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		values = append(values, string(scope))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// apiKeyKey is a context key for API key.
+type apiKeyKey struct{}
+
+// WithAPIKey returns context with API key which authenticated the request.
+func WithAPIKey(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// GetAPIKey returns API key which authenticated the request, false if request is authenticated otherwise.
+func GetAPIKey(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(APIKey)
+	return key, ok
+}
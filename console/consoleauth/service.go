@@ -5,11 +5,17 @@ package consoleauth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/zeebo/errs"
 
+	"cleanmasters/audit"
 	"cleanmasters/clients"
 	"cleanmasters/internal/auth"
 )
@@ -17,21 +23,52 @@ import (
 var (
 	// Error is an internal error class for auth service.
 	Error = errs.Class("console authentication error")
+	// ErrUnauthorized indicates that provided credentials or tokens are not valid.
+	ErrUnauthorized = errs.Class("console unauthorized error")
+	// ErrImpersonation indicates that impersonation request is not valid.
+	ErrImpersonation = errs.Class("impersonation error")
 )
 
 const (
 	// AuthTokenDuration is an expiration duration for auth token.
-	AuthTokenDuration = 24 * time.Hour
+	AuthTokenDuration = 15 * time.Minute
+	// RefreshTokenDuration is an expiration duration for refresh token.
+	RefreshTokenDuration = 60 * 24 * time.Hour
+	// ImpersonationDuration is an expiration duration for token issued to the manager acting on behalf of the client.
+	ImpersonationDuration = 15 * time.Minute
+	// refreshTokenLength is a length of random part of refresh token in bytes.
+	refreshTokenLength = 32
 )
 
+// Tokens holds pair of access and refresh tokens issued to the client.
+type Tokens struct {
+	AccessToken  auth.Token
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
 // Service exposes all console authentication rules.
+//
+// architecture: Service
 type Service struct {
-	clients clients.Service
-	signer  auth.TokenSigner
+	sessions DB
+	clients  *clients.Service
+	signer   *auth.TokenSigner
+	audit    *audit.Service
+}
+
+// NewService is a constructor for console auth service.
+func NewService(sessions DB, clients *clients.Service, signer *auth.TokenSigner, audit *audit.Service) *Service {
+	return &Service{
+		sessions: sessions,
+		clients:  clients,
+		signer:   signer,
+		audit:    audit,
+	}
 }
 
-// Login validates token from context and returns authorized Authorization.
-func (service *Service) Login(ctx context.Context, token, phone string) (auth.Token, error) {
+// Login registers client if needed, starts new session for the device and returns pair of tokens.
+func (service *Service) Login(ctx context.Context, token, phone, device string) (Tokens, error) {
 	// TODO: add firebase token check
 	//err := validateToken(token)
 	//if err != nil {
@@ -41,24 +78,141 @@ func (service *Service) Login(ctx context.Context, token, phone string) (auth.To
 	client, err := service.clients.GetByPhone(ctx, phone)
 	if err != nil {
 		if !clients.ErrNotExist.Has(err) {
-			return auth.Token{}, Error.Wrap(err)
+			return Tokens{}, Error.Wrap(err)
 		}
 
 		id, err := service.clients.Register(ctx, phone)
 		if err != nil {
-			return auth.Token{}, Error.Wrap(err)
+			return Tokens{}, Error.Wrap(err)
 		}
 		client.ID = id
 	}
 
+	now := time.Now().UTC()
+	session := Session{
+		ID:         uuid.New(),
+		ClientID:   client.ID,
+		Device:     device,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
+	err = service.sessions.CreateSession(ctx, session)
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
+	}
+
+	tokens, err := service.issueTokens(ctx, session, now)
+
+	return tokens, Error.Wrap(err)
+}
+
+// Refresh exchanges refresh token for a new pair of tokens.
+// Every refresh token could be used only once, reuse of refresh token revokes whole session.
+func (service *Service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	hash, err := hashRefreshToken(refreshToken)
+	if err != nil {
+		return Tokens{}, ErrUnauthorized.Wrap(err)
+	}
+
+	token, err := service.sessions.GetRefreshToken(ctx, hash)
+	if err != nil {
+		if ErrNoRefreshToken.Has(err) {
+			return Tokens{}, ErrUnauthorized.Wrap(err)
+		}
+		return Tokens{}, Error.Wrap(err)
+	}
+
+	now := time.Now().UTC()
+
+	err = service.sessions.UseRefreshToken(ctx, hash, now)
+	if err != nil {
+		if ErrRefreshTokenUsed.Has(err) {
+			// refresh token was stolen or replayed, so the whole token family is not trusted anymore.
+			return Tokens{}, errs.Combine(ErrUnauthorized.Wrap(err), Error.Wrap(service.sessions.RevokeSession(ctx, token.SessionID, now)))
+		}
+		return Tokens{}, Error.Wrap(err)
+	}
+
+	if token.ExpiresAt.Before(now) {
+		return Tokens{}, ErrUnauthorized.New("refresh token expired")
+	}
+
+	session, err := service.sessions.GetSession(ctx, token.SessionID)
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
+	}
+	if session.IsRevoked() {
+		return Tokens{}, ErrUnauthorized.New("session revoked")
+	}
+
+	err = service.sessions.TouchSession(ctx, session.ID, now)
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
+	}
+
+	tokens, err := service.issueTokens(ctx, session, now)
+
+	return tokens, Error.Wrap(err)
+}
+
+// Impersonate issues short-lived access token which allows the manager to act on behalf of the client.
+// Token is marked with the manager, could not be refreshed, and every impersonation is recorded in audit log.
+func (service *Service) Impersonate(ctx context.Context, clientID, managerID uuid.UUID, reason string) (Tokens, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return Tokens{}, ErrImpersonation.New("reason is required")
+	}
+
+	_, err := service.clients.Get(ctx, clientID)
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
+	}
+
 	claims := auth.Claims{
-		ID:        client.ID,
-		ExpiresAt: time.Now().Add(AuthTokenDuration),
+		ID:             clientID,
+		ExpiresAt:      time.Now().UTC().Add(ImpersonationDuration),
+		ImpersonatorID: managerID,
+	}
+
+	err = service.audit.Record(ctx, audit.ActionImpersonate, audit.EntityClient, clientID, []audit.Change{
+		{Field: "reason", After: reason},
+		{Field: "expires_at", After: claims.ExpiresAt.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
+	}
+
+	accessToken, err := service.signer.CreateToken(ctx, claims)
+	if err != nil {
+		return Tokens{}, Error.Wrap(err)
 	}
 
-	authToken, err := service.signer.CreateToken(ctx, claims)
+	return Tokens{
+		AccessToken: accessToken,
+		ExpiresAt:   claims.ExpiresAt,
+	}, nil
+}
+
+// Sessions returns all signed in devices of the client.
+func (service *Service) Sessions(ctx context.Context, clientID uuid.UUID) ([]Session, error) {
+	sessions, err := service.sessions.ListSessions(ctx, clientID)
+
+	return sessions, Error.Wrap(err)
+}
+
+// SignOut revokes client's session, so device has to log in again.
+func (service *Service) SignOut(ctx context.Context, clientID, sessionID uuid.UUID) error {
+	session, err := service.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	if session.ClientID != clientID {
+		return ErrNoSession.New("%s", sessionID)
+	}
 
-	return authToken, Error.Wrap(err)
+	return Error.Wrap(service.sessions.RevokeSession(ctx, sessionID, time.Now().UTC()))
 }
 
 // Authorize validates token from context and returns authorized Authorization.
@@ -110,7 +264,20 @@ func (service *Service) Authenticate(ctx context.Context, token auth.Token) (_ *
 // authorize checks claims.
 func (service *Service) authorize(ctx context.Context, claims *auth.Claims) (err error) {
 	if !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(time.Now()) {
-		return Error.Wrap(err)
+		return Error.New("token expired")
+	}
+	if claims.IsImpersonation() && claims.ExpiresAt.IsZero() {
+		return Error.New("impersonation token has to expire")
+	}
+
+	if claims.SessionID != uuid.Nil {
+		session, err := service.sessions.GetSession(ctx, claims.SessionID)
+		if err != nil {
+			return Error.Wrap(err)
+		}
+		if session.IsRevoked() {
+			return Error.New("session revoked")
+		}
 	}
 
 	_, err = service.clients.Get(ctx, claims.ID)
@@ -120,3 +287,70 @@ func (service *Service) authorize(ctx context.Context, claims *auth.Claims) (err
 
 	return nil
 }
+
+// issueTokens creates new access token and new refresh token for the session.
+func (service *Service) issueTokens(ctx context.Context, session Session, now time.Time) (Tokens, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	hash, err := hashRefreshToken(refreshToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	err = service.sessions.AddRefreshToken(ctx, RefreshToken{
+		Hash:      hash,
+		SessionID: session.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenDuration),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	claims := auth.Claims{
+		ID:        session.ClientID,
+		SessionID: session.ID,
+		ExpiresAt: now.Add(AuthTokenDuration),
+	}
+
+	accessToken, err := service.signer.CreateToken(ctx, claims)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken generates random refresh token.
+func newRefreshToken() (string, error) {
+	data := make([]byte, refreshTokenLength)
+
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// hashRefreshToken returns hash of refresh token which is stored in database.
+func hashRefreshToken(refreshToken string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != refreshTokenLength {
+		return nil, Error.New("invalid refresh token length")
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hash[:], nil
+}
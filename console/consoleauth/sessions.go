@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package consoleauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+)
+
+var (
+	// ErrNoSession indicates that session does not exist.
+	ErrNoSession = errs.Class("session does not exist")
+	// ErrNoRefreshToken indicates that refresh token does not exist.
+	ErrNoRefreshToken = errs.Class("refresh token does not exist")
+	// ErrRefreshTokenUsed indicates that refresh token was already exchanged.
+	ErrRefreshTokenUsed = errs.Class("refresh token already used")
+)
+
+// DB exposes methods to manage console sessions, their refresh tokens and API keys.
+//
+// architecture: Database
+type DB interface {
+	// CreateSession is a method for inserting new Session to the database.
+	CreateSession(ctx context.Context, session Session) error
+	// GetSession is used to return session by id.
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
+	// ListSessions is used to return all not revoked sessions of the client.
+	ListSessions(ctx context.Context, clientID uuid.UUID) ([]Session, error)
+	// TouchSession updates last usage time of the session.
+	TouchSession(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+	// RevokeSession revokes session and therefore all refresh tokens issued for it.
+	RevokeSession(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+
+	// AddRefreshToken is a method for inserting new RefreshToken to the database.
+	AddRefreshToken(ctx context.Context, token RefreshToken) error
+	// GetRefreshToken is used to return refresh token by its hash.
+	GetRefreshToken(ctx context.Context, hash []byte) (RefreshToken, error)
+	// UseRefreshToken marks refresh token as used, returns ErrRefreshTokenUsed if it was used before.
+	UseRefreshToken(ctx context.Context, hash []byte, usedAt time.Time) error
+
+	// CreateAPIKey is a method for inserting new APIKey to the database.
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// GetAPIKey is used to return API key by id, returns ErrNoAPIKey if there is no such key.
+	GetAPIKey(ctx context.Context, id uuid.UUID) (APIKey, error)
+	// ListAPIKeys is used to return all API keys, newest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey marks API key as revoked.
+	RevokeAPIKey(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
+	// TouchAPIKey updates last usage time of API key.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+}
+
+// Session describes single signed in device of the client.
+// All refresh tokens rotated from one login belong to the same session (token family).
+type Session struct {
+	ID         uuid.UUID
+	ClientID   uuid.UUID
+	Device     string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  *time.Time
+}
+
+// IsRevoked returns true if session was revoked.
+func (session Session) IsRevoked() bool {
+	return session.RevokedAt != nil
+}
+
+// RefreshToken describes single-use token which is exchanged for a new pair of tokens.
+// Only the hash of the token is stored.
+type RefreshToken struct {
+	Hash      []byte
+	SessionID uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,178 @@
+package consoleauth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/audit"
+	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/database/dbtesting"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/internal/mail"
+)
+
+func TestSessions(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		repo := db.ConsoleSessions()
+
+		clientID, err := db.Clients().Register(ctx, "0931112233")
+		require.NoError(t, err)
+
+		now := time.Now().UTC()
+		session := consoleauth.Session{
+			ID:         uuid.New(),
+			ClientID:   clientID,
+			Device:     "iPhone",
+			CreatedAt:  now,
+			LastUsedAt: now,
+		}
+
+		err = repo.CreateSession(ctx, session)
+		require.NoError(t, err)
+
+		sessionCheck, err := repo.GetSession(ctx, session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, session.ClientID, sessionCheck.ClientID)
+		assert.Equal(t, session.Device, sessionCheck.Device)
+		assert.False(t, sessionCheck.IsRevoked())
+
+		token := consoleauth.RefreshToken{
+			Hash:      []byte("hash"),
+			SessionID: session.ID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		}
+
+		err = repo.AddRefreshToken(ctx, token)
+		require.NoError(t, err)
+
+		tokenCheck, err := repo.GetRefreshToken(ctx, token.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, token.SessionID, tokenCheck.SessionID)
+		assert.Nil(t, tokenCheck.UsedAt)
+
+		err = repo.UseRefreshToken(ctx, token.Hash, now)
+		require.NoError(t, err)
+
+		err = repo.UseRefreshToken(ctx, token.Hash, now)
+		assert.True(t, consoleauth.ErrRefreshTokenUsed.Has(err))
+
+		_, err = repo.GetRefreshToken(ctx, []byte("unknown"))
+		assert.True(t, consoleauth.ErrNoRefreshToken.Has(err))
+
+		list, err := repo.ListSessions(ctx, clientID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, session.ID, list[0].ID)
+
+		err = repo.RevokeSession(ctx, session.ID, now)
+		require.NoError(t, err)
+
+		sessionCheck, err = repo.GetSession(ctx, session.ID)
+		require.NoError(t, err)
+		assert.True(t, sessionCheck.IsRevoked())
+
+		list, err = repo.ListSessions(ctx, clientID)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+
+		_, err = repo.GetSession(ctx, uuid.New())
+		assert.True(t, consoleauth.ErrNoSession.Has(err))
+	})
+}
+
+func TestImpersonate(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		auditService := audit.NewService(db.Audit())
+		service := consoleauth.NewService(db.ConsoleSessions(), clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db)), auth.NewTokenSigner("secret"), auditService)
+
+		clientID, err := db.Clients().Register(ctx, "0931112244")
+		require.NoError(t, err)
+		managerID := uuid.New()
+
+		_, err = service.Impersonate(ctx, clientID, managerID, " ")
+		require.True(t, consoleauth.ErrImpersonation.Has(err))
+
+		tokens, err := service.Impersonate(ctx, clientID, managerID, "client can not see orders")
+		require.NoError(t, err)
+		assert.Empty(t, tokens.RefreshToken)
+		assert.WithinDuration(t, time.Now().Add(consoleauth.ImpersonationDuration), tokens.ExpiresAt, time.Minute)
+
+		claims, err := service.Authorize(auth.SetToken(ctx, []byte(tokens.AccessToken.String())))
+		require.NoError(t, err)
+		assert.Equal(t, clientID, claims.ID)
+		assert.Equal(t, managerID, claims.ImpersonatorID)
+
+		entries, err := auditService.List(ctx, audit.Filter{Action: audit.ActionImpersonate, EntityID: clientID.String()})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "client can not see orders", entries[0].Changes[0].After)
+
+		// changes made with impersonation token are attributed to the manager.
+		err = auditService.Record(auth.SetClaims(ctx, claims), audit.ActionUpdate, audit.EntityClient, clientID, []audit.Change{{Field: "email", After: "new@qwe.com"}})
+		require.NoError(t, err)
+
+		entries, err = auditService.List(ctx, audit.Filter{Action: audit.ActionUpdate, EntityID: clientID.String()})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, managerID, entries[0].ActorID)
+		assert.Equal(t, audit.ActorManager, entries[0].ActorType)
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		auditService := audit.NewService(db.Audit())
+		service := consoleauth.NewService(db.ConsoleSessions(), clients.NewService(db.Clients(), mail.NewLogMailer(zaplog.NewLog()), cleanmasters.ClientsTransaction(db)), auth.NewTokenSigner("secret"), auditService)
+
+		_, _, err := service.CreateAPIKey(ctx, uuid.Nil, consoleauth.NewAPIKey{
+			Name:      "booking site",
+			Scopes:    []consoleauth.Scope{"orders:everything"},
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.True(t, consoleauth.ErrAPIKeyValidation.Has(err))
+
+		key, secret, err := service.CreateAPIKey(ctx, uuid.Nil, consoleauth.NewAPIKey{
+			Name:       "booking site",
+			Scopes:     []consoleauth.Scope{consoleauth.ScopeClientsWrite},
+			AllowedIPs: []string{"10.0.0.0/8", "192.168.1.10"},
+			ExpiresAt:  time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, string(key.SecretHash), secret)
+
+		authenticated, err := service.AuthenticateAPIKey(ctx, secret, "10.1.2.3")
+		require.NoError(t, err)
+		assert.Equal(t, key.ID, authenticated.ID)
+		assert.True(t, authenticated.HasScope(consoleauth.ScopeClientsWrite))
+		assert.False(t, authenticated.HasScope(consoleauth.ScopeDevicesWrite))
+		assert.NotNil(t, authenticated.LastUsedAt)
+
+		_, err = service.AuthenticateAPIKey(ctx, secret, "192.168.1.10")
+		require.NoError(t, err)
+
+		_, err = service.AuthenticateAPIKey(ctx, secret, "172.16.0.1")
+		require.True(t, consoleauth.ErrUnauthorized.Has(err))
+
+		_, err = service.AuthenticateAPIKey(ctx, secret[:len(secret)-2]+"AA", "10.1.2.3")
+		require.True(t, consoleauth.ErrUnauthorized.Has(err))
+
+		keys, err := service.APIKeys(ctx)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10"}, keys[0].AllowedIPs)
+
+		require.NoError(t, service.RevokeAPIKey(ctx, key.ID))
+
+		_, err = service.AuthenticateAPIKey(ctx, secret, "10.1.2.3")
+		require.True(t, consoleauth.ErrUnauthorized.Has(err))
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/internal/auth"
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// ErrAuth is an internal error type for auth controller.
+	ErrAuth = errs.Class("auth controller error")
+)
+
+// Auth is a web api controller.
+// Exposes login, token refresh and device management endpoints.
+type Auth struct {
+	log  logger.Logger
+	auth *consoleauth.Service
+}
+
+// NewAuth is a constructor for auth controller.
+func NewAuth(log logger.Logger, auth *consoleauth.Service) *Auth {
+	return &Auth{
+		log:  log,
+		auth: auth,
+	}
+}
+
+// LoginRequest holds all needed data to log in client.
+type LoginRequest struct {
+	Token  string `json:"token"`
+	Phone  string `json:"phone"`
+	Device string `json:"device"`
+}
+
+// RefreshRequest holds refresh token that is exchanged for a new pair of tokens.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokensResponse holds pair of issued tokens.
+type TokensResponse struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// DeviceResponse describes signed in device of the client.
+type DeviceResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Current    bool      `json:"current"`
+}
+
+// Login is an endpoint to log in client and issue pair of tokens.
+func (controller *Auth) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	request := LoginRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		controller.serveError(w, http.StatusBadRequest, ErrAuth.Wrap(err))
+		return
+	}
+
+	tokens, err := controller.auth.Login(ctx, request.Token, request.Phone, request.Device)
+	if err != nil {
+		controller.log.Error("couldn't log in client", ErrAuth.Wrap(err))
+		controller.serveError(w, http.StatusInternalServerError, ErrAuth.Wrap(err))
+		return
+	}
+
+	controller.serveTokens(w, tokens)
+}
+
+// Refresh is an endpoint to exchange refresh token for a new pair of tokens.
+func (controller *Auth) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	request := RefreshRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		controller.serveError(w, http.StatusBadRequest, ErrAuth.Wrap(err))
+		return
+	}
+
+	tokens, err := controller.auth.Refresh(ctx, request.RefreshToken)
+	if err != nil {
+		if consoleauth.ErrUnauthorized.Has(err) {
+			controller.serveError(w, http.StatusUnauthorized, ErrAuth.Wrap(err))
+			return
+		}
+
+		controller.log.Error("couldn't refresh tokens", ErrAuth.Wrap(err))
+		controller.serveError(w, http.StatusInternalServerError, ErrAuth.Wrap(err))
+		return
+	}
+
+	controller.serveTokens(w, tokens)
+}
+
+// Devices is an endpoint that returns all signed in devices of the client.
+func (controller *Auth) Devices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		controller.serveError(w, http.StatusUnauthorized, ErrAuth.Wrap(err))
+		return
+	}
+
+	sessions, err := controller.auth.Sessions(ctx, claims.ID)
+	if err != nil {
+		controller.log.Error("couldn't list sessions", ErrAuth.Wrap(err))
+		controller.serveError(w, http.StatusInternalServerError, ErrAuth.Wrap(err))
+		return
+	}
+
+	devices := make([]DeviceResponse, 0, len(sessions))
+	for _, session := range sessions {
+		devices = append(devices, DeviceResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == claims.SessionID,
+		})
+	}
+
+	err = json.NewEncoder(w).Encode(devices)
+	if err != nil {
+		controller.log.Error("failed to write json response", ErrAuth.Wrap(err))
+	}
+}
+
+// SignOut is an endpoint that signs out one of the client's devices.
+func (controller *Auth) SignOut(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		controller.serveError(w, http.StatusUnauthorized, ErrAuth.Wrap(err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		controller.serveError(w, http.StatusBadRequest, ErrAuth.Wrap(err))
+		return
+	}
+
+	err = controller.auth.SignOut(ctx, claims.ID, sessionID)
+	if err != nil {
+		if consoleauth.ErrNoSession.Has(err) {
+			controller.serveError(w, http.StatusNotFound, ErrAuth.Wrap(err))
+			return
+		}
+
+		controller.log.Error("couldn't sign out device", ErrAuth.Wrap(err))
+		controller.serveError(w, http.StatusInternalServerError, ErrAuth.Wrap(err))
+		return
+	}
+}
+
+// serveTokens sends issued tokens as json.
+func (controller *Auth) serveTokens(w http.ResponseWriter, tokens consoleauth.Tokens) {
+	response := TokensResponse{
+		AccessToken:  tokens.AccessToken.String(),
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	}
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		controller.log.Error("failed to write json response", ErrAuth.Wrap(err))
+	}
+}
+
+// serveError set http statuses and send json error.
+func (controller *Auth) serveError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+
+	var response struct {
+		Error string `json:"error"`
+	}
+
+	response.Error = err.Error()
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		controller.log.Error("failed to write json error response", ErrAuth.Wrap(err))
+	}
+}
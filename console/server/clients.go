@@ -11,6 +11,7 @@ import (
 
 	"cleanmasters/clients"
 	"cleanmasters/internal/auth"
+	"cleanmasters/internal/fielderr"
 	"cleanmasters/internal/logger"
 )
 
@@ -59,13 +60,22 @@ func (controller *Clients) UpdatePersonalData(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = controller.clients.Update(ctx, clients.Client{
+	err = controller.clients.UpdatePersonalData(ctx, clients.Client{
 		ID:        claims.ID,
 		FirstName: request.FirstName,
 		LastName:  request.LastName,
 		Email:     request.Email,
 		Phone:     request.Phone,
 	})
+	if fieldErr, ok := fielderr.As(err); ok {
+		status := http.StatusBadRequest
+		if fieldErr.Kind == fielderr.KindTaken {
+			status = http.StatusConflict
+		}
+
+		controller.serveError(w, status, fieldErr)
+		return
+	}
 	if err != nil {
 		controller.log.Error("couldn't update client", ErrClients.Wrap(err))
 		controller.serveError(w, http.StatusInternalServerError, ErrClients.Wrap(err))
@@ -73,15 +83,83 @@ func (controller *Clients) UpdatePersonalData(w http.ResponseWriter, r *http.Req
 	}
 }
 
+// VerifyEmailRequest holds code sent to client email.
+type VerifyEmailRequest struct {
+	Code string `json:"code"`
+}
+
+// SendEmailVerification is an endpoint that sends verification code to the client email.
+func (controller *Clients) SendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		controller.serveError(w, http.StatusUnauthorized, ErrClients.Wrap(err))
+		return
+	}
+
+	err = controller.clients.SendEmailVerification(ctx, claims.ID)
+	if err != nil {
+		controller.serveEmailVerificationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail is an endpoint that marks client email as verified with the code sent to it.
+func (controller *Clients) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Add("Content-Type", "application/json")
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		controller.serveError(w, http.StatusUnauthorized, ErrClients.Wrap(err))
+		return
+	}
+
+	request := VerifyEmailRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		controller.serveError(w, http.StatusBadRequest, ErrClients.Wrap(err))
+		return
+	}
+
+	err = controller.clients.VerifyEmail(ctx, claims.ID, request.Code)
+	if err != nil {
+		controller.serveEmailVerificationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveEmailVerificationError sends json error of failed email verification.
+func (controller *Clients) serveEmailVerificationError(w http.ResponseWriter, err error) {
+	if clients.ErrEmailVerification.Has(err) {
+		controller.serveError(w, http.StatusBadRequest, errs.Unwrap(err))
+		return
+	}
+
+	controller.log.Error("couldn't verify client email", ErrClients.Wrap(err))
+	controller.serveError(w, http.StatusInternalServerError, ErrClients.Wrap(err))
+}
+
 // serveError set http statuses and send json error.
 func (controller *Clients) serveError(w http.ResponseWriter, status int, err error) {
 	w.WriteHeader(status)
 
 	var response struct {
 		Error string `json:"error"`
+		// Field is a name of the request field which value is rejected, if error is about single field.
+		Field string `json:"field,omitempty"`
 	}
 
 	response.Error = err.Error()
+	if fieldErr, ok := fielderr.As(err); ok {
+		response.Field = fieldErr.Field
+	}
 
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
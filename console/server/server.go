@@ -8,11 +8,14 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/zeebo/errs"
 	"golang.org/x/sync/errgroup"
 
+	"cleanmasters/audit"
 	"cleanmasters/clients"
 	"cleanmasters/console/consoleauth"
 	"cleanmasters/internal/auth"
@@ -55,12 +58,26 @@ func NewServer(log logger.Logger, config Config, clients *clients.Service, auth
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
+	router.Use(withAuditRequest)
 
 	apiRouter := router.PathPrefix("/api/v0").Subrouter()
 
+	authRouter := apiRouter.PathPrefix("/auth").Subrouter().StrictSlash(true)
+	authController := NewAuth(server.log, server.auth)
+	authRouter.HandleFunc("/login", authController.Login).Methods(http.MethodPost)
+	authRouter.HandleFunc("/refresh", authController.Refresh).Methods(http.MethodPost)
+
+	devicesRouter := authRouter.PathPrefix("/devices").Subrouter()
+	devicesRouter.Use(server.authenticate)
+	devicesRouter.Handle("", withScope(consoleauth.ScopeDevicesRead, authController.Devices)).Methods(http.MethodGet)
+	devicesRouter.Handle("/{id}", withScope(consoleauth.ScopeDevicesWrite, authController.SignOut)).Methods(http.MethodDelete)
+
 	clientsRouter := apiRouter.PathPrefix("/clients").Subrouter().StrictSlash(true)
+	clientsRouter.Use(server.authenticate)
 	clientsController := NewClients(server.log, server.clients)
-	clientsRouter.HandleFunc("", clientsController.UpdatePersonalData).Methods(http.MethodPatch)
+	clientsRouter.Handle("", withScope(consoleauth.ScopeClientsWrite, clientsController.UpdatePersonalData)).Methods(http.MethodPatch)
+	clientsRouter.Handle("/email/verification", withScope(consoleauth.ScopeClientsWrite, clientsController.SendEmailVerification)).Methods(http.MethodPost)
+	clientsRouter.Handle("/email/verify", withScope(consoleauth.ScopeClientsWrite, clientsController.VerifyEmail)).Methods(http.MethodPost)
 
 	server.server = http.Server{
 		Handler: router,
@@ -97,9 +114,16 @@ func (server *Server) Close() error {
 }
 
 // authenticate performs initial authorization before every request.
+// Clients use "Bearer" access tokens, services use "ApiKey" keys and select the client with X-Client-ID header.
 func (server *Server) authenticate(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
+		authorizationHeader := r.Header.Get("Authorization")
+		if strings.HasPrefix(authorizationHeader, apiKeyScheme) {
+			server.authenticateAPIKey(w, r, strings.TrimPrefix(authorizationHeader, apiKeyScheme), handler)
+			return
+		}
+
+		token := strings.TrimPrefix(authorizationHeader, "Bearer ")
 		if len(token) == 0 {
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
@@ -115,6 +139,86 @@ func (server *Server) authenticate(handler http.Handler) http.Handler {
 
 		ctx = auth.SetClaims(ctx, authorization)
 
+		// lets the app show that manager acts on behalf of the client.
+		if authorization.IsImpersonation() {
+			w.Header().Set("X-Impersonated-By", authorization.ImpersonatorID.String())
+		}
+
 		handler.ServeHTTP(w, r.Clone(ctx))
 	})
 }
+
+// apiKeyScheme is an authorization scheme of API keys.
+const apiKeyScheme = "ApiKey "
+
+// authenticateAPIKey authenticates service by API key and puts key identity into context.
+func (server *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request, rawKey string, handler http.Handler) {
+	ctx := r.Context()
+
+	key, err := server.auth.AuthenticateAPIKey(ctx, rawKey, remoteIP(r))
+	if err != nil {
+		if !consoleauth.ErrUnauthorized.Has(err) {
+			server.log.Error("could not authenticate api key", Error.Wrap(err))
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// all console endpoints act on behalf of the client, so service has to name one.
+	clientID, err := uuid.Parse(r.Header.Get("X-Client-ID"))
+	if err != nil {
+		http.Error(w, "X-Client-ID header is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err = server.clients.Get(ctx, clientID)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	ctx = consoleauth.WithAPIKey(ctx, key)
+	ctx = auth.SetClaims(ctx, auth.Claims{
+		ID:       clientID,
+		APIKeyID: key.ID,
+	})
+
+	handler.ServeHTTP(w, r.Clone(ctx))
+}
+
+// withScope rejects requests authenticated with API key which is not granted the scope.
+// Requests of clients authenticated with access tokens are not restricted.
+func withScope(scope consoleauth.Scope, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := consoleauth.GetAPIKey(r.Context())
+		if ok && !key.HasScope(scope) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// remoteIP returns address of the request without port.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// withAuditRequest puts information about request into context, so changes made by clients are attributed in audit log.
+func withAuditRequest(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithRequest(r.Context(), audit.Request{
+			ActorType: audit.ActorClient,
+			IP:        remoteIP(r),
+			UserAgent: r.UserAgent(),
+		})
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/adminauth"
+)
+
+// ensures that adminauthdb implements adminauth.DB.
+var _ adminauth.DB = (*adminauthdb)(nil)
+
+// ErrAdminAuthDB in the error class that indicates about AdminAuthDB error.
+var ErrAdminAuthDB = errs.Class("AdminAuthDB error")
+
+// adminauthdb is a Postgres implementation of adminauth.DB.
+//
+// architecture: Database
+type adminauthdb struct {
+	conn executor
+}
+
+// SetRecoveryCodes replaces all recovery codes of the manager.
+func (repository *adminauthdb) SetRecoveryCodes(ctx context.Context, managerID uuid.UUID, hashes [][]byte) error {
+	return inTx(ctx, repository.conn, func(tx executor) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM manager_recovery_codes WHERE manager_id = $1;`, managerID)
+		if err != nil {
+			return ErrAdminAuthDB.Wrap(err)
+		}
+
+		for _, hash := range hashes {
+			_, err = tx.ExecContext(ctx, `INSERT INTO manager_recovery_codes (manager_id, code_hash) VALUES ($1, $2);`, managerID, hash)
+			if err != nil {
+				return ErrAdminAuthDB.Wrap(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode marks unused recovery code as used, returns ErrNoRecoveryCode if there is no such code.
+func (repository *adminauthdb) UseRecoveryCode(ctx context.Context, managerID uuid.UUID, hash []byte, usedAt time.Time) error {
+	statement := `UPDATE manager_recovery_codes SET used_at = $1 WHERE manager_id = $2 AND code_hash = $3 AND used_at IS NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, usedAt, managerID, hash)
+	if err != nil {
+		return ErrAdminAuthDB.Wrap(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ErrAdminAuthDB.Wrap(err)
+	}
+	if affected == 0 {
+		return adminauth.ErrNoRecoveryCode.New("")
+	}
+
+	return nil
+}
+
+// GetLoginThrottle returns throttling state of the key, zero state if there were no failures.
+func (repository *adminauthdb) GetLoginThrottle(ctx context.Context, key string) (adminauth.LoginThrottle, error) {
+	statement := `SELECT failures, last_failure_at, locked_until FROM login_throttles WHERE key = $1;`
+
+	throttle := adminauth.LoginThrottle{
+		Key: key,
+	}
+
+	var lockedUntil sql.NullTime
+	row := repository.conn.QueryRowContext(ctx, statement, key)
+	if err := row.Scan(&throttle.Failures, &throttle.LastFailureAt, &lockedUntil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return throttle, nil
+		}
+		return adminauth.LoginThrottle{}, ErrAdminAuthDB.Wrap(err)
+	}
+
+	throttle.LockedUntil = lockedUntil.Time
+
+	return throttle, nil
+}
+
+// RecordLoginFailure increments failures counter of the key and returns updated state,
+// counter starts over if the last failure happened before resetBefore.
+func (repository *adminauthdb) RecordLoginFailure(ctx context.Context, key string, failedAt, resetBefore time.Time) (adminauth.LoginThrottle, error) {
+	statement := `INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, $2)
+					ON CONFLICT (key) DO UPDATE SET
+						failures = CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+						locked_until = CASE WHEN login_throttles.last_failure_at < $3 THEN NULL ELSE login_throttles.locked_until END,
+						last_failure_at = EXCLUDED.last_failure_at
+					RETURNING failures, last_failure_at, locked_until;`
+
+	throttle := adminauth.LoginThrottle{
+		Key: key,
+	}
+
+	var lockedUntil sql.NullTime
+	row := repository.conn.QueryRowContext(ctx, statement, key, failedAt, resetBefore)
+	if err := row.Scan(&throttle.Failures, &throttle.LastFailureAt, &lockedUntil); err != nil {
+		return adminauth.LoginThrottle{}, ErrAdminAuthDB.Wrap(err)
+	}
+
+	throttle.LockedUntil = lockedUntil.Time
+
+	return throttle, nil
+}
+
+// LockLogin prohibits login attempts for the key until specified time.
+func (repository *adminauthdb) LockLogin(ctx context.Context, key string, lockedUntil time.Time) error {
+	statement := `UPDATE login_throttles SET locked_until = $1 WHERE key = $2;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, lockedUntil, key)
+
+	return ErrAdminAuthDB.Wrap(err)
+}
+
+// ResetLoginThrottle removes throttling state of the key.
+func (repository *adminauthdb) ResetLoginThrottle(ctx context.Context, key string) error {
+	statement := `DELETE FROM login_throttles WHERE key = $1;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, key)
+
+	return ErrAdminAuthDB.Wrap(err)
+}
+
+// AddLoginAttempt records login attempt for auditing.
+func (repository *adminauthdb) AddLoginAttempt(ctx context.Context, attempt adminauth.LoginAttempt) error {
+	statement := `INSERT INTO login_attempts (id, email, ip, manager_id, success, reason, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	var managerID interface{}
+	if attempt.ManagerID != uuid.Nil {
+		managerID = attempt.ManagerID
+	}
+
+	_, err := repository.conn.ExecContext(ctx, statement, attempt.ID, attempt.Email, attempt.IP, managerID, attempt.Success, attempt.Reason, attempt.CreatedAt)
+
+	return ErrAdminAuthDB.Wrap(err)
+}
+
+// ListFailedLoginIPs returns distinct IP addresses of failed login attempts of the manager since specified time.
+func (repository *adminauthdb) ListFailedLoginIPs(ctx context.Context, managerID uuid.UUID, since time.Time) (_ []string, err error) {
+	statement := `SELECT DISTINCT ip FROM login_attempts WHERE manager_id = $1 AND success = FALSE AND created_at >= $2;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement, managerID, since)
+	if err != nil {
+		return nil, ErrAdminAuthDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err = rows.Scan(&ip); err != nil {
+			return nil, ErrAdminAuthDB.Wrap(err)
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, ErrAdminAuthDB.Wrap(rows.Err())
+}
+
+// AddPasswordToken saves password token.
+func (repository *adminauthdb) AddPasswordToken(ctx context.Context, token adminauth.PasswordToken) error {
+	statement := `INSERT INTO manager_password_tokens (token_hash, manager_id, purpose, created_at, expires_at) VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := repository.conn.ExecContext(ctx, statement, token.Hash, token.ManagerID, token.Purpose, token.CreatedAt, token.ExpiresAt)
+
+	return ErrAdminAuthDB.Wrap(err)
+}
+
+// GetPasswordToken returns password token by hash, returns ErrNoPasswordToken if there is no such token.
+func (repository *adminauthdb) GetPasswordToken(ctx context.Context, hash []byte) (adminauth.PasswordToken, error) {
+	statement := `SELECT manager_id, purpose, created_at, expires_at, used_at FROM manager_password_tokens WHERE token_hash = $1;`
+
+	token := adminauth.PasswordToken{
+		Hash: hash,
+	}
+
+	var usedAt sql.NullTime
+	row := repository.conn.QueryRowContext(ctx, statement, hash)
+	if err := row.Scan(&token.ManagerID, &token.Purpose, &token.CreatedAt, &token.ExpiresAt, &usedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return adminauth.PasswordToken{}, adminauth.ErrNoPasswordToken.Wrap(err)
+		}
+		return adminauth.PasswordToken{}, ErrAdminAuthDB.Wrap(err)
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	return token, nil
+}
+
+// DeletePasswordTokens deletes all password tokens of the manager.
+func (repository *adminauthdb) DeletePasswordTokens(ctx context.Context, managerID uuid.UUID) error {
+	statement := `DELETE FROM manager_password_tokens WHERE manager_id = $1;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, managerID)
+
+	return ErrAdminAuthDB.Wrap(err)
+}
+
+// UsePasswordToken marks unused password token as used, returns ErrNoPasswordToken if there is no such token.
+func (repository *adminauthdb) UsePasswordToken(ctx context.Context, hash []byte, usedAt time.Time) error {
+	statement := `UPDATE manager_password_tokens SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, usedAt, hash)
+	if err != nil {
+		return ErrAdminAuthDB.Wrap(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ErrAdminAuthDB.Wrap(err)
+	}
+	if affected == 0 {
+		return adminauth.ErrNoPasswordToken.New("")
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/audit"
+)
+
+// ensures that auditdb implements audit.DB.
+var _ audit.DB = (*auditdb)(nil)
+
+// ErrAuditDB in the error class that indicates about AuditDB error.
+var ErrAuditDB = errs.Class("AuditDB error")
+
+// auditdb is a Postgres implementation of audit.DB.
+//
+// architecture: Database
+type auditdb struct {
+	conn executor
+}
+
+// auditColumns is a list of columns selected for audit entry.
+const auditColumns = `sequence, id, actor_id, actor_type, action, entity_type, entity_id, changes, ip, user_agent, created_at, prev_hash, hash`
+
+// Append links entry to the last entry of the chain, calculates its hash and saves it.
+// Within WithTx the lock on audit log is held until the whole transaction ends.
+func (repository *auditdb) Append(ctx context.Context, entry audit.Entry) (appended audit.Entry, err error) {
+	err = inTx(ctx, repository.conn, func(tx executor) error {
+		appended, err = appendEntry(ctx, tx, entry)
+		return err
+	})
+
+	return appended, err
+}
+
+// appendEntry appends entry within transaction.
+func appendEntry(ctx context.Context, tx executor, entry audit.Entry) (audit.Entry, error) {
+	// exclusive lock serializes appends, readers are not blocked.
+	_, err := tx.ExecContext(ctx, `LOCK TABLE audit_log IN EXCLUSIVE MODE;`)
+	if err != nil {
+		return audit.Entry{}, ErrAuditDB.Wrap(err)
+	}
+
+	row := tx.QueryRowContext(ctx, `SELECT sequence, hash FROM audit_log ORDER BY sequence DESC LIMIT 1;`)
+	err = row.Scan(&entry.Sequence, &entry.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return audit.Entry{}, ErrAuditDB.Wrap(err)
+	}
+
+	entry.Sequence++
+	entry.Hash = entry.CalculateHash()
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return audit.Entry{}, ErrAuditDB.Wrap(err)
+	}
+
+	var actorID interface{}
+	if entry.ActorID != uuid.Nil {
+		actorID = entry.ActorID
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (`+auditColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);`,
+		entry.Sequence, entry.ID, actorID, entry.ActorType, entry.Action, entry.EntityType, entry.EntityID, changes,
+		entry.IP, entry.UserAgent, entry.CreatedAt, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return audit.Entry{}, ErrAuditDB.Wrap(err)
+	}
+
+	return entry, nil
+}
+
+// List returns entries which match the filter ordered by sequence number, newest first.
+func (repository *auditdb) List(ctx context.Context, filter audit.Filter) ([]audit.Entry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if filter.ActorID != uuid.Nil {
+		where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("created_at < ?", filter.To)
+	}
+
+	statement := `SELECT ` + auditColumns + ` FROM audit_log`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	statement += ` ORDER BY sequence DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		statement += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+
+	return repository.query(ctx, statement, args...)
+}
+
+// Chain returns all entries ordered by sequence number, oldest first.
+func (repository *auditdb) Chain(ctx context.Context) ([]audit.Entry, error) {
+	return repository.query(ctx, `SELECT `+auditColumns+` FROM audit_log ORDER BY sequence ASC`)
+}
+
+// query selects audit entries.
+func (repository *auditdb) query(ctx context.Context, statement string, args ...interface{}) (entries []audit.Entry, err error) {
+	rows, err := repository.conn.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, ErrAuditDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		var entry audit.Entry
+		var actorID, changes []byte
+
+		err = rows.Scan(&entry.Sequence, &entry.ID, &actorID, &entry.ActorType, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&changes, &entry.IP, &entry.UserAgent, &entry.CreatedAt, &entry.PrevHash, &entry.Hash)
+		if err != nil {
+			return nil, ErrAuditDB.Wrap(err)
+		}
+
+		if len(actorID) > 0 {
+			entry.ActorID, err = uuid.ParseBytes(actorID)
+			if err != nil {
+				return nil, ErrAuditDB.Wrap(err)
+			}
+		}
+		if err = json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, ErrAuditDB.Wrap(err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, ErrAuditDB.Wrap(rows.Err())
+}
@@ -7,12 +7,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/zeebo/errs"
 
 	"cleanmasters/clients"
+	"cleanmasters/internal/mail"
 )
 
 // ensures that clients implements cleanmasters.Clients.
@@ -25,49 +29,86 @@ var ErrClientsBD = errs.Class("ClientsDB error")
 //
 // architecture: database
 type clientsdb struct {
-	conn *sql.DB
+	conn executor
 }
 
 // Add is a method for inserting new Client to the database.
 func (repository *clientsdb) Add(ctx context.Context, client clients.Client) error {
 
-	statement := `INSERT INTO clients (id, email, phone, first_name, last_name, created_at) VALUES ($1, $2, $3, $4, $5, $6);`
+	statement := `INSERT INTO clients (id, email, email_normalized, phone, first_name, last_name, created_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
 
-	_, err := repository.conn.ExecContext(ctx, statement, client.ID, client.Email, client.Phone, client.FirstName, client.LastName, time.Now().UTC())
+	_, err := repository.conn.ExecContext(ctx, statement, client.ID, client.Email, normalizedEmail(client.Email), client.Phone, client.FirstName, client.LastName, time.Now().UTC(), client.Version)
 
-	return ErrClientsBD.Wrap(err)
+	return ErrClientsBD.Wrap(constraintError(err))
 }
 
 // Register is a method for inserting new Client to the database.
 func (repository *clientsdb) Register(ctx context.Context, phone string) (uuid.UUID, error) {
 	id := uuid.New()
 
-	statement := `INSERT INTO clients (id, email, phone, first_name, last_name, created_at) VALUES ($1, $2, $3, $4, $5, $6);`
+	statement := `INSERT INTO clients (id, email, phone, first_name, last_name, created_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7);`
 
-	_, err := repository.conn.ExecContext(ctx, statement, id, "", phone, "", "", time.Now().UTC())
+	_, err := repository.conn.ExecContext(ctx, statement, id, "", phone, "", "", time.Now().UTC(), 1)
 
-	return id, ErrClientsBD.Wrap(err)
+	return id, ErrClientsBD.Wrap(constraintError(err))
 }
 
 // Update is a method for updating a Client in the database.
+// Client is updated only if its version is not changed, otherwise clients.ErrConflict is returned.
+// Normalized email is written only if email is changed, so clients which share email with older ones
+// since before emails were normalized keep it empty and could be updated.
 func (repository *clientsdb) Update(ctx context.Context, client clients.Client) error {
 	statement := `UPDATE clients 
 					SET phone = $1,
 						first_name = $2,
 						last_name = $3,
-						email = $4
-					WHERE id = $5`
+						email = $4,
+						email_normalized = CASE WHEN email IS NOT DISTINCT FROM $4 THEN email_normalized ELSE $7 END,
+						email_verified_at = CASE WHEN email IS NOT DISTINCT FROM $4 OR email_normalized IS NOT DISTINCT FROM $7
+							THEN email_verified_at END,
+						version = version + 1
+					WHERE id = $5 AND version = $6 AND deleted_at IS NULL`
+
+	result, err := repository.conn.ExecContext(ctx, statement, client.Phone, client.FirstName, client.LastName, client.Email, client.ID, client.Version,
+		normalizedEmail(client.Email))
+	if err != nil {
+		return ErrClientsBD.Wrap(constraintError(err))
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+	if updated == 0 {
+		current, err := repository.Get(ctx, client.ID)
+		if err != nil {
+			return err
+		}
 
-	_, err := repository.conn.ExecContext(ctx, statement, client.Phone, client.FirstName, client.LastName, client.Email, client.ID)
+		return clients.ErrConflict.New("version %d is changed to %d", client.Version, current.Version)
+	}
 
-	return ErrClientsBD.Wrap(err)
+	return nil
 }
 
-// List is used to return all clients.
-func (repository *clientsdb) List(ctx context.Context) (clientList []clients.Client, err error) {
-	statement := `SELECT id, email, phone, first_name, last_name, created_at FROM clients;`
+// ListByContacts is used to return clients which have one of the phones or one of the emails,
+// phones are compared by digits and emails in normalized form.
+func (repository *clientsdb) ListByContacts(ctx context.Context, phones, emails []string) (clientList []clients.Client, err error) {
+	statement := `SELECT id, email, phone, first_name, last_name, created_at, version
+					FROM clients
+					WHERE (` + phoneDigits + ` = ANY($1) OR email_normalized = ANY($2)) AND deleted_at IS NULL;`
 
-	rows, err := repository.conn.QueryContext(ctx, statement)
+	digits := make([]string, 0, len(phones))
+	for _, phone := range phones {
+		digits = append(digits, clients.PhoneDigits(phone))
+	}
+
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		normalized = append(normalized, mail.NormalizeAddress(email))
+	}
+
+	rows, err := repository.conn.QueryContext(ctx, statement, pq.Array(digits), pq.Array(normalized))
 	if err != nil {
 		return nil, ErrClientsBD.Wrap(err)
 	}
@@ -76,28 +117,201 @@ func (repository *clientsdb) List(ctx context.Context) (clientList []clients.Cli
 	for rows.Next() {
 		client := clients.Client{}
 
-		var id []byte
-		if err := rows.Scan(&id, &client.Email, &client.Phone, &client.FirstName, &client.LastName, &client.CreatedAt); err != nil {
+		if err := rows.Scan(&client.ID, &client.Email, &client.Phone, &client.FirstName, &client.LastName, &client.CreatedAt, &client.Version); err != nil {
 			return nil, ErrClientsBD.Wrap(err)
 		}
 
-		client.ID, err = uuid.ParseBytes(id)
-		if err != nil {
+		clientList = append(clientList, client)
+	}
+
+	return clientList, ErrClientsBD.Wrap(rows.Err())
+}
+
+// sortColumns maps sort fields to columns of the keyset, id makes the order unique.
+var sortColumns = map[clients.SortField][]string{
+	clients.SortByName:      {"last_name", "first_name", "id"},
+	clients.SortByCreatedAt: {"created_at", "id"},
+	clients.SortByPhone:     {"phone", "id"},
+}
+
+// List is used to return at most query.Limit clients which match the filter, in query order.
+// Clients right after the cursor are returned, or right before it if cursor is backward.
+func (repository *clientsdb) List(ctx context.Context, query clients.ListQuery) (clientList []clients.Client, err error) {
+	err = repository.iterate(ctx, query, func(client clients.Client) error {
+		clientList = append(clientList, client)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(clientList)-1; i < j; i, j = i+1, j-1 {
+			clientList[i], clientList[j] = clientList[j], clientList[i]
+		}
+	}
+
+	return clientList, nil
+}
+
+// Iterate calls fn for every client which matches the filter, in query order, cursor and limit are ignored.
+// Clients are read from database cursor one by one, iteration stops on the first error returned by fn.
+func (repository *clientsdb) Iterate(ctx context.Context, query clients.ListQuery, fn func(clients.Client) error) error {
+	query.Cursor, query.Limit = nil, 0
+	return repository.iterate(ctx, query, fn)
+}
+
+// iterate calls fn for every client selected by query, backward page is selected in reversed order.
+func (repository *clientsdb) iterate(ctx context.Context, query clients.ListQuery, fn func(clients.Client) error) (err error) {
+	columns, ok := sortColumns[query.Sort]
+	if !ok {
+		return ErrClientsBD.New("unknown sort field %q", query.Sort)
+	}
+
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if !query.Filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(query.Filter.CreatedFrom))
+	}
+	if !query.Filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(query.Filter.CreatedTo))
+	}
+	switch query.Filter.Email {
+	case clients.EmailPresent:
+		conditions = append(conditions, "email <> ''")
+	case clients.EmailMissing:
+		conditions = append(conditions, "email = ''")
+	}
+
+	desc := query.Desc
+	backward := query.Cursor != nil && query.Cursor.Backward
+	if backward {
+		desc = !desc
+	}
+
+	if query.Cursor != nil {
+		values := map[string]interface{}{
+			"last_name":  query.Cursor.LastName,
+			"first_name": query.Cursor.FirstName,
+			"created_at": query.Cursor.CreatedAt,
+			"phone":      query.Cursor.Phone,
+			"id":         query.Cursor.ID,
+		}
+
+		placeholders := make([]string, 0, len(columns))
+		for _, column := range columns {
+			placeholders = append(placeholders, arg(values[column]))
+		}
+
+		operator := ">"
+		if desc {
+			operator = "<"
+		}
+		conditions = append(conditions, "("+strings.Join(columns, ", ")+") "+operator+" ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	order := make([]string, 0, len(columns))
+	for _, column := range columns {
+		order = append(order, column+direction)
+	}
+
+	statement := `SELECT id, email, phone, first_name, last_name, created_at, version FROM clients` +
+		` WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY ` + strings.Join(order, ", ")
+	if query.Limit > 0 {
+		statement += ` LIMIT ` + arg(query.Limit)
+	}
+
+	rows, err := repository.conn.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		client := clients.Client{}
+
+		if err := rows.Scan(&client.ID, &client.Email, &client.Phone, &client.FirstName, &client.LastName, &client.CreatedAt, &client.Version); err != nil {
+			return ErrClientsBD.Wrap(err)
+		}
+
+		if err = fn(client); err != nil {
+			return err
+		}
+	}
+
+	return ErrClientsBD.Wrap(rows.Err())
+}
+
+// searchDocument is an expression of clients full-text search document, it matches clients_search_idx.
+const searchDocument = `to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || coalesce(email, ''))`
+
+// phoneDigits is an expression of digits of client phone, it matches clients.PhoneDigits,
+// clients_phone_digits_idx and clients_phone_digits_trgm_idx.
+const phoneDigits = `regexp_replace(phone, '\D', '', 'g')`
+
+// Search is used to return at most limit clients which match the query, most relevant first.
+// Names and email are matched by trigram similarity and full-text search, phone is matched by digits fragment.
+func (repository *clientsdb) Search(ctx context.Context, query clients.SearchQuery, limit int) (results []clients.SearchResult, err error) {
+	statement := `SELECT id, email, phone, first_name, last_name, created_at, version,
+						GREATEST(
+							similarity(lower(last_name), $1),
+							similarity(lower(first_name), $1),
+							similarity(lower(email), $1),
+							CASE WHEN lower(email) LIKE $2 || '%' THEN 0.9 WHEN lower(email) LIKE '%' || $2 || '%' THEN 0.6 ELSE 0 END,
+							CASE WHEN $3 = '' THEN 0 WHEN ` + phoneDigits + ` LIKE '%' || $3 THEN 1 WHEN ` + phoneDigits + ` LIKE '%' || $3 || '%' THEN 0.8 ELSE 0 END,
+							ts_rank(` + searchDocument + `, plainto_tsquery('simple', $1))
+						) AS rank
+					FROM clients
+					WHERE (lower(last_name) % $1
+						OR lower(first_name) % $1
+						OR lower(email) % $1
+						OR lower(email) LIKE '%' || $2 || '%'
+						OR ($3 <> '' AND ` + phoneDigits + ` LIKE '%' || $3 || '%')
+						OR ` + searchDocument + ` @@ plainto_tsquery('simple', $1))
+						AND deleted_at IS NULL
+					ORDER BY rank DESC, last_name, first_name, id
+					LIMIT $4;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement, query.Text, escapeLike(query.Text), query.Digits, limit)
+	if err != nil {
+		return nil, ErrClientsBD.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		var result clients.SearchResult
+
+		if err := rows.Scan(&result.ID, &result.Email, &result.Phone, &result.FirstName, &result.LastName, &result.CreatedAt, &result.Version, &result.Rank); err != nil {
 			return nil, ErrClientsBD.Wrap(err)
 		}
 
-		clientList = append(clientList, client)
+		results = append(results, result)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, ErrClientsBD.Wrap(err)
 	}
 
-	return clientList, nil
+	return results, nil
+}
+
+// escapeLike escapes LIKE pattern special characters, so value is matched literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
 }
 
 // GetByID is used to return client by id.
 func (repository *clientsdb) Get(ctx context.Context, id uuid.UUID) (clients.Client, error) {
-	statement := `SELECT phone, first_name, last_name, email FROM clients WHERE id = $1;`
+	statement := `SELECT phone, first_name, last_name, email, created_at, version, email_verified_at FROM clients WHERE id = $1 AND deleted_at IS NULL;`
 
 	client := clients.Client{
 		ID: id,
@@ -105,7 +319,7 @@ func (repository *clientsdb) Get(ctx context.Context, id uuid.UUID) (clients.Cli
 
 	row := repository.conn.QueryRowContext(ctx, statement, id)
 
-	if err := row.Scan(&client.Phone, &client.FirstName, &client.LastName, &client.Email); err != nil {
+	if err := row.Scan(&client.Phone, &client.FirstName, &client.LastName, &client.Email, &client.CreatedAt, &client.Version, &client.EmailVerifiedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return clients.Client{}, clients.ErrNotExist.Wrap(err)
 		}
@@ -117,7 +331,7 @@ func (repository *clientsdb) Get(ctx context.Context, id uuid.UUID) (clients.Cli
 
 // GetByPhone is used to return Client by phone number.
 func (repository *clientsdb) GetByPhone(ctx context.Context, phone string) (clients.Client, error) {
-	statement := `SELECT id, email, first_name, last_name FROM clients WHERE phone = $1;`
+	statement := `SELECT id, email, first_name, last_name, created_at, version, email_verified_at FROM clients WHERE phone = $1 AND deleted_at IS NULL;`
 
 	client := clients.Client{
 		Phone: phone,
@@ -125,16 +339,193 @@ func (repository *clientsdb) GetByPhone(ctx context.Context, phone string) (clie
 
 	row := repository.conn.QueryRowContext(ctx, statement, phone)
 
-	err := row.Scan(&client.ID, &client.Email, &client.FirstName, &client.LastName)
+	if err := row.Scan(&client.ID, &client.Email, &client.FirstName, &client.LastName, &client.CreatedAt, &client.Version, &client.EmailVerifiedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return clients.Client{}, clients.ErrNotExist.Wrap(err)
+		}
+		return clients.Client{}, ErrClientsBD.Wrap(err)
+	}
+
+	return client, nil
+}
+
+// GetByEmail is used to return Client by email, emails are compared in normalized form.
+func (repository *clientsdb) GetByEmail(ctx context.Context, email string) (clients.Client, error) {
+	statement := `SELECT id, email, phone, first_name, last_name, created_at, version, email_verified_at FROM clients WHERE email_normalized = $1 AND deleted_at IS NULL;`
+
+	var client clients.Client
+
+	row := repository.conn.QueryRowContext(ctx, statement, mail.NormalizeAddress(email))
+
+	if err := row.Scan(&client.ID, &client.Email, &client.Phone, &client.FirstName, &client.LastName, &client.CreatedAt, &client.Version, &client.EmailVerifiedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return clients.Client{}, clients.ErrNotExist.Wrap(err)
+		}
+		return clients.Client{}, ErrClientsBD.Wrap(err)
+	}
 
-	return client, ErrClientsBD.Wrap(err)
+	return client, nil
 }
 
-// Delete deletes specified client.
+// Delete marks client as deleted, deleted client is hidden until it is restored or purged.
 func (repository *clientsdb) Delete(ctx context.Context, id uuid.UUID) error {
-	statement := `DELETE FROM clients WHERE id = $1`
+	statement := `UPDATE clients SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, id, time.Now().UTC())
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+
+	return clientAffected(result)
+}
+
+// ListDeleted is used to return deleted clients which are not purged yet, recently deleted first.
+func (repository *clientsdb) ListDeleted(ctx context.Context) (clientList []clients.Client, err error) {
+	statement := `SELECT id, email, phone, first_name, last_name, created_at, version, deleted_at
+					FROM clients
+					WHERE deleted_at IS NOT NULL
+					ORDER BY deleted_at DESC, id;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, ErrClientsBD.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		client := clients.Client{}
+
+		if err := rows.Scan(&client.ID, &client.Email, &client.Phone, &client.FirstName, &client.LastName, &client.CreatedAt, &client.Version, &client.DeletedAt); err != nil {
+			return nil, ErrClientsBD.Wrap(err)
+		}
+
+		clientList = append(clientList, client)
+	}
+
+	return clientList, ErrClientsBD.Wrap(rows.Err())
+}
+
+// Restore makes deleted client visible again.
+func (repository *clientsdb) Restore(ctx context.Context, id uuid.UUID) error {
+	statement := `UPDATE clients SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, id)
+	if err != nil {
+		return ErrClientsBD.Wrap(constraintError(err))
+	}
+
+	return clientAffected(result)
+}
+
+// Purge permanently deletes clients which were deleted before the time, ids of purged clients are returned.
+func (repository *clientsdb) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	statement := `DELETE FROM clients WHERE deleted_at < $1 RETURNING id;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement, deletedBefore)
+	if err != nil {
+		return nil, ErrClientsBD.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
 
-	_, err := repository.conn.ExecContext(ctx, statement, id)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, ErrClientsBD.Wrap(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, ErrClientsBD.Wrap(rows.Err())
+}
+
+// SetEmailVerification saves email verification, pending verification of the client is replaced.
+func (repository *clientsdb) SetEmailVerification(ctx context.Context, verification clients.EmailVerification) error {
+	statement := `INSERT INTO client_email_verifications (client_id, email_normalized, code_hash, attempts, created_at, expires_at)
+					VALUES ($1, $2, $3, $4, $5, $6)
+					ON CONFLICT (client_id) DO UPDATE SET
+						email_normalized = EXCLUDED.email_normalized,
+						code_hash = EXCLUDED.code_hash,
+						attempts = EXCLUDED.attempts,
+						created_at = EXCLUDED.created_at,
+						expires_at = EXCLUDED.expires_at;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, verification.ClientID, verification.Email, verification.CodeHash,
+		verification.Attempts, verification.CreatedAt, verification.ExpiresAt)
 
 	return ErrClientsBD.Wrap(err)
 }
+
+// GetEmailVerification returns pending email verification of the client.
+func (repository *clientsdb) GetEmailVerification(ctx context.Context, clientID uuid.UUID) (clients.EmailVerification, error) {
+	statement := `SELECT email_normalized, code_hash, attempts, created_at, expires_at FROM client_email_verifications WHERE client_id = $1;`
+
+	verification := clients.EmailVerification{
+		ClientID: clientID,
+	}
+
+	row := repository.conn.QueryRowContext(ctx, statement, clientID)
+
+	err := row.Scan(&verification.Email, &verification.CodeHash, &verification.Attempts, &verification.CreatedAt, &verification.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return clients.EmailVerification{}, clients.ErrNoEmailVerification.Wrap(err)
+		}
+		return clients.EmailVerification{}, ErrClientsBD.Wrap(err)
+	}
+
+	return verification, nil
+}
+
+// AddEmailVerificationAttempt increments number of wrong codes entered for pending email verification.
+func (repository *clientsdb) AddEmailVerificationAttempt(ctx context.Context, clientID uuid.UUID) error {
+	statement := `UPDATE client_email_verifications SET attempts = attempts + 1 WHERE client_id = $1;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, clientID)
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+	if updated == 0 {
+		return clients.ErrNoEmailVerification.Wrap(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// VerifyEmail marks current email of the client as verified and removes pending email verification.
+func (repository *clientsdb) VerifyEmail(ctx context.Context, clientID uuid.UUID, verifiedAt time.Time) error {
+	statement := `WITH verification AS (DELETE FROM client_email_verifications WHERE client_id = $1)
+					UPDATE clients SET email_verified_at = $2 WHERE id = $1 AND deleted_at IS NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, clientID, verifiedAt)
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+
+	return clientAffected(result)
+}
+
+// clientAffected returns clients.ErrNotExist if statement did not change any client.
+func clientAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ErrClientsBD.Wrap(err)
+	}
+	if affected == 0 {
+		return clients.ErrNotExist.Wrap(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// normalizedEmail returns normalized email which is stored for lookups, empty email is stored as NULL.
+func normalizedEmail(email string) sql.NullString {
+	normalized := mail.NormalizeAddress(email)
+
+	return sql.NullString{String: normalized, Valid: normalized != ""}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Config defines connection pool of Postgres database and how it is checked when it is opened.
+type Config struct {
+	// MaxOpenConns limits number of connections opened at once.
+	MaxOpenConns int
+	// MaxIdleConns is a number of unused connections which are kept open.
+	MaxIdleConns int
+	// ConnMaxLifetime is a period after which connection is closed and replaced with a new one.
+	ConnMaxLifetime time.Duration
+	// StatementTimeout aborts statements which run longer, it is sent to Postgres as statement_timeout,
+	// so connection string could override it.
+	StatementTimeout time.Duration
+	// Ping defines how database is checked when it is opened.
+	Ping PingConfig
+}
+
+// PingConfig defines how opened database is waited for.
+type PingConfig struct {
+	// Attempts is a number of pings before database is considered unavailable.
+	Attempts int
+	// Backoff is a delay after the first failed ping, it is doubled after every next one.
+	Backoff time.Duration
+	// MaxBackoff limits delay between pings.
+	MaxBackoff time.Duration
+}
+
+// DefaultConfig is used when database is not configured.
+var DefaultConfig = Config{
+	MaxOpenConns:     25,
+	MaxIdleConns:     5,
+	ConnMaxLifetime:  30 * time.Minute,
+	StatementTimeout: 30 * time.Second,
+	Ping: PingConfig{
+		Attempts:   5,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	},
+}
+
+// withDefaults returns config where empty fields are replaced with DefaultConfig values.
+func (config Config) withDefaults() Config {
+	if config.MaxOpenConns <= 0 {
+		config.MaxOpenConns = DefaultConfig.MaxOpenConns
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = DefaultConfig.MaxIdleConns
+	}
+	if config.MaxIdleConns > config.MaxOpenConns {
+		config.MaxIdleConns = config.MaxOpenConns
+	}
+	if config.ConnMaxLifetime <= 0 {
+		config.ConnMaxLifetime = DefaultConfig.ConnMaxLifetime
+	}
+	if config.StatementTimeout <= 0 {
+		config.StatementTimeout = DefaultConfig.StatementTimeout
+	}
+	if config.Ping.Attempts <= 0 {
+		config.Ping.Attempts = DefaultConfig.Ping.Attempts
+	}
+	if config.Ping.Backoff <= 0 {
+		config.Ping.Backoff = DefaultConfig.Ping.Backoff
+	}
+	if config.Ping.MaxBackoff <= 0 {
+		config.Ping.MaxBackoff = DefaultConfig.Ping.MaxBackoff
+	}
+
+	return config
+}
+
+// connectionString returns key=value connection string which sets statement timeout of every connection.
+// Later settings take precedence, so timeout set in database URL is kept.
+func connectionString(databaseURL string, statementTimeout time.Duration) (string, error) {
+	dsn := databaseURL
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSpace(fmt.Sprintf("statement_timeout=%d %s", statementTimeout.Milliseconds(), dsn)), nil
+}
+
+// ping checks that database is available, failed ping is retried with growing delay.
+func ping(ctx context.Context, conn *sql.DB, config PingConfig) error {
+	backoff := config.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := conn.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= config.Attempts {
+			return Error.New("database is not available after %d attempts: %v", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Error.Wrap(ctx.Err())
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
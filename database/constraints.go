@@ -0,0 +1,50 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/clients"
+	"cleanmasters/internal/fielderr"
+	"cleanmasters/internal/postgres"
+)
+
+// constraintErrors maps names of unique and foreign key constraints to errors about fields they guard.
+var constraintErrors = map[string]*fielderr.Error{
+	"clients_phone_key":             clients.ErrPhoneTaken,
+	"clients_email_normalized_key":  clients.ErrEmailTaken,
+	"managers_email_normalized_key": managers.ErrEmailTaken,
+}
+
+// columnFields maps column names to names of entity fields if they differ.
+var columnFields = map[string]string{
+	"first_name":       "firstName",
+	"last_name":        "lastName",
+	"email_normalized": "email",
+	"password_hash":    "password",
+}
+
+// constraintError translates integrity constraint violation into error about the offending field.
+// Other errors, as well as violations of constraints which are not known, are returned as is.
+func constraintError(err error) error {
+	violation, ok := postgres.AsConstraintViolation(err)
+	if !ok {
+		return err
+	}
+
+	if fieldErr, ok := constraintErrors[violation.Constraint]; ok {
+		return fieldErr
+	}
+
+	if violation.Code == postgres.CodeNotNullViolation && violation.Column != "" {
+		field := violation.Column
+		if name, ok := columnFields[field]; ok {
+			field = name
+		}
+
+		return fielderr.New(field, fielderr.KindRequired)
+	}
+
+	return err
+}
@@ -6,13 +6,20 @@ package database
 import (
 	"context"
 	"database/sql"
+	"net/url"
+	"strings"
 
 	_ "github.com/lib/pq" // postgres driver.
 	"github.com/zeebo/errs"
 
 	"cleanmasters"
+	"cleanmasters/adminportal/adminauth"
 	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
 	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/database/memdb"
+	"cleanmasters/database/migrate"
 )
 
 var (
@@ -26,63 +33,156 @@ var _ cleanmasters.DB = (*database)(nil)
 // database is a Postgres implementation of the admin DB.
 type database struct {
 	conn *sql.DB
+	// tx is set if database is obtained within WithTx, repositories run statements in it.
+	tx *sql.Tx
 }
 
 // Close closes underlying db connection.
 func (db *database) Close() error {
+	if db.tx != nil {
+		return Error.New("database could not be closed within transaction")
+	}
+
 	return Error.Wrap(db.conn.Close())
 }
 
-// CreateSchema create tables.
-func (db *database) CreateSchema(ctx context.Context) (err error) {
-	createTableQuery :=
-		`
-		CREATE TABLE IF NOT EXISTS clients (
-            id                  BYTEA NOT NULL,
-            phone               TEXT  NOT NULL,
-            first_name          TEXT,
-            last_name           TEXT,
-            email               TEXT,
-            email_normalized    TEXT,
-            created_at          timestamp with time zone NOT NULL,
-            PRIMARY KEY(id),
-            UNIQUE (phone),
-            UNIQUE (email_normalized)
-		);
-		CREATE TABLE IF NOT EXISTS managers (
-            id                  BYTEA NOT NULL,
-            first_name          TEXT  NOT NULL,
-            last_name           TEXT  NOT NULL,
-            email               TEXT  NOT NULL,
-            email_normalized    TEXT  NOT NULL,
-            password_hash       BYTEA NOT NULL,
-            created_at          timestamp with time zone NOT NULL,
-            PRIMARY KEY(id),
-            UNIQUE (email_normalized)
-		);
-		`
-
-	_, err = db.conn.ExecContext(ctx, createTableQuery)
+// Ping checks that database is available.
+func (db *database) Ping(ctx context.Context) error {
+	return Error.Wrap(db.conn.PingContext(ctx))
+}
+
+// Stats returns statistics of connection pool.
+func (db *database) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
 
+// MigrateToLatest applies all pending schema migrations.
+func (db *database) MigrateToLatest(ctx context.Context) error {
+	if db.tx != nil {
+		return Error.New("migrations could not be applied within transaction")
+	}
+
+	_, err := migrate.New(db.conn, migrations).Up(ctx)
 	return Error.Wrap(err)
 }
 
-// Open returns cleanmasters.DB postgresql implementation.
-func Open(databaseURL string) (cleanmasters.DB, error) {
-	conn, err := sql.Open("postgres", databaseURL)
+// NewMigrator returns migrator of Postgres database opened with Open, so migrations could be inspected and applied.
+func NewMigrator(db cleanmasters.DB) (*migrate.Migrator, error) {
+	postgres, ok := db.(*database)
+	if !ok {
+		return nil, Error.New("migrations are supported only by postgres database")
+	}
+
+	return migrate.New(postgres.conn, migrations), nil
+}
+
+// Open returns cleanmasters.DB implementation selected by the scheme of database URL:
+// postgres:// and postgresql:// URLs and key=value connection strings open Postgres,
+// file: URLs open database stored in the single file, e.g. file:///var/lib/cleanmasters/cleanmasters.db,
+// "memory" opens empty in-memory database.
+// Postgres connection pool is set up by config and database is pinged until it is available.
+func Open(ctx context.Context, databaseURL string, config Config) (cleanmasters.DB, error) {
+	if databaseURL == memoryDatabase {
+		return memdb.New(), nil
+	}
+
+	switch scheme(databaseURL) {
+	case "", "postgres", "postgresql":
+		return openPostgres(ctx, databaseURL, config.withDefaults())
+	case "file":
+		parsed, err := url.Parse(databaseURL)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+
+		path := parsed.Path
+		if parsed.Opaque != "" {
+			path = parsed.Opaque
+		}
+		if path == "" {
+			return nil, Error.New("database file path is not set")
+		}
+
+		db, err := memdb.OpenFile(path)
+		return db, Error.Wrap(err)
+	default:
+		return nil, Error.New("unsupported database %q", scheme(databaseURL))
+	}
+}
+
+// memoryDatabase is a connection string of in-memory database, which is used for demos.
+const memoryDatabase = "memory"
+
+// scheme returns lowercase scheme of database URL, it is empty for key=value connection string.
+func scheme(databaseURL string) string {
+	colon := strings.IndexByte(databaseURL, ':')
+	if colon <= 0 {
+		return ""
+	}
+
+	for i, r := range databaseURL[:colon] {
+		letter := 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+		if !letter && (i == 0 || !('0' <= r && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return ""
+		}
+	}
+
+	return strings.ToLower(databaseURL[:colon])
+}
+
+// openPostgres returns cleanmasters.DB postgresql implementation.
+func openPostgres(ctx context.Context, databaseURL string, config Config) (cleanmasters.DB, error) {
+	dsn, err := connectionString(databaseURL, config.StatementTimeout)
 	if err != nil {
 		return nil, Error.Wrap(err)
 	}
 
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	conn.SetMaxOpenConns(config.MaxOpenConns)
+	conn.SetMaxIdleConns(config.MaxIdleConns)
+	conn.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	if err = ping(ctx, conn, config.Ping); err != nil {
+		return nil, errs.Combine(err, Error.Wrap(conn.Close()))
+	}
+
 	return &database{conn: conn}, nil
 }
 
 // Clients provides access to Clients store.
 func (db *database) Clients() clients.DB {
-	return &clientsdb{conn: db.conn}
+	return &clientsdb{conn: db.executor()}
 }
 
 // Managers provides access to Managers database.
 func (db *database) Managers() managers.DB {
-	return &managersdb{conn: db.conn}
+	return &managersdb{conn: db.executor()}
+}
+
+// ConsoleSessions provides access to console sessions database.
+func (db *database) ConsoleSessions() consoleauth.DB {
+	return &sessionsdb{conn: db.executor()}
+}
+
+// AdminAuth provides access to managers authentication database.
+func (db *database) AdminAuth() adminauth.DB {
+	return &adminauthdb{conn: db.executor()}
+}
+
+// Audit provides access to audit log database.
+func (db *database) Audit() audit.DB {
+	return &auditdb{conn: db.executor()}
+}
+
+// executor returns transaction if database is obtained within WithTx, otherwise the whole database.
+func (db *database) executor() executor {
+	if db.tx != nil {
+		return db.tx
+	}
+
+	return db.conn
 }
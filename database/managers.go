@@ -7,13 +7,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zeebo/errs"
 
 	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/mail"
 )
 
 // ensures that managers implements cleanmasters.Managers.
@@ -26,12 +26,13 @@ var ErrManagersDB = errs.Class("ManagersDB error")
 //
 // architecture: Database
 type managersdb struct {
-	conn *sql.DB
+	conn executor
 }
 
 // Get is used to return manager by id.
 func (repository *managersdb) Get(ctx context.Context, id uuid.UUID) (managers.Manager, error) {
-	statement := `SELECT password_hash, first_name, last_name, email, created_at FROM managers WHERE id = $1;`
+	statement := `SELECT password_hash, first_name, last_name, email, role, totp_secret, totp_enabled, totp_counter, created_at, version
+					FROM managers WHERE id = $1 AND deleted_at IS NULL;`
 
 	manager := managers.Manager{
 		ID: id,
@@ -39,7 +40,8 @@ func (repository *managersdb) Get(ctx context.Context, id uuid.UUID) (managers.M
 
 	row := repository.conn.QueryRowContext(ctx, statement, id)
 
-	if err := row.Scan(&manager.PasswordHash, &manager.FirstName, &manager.LastName, &manager.Email, &manager.CreatedAt); err != nil {
+	if err := row.Scan(&manager.PasswordHash, &manager.FirstName, &manager.LastName, &manager.Email, &manager.Role,
+		&manager.SecondFactor.Secret, &manager.SecondFactor.Enabled, &manager.SecondFactor.LastCounter, &manager.CreatedAt, &manager.Version); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return managers.Manager{}, managers.ErrNoManager.Wrap(err)
 		}
@@ -51,16 +53,17 @@ func (repository *managersdb) Get(ctx context.Context, id uuid.UUID) (managers.M
 
 // GetByEmail is used to return manager by id.
 func (repository *managersdb) GetByEmail(ctx context.Context, email string) (managers.Manager, error) {
-	statement := `SELECT id, first_name, last_name, password_hash, created_at FROM managers WHERE email_normalized = $1;`
+	statement := `SELECT id, first_name, last_name, password_hash, role, totp_secret, totp_enabled, totp_counter, created_at, version
+					FROM managers WHERE email_normalized = $1 AND deleted_at IS NULL;`
 
 	manager := managers.Manager{
 		Email: email,
 	}
 
-	row := repository.conn.QueryRowContext(ctx, statement, normalizeEmail(email))
+	row := repository.conn.QueryRowContext(ctx, statement, mail.NormalizeAddress(email))
 
-	var id []byte
-	err := row.Scan(&id, &manager.FirstName, &manager.LastName, &manager.PasswordHash, &manager.CreatedAt)
+	err := row.Scan(&manager.ID, &manager.FirstName, &manager.LastName, &manager.PasswordHash, &manager.Role,
+		&manager.SecondFactor.Secret, &manager.SecondFactor.Enabled, &manager.SecondFactor.LastCounter, &manager.CreatedAt, &manager.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return managers.Manager{}, managers.ErrNoManager.Wrap(err)
@@ -68,49 +71,75 @@ func (repository *managersdb) GetByEmail(ctx context.Context, email string) (man
 		return managers.Manager{}, ErrManagersDB.Wrap(err)
 	}
 
-	manager.ID, err = uuid.ParseBytes(id)
-	if err != nil {
-		return managers.Manager{}, ErrManagersDB.Wrap(err)
-	}
-
 	return manager, nil
 }
 
 // Update is a method for updating a Manager in the database.
+// Manager is updated only if its version is not changed, otherwise managers.ErrConflict is returned.
 func (repository *managersdb) Update(ctx context.Context, manager managers.Manager) error {
 	statement := `UPDATE managers 
 					SET password_hash = $1,
 						first_name = $2,
 						last_name = $3,
-						email = $4
-					WHERE id = $5`
+						email = $4,
+						email_normalized = $5,
+						role = $6,
+						totp_secret = $7,
+						totp_enabled = $8,
+						totp_counter = $9,
+						version = version + 1
+					WHERE id = $10 AND version = $11 AND deleted_at IS NULL`
+
+	result, err := repository.conn.ExecContext(ctx, statement, manager.PasswordHash, manager.FirstName, manager.LastName, manager.Email, mail.NormalizeAddress(manager.Email),
+		manager.Role, manager.SecondFactor.Secret, manager.SecondFactor.Enabled, manager.SecondFactor.LastCounter, manager.ID, manager.Version)
+	if err != nil {
+		return ErrManagersDB.Wrap(constraintError(err))
+	}
 
-	_, err := repository.conn.ExecContext(ctx, statement, manager.PasswordHash, manager.FirstName, manager.LastName, manager.Email, manager.ID)
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return ErrManagersDB.Wrap(err)
+	}
+	if updated == 0 {
+		current, err := repository.Get(ctx, manager.ID)
+		if err != nil {
+			return err
+		}
 
-	return ErrManagersDB.Wrap(err)
+		return managers.ErrConflict.New("version %d is changed to %d", manager.Version, current.Version)
+	}
+
+	return nil
 }
 
 // Add is a method for inserting new Manager to the database.
 func (repository *managersdb) Add(ctx context.Context, manager managers.Manager) error {
-	statement := `INSERT INTO managers (id, password_hash, first_name, last_name, email, email_normalized, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	statement := `INSERT INTO managers (id, password_hash, first_name, last_name, email, email_normalized, role, created_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
 
-	_, err := repository.conn.ExecContext(ctx, statement, manager.ID, manager.PasswordHash, manager.FirstName, manager.LastName, manager.Email, normalizeEmail(manager.Email), time.Now().UTC())
+	_, err := repository.conn.ExecContext(ctx, statement, manager.ID, manager.PasswordHash, manager.FirstName, manager.LastName, manager.Email, mail.NormalizeAddress(manager.Email), manager.Role, time.Now().UTC(), manager.Version)
 
-	return ErrManagersDB.Wrap(err)
+	return ErrManagersDB.Wrap(constraintError(err))
 }
 
-// Remove is a method for deleting a Manager from the database.
+// Remove marks manager as deleted, deleted manager is hidden until it is restored or purged.
 func (repository *managersdb) Remove(ctx context.Context, id uuid.UUID) error {
-	statement := `DELETE FROM managers WHERE id = $1;`
+	statement := `UPDATE managers SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL;`
 
-	_, err := repository.conn.ExecContext(ctx, statement, id)
+	result, err := repository.conn.ExecContext(ctx, statement, id, time.Now().UTC())
+	if err != nil {
+		return ErrManagersDB.Wrap(err)
+	}
 
-	return ErrManagersDB.Wrap(err)
+	return managerAffected(result)
 }
 
-// List is used to return all managers.
-func (repository *managersdb) List(ctx context.Context) (managerList []managers.Manager, err error) {
-	statement := `SELECT id, password_hash, first_name, last_name, email, created_at FROM managers;`
+// ListDeleted is used to return deleted managers which are not purged yet, recently deleted first.
+// Password hashes and second factor secrets are not selected.
+func (repository *managersdb) ListDeleted(ctx context.Context) (managerList []managers.Manager, err error) {
+	statement := `SELECT id, first_name, last_name, email, role, totp_enabled, created_at, version, deleted_at
+					FROM managers
+					WHERE deleted_at IS NOT NULL
+					ORDER BY deleted_at DESC, id;`
 
 	rows, err := repository.conn.QueryContext(ctx, statement)
 	if err != nil {
@@ -121,13 +150,77 @@ func (repository *managersdb) List(ctx context.Context) (managerList []managers.
 	for rows.Next() {
 		manager := managers.Manager{}
 
-		var id []byte
-		if err := rows.Scan(&id, &manager.PasswordHash, &manager.FirstName, &manager.LastName, &manager.Email, &manager.CreatedAt); err != nil {
+		if err := rows.Scan(&manager.ID, &manager.FirstName, &manager.LastName, &manager.Email, &manager.Role, &manager.SecondFactor.Enabled, &manager.CreatedAt, &manager.Version, &manager.DeletedAt); err != nil {
 			return nil, ErrManagersDB.Wrap(err)
 		}
 
-		manager.ID, err = uuid.ParseBytes(id)
-		if err != nil {
+		managerList = append(managerList, manager)
+	}
+
+	return managerList, ErrManagersDB.Wrap(rows.Err())
+}
+
+// Restore makes deleted manager visible again.
+func (repository *managersdb) Restore(ctx context.Context, id uuid.UUID) error {
+	statement := `UPDATE managers SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, id)
+	if err != nil {
+		return ErrManagersDB.Wrap(constraintError(err))
+	}
+
+	return managerAffected(result)
+}
+
+// Purge permanently deletes managers which were deleted before the time, ids of purged managers are returned.
+func (repository *managersdb) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	statement := `DELETE FROM managers WHERE deleted_at < $1 RETURNING id;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement, deletedBefore)
+	if err != nil {
+		return nil, ErrManagersDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, ErrManagersDB.Wrap(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, ErrManagersDB.Wrap(rows.Err())
+}
+
+// managerAffected returns managers.ErrNoManager if statement did not change any manager.
+func managerAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ErrManagersDB.Wrap(err)
+	}
+	if affected == 0 {
+		return managers.ErrNoManager.Wrap(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// List is used to return all managers.
+func (repository *managersdb) List(ctx context.Context) (managerList []managers.Manager, err error) {
+	statement := `SELECT id, password_hash, first_name, last_name, email, role, totp_enabled, created_at, version FROM managers WHERE deleted_at IS NULL;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, ErrManagersDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		manager := managers.Manager{}
+
+		if err := rows.Scan(&manager.ID, &manager.PasswordHash, &manager.FirstName, &manager.LastName, &manager.Email, &manager.Role, &manager.SecondFactor.Enabled, &manager.CreatedAt, &manager.Version); err != nil {
 			return nil, ErrManagersDB.Wrap(err)
 		}
 
@@ -140,7 +233,27 @@ func (repository *managersdb) List(ctx context.Context) (managerList []managers.
 	return managerList, nil
 }
 
-// normalizeEmail normalizes email for more elegant storing and checking.
-func normalizeEmail(email string) string {
-	return strings.ToUpper(email)
+// Iterate calls fn for every manager ordered by creation time, password hash and second factor secret are not selected.
+func (repository *managersdb) Iterate(ctx context.Context, fn func(managers.Manager) error) (err error) {
+	statement := `SELECT id, first_name, last_name, email, role, totp_enabled, created_at, version FROM managers WHERE deleted_at IS NULL ORDER BY created_at, id;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement)
+	if err != nil {
+		return ErrManagersDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		manager := managers.Manager{}
+
+		if err := rows.Scan(&manager.ID, &manager.FirstName, &manager.LastName, &manager.Email, &manager.Role, &manager.SecondFactor.Enabled, &manager.CreatedAt, &manager.Version); err != nil {
+			return ErrManagersDB.Wrap(err)
+		}
+
+		if err = fn(manager); err != nil {
+			return err
+		}
+	}
+
+	return ErrManagersDB.Wrap(rows.Err())
 }
@@ -0,0 +1,223 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/adminauth"
+)
+
+// ensures that adminauthdb implements adminauth.DB.
+var _ adminauth.DB = (*adminauthdb)(nil)
+
+// ErrAdminAuthDB in the error class that indicates about AdminAuthDB error.
+var ErrAdminAuthDB = errs.Class("AdminAuthDB error")
+
+// adminauthdb is an in-memory implementation of adminauth.DB.
+//
+// architecture: Database
+type adminauthdb struct {
+	db *database
+}
+
+// SetRecoveryCodes replaces all recovery codes of the manager.
+func (repository *adminauthdb) SetRecoveryCodes(ctx context.Context, managerID uuid.UUID, hashes [][]byte) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.managers[managerID]; !ok && len(hashes) > 0 {
+			return ErrAdminAuthDB.New("manager %s does not exist", managerID)
+		}
+
+		codes := make(map[recoveryCodeKey]*time.Time, len(hashes))
+		for _, hash := range hashes {
+			key := recoveryCodeKey{managerID: managerID, hash: string(hash)}
+			if _, ok := codes[key]; ok {
+				return ErrAdminAuthDB.New("recovery code is duplicated")
+			}
+			codes[key] = nil
+		}
+
+		for key := range tables.recoveryCodes {
+			if key.managerID == managerID {
+				tables.deleteRecoveryCode(key)
+			}
+		}
+		for key, usedAt := range codes {
+			tables.putRecoveryCode(key, usedAt)
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode marks unused recovery code as used, returns ErrNoRecoveryCode if there is no such code.
+func (repository *adminauthdb) UseRecoveryCode(ctx context.Context, managerID uuid.UUID, hash []byte, usedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		key := recoveryCodeKey{managerID: managerID, hash: string(hash)}
+
+		used, ok := tables.recoveryCodes[key]
+		if !ok || used != nil {
+			return adminauth.ErrNoRecoveryCode.New("")
+		}
+
+		tables.putRecoveryCode(key, timestampPtr(&usedAt))
+		return nil
+	})
+}
+
+// GetLoginThrottle returns throttling state of the key, zero state if there were no failures.
+func (repository *adminauthdb) GetLoginThrottle(ctx context.Context, key string) (throttle adminauth.LoginThrottle, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		throttle = tables.loginThrottles[key]
+		throttle.Key = key
+
+		return nil
+	})
+
+	return throttle, err
+}
+
+// RecordLoginFailure increments failures counter of the key and returns updated state,
+// counter starts over if the last failure happened before resetBefore.
+func (repository *adminauthdb) RecordLoginFailure(ctx context.Context, key string, failedAt, resetBefore time.Time) (throttle adminauth.LoginThrottle, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		throttle = tables.loginThrottles[key]
+		if throttle.LastFailureAt.Before(resetBefore) {
+			throttle = adminauth.LoginThrottle{}
+		}
+		throttle.Key = key
+		throttle.Failures++
+		throttle.LastFailureAt = timestamp(failedAt)
+		tables.putLoginThrottle(throttle)
+
+		return nil
+	})
+
+	return throttle, err
+}
+
+// LockLogin prohibits login attempts for the key until specified time.
+func (repository *adminauthdb) LockLogin(ctx context.Context, key string, lockedUntil time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		if throttle, ok := tables.loginThrottles[key]; ok {
+			throttle.LockedUntil = timestamp(lockedUntil)
+			tables.putLoginThrottle(throttle)
+		}
+
+		return nil
+	})
+}
+
+// ResetLoginThrottle removes throttling state of the key.
+func (repository *adminauthdb) ResetLoginThrottle(ctx context.Context, key string) error {
+	return repository.db.run(func(tables *tables) error {
+		tables.deleteLoginThrottle(key)
+
+		return nil
+	})
+}
+
+// AddLoginAttempt records login attempt for auditing.
+func (repository *adminauthdb) AddLoginAttempt(ctx context.Context, attempt adminauth.LoginAttempt) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.loginAttempts[attempt.ID]; ok {
+			return ErrAdminAuthDB.New("login attempt %s already exists", attempt.ID)
+		}
+
+		attempt.CreatedAt = timestamp(attempt.CreatedAt)
+		tables.putLoginAttempt(attempt)
+
+		return nil
+	})
+}
+
+// ListFailedLoginIPs returns distinct IP addresses of failed login attempts of the manager since specified time.
+func (repository *adminauthdb) ListFailedLoginIPs(ctx context.Context, managerID uuid.UUID, since time.Time) (ips []string, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		seen := map[string]bool{}
+		for _, attempt := range tables.loginAttempts {
+			if attempt.ManagerID != managerID || attempt.Success || attempt.CreatedAt.Before(since) || seen[attempt.IP] {
+				continue
+			}
+
+			seen[attempt.IP] = true
+			ips = append(ips, attempt.IP)
+		}
+
+		return nil
+	})
+
+	return ips, err
+}
+
+// AddPasswordToken saves password token.
+func (repository *adminauthdb) AddPasswordToken(ctx context.Context, token adminauth.PasswordToken) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.passwordTokens[string(token.Hash)]; ok {
+			return ErrAdminAuthDB.New("password token already exists")
+		}
+		if _, ok := tables.managers[token.ManagerID]; !ok {
+			return ErrAdminAuthDB.New("manager %s does not exist", token.ManagerID)
+		}
+
+		tables.putPasswordToken(adminauth.PasswordToken{
+			Hash:      cloneBytes(token.Hash),
+			ManagerID: token.ManagerID,
+			Purpose:   token.Purpose,
+			CreatedAt: timestamp(token.CreatedAt),
+			ExpiresAt: timestamp(token.ExpiresAt),
+		})
+
+		return nil
+	})
+}
+
+// GetPasswordToken returns password token by hash, returns ErrNoPasswordToken if there is no such token.
+func (repository *adminauthdb) GetPasswordToken(ctx context.Context, hash []byte) (token adminauth.PasswordToken, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.passwordTokens[string(hash)]
+		if !ok {
+			return adminauth.ErrNoPasswordToken.New("")
+		}
+
+		token = row
+		token.Hash = cloneBytes(row.Hash)
+		token.UsedAt = timestampPtr(row.UsedAt)
+		return nil
+	})
+
+	return token, err
+}
+
+// UsePasswordToken marks unused password token as used, returns ErrNoPasswordToken if there is no such token.
+func (repository *adminauthdb) UsePasswordToken(ctx context.Context, hash []byte, usedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		token, ok := tables.passwordTokens[string(hash)]
+		if !ok || token.UsedAt != nil {
+			return adminauth.ErrNoPasswordToken.New("")
+		}
+
+		token.UsedAt = timestampPtr(&usedAt)
+		tables.putPasswordToken(token)
+
+		return nil
+	})
+}
+
+// DeletePasswordTokens deletes all password tokens of the manager.
+func (repository *adminauthdb) DeletePasswordTokens(ctx context.Context, managerID uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		for hash, token := range tables.passwordTokens {
+			if token.ManagerID == managerID {
+				tables.deletePasswordToken(hash)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"cleanmasters/audit"
+)
+
+// ensures that auditdb implements audit.DB.
+var _ audit.DB = (*auditdb)(nil)
+
+// auditdb is an in-memory implementation of audit.DB.
+//
+// architecture: Database
+type auditdb struct {
+	db *database
+}
+
+// Append links entry to the last entry of the chain, calculates its hash and saves it.
+// Within WithTx appends of other transactions wait until the whole transaction ends.
+func (repository *auditdb) Append(ctx context.Context, entry audit.Entry) (appended audit.Entry, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		entry.Sequence, entry.PrevHash = 0, nil
+		if len(tables.auditLog) > 0 {
+			last := tables.auditLog[len(tables.auditLog)-1]
+			entry.Sequence, entry.PrevHash = last.Sequence, cloneBytes(last.Hash)
+		}
+
+		entry.Sequence++
+		entry.Hash = entry.CalculateHash()
+
+		row := entry
+		row.Changes = append([]audit.Change(nil), entry.Changes...)
+		row.CreatedAt = timestamp(entry.CreatedAt)
+		tables.appendAuditEntry(row)
+
+		appended = entry
+		return nil
+	})
+
+	return appended, err
+}
+
+// List returns entries which match the filter ordered by sequence number, newest first.
+func (repository *auditdb) List(ctx context.Context, filter audit.Filter) (entries []audit.Entry, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for i := len(tables.auditLog) - 1; i >= 0; i-- {
+			if filter.Limit > 0 && len(entries) == filter.Limit {
+				break
+			}
+
+			entry := tables.auditLog[i]
+			if matchesAuditFilter(entry, filter) {
+				entries = append(entries, cloneEntry(entry))
+			}
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// Chain returns all entries ordered by sequence number, oldest first.
+func (repository *auditdb) Chain(ctx context.Context) (entries []audit.Entry, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, entry := range tables.auditLog {
+			entries = append(entries, cloneEntry(entry))
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// matchesAuditFilter checks whether entry matches the filter.
+func matchesAuditFilter(entry audit.Entry, filter audit.Filter) bool {
+	switch {
+	case filter.ActorID != uuid.Nil && entry.ActorID != filter.ActorID:
+		return false
+	case filter.Action != "" && entry.Action != filter.Action:
+		return false
+	case filter.EntityType != "" && entry.EntityType != filter.EntityType:
+		return false
+	case filter.EntityID != "" && entry.EntityID != filter.EntityID:
+		return false
+	case !filter.From.IsZero() && entry.CreatedAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !entry.CreatedAt.Before(filter.To):
+		return false
+	default:
+		return true
+	}
+}
+
+// cloneEntry returns copy of the entry which does not share memory with stored one.
+func cloneEntry(entry audit.Entry) audit.Entry {
+	entry.Changes = append([]audit.Change(nil), entry.Changes...)
+	entry.PrevHash = cloneBytes(entry.PrevHash)
+	entry.Hash = cloneBytes(entry.Hash)
+
+	return entry
+}
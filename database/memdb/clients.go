@@ -0,0 +1,534 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/clients"
+	"cleanmasters/internal/mail"
+)
+
+// ensures that clientsdb implements clients.DB.
+var _ clients.DB = (*clientsdb)(nil)
+
+// ErrClientsDB in the error class that indicates about ClientsDB error.
+var ErrClientsDB = errs.Class("ClientsDB error")
+
+// clientsdb is an in-memory implementation of clients.DB.
+//
+// architecture: Database
+type clientsdb struct {
+	db *database
+}
+
+// Add is a method for inserting new Client to the database.
+func (repository *clientsdb) Add(ctx context.Context, client clients.Client) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.clients[client.ID]; ok {
+			return ErrClientsDB.New("client %s already exists", client.ID)
+		}
+
+		row := clients.Client{
+			ID:        client.ID,
+			Email:     client.Email,
+			Phone:     client.Phone,
+			FirstName: client.FirstName,
+			LastName:  client.LastName,
+			CreatedAt: now(),
+			Version:   client.Version,
+		}
+		if err := checkClientContacts(tables, row); err != nil {
+			return err
+		}
+
+		tables.putClient(row)
+		return nil
+	})
+}
+
+// Register is a method for inserting new Client to the database.
+func (repository *clientsdb) Register(ctx context.Context, phone string) (uuid.UUID, error) {
+	row := clients.Client{
+		ID:        uuid.New(),
+		Phone:     phone,
+		CreatedAt: now(),
+		Version:   1,
+	}
+
+	err := repository.db.run(func(tables *tables) error {
+		if err := checkClientContacts(tables, row); err != nil {
+			return err
+		}
+
+		tables.putClient(row)
+		return nil
+	})
+
+	return row.ID, err
+}
+
+// Update is a method for updating a Client in the database.
+// Client is updated only if its version is not changed, otherwise clients.ErrConflict is returned.
+func (repository *clientsdb) Update(ctx context.Context, client clients.Client) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.clients[client.ID]
+		if !ok || row.DeletedAt != nil {
+			return clients.ErrNotExist.New("%s", client.ID)
+		}
+		if row.Version != client.Version {
+			return clients.ErrConflict.New("version %d is changed to %d", client.Version, row.Version)
+		}
+
+		if mail.NormalizeAddress(row.Email) != mail.NormalizeAddress(client.Email) {
+			row.EmailVerifiedAt = nil
+		}
+		row.Phone = client.Phone
+		row.FirstName = client.FirstName
+		row.LastName = client.LastName
+		row.Email = client.Email
+		row.Version++
+
+		if err := checkClientContacts(tables, row); err != nil {
+			return err
+		}
+
+		tables.putClient(row)
+		return nil
+	})
+}
+
+// checkClientContacts returns clients.ErrPhoneTaken or clients.ErrEmailTaken if another not deleted client uses the contact.
+func checkClientContacts(tables *tables, client clients.Client) error {
+	email := mail.NormalizeAddress(client.Email)
+
+	for id, other := range tables.clients {
+		if id == client.ID || other.DeletedAt != nil {
+			continue
+		}
+
+		if other.Phone == client.Phone {
+			return ErrClientsDB.Wrap(clients.ErrPhoneTaken)
+		}
+		if email != "" && mail.NormalizeAddress(other.Email) == email {
+			return ErrClientsDB.Wrap(clients.ErrEmailTaken)
+		}
+	}
+
+	return nil
+}
+
+// ListByContacts is used to return clients which have one of the phones or one of the emails,
+// phones are compared by digits and emails in normalized form.
+func (repository *clientsdb) ListByContacts(ctx context.Context, phones, emails []string) (clientList []clients.Client, err error) {
+	phoneSet := make(map[string]bool, len(phones))
+	for _, phone := range phones {
+		if phone = clients.PhoneDigits(phone); phone != "" {
+			phoneSet[phone] = true
+		}
+	}
+
+	emailSet := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		if email = mail.NormalizeAddress(email); email != "" {
+			emailSet[email] = true
+		}
+	}
+
+	err = repository.db.run(func(tables *tables) error {
+		for _, client := range tables.clients {
+			if client.DeletedAt != nil {
+				continue
+			}
+
+			if phoneSet[clients.PhoneDigits(client.Phone)] || emailSet[mail.NormalizeAddress(client.Email)] {
+				clientList = append(clientList, listedClient(client))
+			}
+		}
+
+		return nil
+	})
+
+	return clientList, err
+}
+
+// List is used to return at most query.Limit clients which match the filter, in query order.
+// Clients right after the cursor are returned, or right before it if cursor is backward.
+func (repository *clientsdb) List(ctx context.Context, query clients.ListQuery) ([]clients.Client, error) {
+	clientList, err := repository.list(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(clientList)-1; i < j; i, j = i+1, j-1 {
+			clientList[i], clientList[j] = clientList[j], clientList[i]
+		}
+	}
+
+	return clientList, nil
+}
+
+// Iterate calls fn for every client which matches the filter, in query order, cursor and limit are ignored.
+// Clients are selected before the first call, so fn could use the database, iteration stops on the first error returned by fn.
+func (repository *clientsdb) Iterate(ctx context.Context, query clients.ListQuery, fn func(clients.Client) error) error {
+	query.Cursor, query.Limit = nil, 0
+
+	clientList, err := repository.list(query)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range clientList {
+		if err = fn(client); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list returns clients selected by query, backward page is returned in reversed order.
+func (repository *clientsdb) list(query clients.ListQuery) (clientList []clients.Client, err error) {
+	if !query.Sort.IsValid() {
+		return nil, ErrClientsDB.New("unknown sort field %q", query.Sort)
+	}
+
+	desc := query.Desc
+	if query.Cursor != nil && query.Cursor.Backward {
+		desc = !desc
+	}
+
+	// less orders clients by sort key in the requested direction.
+	less := func(a, b clients.Cursor) bool {
+		if desc {
+			return compareCursors(query.Sort, a, b) > 0
+		}
+		return compareCursors(query.Sort, a, b) < 0
+	}
+
+	err = repository.db.run(func(tables *tables) error {
+		for _, client := range tables.clients {
+			if client.DeletedAt != nil || !matchesFilter(client, query.Filter) {
+				continue
+			}
+			if query.Cursor != nil && !less(*query.Cursor, clients.NewCursor(client, false)) {
+				continue
+			}
+
+			clientList = append(clientList, listedClient(client))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(clientList, func(i, j int) bool {
+		return less(clients.NewCursor(clientList[i], false), clients.NewCursor(clientList[j], false))
+	})
+	if query.Limit > 0 && len(clientList) > query.Limit {
+		clientList = clientList[:query.Limit]
+	}
+
+	return clientList, nil
+}
+
+// matchesFilter checks whether client matches list filter.
+func matchesFilter(client clients.Client, filter clients.ListFilter) bool {
+	if !filter.CreatedFrom.IsZero() && client.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && !client.CreatedAt.Before(filter.CreatedTo) {
+		return false
+	}
+
+	switch filter.Email {
+	case clients.EmailPresent:
+		return client.Email != ""
+	case clients.EmailMissing:
+		return client.Email == ""
+	default:
+		return true
+	}
+}
+
+// compareCursors compares sort keys of the field, id makes the order unique.
+func compareCursors(field clients.SortField, a, b clients.Cursor) int {
+	var result int
+	switch field {
+	case clients.SortByName:
+		result = strings.Compare(a.LastName, b.LastName)
+		if result == 0 {
+			result = strings.Compare(a.FirstName, b.FirstName)
+		}
+	case clients.SortByCreatedAt:
+		switch {
+		case a.CreatedAt.Before(b.CreatedAt):
+			result = -1
+		case a.CreatedAt.After(b.CreatedAt):
+			result = 1
+		}
+	case clients.SortByPhone:
+		result = strings.Compare(a.Phone, b.Phone)
+	}
+
+	if result != 0 {
+		return result
+	}
+
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// Search is used to return at most limit clients which match the query, most relevant first.
+// Matching mirrors Postgres implementation: names and email are matched by trigram similarity and by words,
+// phone is matched by digits fragment.
+func (repository *clientsdb) Search(ctx context.Context, query clients.SearchQuery, limit int) (results []clients.SearchResult, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, client := range tables.clients {
+			if client.DeletedAt != nil {
+				continue
+			}
+
+			if rank, ok := searchRank(client, query); ok {
+				results = append(results, clients.SearchResult{Client: listedClient(client), Rank: rank})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return compareCursors(clients.SortByName, clients.NewCursor(results[i].Client, false), clients.NewCursor(results[j].Client, false)) < 0
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// Get is used to return client by id.
+func (repository *clientsdb) Get(ctx context.Context, id uuid.UUID) (client clients.Client, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.clients[id]
+		if !ok || row.DeletedAt != nil {
+			return clients.ErrNotExist.New("%s", id)
+		}
+
+		client = row
+		client.EmailVerifiedAt = timestampPtr(row.EmailVerifiedAt)
+		return nil
+	})
+
+	return client, err
+}
+
+// GetByPhone is used to return Client by phone number.
+func (repository *clientsdb) GetByPhone(ctx context.Context, phone string) (clients.Client, error) {
+	return repository.find(func(client clients.Client) bool {
+		return client.Phone == phone
+	})
+}
+
+// GetByEmail is used to return Client by email, emails are compared in normalized form.
+func (repository *clientsdb) GetByEmail(ctx context.Context, email string) (clients.Client, error) {
+	email = mail.NormalizeAddress(email)
+
+	return repository.find(func(client clients.Client) bool {
+		return email != "" && mail.NormalizeAddress(client.Email) == email
+	})
+}
+
+// find returns the not deleted client which matches, unique contacts guarantee that there is at most one.
+func (repository *clientsdb) find(match func(clients.Client) bool) (client clients.Client, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, row := range tables.clients {
+			if row.DeletedAt == nil && match(row) {
+				client = row
+				client.EmailVerifiedAt = timestampPtr(row.EmailVerifiedAt)
+				return nil
+			}
+		}
+
+		return clients.ErrNotExist.New("")
+	})
+
+	return client, err
+}
+
+// Delete marks client as deleted, deleted client is hidden until it is restored or purged.
+func (repository *clientsdb) Delete(ctx context.Context, id uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.clients[id]
+		if !ok || row.DeletedAt != nil {
+			return clients.ErrNotExist.New("%s", id)
+		}
+
+		deletedAt := now()
+		row.DeletedAt = &deletedAt
+		tables.putClient(row)
+
+		return nil
+	})
+}
+
+// ListDeleted is used to return deleted clients which are not purged yet, recently deleted first.
+func (repository *clientsdb) ListDeleted(ctx context.Context) (clientList []clients.Client, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, row := range tables.clients {
+			if row.DeletedAt == nil {
+				continue
+			}
+
+			client := listedClient(row)
+			client.DeletedAt = row.DeletedAt
+			clientList = append(clientList, client)
+		}
+
+		return nil
+	})
+
+	sort.Slice(clientList, func(i, j int) bool {
+		a, b := clientList[i], clientList[j]
+		if !a.DeletedAt.Equal(*b.DeletedAt) {
+			return a.DeletedAt.After(*b.DeletedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+
+	return clientList, err
+}
+
+// Restore makes deleted client visible again.
+func (repository *clientsdb) Restore(ctx context.Context, id uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.clients[id]
+		if !ok || row.DeletedAt == nil {
+			return clients.ErrNotExist.New("%s", id)
+		}
+
+		row.DeletedAt = nil
+		row.Version++
+		if err := checkClientContacts(tables, row); err != nil {
+			return err
+		}
+
+		tables.putClient(row)
+		return nil
+	})
+}
+
+// Purge permanently deletes clients which were deleted before the time, ids of purged clients are returned.
+// Sessions and email verifications of purged clients are deleted with them.
+func (repository *clientsdb) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for id, client := range tables.clients {
+			if client.DeletedAt == nil || !client.DeletedAt.Before(deletedBefore) {
+				continue
+			}
+
+			tables.deleteClient(id)
+			tables.deleteEmailVerification(id)
+			for sessionID, session := range tables.sessions {
+				if session.ClientID == id {
+					tables.deleteSession(sessionID)
+				}
+			}
+
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+
+	return ids, err
+}
+
+// SetEmailVerification saves email verification, pending verification of the client is replaced.
+func (repository *clientsdb) SetEmailVerification(ctx context.Context, verification clients.EmailVerification) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.clients[verification.ClientID]; !ok {
+			return ErrClientsDB.New("client %s does not exist", verification.ClientID)
+		}
+
+		verification.CodeHash = cloneBytes(verification.CodeHash)
+		verification.CreatedAt = timestamp(verification.CreatedAt)
+		verification.ExpiresAt = timestamp(verification.ExpiresAt)
+		tables.putEmailVerification(verification)
+
+		return nil
+	})
+}
+
+// GetEmailVerification returns pending email verification of the client.
+func (repository *clientsdb) GetEmailVerification(ctx context.Context, clientID uuid.UUID) (verification clients.EmailVerification, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.emailVerifications[clientID]
+		if !ok {
+			return clients.ErrNoEmailVerification.New("%s", clientID)
+		}
+
+		verification = row
+		verification.CodeHash = cloneBytes(row.CodeHash)
+		return nil
+	})
+
+	return verification, err
+}
+
+// AddEmailVerificationAttempt increments number of wrong codes entered for pending email verification.
+func (repository *clientsdb) AddEmailVerificationAttempt(ctx context.Context, clientID uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		verification, ok := tables.emailVerifications[clientID]
+		if !ok {
+			return clients.ErrNoEmailVerification.New("%s", clientID)
+		}
+
+		verification.Attempts++
+		tables.putEmailVerification(verification)
+
+		return nil
+	})
+}
+
+// VerifyEmail marks current email of the client as verified and removes pending email verification.
+func (repository *clientsdb) VerifyEmail(ctx context.Context, clientID uuid.UUID, verifiedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		tables.deleteEmailVerification(clientID)
+
+		row, ok := tables.clients[clientID]
+		if !ok || row.DeletedAt != nil {
+			return clients.ErrNotExist.New("%s", clientID)
+		}
+
+		verifiedAt = timestamp(verifiedAt)
+		row.EmailVerifiedAt = &verifiedAt
+		tables.putClient(row)
+
+		return nil
+	})
+}
+
+// listedClient returns client without fields which are loaded only with single client or only for deleted clients.
+func listedClient(client clients.Client) clients.Client {
+	client.DeletedAt = nil
+	client.EmailVerifiedAt = nil
+
+	return client
+}
@@ -0,0 +1,259 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"cleanmasters"
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
+	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+)
+
+var (
+	// Error is in-memory database error type.
+	Error = errs.Class("memory database error")
+	// ErrTx indicates that transaction is already finished.
+	ErrTx = errs.Class("memory database transaction error")
+)
+
+// ensures that database implements cleanmasters.DB.
+var _ cleanmasters.DB = (*database)(nil)
+
+// database is an in-memory implementation of the admin DB, data is lost when process exits unless database is
+// opened from file. It keeps the same constraints as Postgres implementation, so it is used in tests and demos.
+// Strings are ordered by bytes, as with C collation.
+type database struct {
+	store *store
+	// tx is set if database is obtained within WithTx, repositories change its copy of tables.
+	tx *transaction
+}
+
+// store holds committed tables.
+type store struct {
+	// mu is held by every statement and by WithTx until transaction ends, so transactions are serialized.
+	mu     sync.Mutex
+	tables *tables
+	closed bool
+
+	// file is set if tables are persisted, committed changes are written to it.
+	file *boltFile
+	// broken is set if committed changes could not be written to file, database has to be reopened then.
+	broken error
+}
+
+// transaction holds tables changed by the running transaction, they replace committed tables on commit.
+type transaction struct {
+	mu     sync.Mutex
+	tables *tables
+	done   bool
+}
+
+// New returns empty in-memory cleanmasters.DB.
+func New() cleanmasters.DB {
+	return &database{store: &store{tables: newTables()}}
+}
+
+// Close drops all data which is not persisted, database could not be used after that.
+func (db *database) Close() error {
+	if db.tx != nil {
+		return Error.New("database could not be closed within transaction")
+	}
+
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if db.store.closed {
+		return nil
+	}
+
+	db.store.closed = true
+	db.store.tables = newTables()
+
+	if db.store.file != nil {
+		return db.store.file.close()
+	}
+
+	return nil
+}
+
+// Ping returns error if database is closed or its file could not be written.
+func (db *database) Ping(ctx context.Context) error {
+	if db.tx != nil {
+		// store is held by the running transaction.
+		return nil
+	}
+
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	return db.store.check()
+}
+
+// Stats returns empty statistics, in-memory database has no connections.
+func (db *database) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+// MigrateToLatest does nothing, tables of in-memory database always have the latest schema.
+func (db *database) MigrateToLatest(ctx context.Context) error {
+	if db.tx != nil {
+		return Error.New("migrations could not be applied within transaction")
+	}
+
+	return nil
+}
+
+// WithTx runs fn with a copy of tables which replaces committed ones if fn returns nil.
+// Transaction holds the whole database, so it never fails to serialize and fn is called once.
+// WithTx called on tx joins the running transaction.
+func (db *database) WithTx(ctx context.Context, fn func(tx cleanmasters.DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if err := db.store.check(); err != nil {
+		return err
+	}
+
+	tx := &transaction{tables: db.store.tables.clone()}
+	defer tx.finish()
+
+	if err := fn(&database{store: db.store, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := db.store.commit(tx.tables); err != nil {
+		return err
+	}
+
+	db.store.tables = tx.tables
+	return nil
+}
+
+// finish prohibits further use of transaction repositories.
+func (tx *transaction) finish() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.done = true
+}
+
+// run calls fn with tables of transaction if database is obtained within WithTx, otherwise with committed tables.
+// fn has to check constraints before changing tables, so failed statement does not leave partial changes.
+func (db *database) run(fn func(tables *tables) error) error {
+	if db.tx != nil {
+		db.tx.mu.Lock()
+		defer db.tx.mu.Unlock()
+
+		if db.tx.done {
+			return ErrTx.New("transaction is already finished")
+		}
+
+		return fn(db.tx.tables)
+	}
+
+	db.store.mu.Lock()
+	defer db.store.mu.Unlock()
+
+	if err := db.store.check(); err != nil {
+		return err
+	}
+
+	err := fn(db.store.tables)
+	return errs.Combine(err, db.store.commit(db.store.tables))
+}
+
+// check returns error if database could not be used.
+func (store *store) check() error {
+	switch {
+	case store.closed:
+		return Error.New("database is closed")
+	case store.broken != nil:
+		return Error.New("database file is not written, it has to be reopened: %v", store.broken)
+	default:
+		return nil
+	}
+}
+
+// commit writes changes of tables to file, if it fails, database could not be used further,
+// since tables are not consistent with the file anymore.
+func (store *store) commit(tables *tables) error {
+	changes := tables.takeChanges()
+	if store.file == nil || len(changes) == 0 {
+		return nil
+	}
+
+	if err := store.file.write(changes); err != nil {
+		store.broken = err
+		return err
+	}
+
+	return nil
+}
+
+// Clients provides access to Clients store.
+func (db *database) Clients() clients.DB {
+	return &clientsdb{db: db}
+}
+
+// Managers provides access to Managers database.
+func (db *database) Managers() managers.DB {
+	return &managersdb{db: db}
+}
+
+// ConsoleSessions provides access to console sessions database.
+func (db *database) ConsoleSessions() consoleauth.DB {
+	return &sessionsdb{db: db}
+}
+
+// AdminAuth provides access to managers authentication database.
+func (db *database) AdminAuth() adminauth.DB {
+	return &adminauthdb{db: db}
+}
+
+// Audit provides access to audit log database.
+func (db *database) Audit() audit.DB {
+	return &auditdb{db: db}
+}
+
+// now returns current time as it is stored by Postgres.
+func now() time.Time {
+	return timestamp(time.Now())
+}
+
+// timestamp returns time with precision and location of Postgres timestamp.
+func timestamp(t time.Time) time.Time {
+	return t.Round(time.Microsecond).UTC()
+}
+
+// timestampPtr returns copy of optional time with precision and location of Postgres timestamp.
+func timestampPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	value := timestamp(*t)
+	return &value
+}
+
+// cloneBytes returns copy of bytes, so stored rows do not share memory with callers.
+func cloneBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/clients"
+	"cleanmasters/database/memdb"
+)
+
+func TestConcurrentRegister(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	defer func() { require.NoError(t, db.Close()) }()
+
+	const workers = 10
+	results := make(chan error, workers)
+
+	var group sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			results <- db.WithTx(ctx, func(tx cleanmasters.DB) error {
+				_, err := tx.Clients().Register(ctx, "380500000001")
+				return err
+			})
+		}()
+	}
+	group.Wait()
+	close(results)
+
+	registered := 0
+	for err := range results {
+		if err == nil {
+			registered++
+			continue
+		}
+		assert.True(t, errors.Is(err, clients.ErrPhoneTaken), err)
+	}
+	assert.Equal(t, 1, registered)
+
+	list, err := db.Clients().List(ctx, clients.ListQuery{Sort: clients.SortByPhone})
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestClosed(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	require.NoError(t, db.Close())
+
+	_, err := db.Clients().Register(ctx, "380500000001")
+	assert.True(t, memdb.Error.Has(err))
+}
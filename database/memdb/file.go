@@ -0,0 +1,257 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+	bolt "go.etcd.io/bbolt"
+
+	"cleanmasters"
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
+	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+)
+
+// lockTimeout is how long OpenFile waits for the file which is used by another process.
+const lockTimeout = time.Second
+
+// fileTables lists buckets of database file, every table is stored in the bucket with its name.
+var fileTables = []string{
+	tableClients,
+	tableEmailVerifications,
+	tableManagers,
+	tableRecoveryCodes,
+	tablePasswordTokens,
+	tableLoginThrottles,
+	tableLoginAttempts,
+	tableSessions,
+	tableRefreshTokens,
+	tableAPIKeys,
+	tableAuditLog,
+}
+
+// OpenFile returns cleanmasters.DB which persists tables in the single bbolt file, so it could be run
+// on a single box without database server. File is created if it does not exist.
+//
+// Every table is a bucket with rows stored as json of entities, so there is no schema to migrate.
+// Every committed statement or transaction writes its changes in one bbolt transaction. Rows are read
+// into memory on open and queries are served from memory, so file fits small deployments only.
+// File is locked exclusively while it is open, so it could not be opened by another process at the same time.
+func OpenFile(path string) (_ cleanmasters.DB, err error) {
+	file, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		if errs.Is(err, bolt.ErrTimeout) {
+			return nil, Error.New("database file %s is used by another process", path)
+		}
+		return nil, Error.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, Error.Wrap(file.Close()))
+		}
+	}()
+
+	err = file.Update(func(tx *bolt.Tx) error {
+		for _, table := range fileTables {
+			if _, err := tx.CreateBucketIfNotExists([]byte(table)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	tables, err := load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	tables.persisted = true
+	return &database{store: &store{tables: tables, file: &boltFile{db: file}}}, nil
+}
+
+// load reads all tables from the file.
+func load(file *bolt.DB) (*tables, error) {
+	tables := newTables()
+
+	err := file.View(func(tx *bolt.Tx) error {
+		for _, table := range fileTables {
+			err := tx.Bucket([]byte(table)).ForEach(func(key, row []byte) error {
+				if err := tables.apply(storedChange{Table: table, Key: string(key), Row: row}); err != nil {
+					return Error.New("database file %s is corrupted in table %s at key %x: %v", file.Path(), table, key, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return tables, nil
+}
+
+// boltFile is an open database file.
+type boltFile struct {
+	db *bolt.DB
+}
+
+// write saves changes in a single bbolt transaction, which is synced to disk on commit.
+func (file *boltFile) write(changes []change) error {
+	return Error.Wrap(file.db.Update(func(tx *bolt.Tx) error {
+		for _, change := range changes {
+			bucket := tx.Bucket([]byte(change.Table))
+			if bucket == nil {
+				return Error.New("unknown table %q", change.Table)
+			}
+
+			if change.Row == nil {
+				if err := bucket.Delete([]byte(change.Key)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			row, err := json.Marshal(change.Row)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put([]byte(change.Key), row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// close releases the lock and closes the file.
+func (file *boltFile) close() error {
+	return Error.Wrap(file.db.Close())
+}
+
+// storedChange is a row read from database file.
+type storedChange struct {
+	Table string
+	Key   string
+	Row   json.RawMessage
+}
+
+// storedManager is a manager row with the number of its write, so managers are listed in the same order after open.
+type storedManager struct {
+	managers.Manager
+	Write int64 `json:"write"`
+}
+
+// auditKey returns key of audit entry, big-endian sequence keeps entries ordered in the bucket.
+func auditKey(sequence int64) string {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], uint64(sequence))
+	return string(key[:])
+}
+
+// apply writes row read from the file.
+func (t *tables) apply(change storedChange) (err error) {
+	decode := func(row interface{}) error {
+		return json.Unmarshal(change.Row, row)
+	}
+
+	switch change.Table {
+	case tableClients:
+		var client clients.Client
+		if err = decode(&client); err == nil {
+			t.putClient(client)
+		}
+	case tableEmailVerifications:
+		var verification clients.EmailVerification
+		if err = decode(&verification); err == nil {
+			t.putEmailVerification(verification)
+		}
+	case tableManagers:
+		var stored storedManager
+		if err = decode(&stored); err == nil {
+			t.loadManager(stored.Manager, stored.Write)
+		}
+	case tableRecoveryCodes:
+		key, err := parseRecoveryCodeKey(change.Key)
+		if err != nil {
+			return err
+		}
+
+		var usedAt *time.Time
+		if err = decode(&usedAt); err != nil {
+			return err
+		}
+		t.putRecoveryCode(key, usedAt)
+	case tablePasswordTokens:
+		var token adminauth.PasswordToken
+		if err = decode(&token); err == nil {
+			t.putPasswordToken(token)
+		}
+	case tableLoginThrottles:
+		var throttle adminauth.LoginThrottle
+		if err = decode(&throttle); err == nil {
+			t.putLoginThrottle(throttle)
+		}
+	case tableLoginAttempts:
+		var attempt adminauth.LoginAttempt
+		if err = decode(&attempt); err == nil {
+			t.putLoginAttempt(attempt)
+		}
+	case tableSessions:
+		var session consoleauth.Session
+		if err = decode(&session); err == nil {
+			t.putSession(session)
+		}
+	case tableRefreshTokens:
+		var token consoleauth.RefreshToken
+		if err = decode(&token); err == nil {
+			t.putRefreshToken(token)
+		}
+	case tableAPIKeys:
+		var key consoleauth.APIKey
+		if err = decode(&key); err == nil {
+			t.putAPIKey(key)
+		}
+	case tableAuditLog:
+		var entry audit.Entry
+		if err = decode(&entry); err == nil {
+			t.appendAuditEntry(entry)
+		}
+	default:
+		return Error.New("unknown table %q", change.Table)
+	}
+
+	return err
+}
+
+// parseRecoveryCodeKey parses recovery code key as it is stored in database file.
+func parseRecoveryCodeKey(value string) (key recoveryCodeKey, err error) {
+	separator := strings.IndexByte(value, '/')
+	if separator < 0 {
+		return key, Error.New("invalid recovery code key %q", value)
+	}
+
+	if key.managerID, err = uuid.Parse(value[:separator]); err != nil {
+		return key, err
+	}
+
+	hash, err := hex.DecodeString(value[separator+1:])
+	key.hash = string(hash)
+	return key, err
+}
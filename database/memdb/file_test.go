@@ -0,0 +1,147 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
+	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+	"cleanmasters/database/memdb"
+)
+
+func TestFileReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(tempDir(t), "cleanmasters.db")
+
+	db, err := memdb.OpenFile(path)
+	require.NoError(t, err)
+
+	clientID, err := db.Clients().Register(ctx, "380500000001")
+	require.NoError(t, err)
+	deletedID, err := db.Clients().Register(ctx, "380500000002")
+	require.NoError(t, err)
+	require.NoError(t, db.Clients().Delete(ctx, deletedID))
+	_, err = db.Clients().Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	first := managers.Manager{ID: uuid.New(), Email: "first@example.com", PasswordHash: []byte{1}, Role: managers.RoleAdmin, Version: 1}
+	second := managers.Manager{ID: uuid.New(), Email: "second@example.com", PasswordHash: []byte{2}, Role: managers.RoleSupport, Version: 1}
+	require.NoError(t, db.Managers().Add(ctx, first))
+	require.NoError(t, db.Managers().Add(ctx, second))
+	first.FirstName = "First"
+	require.NoError(t, db.Managers().Update(ctx, first))
+
+	require.NoError(t, db.AdminAuth().SetRecoveryCodes(ctx, first.ID, [][]byte{{1}, {2}}))
+	require.NoError(t, db.AdminAuth().UseRecoveryCode(ctx, first.ID, []byte{1}, time.Now()))
+
+	session := consoleauth.Session{ID: uuid.New(), ClientID: clientID, CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	require.NoError(t, db.ConsoleSessions().CreateSession(ctx, session))
+
+	_, err = db.Audit().Append(ctx, audit.Entry{ID: uuid.New(), Action: "client.create", CreatedAt: time.Now()})
+	require.NoError(t, err)
+
+	// transaction which is rolled back is not written to file.
+	err = db.WithTx(ctx, func(tx cleanmasters.DB) error {
+		_, err := tx.Clients().Register(ctx, "380500000003")
+		require.NoError(t, err)
+		return clients.ErrNotExist.New("rollback")
+	})
+	require.Error(t, err)
+
+	expected := snapshot(ctx, t, db)
+	require.NoError(t, db.Close())
+
+	db, err = memdb.OpenFile(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	assert.Equal(t, expected, snapshot(ctx, t, db))
+
+	err = db.AdminAuth().UseRecoveryCode(ctx, first.ID, []byte{1}, time.Now())
+	assert.True(t, adminauth.ErrNoRecoveryCode.Has(err))
+	assert.NoError(t, db.AdminAuth().UseRecoveryCode(ctx, first.ID, []byte{2}, time.Now()))
+}
+
+func TestFileLocked(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(tempDir(t), "cleanmasters.db")
+
+	db, err := memdb.OpenFile(path)
+	require.NoError(t, err)
+	_, err = db.Clients().Register(ctx, "380500000001")
+	require.NoError(t, err)
+
+	// file which is open could not be opened again, e.g. by command run next to the server.
+	_, err = memdb.OpenFile(path)
+	require.True(t, memdb.Error.Has(err), err)
+
+	require.NoError(t, db.Close())
+
+	db, err = memdb.OpenFile(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	list, err := db.Clients().List(ctx, clients.ListQuery{Sort: clients.SortByPhone})
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestFileCorrupted(t *testing.T) {
+	path := filepath.Join(tempDir(t), "cleanmasters.db")
+	require.NoError(t, ioutil.WriteFile(path, bytes.Repeat([]byte("corrupted"), 1024), 0600))
+
+	_, err := memdb.OpenFile(path)
+	assert.True(t, memdb.Error.Has(err))
+}
+
+// dbSnapshot holds rows which are compared after database is reopened.
+type dbSnapshot struct {
+	Clients  []clients.Client
+	Managers []managers.Manager
+	Sessions []consoleauth.Session
+	Audit    []audit.Entry
+}
+
+// snapshot reads rows of all repositories.
+func snapshot(ctx context.Context, t *testing.T, db cleanmasters.DB) (s dbSnapshot) {
+	var err error
+
+	s.Clients, err = db.Clients().List(ctx, clients.ListQuery{Sort: clients.SortByPhone})
+	require.NoError(t, err)
+	s.Managers, err = db.Managers().List(ctx)
+	require.NoError(t, err)
+	for _, client := range s.Clients {
+		sessions, err := db.ConsoleSessions().ListSessions(ctx, client.ID)
+		require.NoError(t, err)
+		s.Sessions = append(s.Sessions, sessions...)
+	}
+	s.Audit, err = db.Audit().Chain(ctx)
+	require.NoError(t, err)
+
+	return s
+}
+
+// tempDir returns temporary directory which is removed when test ends.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "memdb")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return dir
+}
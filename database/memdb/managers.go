@@ -0,0 +1,324 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/internal/mail"
+)
+
+// ensures that managersdb implements managers.DB.
+var _ managers.DB = (*managersdb)(nil)
+
+// ErrManagersDB in the error class that indicates about ManagersDB error.
+var ErrManagersDB = errs.Class("ManagersDB error")
+
+// managersdb is an in-memory implementation of managers.DB.
+//
+// architecture: Database
+type managersdb struct {
+	db *database
+}
+
+// Get is used to return manager by id.
+func (repository *managersdb) Get(ctx context.Context, id uuid.UUID) (manager managers.Manager, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.managers[id]
+		if !ok || row.DeletedAt != nil {
+			return managers.ErrNoManager.New("%s", id)
+		}
+
+		manager = cloneManager(row)
+		return nil
+	})
+
+	return manager, err
+}
+
+// GetByEmail is used to return manager by email, emails are compared in normalized form.
+func (repository *managersdb) GetByEmail(ctx context.Context, email string) (manager managers.Manager, err error) {
+	email = mail.NormalizeAddress(email)
+
+	err = repository.db.run(func(tables *tables) error {
+		for _, row := range tables.managers {
+			if row.DeletedAt == nil && mail.NormalizeAddress(row.Email) == email {
+				manager = cloneManager(row)
+				return nil
+			}
+		}
+
+		return managers.ErrNoManager.New("")
+	})
+
+	return manager, err
+}
+
+// Update is a method for updating a Manager in the database.
+// Manager is updated only if its version is not changed, otherwise managers.ErrConflict is returned.
+func (repository *managersdb) Update(ctx context.Context, manager managers.Manager) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.managers[manager.ID]
+		if !ok || row.DeletedAt != nil {
+			return managers.ErrNoManager.New("%s", manager.ID)
+		}
+		if row.Version != manager.Version {
+			return managers.ErrConflict.New("version %d is changed to %d", manager.Version, row.Version)
+		}
+
+		row.PasswordHash = cloneBytes(manager.PasswordHash)
+		row.FirstName = manager.FirstName
+		row.LastName = manager.LastName
+		row.Email = manager.Email
+		row.Role = manager.Role
+		row.SecondFactor = managers.SecondFactor{
+			Secret:      cloneBytes(manager.SecondFactor.Secret),
+			Enabled:     manager.SecondFactor.Enabled,
+			LastCounter: manager.SecondFactor.LastCounter,
+		}
+		row.Version++
+
+		if err := checkManagerEmail(tables, row); err != nil {
+			return err
+		}
+
+		tables.writeManager(row)
+		return nil
+	})
+}
+
+// Add is a method for inserting new Manager to the database.
+func (repository *managersdb) Add(ctx context.Context, manager managers.Manager) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.managers[manager.ID]; ok {
+			return ErrManagersDB.New("manager %s already exists", manager.ID)
+		}
+
+		row := managers.Manager{
+			ID:           manager.ID,
+			FirstName:    manager.FirstName,
+			LastName:     manager.LastName,
+			Email:        manager.Email,
+			PasswordHash: cloneBytes(manager.PasswordHash),
+			Role:         manager.Role,
+			CreatedAt:    now(),
+			Version:      manager.Version,
+		}
+		if err := checkManagerEmail(tables, row); err != nil {
+			return err
+		}
+
+		tables.writeManager(row)
+		return nil
+	})
+}
+
+// checkManagerEmail returns managers.ErrEmailTaken if another not deleted manager uses the email.
+func checkManagerEmail(tables *tables, manager managers.Manager) error {
+	email := mail.NormalizeAddress(manager.Email)
+
+	for id, other := range tables.managers {
+		if id != manager.ID && other.DeletedAt == nil && mail.NormalizeAddress(other.Email) == email {
+			return ErrManagersDB.Wrap(managers.ErrEmailTaken)
+		}
+	}
+
+	return nil
+}
+
+// Remove marks manager as deleted, deleted manager is hidden until it is restored or purged.
+func (repository *managersdb) Remove(ctx context.Context, id uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.managers[id]
+		if !ok || row.DeletedAt != nil {
+			return managers.ErrNoManager.New("%s", id)
+		}
+
+		deletedAt := now()
+		row.DeletedAt = &deletedAt
+		tables.writeManager(row)
+
+		return nil
+	})
+}
+
+// ListDeleted is used to return deleted managers which are not purged yet, recently deleted first.
+// Password hashes and second factor secrets are not returned.
+func (repository *managersdb) ListDeleted(ctx context.Context) (managerList []managers.Manager, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, row := range tables.managers {
+			if row.DeletedAt == nil {
+				continue
+			}
+
+			manager := listedManager(row)
+			manager.DeletedAt = row.DeletedAt
+			managerList = append(managerList, manager)
+		}
+
+		return nil
+	})
+
+	sort.Slice(managerList, func(i, j int) bool {
+		a, b := managerList[i], managerList[j]
+		if !a.DeletedAt.Equal(*b.DeletedAt) {
+			return a.DeletedAt.After(*b.DeletedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+
+	return managerList, err
+}
+
+// Restore makes deleted manager visible again.
+func (repository *managersdb) Restore(ctx context.Context, id uuid.UUID) error {
+	return repository.db.run(func(tables *tables) error {
+		row, ok := tables.managers[id]
+		if !ok || row.DeletedAt == nil {
+			return managers.ErrNoManager.New("%s", id)
+		}
+
+		row.DeletedAt = nil
+		row.Version++
+		if err := checkManagerEmail(tables, row); err != nil {
+			return err
+		}
+
+		tables.writeManager(row)
+		return nil
+	})
+}
+
+// Purge permanently deletes managers which were deleted before the time, ids of purged managers are returned.
+// Recovery codes and password tokens of purged managers are deleted with them, their API keys lose the creator.
+func (repository *managersdb) Purge(ctx context.Context, deletedBefore time.Time) (ids []uuid.UUID, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for id, manager := range tables.managers {
+			if manager.DeletedAt == nil || !manager.DeletedAt.Before(deletedBefore) {
+				continue
+			}
+
+			tables.deleteManager(id)
+			for key := range tables.recoveryCodes {
+				if key.managerID == id {
+					tables.deleteRecoveryCode(key)
+				}
+			}
+			for hash, token := range tables.passwordTokens {
+				if token.ManagerID == id {
+					tables.deletePasswordToken(hash)
+				}
+			}
+			for _, key := range tables.apiKeys {
+				if key.CreatedBy == id {
+					key.CreatedBy = uuid.Nil
+					tables.putAPIKey(key)
+				}
+			}
+
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+
+	return ids, err
+}
+
+// List is used to return all managers in order of writes, second factor secrets are not returned.
+func (repository *managersdb) List(ctx context.Context) (managerList []managers.Manager, err error) {
+	writes := map[uuid.UUID]int64{}
+	err = repository.db.run(func(tables *tables) error {
+		for _, row := range tables.managers {
+			if row.DeletedAt != nil {
+				continue
+			}
+
+			manager := listedManager(row)
+			manager.PasswordHash = cloneBytes(row.PasswordHash)
+			managerList = append(managerList, manager)
+			writes[row.ID] = tables.managerWrites[row.ID]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(managerList, func(i, j int) bool {
+		return writes[managerList[i].ID] < writes[managerList[j].ID]
+	})
+
+	return managerList, nil
+}
+
+// Iterate calls fn for every manager ordered by creation time, password hash and second factor secret are not returned.
+// Managers are selected before the first call, so fn could use the database.
+func (repository *managersdb) Iterate(ctx context.Context, fn func(managers.Manager) error) error {
+	var managerList []managers.Manager
+	err := repository.db.run(func(tables *tables) error {
+		for _, row := range tables.managers {
+			if row.DeletedAt == nil {
+				managerList = append(managerList, listedManager(row))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sortManagers(managerList)
+
+	for _, manager := range managerList {
+		if err = fn(manager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortManagers orders managers by creation time and id.
+func sortManagers(managerList []managers.Manager) {
+	sort.Slice(managerList, func(i, j int) bool {
+		a, b := managerList[i], managerList[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+}
+
+// listedManager returns manager without password hash, second factor secret and counter, and deletion time.
+func listedManager(manager managers.Manager) managers.Manager {
+	return managers.Manager{
+		ID:           manager.ID,
+		FirstName:    manager.FirstName,
+		LastName:     manager.LastName,
+		Email:        manager.Email,
+		Role:         manager.Role,
+		SecondFactor: managers.SecondFactor{Enabled: manager.SecondFactor.Enabled},
+		CreatedAt:    manager.CreatedAt,
+		Version:      manager.Version,
+	}
+}
+
+// cloneManager returns copy of the manager which does not share memory with stored row, deletion time is not returned.
+func cloneManager(manager managers.Manager) managers.Manager {
+	manager.PasswordHash = cloneBytes(manager.PasswordHash)
+	manager.SecondFactor.Secret = cloneBytes(manager.SecondFactor.Secret)
+	manager.DeletedAt = nil
+
+	return manager
+}
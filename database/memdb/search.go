@@ -0,0 +1,111 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"cleanmasters/clients"
+)
+
+const (
+	// similarityThreshold is a minimal trigram similarity of matching values, as pg_trgm.similarity_threshold.
+	similarityThreshold = 0.3
+	// wordsRank is a rank of client which contains all words of the query, it is close to ts_rank of a single match.
+	wordsRank = 0.06
+)
+
+// searchRank returns relevance of the client to the query and whether client matches it at all,
+// it mirrors rank calculated by Postgres implementation.
+func searchRank(client clients.Client, query clients.SearchQuery) (float64, bool) {
+	lastName := strings.ToLower(client.LastName)
+	firstName := strings.ToLower(client.FirstName)
+	email := strings.ToLower(client.Email)
+
+	rank := math.Max(similarity(lastName, query.Text), math.Max(similarity(firstName, query.Text), similarity(email, query.Text)))
+	matches := rank >= similarityThreshold
+
+	switch {
+	case strings.HasPrefix(email, query.Text):
+		rank, matches = math.Max(rank, 0.9), true
+	case strings.Contains(email, query.Text):
+		rank, matches = math.Max(rank, 0.6), true
+	}
+
+	if query.Digits != "" {
+		phone := clients.PhoneDigits(client.Phone)
+		switch {
+		case strings.HasSuffix(phone, query.Digits):
+			rank, matches = math.Max(rank, 1), true
+		case strings.Contains(phone, query.Digits):
+			rank, matches = math.Max(rank, 0.8), true
+		}
+	}
+
+	if containsWords(words(firstName+" "+lastName+" "+email), words(query.Text)) {
+		rank, matches = math.Max(rank, wordsRank), true
+	}
+
+	return rank, matches
+}
+
+// similarity returns trigram similarity of values as pg_trgm similarity function does:
+// number of shared trigrams divided by number of distinct trigrams of both values.
+func similarity(a, b string) float64 {
+	trigramsA, trigramsB := trigrams(a), trigrams(b)
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range trigramsA {
+		if trigramsB[trigram] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(trigramsA)+len(trigramsB)-shared)
+}
+
+// trigrams returns set of trigrams of every word of the value, words are padded with two spaces before and one after.
+func trigrams(value string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range words(value) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+
+	return set
+}
+
+// words splits value into lower case words of letters and digits.
+func words(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords checks whether document has all words of the query, empty query matches nothing.
+func containsWords(document, query []string) bool {
+	if len(query) == 0 {
+		return false
+	}
+
+	set := make(map[string]bool, len(document))
+	for _, word := range document {
+		set[word] = true
+	}
+
+	for _, word := range query {
+		if !set[word] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,262 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/console/consoleauth"
+)
+
+// ensures that sessionsdb implements consoleauth.DB.
+var _ consoleauth.DB = (*sessionsdb)(nil)
+
+// ErrSessionsDB in the error class that indicates about SessionsDB error.
+var ErrSessionsDB = errs.Class("SessionsDB error")
+
+// sessionsdb is an in-memory implementation of consoleauth.DB.
+//
+// architecture: Database
+type sessionsdb struct {
+	db *database
+}
+
+// CreateSession is a method for inserting new Session to the database.
+func (repository *sessionsdb) CreateSession(ctx context.Context, session consoleauth.Session) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.sessions[session.ID]; ok {
+			return ErrSessionsDB.New("session %s already exists", session.ID)
+		}
+		if _, ok := tables.clients[session.ClientID]; !ok {
+			return ErrSessionsDB.New("client %s does not exist", session.ClientID)
+		}
+
+		tables.putSession(consoleauth.Session{
+			ID:         session.ID,
+			ClientID:   session.ClientID,
+			Device:     session.Device,
+			CreatedAt:  timestamp(session.CreatedAt),
+			LastUsedAt: timestamp(session.LastUsedAt),
+		})
+
+		return nil
+	})
+}
+
+// GetSession is used to return session by id.
+func (repository *sessionsdb) GetSession(ctx context.Context, id uuid.UUID) (session consoleauth.Session, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.sessions[id]
+		if !ok {
+			return consoleauth.ErrNoSession.New("%s", id)
+		}
+
+		session = row
+		session.RevokedAt = timestampPtr(row.RevokedAt)
+		return nil
+	})
+
+	return session, err
+}
+
+// ListSessions is used to return all not revoked sessions of the client, recently used first.
+func (repository *sessionsdb) ListSessions(ctx context.Context, clientID uuid.UUID) (sessions []consoleauth.Session, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, session := range tables.sessions {
+			if session.ClientID == clientID && session.RevokedAt == nil {
+				sessions = append(sessions, session)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// TouchSession updates last usage time of the session.
+func (repository *sessionsdb) TouchSession(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		if session, ok := tables.sessions[id]; ok {
+			session.LastUsedAt = timestamp(usedAt)
+			tables.putSession(session)
+		}
+
+		return nil
+	})
+}
+
+// RevokeSession revokes session and therefore all refresh tokens issued for it.
+func (repository *sessionsdb) RevokeSession(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		if session, ok := tables.sessions[id]; ok && session.RevokedAt == nil {
+			session.RevokedAt = timestampPtr(&revokedAt)
+			tables.putSession(session)
+		}
+
+		return nil
+	})
+}
+
+// AddRefreshToken is a method for inserting new RefreshToken to the database.
+func (repository *sessionsdb) AddRefreshToken(ctx context.Context, token consoleauth.RefreshToken) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.refreshTokens[string(token.Hash)]; ok {
+			return ErrSessionsDB.New("refresh token already exists")
+		}
+		if _, ok := tables.sessions[token.SessionID]; !ok {
+			return ErrSessionsDB.New("session %s does not exist", token.SessionID)
+		}
+
+		tables.putRefreshToken(consoleauth.RefreshToken{
+			Hash:      cloneBytes(token.Hash),
+			SessionID: token.SessionID,
+			CreatedAt: timestamp(token.CreatedAt),
+			ExpiresAt: timestamp(token.ExpiresAt),
+		})
+
+		return nil
+	})
+}
+
+// GetRefreshToken is used to return refresh token by its hash.
+func (repository *sessionsdb) GetRefreshToken(ctx context.Context, hash []byte) (token consoleauth.RefreshToken, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.refreshTokens[string(hash)]
+		if !ok {
+			return consoleauth.ErrNoRefreshToken.New("")
+		}
+
+		token = row
+		token.Hash = cloneBytes(row.Hash)
+		token.UsedAt = timestampPtr(row.UsedAt)
+		return nil
+	})
+
+	return token, err
+}
+
+// UseRefreshToken marks refresh token as used, returns ErrRefreshTokenUsed if it was used before.
+func (repository *sessionsdb) UseRefreshToken(ctx context.Context, hash []byte, usedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		token, ok := tables.refreshTokens[string(hash)]
+		if !ok || token.UsedAt != nil {
+			return consoleauth.ErrRefreshTokenUsed.New("")
+		}
+
+		token.UsedAt = timestampPtr(&usedAt)
+		tables.putRefreshToken(token)
+
+		return nil
+	})
+}
+
+// CreateAPIKey is a method for inserting new APIKey to the database.
+func (repository *sessionsdb) CreateAPIKey(ctx context.Context, key consoleauth.APIKey) error {
+	return repository.db.run(func(tables *tables) error {
+		if _, ok := tables.apiKeys[key.ID]; ok {
+			return ErrSessionsDB.New("api key %s already exists", key.ID)
+		}
+		if key.CreatedBy != uuid.Nil {
+			if _, ok := tables.managers[key.CreatedBy]; !ok {
+				return ErrSessionsDB.New("manager %s does not exist", key.CreatedBy)
+			}
+		}
+
+		tables.putAPIKey(consoleauth.APIKey{
+			ID:         key.ID,
+			Name:       key.Name,
+			SecretHash: cloneBytes(key.SecretHash),
+			Scopes:     append([]consoleauth.Scope(nil), key.Scopes...),
+			AllowedIPs: append([]string{}, key.AllowedIPs...),
+			CreatedBy:  key.CreatedBy,
+			CreatedAt:  timestamp(key.CreatedAt),
+			ExpiresAt:  timestamp(key.ExpiresAt),
+		})
+
+		return nil
+	})
+}
+
+// GetAPIKey is used to return API key by id, returns ErrNoAPIKey if there is no such key.
+func (repository *sessionsdb) GetAPIKey(ctx context.Context, id uuid.UUID) (key consoleauth.APIKey, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		row, ok := tables.apiKeys[id]
+		if !ok {
+			return consoleauth.ErrNoAPIKey.New("%s", id)
+		}
+
+		key = cloneAPIKey(row)
+		return nil
+	})
+
+	return key, err
+}
+
+// ListAPIKeys is used to return all API keys, newest first.
+func (repository *sessionsdb) ListAPIKeys(ctx context.Context) (keys []consoleauth.APIKey, err error) {
+	err = repository.db.run(func(tables *tables) error {
+		for _, key := range tables.apiKeys {
+			keys = append(keys, cloneAPIKey(key))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks API key as revoked.
+func (repository *sessionsdb) RevokeAPIKey(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		if key, ok := tables.apiKeys[id]; ok && key.RevokedAt == nil {
+			key.RevokedAt = timestampPtr(&revokedAt)
+			tables.putAPIKey(key)
+		}
+
+		return nil
+	})
+}
+
+// TouchAPIKey updates last usage time of API key.
+func (repository *sessionsdb) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	return repository.db.run(func(tables *tables) error {
+		if key, ok := tables.apiKeys[id]; ok {
+			key.LastUsedAt = timestampPtr(&usedAt)
+			tables.putAPIKey(key)
+		}
+
+		return nil
+	})
+}
+
+// cloneAPIKey returns copy of API key which does not share memory with stored row.
+func cloneAPIKey(key consoleauth.APIKey) consoleauth.APIKey {
+	key.SecretHash = cloneBytes(key.SecretHash)
+	key.Scopes = append([]consoleauth.Scope(nil), key.Scopes...)
+	key.AllowedIPs = append([]string{}, key.AllowedIPs...)
+	key.LastUsedAt = timestampPtr(key.LastUsedAt)
+	key.RevokedAt = timestampPtr(key.RevokedAt)
+
+	return key
+}
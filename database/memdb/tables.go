@@ -0,0 +1,291 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package memdb
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cleanmasters/adminportal/adminauth"
+	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
+	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
+)
+
+// names of tables used in database file.
+const (
+	tableClients            = "clients"
+	tableEmailVerifications = "email_verifications"
+	tableManagers           = "managers"
+	tableRecoveryCodes      = "recovery_codes"
+	tablePasswordTokens     = "password_tokens"
+	tableLoginThrottles     = "login_throttles"
+	tableLoginAttempts      = "login_attempts"
+	tableSessions           = "sessions"
+	tableRefreshTokens      = "refresh_tokens"
+	tableAPIKeys            = "api_keys"
+	tableAuditLog           = "audit_log"
+)
+
+// tables holds rows of all tables, rows are stored by value and never changed in place,
+// so copying the maps is enough to copy tables.
+// Rows are written only by put and delete methods, so changes of persisted tables are recorded.
+type tables struct {
+	clients            map[uuid.UUID]clients.Client
+	emailVerifications map[uuid.UUID]clients.EmailVerification
+
+	managers map[uuid.UUID]managers.Manager
+	// managerWrites holds number of the last write of every manager, unordered list returns managers in order of
+	// writes as Postgres does, since updated row is written to the end of the table.
+	managerWrites map[uuid.UUID]int64
+	// writes is a number of the last write of managers.
+	writes int64
+
+	recoveryCodes  map[recoveryCodeKey]*time.Time
+	passwordTokens map[string]adminauth.PasswordToken
+	loginThrottles map[string]adminauth.LoginThrottle
+	loginAttempts  map[uuid.UUID]adminauth.LoginAttempt
+
+	sessions      map[uuid.UUID]consoleauth.Session
+	refreshTokens map[string]consoleauth.RefreshToken
+	apiKeys       map[uuid.UUID]consoleauth.APIKey
+
+	auditLog []audit.Entry
+
+	// persisted is true if tables are saved to database file, only then changes are recorded.
+	persisted bool
+	// changes holds changes which are not written to database file yet.
+	changes []change
+}
+
+// change is a single written or deleted row, row is nil for deleted one.
+type change struct {
+	Table string      `json:"table"`
+	Key   string      `json:"key"`
+	Row   interface{} `json:"row,omitempty"`
+}
+
+// recoveryCodeKey is a primary key of recovery code.
+type recoveryCodeKey struct {
+	managerID uuid.UUID
+	hash      string
+}
+
+// String returns recovery code key as it is stored in database file.
+func (key recoveryCodeKey) String() string {
+	return key.managerID.String() + "/" + hex.EncodeToString([]byte(key.hash))
+}
+
+// newTables returns empty tables.
+func newTables() *tables {
+	return &tables{
+		clients:            map[uuid.UUID]clients.Client{},
+		emailVerifications: map[uuid.UUID]clients.EmailVerification{},
+		managers:           map[uuid.UUID]managers.Manager{},
+		managerWrites:      map[uuid.UUID]int64{},
+		recoveryCodes:      map[recoveryCodeKey]*time.Time{},
+		passwordTokens:     map[string]adminauth.PasswordToken{},
+		loginThrottles:     map[string]adminauth.LoginThrottle{},
+		loginAttempts:      map[uuid.UUID]adminauth.LoginAttempt{},
+		sessions:           map[uuid.UUID]consoleauth.Session{},
+		refreshTokens:      map[string]consoleauth.RefreshToken{},
+		apiKeys:            map[uuid.UUID]consoleauth.APIKey{},
+	}
+}
+
+// clone returns copy of tables which could be changed independently, changes are recorded separately.
+func (t *tables) clone() *tables {
+	c := newTables()
+	for id, client := range t.clients {
+		c.clients[id] = client
+	}
+	for id, verification := range t.emailVerifications {
+		c.emailVerifications[id] = verification
+	}
+	for id, manager := range t.managers {
+		c.managers[id] = manager
+	}
+	for id, write := range t.managerWrites {
+		c.managerWrites[id] = write
+	}
+	c.writes = t.writes
+	for key, usedAt := range t.recoveryCodes {
+		c.recoveryCodes[key] = usedAt
+	}
+	for hash, token := range t.passwordTokens {
+		c.passwordTokens[hash] = token
+	}
+	for key, throttle := range t.loginThrottles {
+		c.loginThrottles[key] = throttle
+	}
+	for id, attempt := range t.loginAttempts {
+		c.loginAttempts[id] = attempt
+	}
+	for id, session := range t.sessions {
+		c.sessions[id] = session
+	}
+	for hash, token := range t.refreshTokens {
+		c.refreshTokens[hash] = token
+	}
+	for id, key := range t.apiKeys {
+		c.apiKeys[id] = key
+	}
+	c.auditLog = append([]audit.Entry(nil), t.auditLog...)
+	c.persisted = t.persisted
+
+	return c
+}
+
+// record remembers change of persisted tables, row is nil for deleted one.
+func (t *tables) record(table, key string, row interface{}) {
+	if t.persisted {
+		t.changes = append(t.changes, change{Table: table, Key: key, Row: row})
+	}
+}
+
+// takeChanges returns recorded changes and forgets them.
+func (t *tables) takeChanges() []change {
+	changes := t.changes
+	t.changes = nil
+
+	return changes
+}
+
+// putClient writes client row.
+func (t *tables) putClient(client clients.Client) {
+	t.clients[client.ID] = client
+	t.record(tableClients, client.ID.String(), client)
+}
+
+// deleteClient deletes client row.
+func (t *tables) deleteClient(id uuid.UUID) {
+	delete(t.clients, id)
+	t.record(tableClients, id.String(), nil)
+}
+
+// putEmailVerification writes email verification row.
+func (t *tables) putEmailVerification(verification clients.EmailVerification) {
+	t.emailVerifications[verification.ClientID] = verification
+	t.record(tableEmailVerifications, verification.ClientID.String(), verification)
+}
+
+// deleteEmailVerification deletes email verification of the client if it exists.
+func (t *tables) deleteEmailVerification(clientID uuid.UUID) {
+	if _, ok := t.emailVerifications[clientID]; ok {
+		delete(t.emailVerifications, clientID)
+		t.record(tableEmailVerifications, clientID.String(), nil)
+	}
+}
+
+// writeManager saves manager row as the last written one.
+func (t *tables) writeManager(manager managers.Manager) {
+	t.writes++
+	t.loadManager(manager, t.writes)
+}
+
+// loadManager saves manager row with the number of its write.
+func (t *tables) loadManager(manager managers.Manager, write int64) {
+	if write > t.writes {
+		t.writes = write
+	}
+	t.managers[manager.ID] = manager
+	t.managerWrites[manager.ID] = write
+	t.record(tableManagers, manager.ID.String(), storedManager{Manager: manager, Write: write})
+}
+
+// deleteManager deletes manager row.
+func (t *tables) deleteManager(id uuid.UUID) {
+	delete(t.managers, id)
+	delete(t.managerWrites, id)
+	t.record(tableManagers, id.String(), nil)
+}
+
+// putRecoveryCode writes recovery code row, usedAt is nil for unused code.
+func (t *tables) putRecoveryCode(key recoveryCodeKey, usedAt *time.Time) {
+	t.recoveryCodes[key] = usedAt
+	t.record(tableRecoveryCodes, key.String(), usedAt)
+}
+
+// deleteRecoveryCode deletes recovery code row.
+func (t *tables) deleteRecoveryCode(key recoveryCodeKey) {
+	delete(t.recoveryCodes, key)
+	t.record(tableRecoveryCodes, key.String(), nil)
+}
+
+// putPasswordToken writes password token row.
+func (t *tables) putPasswordToken(token adminauth.PasswordToken) {
+	t.passwordTokens[string(token.Hash)] = token
+	t.record(tablePasswordTokens, hex.EncodeToString(token.Hash), token)
+}
+
+// deletePasswordToken deletes password token row.
+func (t *tables) deletePasswordToken(hash string) {
+	delete(t.passwordTokens, hash)
+	t.record(tablePasswordTokens, hex.EncodeToString([]byte(hash)), nil)
+}
+
+// putLoginThrottle writes throttling state of the key.
+func (t *tables) putLoginThrottle(throttle adminauth.LoginThrottle) {
+	t.loginThrottles[throttle.Key] = throttle
+	t.record(tableLoginThrottles, throttle.Key, throttle)
+}
+
+// deleteLoginThrottle deletes throttling state of the key if it exists.
+func (t *tables) deleteLoginThrottle(key string) {
+	if _, ok := t.loginThrottles[key]; ok {
+		delete(t.loginThrottles, key)
+		t.record(tableLoginThrottles, key, nil)
+	}
+}
+
+// putLoginAttempt writes login attempt row.
+func (t *tables) putLoginAttempt(attempt adminauth.LoginAttempt) {
+	t.loginAttempts[attempt.ID] = attempt
+	t.record(tableLoginAttempts, attempt.ID.String(), attempt)
+}
+
+// putSession writes session row.
+func (t *tables) putSession(session consoleauth.Session) {
+	t.sessions[session.ID] = session
+	t.record(tableSessions, session.ID.String(), session)
+}
+
+// deleteSession deletes session with its refresh tokens.
+func (t *tables) deleteSession(id uuid.UUID) {
+	delete(t.sessions, id)
+	t.record(tableSessions, id.String(), nil)
+
+	for hash, token := range t.refreshTokens {
+		if token.SessionID == id {
+			t.deleteRefreshToken(hash)
+		}
+	}
+}
+
+// putRefreshToken writes refresh token row.
+func (t *tables) putRefreshToken(token consoleauth.RefreshToken) {
+	t.refreshTokens[string(token.Hash)] = token
+	t.record(tableRefreshTokens, hex.EncodeToString(token.Hash), token)
+}
+
+// deleteRefreshToken deletes refresh token row.
+func (t *tables) deleteRefreshToken(hash string) {
+	delete(t.refreshTokens, hash)
+	t.record(tableRefreshTokens, hex.EncodeToString([]byte(hash)), nil)
+}
+
+// putAPIKey writes API key row.
+func (t *tables) putAPIKey(key consoleauth.APIKey) {
+	t.apiKeys[key.ID] = key
+	t.record(tableAPIKeys, key.ID.String(), key)
+}
+
+// appendAuditEntry adds entry to the end of audit log.
+func (t *tables) appendAuditEntry(entry audit.Entry) {
+	t.auditLog = append(t.auditLog, entry)
+	t.record(tableAuditLog, auditKey(entry.Sequence), entry)
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// Error is a default error class for migrations.
+var Error = errs.Class("migration error")
+
+// lockKey is a first key of advisory lock taken while migrations are applied,
+// the second key is a hash of current schema, so different schemas are migrated independently.
+const lockKey = 0x636d
+
+// Migration is a versioned change of database schema.
+type Migration struct {
+	Version     int
+	Description string
+	// Up is SQL which applies the change, it runs in one transaction with recording the version.
+	Up string
+}
+
+// Status describes whether migration is applied.
+type Status struct {
+	Migration
+	// AppliedAt is nil if migration is pending.
+	AppliedAt *time.Time
+}
+
+// Migrator applies ordered migrations to Postgres schema and records applied versions in schema_migrations table.
+//
+// architecture: Database
+type Migrator struct {
+	conn       *sql.DB
+	migrations []Migration
+}
+
+// New is a constructor for Migrator, migrations have to be ordered by version.
+func New(conn *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		conn:       conn,
+		migrations: migrations,
+	}
+}
+
+// Up applies pending migrations in version order and returns number of applied ones.
+// Migrations are applied under advisory lock, so peers which start concurrently wait for each other.
+func (migrator *Migrator) Up(ctx context.Context) (applied int, err error) {
+	if err = migrator.validate(); err != nil {
+		return 0, err
+	}
+
+	// session-level lock is held by connection, so all statements have to use the same one.
+	conn, err := migrator.conn.Conn(ctx)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, Error.Wrap(conn.Close())) }()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1, hashtext(current_schema()));`, lockKey)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext(current_schema()));`, lockKey)
+		err = errs.Combine(err, Error.Wrap(unlockErr))
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version      INTEGER NOT NULL,
+			description  TEXT    NOT NULL,
+			applied_at   timestamp with time zone NOT NULL,
+			PRIMARY KEY(version)
+		);`)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+
+	version, err := currentVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if latest := migrator.latest(); version > latest {
+		return 0, Error.New("database schema version %d is newer than the latest known migration %d", version, latest)
+	}
+
+	for _, migration := range migrator.migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		if err = apply(ctx, conn, migration); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Version returns the latest applied version, 0 if no migrations are applied.
+func (migrator *Migrator) Version(ctx context.Context) (_ int, err error) {
+	conn, err := migrator.conn.Conn(ctx)
+	if err != nil {
+		return 0, Error.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, Error.Wrap(conn.Close())) }()
+
+	exists, err := tableExists(ctx, conn)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	return currentVersion(ctx, conn)
+}
+
+// Status returns all known migrations with time they were applied at.
+func (migrator *Migrator) Status(ctx context.Context) (_ []Status, err error) {
+	if err = migrator.validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := migrator.conn.Conn(ctx)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, Error.Wrap(conn.Close())) }()
+
+	appliedAt := map[int]time.Time{}
+
+	exists, err := tableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		if appliedAt, err = appliedVersions(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		status := Status{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// validate checks that migrations are ordered by positive unique versions.
+func (migrator *Migrator) validate() error {
+	previous := 0
+	for _, migration := range migrator.migrations {
+		if migration.Version <= previous {
+			return Error.New("migration %d is out of order", migration.Version)
+		}
+		previous = migration.Version
+	}
+
+	return nil
+}
+
+// latest returns version of the last known migration.
+func (migrator *Migrator) latest() int {
+	if len(migrator.migrations) == 0 {
+		return 0
+	}
+
+	return migrator.migrations[len(migrator.migrations)-1].Version
+}
+
+// apply runs migration and records its version in a single transaction.
+func apply(ctx context.Context, conn *sql.Conn, migration Migration) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, Error.Wrap(tx.Rollback()))
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, migration.Up); err != nil {
+		return Error.New("migration %d %q failed: %v", migration.Version, migration.Description, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, description, applied_at) VALUES ($1, $2, $3);`,
+		migration.Version, migration.Description, time.Now().UTC())
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	return Error.Wrap(tx.Commit())
+}
+
+// currentVersion returns the latest applied version from existing schema_migrations table.
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&version)
+
+	return version, Error.Wrap(err)
+}
+
+// appliedVersions returns time each applied version was applied at.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (_ map[int]time.Time, err error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, Error.Wrap(rows.Close())) }()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, Error.Wrap(err)
+		}
+		appliedAt[version] = at
+	}
+
+	return appliedAt, Error.Wrap(rows.Err())
+}
+
+// tableExists checks whether schema_migrations table exists in current schema.
+func tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL;`).Scan(&exists)
+
+	return exists, Error.Wrap(err)
+}
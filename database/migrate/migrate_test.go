@@ -0,0 +1,49 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package migrate_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"cleanmasters"
+	"cleanmasters/database"
+	"cleanmasters/database/dbtesting"
+)
+
+func TestMigrateToLatest(t *testing.T) {
+	dbtesting.RunPostgres(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		migrator, err := database.NewMigrator(db)
+		require.NoError(t, err)
+
+		statuses, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, statuses)
+		for _, status := range statuses {
+			require.NotNil(t, status.AppliedAt, "migration %d is not applied", status.Version)
+		}
+
+		version, err := migrator.Version(ctx)
+		require.NoError(t, err)
+		require.Equal(t, statuses[len(statuses)-1].Version, version)
+
+		// concurrent runs wait for each other and do not apply anything twice.
+		var group errgroup.Group
+		for i := 0; i < 3; i++ {
+			group.Go(func() error {
+				applied, err := migrator.Up(ctx)
+				if err == nil && applied != 0 {
+					t.Errorf("applied %d migrations on migrated database", applied)
+				}
+				return err
+			})
+		}
+		require.NoError(t, group.Wait())
+
+		require.NoError(t, db.MigrateToLatest(ctx))
+	})
+}
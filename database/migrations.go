@@ -0,0 +1,301 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"cleanmasters/database/migrate"
+)
+
+// migrations are applied in order to bring database schema to the latest version.
+// Applied migrations must never be changed, every schema change is a new migration.
+var migrations = []migrate.Migration{
+	{
+		Version: 1,
+		// tables are created only if they do not exist, so databases created before migrations are adopted.
+		Description: "initial schema",
+		Up: `
+		CREATE TABLE IF NOT EXISTS clients (
+            id                  BYTEA NOT NULL,
+            phone               TEXT  NOT NULL,
+            first_name          TEXT,
+            last_name           TEXT,
+            email               TEXT,
+            email_normalized    TEXT,
+            created_at          timestamp with time zone NOT NULL,
+            PRIMARY KEY(id),
+            UNIQUE (phone),
+            UNIQUE (email_normalized)
+		);
+		CREATE TABLE IF NOT EXISTS managers (
+            id                  BYTEA NOT NULL,
+            first_name          TEXT  NOT NULL,
+            last_name           TEXT  NOT NULL,
+            email               TEXT  NOT NULL,
+            email_normalized    TEXT  NOT NULL,
+            password_hash       BYTEA NOT NULL,
+            created_at          timestamp with time zone NOT NULL,
+            PRIMARY KEY(id),
+            UNIQUE (email_normalized)
+		);
+		`,
+	},
+	{
+		Version:     2,
+		Description: "console sessions and refresh tokens",
+		Up: `
+		CREATE TABLE console_sessions (
+            id                  BYTEA NOT NULL,
+            client_id           BYTEA NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+            device              TEXT  NOT NULL,
+            created_at          timestamp with time zone NOT NULL,
+            last_used_at        timestamp with time zone NOT NULL,
+            revoked_at          timestamp with time zone,
+            PRIMARY KEY(id)
+		);
+		CREATE TABLE refresh_tokens (
+            token_hash          BYTEA NOT NULL,
+            session_id          BYTEA NOT NULL REFERENCES console_sessions(id) ON DELETE CASCADE,
+            created_at          timestamp with time zone NOT NULL,
+            expires_at          timestamp with time zone NOT NULL,
+            used_at             timestamp with time zone,
+            PRIMARY KEY(token_hash)
+		);
+		`,
+	},
+	{
+		Version: 3,
+		// managers created before roles existed had full access, so they become admins.
+		Description: "roles and two-factor authentication of managers",
+		Up: `
+		ALTER TABLE managers ADD COLUMN role TEXT;
+		UPDATE managers SET role = 'admin';
+		ALTER TABLE managers ALTER COLUMN role SET NOT NULL;
+		ALTER TABLE managers ADD COLUMN totp_secret BYTEA;
+		ALTER TABLE managers ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE managers ADD COLUMN totp_counter BIGINT NOT NULL DEFAULT 0;
+		CREATE TABLE manager_recovery_codes (
+            manager_id          BYTEA NOT NULL REFERENCES managers(id) ON DELETE CASCADE,
+            code_hash           BYTEA NOT NULL,
+            used_at             timestamp with time zone,
+            PRIMARY KEY(manager_id, code_hash)
+		);
+		`,
+	},
+	{
+		Version:     4,
+		Description: "login throttles and attempts",
+		Up: `
+		CREATE TABLE login_throttles (
+            key                 TEXT    NOT NULL,
+            failures            INTEGER NOT NULL,
+            last_failure_at     timestamp with time zone NOT NULL,
+            locked_until        timestamp with time zone,
+            PRIMARY KEY(key)
+		);
+		CREATE TABLE login_attempts (
+            id                  BYTEA   NOT NULL,
+            email               TEXT    NOT NULL,
+            ip                  TEXT    NOT NULL,
+            manager_id          BYTEA,
+            success             BOOLEAN NOT NULL,
+            reason              TEXT    NOT NULL,
+            created_at          timestamp with time zone NOT NULL,
+            PRIMARY KEY(id)
+		);
+		`,
+	},
+	{
+		Version:     5,
+		Description: "password tokens of managers",
+		Up: `
+		CREATE TABLE manager_password_tokens (
+            token_hash          BYTEA NOT NULL,
+            manager_id          BYTEA NOT NULL REFERENCES managers(id) ON DELETE CASCADE,
+            purpose             TEXT  NOT NULL,
+            created_at          timestamp with time zone NOT NULL,
+            expires_at          timestamp with time zone NOT NULL,
+            used_at             timestamp with time zone,
+            PRIMARY KEY(token_hash)
+		);
+		`,
+	},
+	{
+		Version:     6,
+		Description: "audit log",
+		Up: `
+		CREATE TABLE audit_log (
+            sequence            BIGINT NOT NULL,
+            id                  BYTEA  NOT NULL,
+            actor_id            BYTEA,
+            actor_type          TEXT   NOT NULL,
+            action              TEXT   NOT NULL,
+            entity_type         TEXT   NOT NULL,
+            entity_id           TEXT   NOT NULL,
+            changes             BYTEA  NOT NULL,
+            ip                  TEXT   NOT NULL,
+            user_agent          TEXT   NOT NULL,
+            created_at          timestamp with time zone NOT NULL,
+            prev_hash           BYTEA,
+            hash                BYTEA  NOT NULL,
+            PRIMARY KEY(sequence)
+		);
+		CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+		CREATE INDEX audit_log_actor_idx ON audit_log (actor_id);
+		CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+		`,
+	},
+	{
+		Version:     7,
+		Description: "console api keys",
+		Up: `
+		CREATE TABLE console_api_keys (
+            id                  BYTEA  NOT NULL,
+            name                TEXT   NOT NULL,
+            secret_hash         BYTEA  NOT NULL,
+            scopes              TEXT[] NOT NULL,
+            allowed_ips         TEXT[] NOT NULL,
+            created_by          BYTEA REFERENCES managers(id) ON DELETE SET NULL,
+            created_at          timestamp with time zone NOT NULL,
+            expires_at          timestamp with time zone NOT NULL,
+            last_used_at        timestamp with time zone,
+            revoked_at          timestamp with time zone,
+            PRIMARY KEY(id)
+		);
+		`,
+	},
+	{
+		Version:     8,
+		Description: "client list indexes",
+		Up: `
+		CREATE INDEX clients_name_idx ON clients (last_name, first_name, id);
+		CREATE INDEX clients_created_at_idx ON clients (created_at, id);
+		CREATE INDEX clients_phone_idx ON clients (phone, id);
+		`,
+	},
+	{
+		Version:     9,
+		Description: "client search indexes",
+		Up: `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		CREATE INDEX clients_phone_trgm_idx ON clients USING GIN (phone gin_trgm_ops);
+		CREATE INDEX clients_first_name_trgm_idx ON clients USING GIN (lower(first_name) gin_trgm_ops);
+		CREATE INDEX clients_last_name_trgm_idx ON clients USING GIN (lower(last_name) gin_trgm_ops);
+		CREATE INDEX clients_email_trgm_idx ON clients USING GIN (lower(email) gin_trgm_ops);
+		CREATE INDEX clients_search_idx ON clients USING GIN (to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || coalesce(email, '')));
+		`,
+	},
+	{
+		Version: 10,
+		// ids were written as text by uuid.UUID and could be raw 16 bytes if written as byte slices,
+		// both forms are converted. Rows with ids which are not valid uuids fail the migration.
+		Description: "uuid ids of clients and managers",
+		Up: `
+		CREATE FUNCTION bytea_to_uuid(value BYTEA) RETURNS UUID AS $$
+			SELECT CASE
+				WHEN length(value) = 16 THEN encode(value, 'hex')::UUID
+				ELSE convert_from(value, 'UTF8')::UUID
+			END;
+		$$ LANGUAGE SQL IMMUTABLE STRICT;
+		ALTER TABLE manager_recovery_codes DROP CONSTRAINT manager_recovery_codes_manager_id_fkey;
+		ALTER TABLE manager_password_tokens DROP CONSTRAINT manager_password_tokens_manager_id_fkey;
+		ALTER TABLE console_api_keys DROP CONSTRAINT console_api_keys_created_by_fkey;
+		ALTER TABLE console_sessions DROP CONSTRAINT console_sessions_client_id_fkey;
+		ALTER TABLE clients ALTER COLUMN id TYPE UUID USING bytea_to_uuid(id);
+		ALTER TABLE managers ALTER COLUMN id TYPE UUID USING bytea_to_uuid(id);
+		ALTER TABLE manager_recovery_codes ALTER COLUMN manager_id TYPE UUID USING bytea_to_uuid(manager_id);
+		ALTER TABLE manager_password_tokens ALTER COLUMN manager_id TYPE UUID USING bytea_to_uuid(manager_id);
+		ALTER TABLE login_attempts ALTER COLUMN manager_id TYPE UUID USING bytea_to_uuid(manager_id);
+		ALTER TABLE console_api_keys ALTER COLUMN created_by TYPE UUID USING bytea_to_uuid(created_by);
+		ALTER TABLE console_sessions ALTER COLUMN client_id TYPE UUID USING bytea_to_uuid(client_id);
+		ALTER TABLE manager_recovery_codes ADD CONSTRAINT manager_recovery_codes_manager_id_fkey
+			FOREIGN KEY (manager_id) REFERENCES managers(id) ON DELETE CASCADE;
+		ALTER TABLE manager_password_tokens ADD CONSTRAINT manager_password_tokens_manager_id_fkey
+			FOREIGN KEY (manager_id) REFERENCES managers(id) ON DELETE CASCADE;
+		ALTER TABLE console_api_keys ADD CONSTRAINT console_api_keys_created_by_fkey
+			FOREIGN KEY (created_by) REFERENCES managers(id) ON DELETE SET NULL;
+		ALTER TABLE console_sessions ADD CONSTRAINT console_sessions_client_id_fkey
+			FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE;
+		DROP FUNCTION bytea_to_uuid(BYTEA);
+		`,
+	},
+	{
+		Version:     11,
+		Description: "versions of clients and managers",
+		Up: `
+		ALTER TABLE clients ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+		ALTER TABLE managers ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+		`,
+	},
+	{
+		Version: 12,
+		// uniqueness is kept only among not deleted rows, so phone or email of deleted record could be reused.
+		Description: "soft delete of clients and managers",
+		Up: `
+		ALTER TABLE clients ADD COLUMN deleted_at timestamp with time zone;
+		ALTER TABLE managers ADD COLUMN deleted_at timestamp with time zone;
+		ALTER TABLE clients DROP CONSTRAINT clients_phone_key;
+		ALTER TABLE clients DROP CONSTRAINT clients_email_normalized_key;
+		ALTER TABLE managers DROP CONSTRAINT managers_email_normalized_key;
+		CREATE UNIQUE INDEX clients_phone_key ON clients (phone) WHERE deleted_at IS NULL;
+		CREATE UNIQUE INDEX clients_email_normalized_key ON clients (email_normalized) WHERE deleted_at IS NULL;
+		CREATE UNIQUE INDEX managers_email_normalized_key ON managers (email_normalized) WHERE deleted_at IS NULL;
+		CREATE INDEX clients_deleted_at_idx ON clients (deleted_at) WHERE deleted_at IS NOT NULL;
+		CREATE INDEX managers_deleted_at_idx ON managers (deleted_at) WHERE deleted_at IS NOT NULL;
+		`,
+	},
+	{
+		Version: 13,
+		// normalization mirrors mail.NormalizeAddress, both trim the same ASCII spaces. Emails of clients were
+		// never unique, so only the oldest of clients with the same email gets normalized one, preferring not
+		// deleted clients. Others keep it empty until their email is changed.
+		Description: "normalized emails and email verification of clients",
+		Up: `
+		CREATE FUNCTION normalize_email(email TEXT) RETURNS TEXT AS $$
+			SELECT lower(upper(btrim(email, E' \t\n\r\f\x0B')))
+		$$ LANGUAGE SQL IMMUTABLE;
+		UPDATE managers SET email_normalized = normalize_email(email);
+		UPDATE clients SET email_normalized = first.email_normalized
+			FROM (
+				SELECT DISTINCT ON (normalize_email(email)) id, normalize_email(email) AS email_normalized
+				FROM clients
+				WHERE normalize_email(email) <> ''
+				ORDER BY normalize_email(email), deleted_at IS NOT NULL, created_at
+			) AS first
+			WHERE clients.id = first.id;
+		DROP FUNCTION normalize_email(TEXT);
+		ALTER TABLE clients ADD COLUMN email_verified_at timestamp with time zone;
+		CREATE TABLE client_email_verifications (
+            client_id           UUID    NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+            email_normalized    TEXT    NOT NULL,
+            code_hash           BYTEA   NOT NULL,
+            attempts            INTEGER NOT NULL DEFAULT 0,
+            created_at          timestamp with time zone NOT NULL,
+            expires_at          timestamp with time zone NOT NULL,
+            PRIMARY KEY(client_id)
+		);
+		`,
+	},
+	{
+		Version: 14,
+		// phones are stored as they were entered, search matches digits only, so formatting does not matter.
+		Description: "client search by phone digits",
+		Up: `
+		DROP INDEX clients_phone_trgm_idx;
+		CREATE INDEX clients_phone_digits_trgm_idx ON clients USING GIN (regexp_replace(phone, '\D', '', 'g') gin_trgm_ops);
+		`,
+	},
+	{
+		Version:     15,
+		Description: "client lookup by phone digits",
+		Up: `
+		CREATE INDEX clients_phone_digits_idx ON clients (regexp_replace(phone, '\D', '', 'g'));
+		`,
+	},
+}
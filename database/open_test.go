@@ -0,0 +1,56 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/database"
+	"cleanmasters/database/dbtesting"
+)
+
+func TestOpenUnavailable(t *testing.T) {
+	ctx := context.Background()
+	config := database.Config{
+		Ping: database.PingConfig{Attempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond},
+	}
+
+	start := time.Now()
+	_, err := database.Open(ctx, "postgres://postgres@127.0.0.1:1/cleanmasters?sslmode=disable", config)
+	require.Error(t, err)
+	assert.True(t, database.Error.Has(err))
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.True(t, time.Since(start) >= 25*time.Millisecond)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = database.Open(canceled, "postgres://postgres@127.0.0.1:1/cleanmasters?sslmode=disable", database.Config{})
+	assert.True(t, database.Error.Has(err))
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	_, err := database.Open(context.Background(), "mysql://localhost/cleanmasters", database.Config{})
+	assert.True(t, database.Error.Has(err))
+}
+
+func TestPing(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		require.NoError(t, db.Ping(ctx))
+		require.NoError(t, db.WithTx(ctx, func(tx cleanmasters.DB) error {
+			return tx.Ping(ctx)
+		}))
+	})
+}
+
+func TestStats(t *testing.T) {
+	dbtesting.RunPostgres(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		assert.Equal(t, database.DefaultConfig.MaxOpenConns, db.Stats().MaxOpenConnections)
+	})
+}
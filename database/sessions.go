@@ -0,0 +1,278 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/console/consoleauth"
+)
+
+// ensures that sessionsdb implements consoleauth.DB.
+var _ consoleauth.DB = (*sessionsdb)(nil)
+
+// ErrSessionsDB in the error class that indicates about SessionsDB error.
+var ErrSessionsDB = errs.Class("SessionsDB error")
+
+// sessionsdb is a Postgres implementation of consoleauth.DB.
+//
+// architecture: Database
+type sessionsdb struct {
+	conn executor
+}
+
+// CreateSession is a method for inserting new Session to the database.
+func (repository *sessionsdb) CreateSession(ctx context.Context, session consoleauth.Session) error {
+	statement := `INSERT INTO console_sessions (id, client_id, device, created_at, last_used_at) VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := repository.conn.ExecContext(ctx, statement, session.ID, session.ClientID, session.Device, session.CreatedAt, session.LastUsedAt)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// GetSession is used to return session by id.
+func (repository *sessionsdb) GetSession(ctx context.Context, id uuid.UUID) (consoleauth.Session, error) {
+	statement := `SELECT client_id, device, created_at, last_used_at, revoked_at FROM console_sessions WHERE id = $1;`
+
+	session := consoleauth.Session{
+		ID: id,
+	}
+
+	var revokedAt sql.NullTime
+	row := repository.conn.QueryRowContext(ctx, statement, id)
+	if err := row.Scan(&session.ClientID, &session.Device, &session.CreatedAt, &session.LastUsedAt, &revokedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return consoleauth.Session{}, consoleauth.ErrNoSession.Wrap(err)
+		}
+		return consoleauth.Session{}, ErrSessionsDB.Wrap(err)
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return session, nil
+}
+
+// ListSessions is used to return all not revoked sessions of the client.
+func (repository *sessionsdb) ListSessions(ctx context.Context, clientID uuid.UUID) (sessions []consoleauth.Session, err error) {
+	statement := `SELECT id, device, created_at, last_used_at
+					FROM console_sessions
+					WHERE client_id = $1 AND revoked_at IS NULL
+					ORDER BY last_used_at DESC;`
+
+	rows, err := repository.conn.QueryContext(ctx, statement, clientID)
+	if err != nil {
+		return nil, ErrSessionsDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		session := consoleauth.Session{
+			ClientID: clientID,
+		}
+
+		if err := rows.Scan(&session.ID, &session.Device, &session.CreatedAt, &session.LastUsedAt); err != nil {
+			return nil, ErrSessionsDB.Wrap(err)
+		}
+
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ErrSessionsDB.Wrap(err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession updates last usage time of the session.
+func (repository *sessionsdb) TouchSession(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	statement := `UPDATE console_sessions SET last_used_at = $1 WHERE id = $2;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, usedAt, id)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// RevokeSession revokes session and therefore all refresh tokens issued for it.
+func (repository *sessionsdb) RevokeSession(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	statement := `UPDATE console_sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, revokedAt, id)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// AddRefreshToken is a method for inserting new RefreshToken to the database.
+func (repository *sessionsdb) AddRefreshToken(ctx context.Context, token consoleauth.RefreshToken) error {
+	statement := `INSERT INTO refresh_tokens (token_hash, session_id, created_at, expires_at) VALUES ($1, $2, $3, $4);`
+
+	_, err := repository.conn.ExecContext(ctx, statement, token.Hash, token.SessionID, token.CreatedAt, token.ExpiresAt)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// GetRefreshToken is used to return refresh token by its hash.
+func (repository *sessionsdb) GetRefreshToken(ctx context.Context, hash []byte) (consoleauth.RefreshToken, error) {
+	statement := `SELECT session_id, created_at, expires_at, used_at FROM refresh_tokens WHERE token_hash = $1;`
+
+	token := consoleauth.RefreshToken{
+		Hash: hash,
+	}
+
+	var usedAt sql.NullTime
+	row := repository.conn.QueryRowContext(ctx, statement, hash)
+	if err := row.Scan(&token.SessionID, &token.CreatedAt, &token.ExpiresAt, &usedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return consoleauth.RefreshToken{}, consoleauth.ErrNoRefreshToken.Wrap(err)
+		}
+		return consoleauth.RefreshToken{}, ErrSessionsDB.Wrap(err)
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks refresh token as used, returns ErrRefreshTokenUsed if it was used before.
+func (repository *sessionsdb) UseRefreshToken(ctx context.Context, hash []byte, usedAt time.Time) error {
+	statement := `UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL;`
+
+	result, err := repository.conn.ExecContext(ctx, statement, usedAt, hash)
+	if err != nil {
+		return ErrSessionsDB.Wrap(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ErrSessionsDB.Wrap(err)
+	}
+	if affected == 0 {
+		return consoleauth.ErrRefreshTokenUsed.New("")
+	}
+
+	return nil
+}
+
+// apiKeyColumns is a list of columns selected for API key.
+const apiKeyColumns = `id, name, secret_hash, scopes, allowed_ips, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+// CreateAPIKey is a method for inserting new APIKey to the database.
+func (repository *sessionsdb) CreateAPIKey(ctx context.Context, key consoleauth.APIKey) error {
+	statement := `INSERT INTO console_api_keys (id, name, secret_hash, scopes, allowed_ips, created_by, created_at, expires_at)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	allowedIPs := key.AllowedIPs
+	if allowedIPs == nil {
+		allowedIPs = []string{}
+	}
+
+	var createdBy interface{}
+	if key.CreatedBy != uuid.Nil {
+		createdBy = key.CreatedBy
+	}
+
+	_, err := repository.conn.ExecContext(ctx, statement, key.ID, key.Name, key.SecretHash, pq.Array(scopes), pq.Array(allowedIPs),
+		createdBy, key.CreatedAt, key.ExpiresAt)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// GetAPIKey is used to return API key by id, returns ErrNoAPIKey if there is no such key.
+func (repository *sessionsdb) GetAPIKey(ctx context.Context, id uuid.UUID) (consoleauth.APIKey, error) {
+	row := repository.conn.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM console_api_keys WHERE id = $1;`, id)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return consoleauth.APIKey{}, consoleauth.ErrNoAPIKey.Wrap(err)
+		}
+		return consoleauth.APIKey{}, ErrSessionsDB.Wrap(err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys is used to return all API keys, newest first.
+func (repository *sessionsdb) ListAPIKeys(ctx context.Context) (keys []consoleauth.APIKey, err error) {
+	rows, err := repository.conn.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM console_api_keys ORDER BY created_at DESC;`)
+	if err != nil {
+		return nil, ErrSessionsDB.Wrap(err)
+	}
+	defer func() { err = errs.Combine(err, rows.Close()) }()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, ErrSessionsDB.Wrap(err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, ErrSessionsDB.Wrap(rows.Err())
+}
+
+// RevokeAPIKey marks API key as revoked.
+func (repository *sessionsdb) RevokeAPIKey(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	statement := `UPDATE console_api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, revokedAt, id)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// TouchAPIKey updates last usage time of API key.
+func (repository *sessionsdb) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	statement := `UPDATE console_api_keys SET last_used_at = $1 WHERE id = $2;`
+
+	_, err := repository.conn.ExecContext(ctx, statement, usedAt, id)
+
+	return ErrSessionsDB.Wrap(err)
+}
+
+// scanAPIKey scans API key selected with apiKeyColumns.
+func scanAPIKey(row interface {
+	Scan(dest ...interface{}) error
+}) (consoleauth.APIKey, error) {
+	var key consoleauth.APIKey
+	var scopes []string
+	var createdBy *uuid.UUID
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.SecretHash, pq.Array(&scopes), pq.Array(&key.AllowedIPs), &createdBy,
+		&key.CreatedAt, &key.ExpiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return consoleauth.APIKey{}, err
+	}
+
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, consoleauth.Scope(scope))
+	}
+	if createdBy != nil {
+		key.CreatedBy = *createdBy
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
+
+	"cleanmasters"
+)
+
+// ErrTx indicates that transaction could not be started, committed or rolled back.
+var ErrTx = errs.Class("database transaction error")
+
+const (
+	// maxTxAttempts is a number of times transaction is run before serialization failure is returned.
+	maxTxAttempts = 5
+	// txRetryDelay is a delay before the first retry of transaction, it doubles with every attempt.
+	txRetryDelay = 10 * time.Millisecond
+)
+
+// executor runs statements either on the whole database or within a transaction.
+// Repositories obtained from the transaction share its executor.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// WithTx runs fn in a serializable transaction, repositories of tx passed to fn share it.
+// Transaction is committed if fn returns nil and rolled back if fn returns an error or panics.
+// On serialization failure the whole transaction is retried, so fn could be called several times
+// and must not have side effects outside of tx. WithTx called on tx joins the running transaction.
+func (db *database) WithTx(ctx context.Context, fn func(tx cleanmasters.DB) error) (err error) {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = db.runTx(ctx, fn)
+		if !isSerializationFailure(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errs.Combine(err, ctx.Err())
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// runTx runs fn in a single transaction attempt.
+func (db *database) runTx(ctx context.Context, fn func(tx cleanmasters.DB) error) (err error) {
+	tx, err := db.conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return ErrTx.Wrap(err)
+	}
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			err = errs.Combine(err, ErrTx.Wrap(rollbackErr))
+		}
+	}()
+
+	err = fn(&database{conn: db.conn, tx: tx})
+	if err != nil {
+		return err
+	}
+
+	committed = true
+	return ErrTx.Wrap(tx.Commit())
+}
+
+// inTx runs fn in a transaction which is committed if fn succeeds.
+// If executor is a transaction already, fn joins it and the caller of WithTx commits it.
+func inTx(ctx context.Context, conn executor, fn func(tx executor) error) (err error) {
+	if tx, ok := conn.(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	db, ok := conn.(*sql.DB)
+	if !ok {
+		return ErrTx.New("unexpected executor %T", conn)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrTx.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, tx.Rollback())
+			return
+		}
+		err = ErrTx.Wrap(tx.Commit())
+	}()
+
+	return fn(tx)
+}
+
+// isSerializationFailure checks whether transaction failed because of concurrent transactions
+// and could succeed if retried.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code {
+	case "40001", "40P01": // serialization_failure, deadlock_detected.
+		return true
+	default:
+		return false
+	}
+}
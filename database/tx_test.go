@@ -0,0 +1,75 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters"
+	"cleanmasters/clients"
+	"cleanmasters/database/dbtesting"
+)
+
+func TestWithTx(t *testing.T) {
+	dbtesting.Run(t, func(ctx context.Context, t *testing.T, db cleanmasters.DB) {
+		newClient := func(phone string) clients.Client {
+			return clients.Client{ID: uuid.New(), Phone: phone}
+		}
+
+		t.Run("commit", func(t *testing.T) {
+			client := newClient("380500000001")
+			err := db.WithTx(ctx, func(tx cleanmasters.DB) error {
+				if err := tx.Clients().Add(ctx, client); err != nil {
+					return err
+				}
+
+				// nested transaction joins the running one.
+				return tx.WithTx(ctx, func(tx cleanmasters.DB) error {
+					_, err := tx.Clients().Get(ctx, client.ID)
+					return err
+				})
+			})
+			require.NoError(t, err)
+
+			_, err = db.Clients().Get(ctx, client.ID)
+			require.NoError(t, err)
+		})
+
+		t.Run("rollback on error", func(t *testing.T) {
+			client := newClient("380500000002")
+			errFailed := errors.New("failed")
+			err := db.WithTx(ctx, func(tx cleanmasters.DB) error {
+				if err := tx.Clients().Add(ctx, client); err != nil {
+					return err
+				}
+				return errFailed
+			})
+			require.True(t, errors.Is(err, errFailed))
+
+			_, err = db.Clients().Get(ctx, client.ID)
+			require.Error(t, err)
+		})
+
+		t.Run("rollback on panic", func(t *testing.T) {
+			client := newClient("380500000003")
+			assert.Panics(t, func() {
+				_ = db.WithTx(ctx, func(tx cleanmasters.DB) error {
+					if err := tx.Clients().Add(ctx, client); err != nil {
+						return err
+					}
+					panic("failed")
+				})
+			})
+
+			_, err := db.Clients().Get(ctx, client.ID)
+			require.Error(t, err)
+		})
+	})
+}
@@ -10,7 +10,9 @@ require (
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.4.0
 	github.com/zeebo/errs v1.2.2
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.15.0
 	golang.org/x/crypto v0.0.0-20190510104115-cbcb75029529
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	rsc.io/qr v0.2.0
 )
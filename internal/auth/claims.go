@@ -15,7 +15,19 @@ var ErrClaims = errs.Class("auth claims error")
 // Claims represents data signed by server and used for authentication.
 type Claims struct {
 	ID        uuid.UUID `json:"id"`
+	SessionID uuid.UUID `json:"sessionId"`
 	ExpiresAt time.Time `json:"expiresAt"`
+	// Purpose restricts token usage, empty purpose is a regular auth token.
+	Purpose string `json:"purpose,omitempty"`
+	// ImpersonatorID is an id of the manager who acts on behalf of the client, it is empty for tokens issued to the client.
+	ImpersonatorID uuid.UUID `json:"impersonatorId,omitempty"`
+	// APIKeyID is an id of API key which authenticated the request, it is never part of signed token.
+	APIKeyID uuid.UUID `json:"-"`
+}
+
+// IsImpersonation returns true if token is issued to the manager acting on behalf of the client.
+func (c *Claims) IsImpersonation() bool {
+	return c.ImpersonatorID != uuid.Nil
 }
 
 // JSON returns json representation of Claims.
@@ -0,0 +1,144 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package debug
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zeebo/errs"
+	"golang.org/x/sync/errgroup"
+
+	"cleanmasters/internal/logger"
+)
+
+var (
+	// Error is an error class that indicates internal debug server error.
+	Error = errs.Class("debug server error")
+)
+
+// Config contains configuration for internal debug server, it must not be reachable from outside.
+type Config struct {
+	Address string `help:"address of internal server with health check and database statistics" default:"127.0.0.1:8090"`
+	// HealthTimeout limits time of database health check.
+	HealthTimeout time.Duration
+}
+
+// DefaultConfig is used when debug server is not configured.
+var DefaultConfig = Config{
+	Address:       "127.0.0.1:8090",
+	HealthTimeout: 5 * time.Second,
+}
+
+// DB is a database which state is reported by debug server.
+type DB interface {
+	// Ping checks that database is available.
+	Ping(ctx context.Context) error
+	// Stats returns statistics of database connections.
+	Stats() sql.DBStats
+}
+
+// Server serves internal endpoints with health check and database statistics.
+//
+// architecture: Endpoint
+type Server struct {
+	log    logger.Logger
+	config Config
+	db     DB
+
+	server   http.Server
+	listener net.Listener
+}
+
+// NewServer is a constructor for debug server, DefaultConfig values are used for empty config fields.
+func NewServer(log logger.Logger, config Config, db DB, listener net.Listener) *Server {
+	if config.HealthTimeout <= 0 {
+		config.HealthTimeout = DefaultConfig.HealthTimeout
+	}
+
+	server := &Server{
+		log:      log,
+		config:   config,
+		db:       db,
+		listener: listener,
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/health", server.health).Methods(http.MethodGet)
+	router.HandleFunc("/stats/db", server.dbStats).Methods(http.MethodGet)
+
+	server.server = http.Server{
+		Handler: router,
+	}
+
+	return server
+}
+
+// Run starts the server that serves debug endpoints.
+func (server *Server) Run(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var group errgroup.Group
+
+	group.Go(func() error {
+		<-ctx.Done()
+		return Error.Wrap(server.server.Shutdown(ctx))
+	})
+	group.Go(func() error {
+		defer cancel()
+		err := server.server.Serve(server.listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return Error.Wrap(err)
+	})
+
+	return Error.Wrap(group.Wait())
+}
+
+// Close closes server and underlying listener.
+func (server *Server) Close() error {
+	return Error.Wrap(server.server.Close())
+}
+
+// healthStatus is a response of health check.
+type healthStatus struct {
+	Database string `json:"database"`
+	Error    string `json:"error,omitempty"`
+}
+
+// health pings database, responds with 503 status if it is not available.
+func (server *Server) health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), server.config.HealthTimeout)
+	defer cancel()
+
+	status, code := healthStatus{Database: "ok"}, http.StatusOK
+	if err := server.db.Ping(ctx); err != nil {
+		server.log.Error("database health check failed", Error.Wrap(err))
+		status, code = healthStatus{Database: "unavailable", Error: err.Error()}, http.StatusServiceUnavailable
+	}
+
+	server.serveJSON(w, code, status)
+}
+
+// dbStats responds with statistics of database connections.
+func (server *Server) dbStats(w http.ResponseWriter, r *http.Request) {
+	server.serveJSON(w, http.StatusOK, server.db.Stats())
+}
+
+// serveJSON writes value as json response with the status code.
+func (server *Server) serveJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		server.log.Error("could not encode json response", Error.Wrap(err))
+	}
+}
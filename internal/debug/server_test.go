@@ -0,0 +1,80 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package debug_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/debug"
+	"cleanmasters/internal/logger/zaplog"
+)
+
+// fakeDB reports configured ping error and statistics.
+type fakeDB struct {
+	pingErr error
+	stats   sql.DBStats
+}
+
+func (db *fakeDB) Ping(ctx context.Context) error { return db.pingErr }
+
+func (db *fakeDB) Stats() sql.DBStats { return db.stats }
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	db := &fakeDB{stats: sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}}
+	server := debug.NewServer(zaplog.NewLog(), debug.Config{}, db, listener)
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(ctx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	baseURL := "http://" + listener.Addr().String()
+	get := func(path string, value interface{}) int {
+		response, err := http.Get(baseURL + path)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, response.Body.Close()) }()
+
+		assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(response.Body).Decode(value))
+		return response.StatusCode
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		var status map[string]string
+		assert.Equal(t, http.StatusOK, get("/health", &status))
+		assert.Equal(t, map[string]string{"database": "ok"}, status)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		db.pingErr = errors.New("connection refused")
+		defer func() { db.pingErr = nil }()
+
+		var status map[string]string
+		assert.Equal(t, http.StatusServiceUnavailable, get("/health", &status))
+		assert.Equal(t, map[string]string{"database": "unavailable", "error": "connection refused"}, status)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		var stats sql.DBStats
+		assert.Equal(t, http.StatusOK, get("/stats/db", &stats))
+		assert.Equal(t, db.stats, stats)
+	})
+}
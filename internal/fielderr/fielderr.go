@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package fielderr
+
+import (
+	"errors"
+)
+
+// Kind describes why the field value is not accepted.
+type Kind string
+
+const (
+	// KindTaken means that value has to be unique and is already used by another entity.
+	KindTaken Kind = "taken"
+	// KindRequired means that value is missing.
+	KindRequired Kind = "required"
+	// KindUnknownReference means that value refers to an entity which does not exist.
+	KindUnknownReference Kind = "unknown_reference"
+)
+
+// Error indicates that the value of a single entity field is not accepted.
+// Field is named as in JSON APIs, e.g. "phone" or "firstName".
+type Error struct {
+	Field string
+	Kind  Kind
+}
+
+// New returns error about the field.
+func New(field string, kind Kind) *Error {
+	return &Error{Field: field, Kind: kind}
+}
+
+// Error implements error interface.
+func (err *Error) Error() string {
+	switch err.Kind {
+	case KindTaken:
+		return err.Field + " is already taken"
+	case KindRequired:
+		return err.Field + " is required"
+	case KindUnknownReference:
+		return err.Field + " refers to unknown entity"
+	default:
+		return err.Field + " is not valid"
+	}
+}
+
+// Is reports whether target is an error about the same field of the same kind.
+func (err *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return other.Field == err.Field && other.Kind == err.Kind
+}
+
+// As returns the first field error in the chain of err.
+func As(err error) (*Error, bool) {
+	var fieldErr *Error
+	ok := errors.As(err, &fieldErr)
+
+	return fieldErr, ok
+}
@@ -0,0 +1,33 @@
+package fielderr_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/fielderr"
+)
+
+func TestFieldError(t *testing.T) {
+	errPhoneTaken := fielderr.New("phone", fielderr.KindTaken)
+
+	serviceError, dbError := errs.Class("service"), errs.Class("db")
+
+	err := serviceError.Wrap(dbError.Wrap(errPhoneTaken))
+	assert.True(t, errors.Is(err, errPhoneTaken))
+	assert.True(t, errors.Is(err, fielderr.New("phone", fielderr.KindTaken)))
+	assert.False(t, errors.Is(err, fielderr.New("email", fielderr.KindTaken)))
+	assert.False(t, errors.Is(err, fielderr.New("phone", fielderr.KindRequired)))
+	assert.Equal(t, "phone is already taken", errs.Unwrap(err).Error())
+
+	fieldErr, ok := fielderr.As(err)
+	require.True(t, ok)
+	assert.Equal(t, "phone", fieldErr.Field)
+	assert.Equal(t, fielderr.KindTaken, fieldErr.Kind)
+
+	_, ok = fielderr.As(errs.New("other"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,24 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package mail
+
+import (
+	"strings"
+	"unicode"
+)
+
+// asciiSpace lists spaces trimmed from email address, it matches the set trimmed by database migration.
+const asciiSpace = " \t\n\r\f\v"
+
+// NormalizeAddress returns canonical form of email address which is used to store and compare addresses:
+// surrounding ASCII spaces are trimmed and letters are case folded, e.g. "Ab@Qwe.com " and "aB@qwe.COM" are the same address.
+func NormalizeAddress(address string) string {
+	return strings.Map(foldRune, strings.Trim(address, asciiSpace))
+}
+
+// foldRune maps all runes which are equal under simple Unicode case folding to the same rune.
+// Round trip through upper case folds runes such as long s and Kelvin sign to the same lower case letters as their ASCII pairs.
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
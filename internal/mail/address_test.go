@@ -0,0 +1,28 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cleanmasters/internal/mail"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	for _, test := range []struct {
+		address    string
+		normalized string
+	}{
+		{address: "am@qwe.com", normalized: "am@qwe.com"},
+		{address: " Am@QWE.com\t", normalized: "am@qwe.com"},
+		{address: "ΣΊΣΥΦΟΣ@qwe.com", normalized: "σίσυφοσ@qwe.com"},
+		{address: "σίσυφος@qwe.com", normalized: "σίσυφοσ@qwe.com"},
+		{address: "\u017Fam@qwe.com", normalized: "sam@qwe.com"},
+		{address: "\u212Aate@qwe.com", normalized: "kate@qwe.com"},
+		{address: "  ", normalized: ""},
+		{address: "\v\f\r\nam@qwe.com", normalized: "am@qwe.com"},
+		{address: "\u00A0am@qwe.com\u2003", normalized: "\u00A0am@qwe.com\u2003"},
+	} {
+		assert.Equal(t, test.normalized, mail.NormalizeAddress(test.address), test.address)
+	}
+}
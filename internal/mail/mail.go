@@ -0,0 +1,93 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/logger"
+)
+
+// Error is an error class for mail package.
+var Error = errs.Class("mail error")
+
+// Mailer sends emails.
+//
+// architecture: Service
+type Mailer interface {
+	// Send sends message to the recipient.
+	Send(ctx context.Context, message Message) error
+}
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Config defines which mailer is used.
+type Config struct {
+	// Dir is a directory where messages are stored as files, messages are written to log if it is empty.
+	Dir string
+}
+
+// New creates mailer based on configuration.
+func New(log logger.Logger, config Config) Mailer {
+	if config.Dir != "" {
+		return NewFileMailer(config.Dir)
+	}
+
+	return NewLogMailer(log)
+}
+
+// FileMailer is a local stand-in for real mailer which saves every message to separate file.
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer is a constructor for FileMailer.
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+// Send writes message to new file in mailer directory.
+func (mailer *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := os.MkdirAll(mailer.dir, 0700); err != nil {
+		return Error.Wrap(err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+
+	return Error.Wrap(ioutil.WriteFile(filepath.Join(mailer.dir, name), []byte(message.String()), 0600))
+}
+
+// LogMailer is a local stand-in for real mailer which writes every message to log.
+type LogMailer struct {
+	log logger.Logger
+}
+
+// NewLogMailer is a constructor for LogMailer.
+func NewLogMailer(log logger.Logger) *LogMailer {
+	return &LogMailer{log: log}
+}
+
+// Send writes message to log.
+func (mailer *LogMailer) Send(ctx context.Context, message Message) error {
+	mailer.log.Debug(message.String())
+	return nil
+}
+
+// String formats message with headers.
+func (message Message) String() string {
+	return fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", message.To, message.Subject, message.Body)
+}
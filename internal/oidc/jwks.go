@@ -0,0 +1,183 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// minRefreshInterval limits how often keys are fetched when token is signed with unknown key.
+const minRefreshInterval = time.Minute
+
+// jwk is a single JSON Web Key.
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// keySet caches signing keys of identity provider and refreshes them on key rotation.
+type keySet struct {
+	uri   string
+	fetch func(ctx context.Context, url string, value interface{}) error
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	refreshed time.Time
+}
+
+// newKeySet is a constructor for keySet.
+func newKeySet(uri string, fetch func(ctx context.Context, url string, value interface{}) error) *keySet {
+	return &keySet{
+		uri:   uri,
+		fetch: fetch,
+	}
+}
+
+// verify checks RS256 signature of compact JWS and returns its payload.
+func (set *keySet) verify(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errs.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errs.New("malformed header: %v", err)
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errs.New("malformed header: %v", err)
+	}
+
+	// only asymmetric algorithm is accepted, so "none" and HMAC with public key are rejected.
+	if header.Algorithm != "RS256" {
+		return nil, errs.New("unsupported algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errs.New("malformed signature: %v", err)
+	}
+
+	key, err := set.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errs.New("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errs.New("malformed payload: %v", err)
+	}
+
+	return payload, nil
+}
+
+// key returns key by its id, keys are fetched again if the key is unknown.
+func (set *keySet) key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if key, ok := set.lookup(keyID); ok {
+		return key, nil
+	}
+
+	if !set.refreshed.IsZero() && time.Since(set.refreshed) < minRefreshInterval {
+		return nil, errs.New("unknown key %q", keyID)
+	}
+
+	if err := set.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := set.lookup(keyID); ok {
+		return key, nil
+	}
+
+	return nil, errs.New("unknown key %q", keyID)
+}
+
+// lookup finds cached key, token without key id could be verified only if there is a single key.
+func (set *keySet) lookup(keyID string) (*rsa.PublicKey, bool) {
+	if keyID == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, true
+		}
+	}
+
+	key, ok := set.keys[keyID]
+	return key, ok
+}
+
+// refresh fetches RSA signing keys from JWKS endpoint.
+func (set *keySet) refresh(ctx context.Context) error {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := set.fetch(ctx, set.uri, &document); err != nil {
+		return errs.New("could not fetch keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range document.Keys {
+		if key.KeyType != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		publicKey, err := key.rsa()
+		if err != nil {
+			return err
+		}
+		keys[key.KeyID] = publicKey
+	}
+
+	set.keys = keys
+	set.refreshed = time.Now()
+
+	return nil
+}
+
+// rsa decodes RSA public key.
+func (key jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, errs.New("malformed key %q: %v", key.KeyID, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, errs.New("malformed key %q: %v", key.KeyID, err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+		return nil, errs.New("malformed key %q: invalid exponent", key.KeyID)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
@@ -0,0 +1,310 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+var (
+	// Error is an error class for OpenID Connect errors.
+	Error = errs.Class("oidc error")
+	// ErrInvalidToken indicates that ID token could not be trusted.
+	ErrInvalidToken = errs.Class("invalid id token")
+)
+
+// Config contains OpenID Connect client registration.
+type Config struct {
+	// Issuer is an URL of identity provider, discovery document is fetched from it.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is an URL of callback endpoint registered at identity provider.
+	RedirectURL string
+	// Scopes are requested in addition to openid scope.
+	Scopes []string
+	// GroupsClaim is a name of ID token claim with groups of the user, "groups" is used if it is empty.
+	GroupsClaim string
+}
+
+// discovery is a subset of OpenID Provider metadata.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims holds verified claims of ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// Provider performs authorization code flow with PKCE against single identity provider.
+type Provider struct {
+	config    Config
+	client    *http.Client
+	discovery discovery
+	keys      *keySet
+	now       func() time.Time
+}
+
+// NewProvider fetches discovery document of identity provider, client is http.DefaultClient if nil.
+func NewProvider(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	provider := &Provider{
+		config: config,
+		client: client,
+		now:    time.Now,
+	}
+
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := provider.getJSON(ctx, wellKnown, &provider.discovery); err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	// issuer in discovery document has to match configured one to prevent mix-up with other provider.
+	if provider.discovery.Issuer != config.Issuer {
+		return nil, Error.New("issuer %q does not match configured %q", provider.discovery.Issuer, config.Issuer)
+	}
+
+	provider.keys = newKeySet(provider.discovery.JWKSURI, provider.getJSON)
+
+	return provider, nil
+}
+
+// Request holds secrets of single login attempt, they have to be kept by user agent until callback.
+type Request struct {
+	// State protects callback from cross-site request forgery.
+	State string
+	// Nonce binds ID token to login attempt.
+	Nonce string
+	// Verifier is a PKCE code verifier.
+	Verifier string
+}
+
+// NewRequest generates random state, nonce and PKCE code verifier.
+func NewRequest() (Request, error) {
+	var request Request
+	for _, value := range []*string{&request.State, &request.Nonce, &request.Verifier} {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return Request{}, Error.Wrap(err)
+		}
+
+		*value = base64.RawURLEncoding.EncodeToString(random)
+	}
+
+	return request, nil
+}
+
+// CodeChallenge returns S256 PKCE code challenge of the verifier.
+func CodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL returns URL of identity provider where user agent is redirected to login.
+func (provider *Provider) AuthCodeURL(request Request) string {
+	values := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.config.ClientID},
+		"redirect_uri":          {provider.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, provider.config.Scopes...), " ")},
+		"state":                 {request.State},
+		"nonce":                 {request.Nonce},
+		"code_challenge":        {CodeChallenge(request.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.discovery.AuthorizationEndpoint + separator + values.Encode()
+}
+
+// Exchange validates callback state, exchanges authorization code for ID token and verifies it.
+func (provider *Provider) Exchange(ctx context.Context, request Request, state, code string) (Claims, error) {
+	if request.State == "" || subtle.ConstantTimeCompare([]byte(request.State), []byte(state)) != 1 {
+		return Claims{}, ErrInvalidToken.New("state does not match")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.config.RedirectURL},
+		"client_id":     {provider.config.ClientID},
+		"code_verifier": {request.Verifier},
+	}
+	if provider.config.ClientSecret != "" {
+		form.Set("client_secret", provider.config.ClientSecret)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, Error.Wrap(err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpRequest.Header.Set("Accept", "application/json")
+
+	var response struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = provider.do(httpRequest, &response); err != nil {
+		return Claims{}, Error.Wrap(err)
+	}
+	if response.Error != "" {
+		return Claims{}, Error.New("token endpoint error: %s", response.Error)
+	}
+
+	return provider.Verify(ctx, response.IDToken, request.Nonce)
+}
+
+// Verify validates signature, issuer, audience, expiration and nonce of ID token.
+func (provider *Provider) Verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	payload, err := provider.keys.verify(ctx, idToken)
+	if err != nil {
+		return Claims{}, ErrInvalidToken.Wrap(err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(payload, &raw); err != nil {
+		return Claims{}, ErrInvalidToken.Wrap(err)
+	}
+
+	var standard struct {
+		Issuer        string          `json:"iss"`
+		Subject       string          `json:"sub"`
+		Audience      audience        `json:"aud"`
+		Expiry        int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err = json.Unmarshal(payload, &standard); err != nil {
+		return Claims{}, ErrInvalidToken.Wrap(err)
+	}
+
+	switch {
+	case standard.Issuer != provider.config.Issuer:
+		return Claims{}, ErrInvalidToken.New("unexpected issuer %q", standard.Issuer)
+	case !standard.Audience.contains(provider.config.ClientID):
+		return Claims{}, ErrInvalidToken.New("token is issued for other client")
+	case !provider.now().Before(time.Unix(standard.Expiry, 0)):
+		return Claims{}, ErrInvalidToken.New("token expired")
+	case nonce == "" || subtle.ConstantTimeCompare([]byte(standard.Nonce), []byte(nonce)) != 1:
+		return Claims{}, ErrInvalidToken.New("nonce does not match")
+	case standard.Subject == "":
+		return Claims{}, ErrInvalidToken.New("subject is missing")
+	}
+
+	claims := Claims{
+		Subject: standard.Subject,
+		Email:   standard.Email,
+		Name:    standard.Name,
+		// some providers send boolean as string.
+		EmailVerified: string(standard.EmailVerified) == "true" || string(standard.EmailVerified) == `"true"`,
+	}
+
+	if groups, ok := raw[provider.config.GroupsClaim]; ok {
+		if err = json.Unmarshal(groups, &claims.Groups); err != nil {
+			return Claims{}, ErrInvalidToken.Wrap(err)
+		}
+	}
+
+	return claims, nil
+}
+
+// audience is an aud claim which could be either string or array of strings.
+type audience []string
+
+// UnmarshalJSON decodes string or array of strings.
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*aud = multiple
+
+	return nil
+}
+
+// contains returns true if audience includes client.
+func (aud audience) contains(clientID string) bool {
+	for _, value := range aud {
+		if value == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getJSON fetches and decodes JSON document.
+func (provider *Provider) getJSON(ctx context.Context, url string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	return provider.do(request, value)
+}
+
+// maxResponseSize limits size of identity provider responses.
+const maxResponseSize = 1 << 20
+
+// do sends request and decodes JSON response.
+func (provider *Provider) do(request *http.Request, value interface{}) (err error) {
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, response.Body.Close()) }()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	// token endpoint reports errors with 400 status and JSON body.
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusBadRequest {
+		return errs.New("unexpected status %d from %s", response.StatusCode, request.URL)
+	}
+
+	return json.Unmarshal(body, value)
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/oidc"
+	"cleanmasters/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://portal.test/authorize/sso/callback"
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+
+	idp := oidctest.NewIdP("portal", "secret")
+	defer idp.Close()
+
+	idp.User = map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "oleg@example.com",
+		"email_verified": true,
+		"name":           "Oleg",
+		"groups":         []string{"cleanmasters-admins", "everyone"},
+	}
+
+	provider, err := oidc.NewProvider(ctx, idp.Config(redirectURL), nil)
+	require.NoError(t, err)
+
+	login := func(t *testing.T) (oidc.Request, string, string) {
+		request, err := oidc.NewRequest()
+		require.NoError(t, err)
+
+		callback, err := idp.Login(provider.AuthCodeURL(request))
+		require.NoError(t, err)
+		require.Equal(t, redirectURL, callback.Scheme+"://"+callback.Host+callback.Path)
+
+		return request, callback.Query().Get("state"), callback.Query().Get("code")
+	}
+
+	t.Run("success", func(t *testing.T) {
+		request, state, code := login(t)
+
+		claims, err := provider.Exchange(ctx, request, state, code)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", claims.Subject)
+		assert.Equal(t, "oleg@example.com", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, "Oleg", claims.Name)
+		assert.Equal(t, []string{"cleanmasters-admins", "everyone"}, claims.Groups)
+
+		// authorization code could be used only once.
+		_, err = provider.Exchange(ctx, request, state, code)
+		require.Error(t, err)
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		request, _, code := login(t)
+
+		_, err := provider.Exchange(ctx, request, "forged", code)
+		require.True(t, oidc.ErrInvalidToken.Has(err))
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		request, state, code := login(t)
+		request.Verifier = "other-verifier"
+
+		_, err := provider.Exchange(ctx, request, state, code)
+		require.Error(t, err)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		request, state, code := login(t)
+		request.Nonce = "other-nonce"
+
+		_, err := provider.Exchange(ctx, request, state, code)
+		require.True(t, oidc.ErrInvalidToken.Has(err))
+	})
+
+	tampered := []struct {
+		name   string
+		tamper func(claims map[string]interface{})
+	}{
+		{"expired", func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"other audience", func(claims map[string]interface{}) { claims["aud"] = []string{"other-client"} }},
+		{"other issuer", func(claims map[string]interface{}) { claims["iss"] = "https://evil.test" }},
+	}
+	for _, test := range tampered {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			idp.Tamper = test.tamper
+			defer func() { idp.Tamper = nil }()
+
+			request, state, code := login(t)
+
+			_, err := provider.Exchange(ctx, request, state, code)
+			require.True(t, oidc.ErrInvalidToken.Has(err))
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	ctx := context.Background()
+
+	idp := oidctest.NewIdP("portal", "")
+	defer idp.Close()
+
+	provider, err := oidc.NewProvider(ctx, idp.Config(redirectURL), nil)
+	require.NoError(t, err)
+
+	token := idp.Sign(map[string]interface{}{
+		"iss":   idp.Issuer,
+		"aud":   "portal",
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": "nonce",
+	})
+
+	_, err = provider.Verify(ctx, token, "nonce")
+	require.NoError(t, err)
+
+	t.Run("tampered payload", func(t *testing.T) {
+		other := idp.Sign(map[string]interface{}{
+			"iss":   idp.Issuer,
+			"aud":   "portal",
+			"sub":   "admin",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		})
+
+		// payload of other token with signature of the first one.
+		forged := token[:strings.IndexByte(token, '.')] + other[strings.IndexByte(other, '.'):strings.LastIndexByte(other, '.')] + token[strings.LastIndexByte(token, '.'):]
+
+		_, err := provider.Verify(ctx, forged, "nonce")
+		require.True(t, oidc.ErrInvalidToken.Has(err))
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		// {"alg":"none"}
+		unsigned := "eyJhbGciOiJub25lIn0" + token[strings.IndexByte(token, '.'):strings.LastIndexByte(token, '.')] + "."
+
+		_, err := provider.Verify(ctx, unsigned, "nonce")
+		require.True(t, oidc.ErrInvalidToken.Has(err))
+	})
+
+	t.Run("other issuer key", func(t *testing.T) {
+		other := oidctest.NewIdP("portal", "")
+		defer other.Close()
+
+		token := other.Sign(map[string]interface{}{
+			"iss":   idp.Issuer,
+			"aud":   "portal",
+			"sub":   "user-1",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		})
+
+		_, err := provider.Verify(ctx, token, "nonce")
+		require.True(t, oidc.ErrInvalidToken.Has(err))
+	})
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// example from RFC 7636 appendix B.
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts every argon2id hash.
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams defines cost of argon2id hashes.
+type Argon2idParams struct {
+	// Time is a number of passes over memory.
+	Time uint32
+	// Memory is a size of memory in KiB.
+	Memory uint32
+	// Threads is a degree of parallelism.
+	Threads uint8
+	// SaltLength is a length of random salt in bytes.
+	SaltLength uint32
+	// KeyLength is a length of derived key in bytes.
+	KeyLength uint32
+}
+
+// argon2idScheme encodes hashes in PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type argon2idScheme struct {
+	params Argon2idParams
+}
+
+// hash hashes password with configured parameters.
+func (scheme argon2idScheme) hash(password string) ([]byte, error) {
+	salt := make([]byte, scheme.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, scheme.params.Time, scheme.params.Memory, scheme.params.Threads, scheme.params.KeyLength)
+
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		scheme.params.Memory, scheme.params.Time, scheme.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// compare returns ErrMismatch if password does not match encoded hash.
+func (scheme argon2idScheme) compare(encoded []byte, password string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return ErrMismatch.Wrap(err)
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return ErrMismatch.New("")
+	}
+
+	return nil
+}
+
+// outdated returns true if hash was created with other parameters than configured.
+func (scheme argon2idScheme) outdated(encoded []byte) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params != scheme.params
+}
+
+// matches returns true if hash is argon2id hash.
+func (scheme argon2idScheme) matches(encoded []byte) bool {
+	return bytes.HasPrefix(encoded, []byte(argon2idPrefix))
+}
+
+// decodeArgon2id parses parameters, salt and key from argon2id hash.
+func decodeArgon2id(encoded []byte) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrHasher.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrHasher.Wrap(err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrHasher.New("unsupported argon2 version %d", version)
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrHasher.Wrap(err)
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrHasher.Wrap(err)
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrHasher.Wrap(err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
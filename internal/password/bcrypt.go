@@ -0,0 +1,41 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password
+
+import (
+	"bytes"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptParams defines cost of bcrypt hashes.
+type BcryptParams struct {
+	Cost int
+}
+
+// bcryptScheme uses modular crypt format of bcrypt hashes: $2a$10$<salt and key>.
+type bcryptScheme struct {
+	params BcryptParams
+}
+
+// hash hashes password with configured cost.
+func (scheme bcryptScheme) hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), scheme.params.Cost)
+}
+
+// compare returns ErrMismatch if password does not match encoded hash.
+func (scheme bcryptScheme) compare(encoded []byte, password string) error {
+	return ErrMismatch.Wrap(bcrypt.CompareHashAndPassword(encoded, []byte(password)))
+}
+
+// outdated returns true if hash was created with other cost than configured.
+func (scheme bcryptScheme) outdated(encoded []byte) bool {
+	cost, err := bcrypt.Cost(encoded)
+	return err != nil || cost != scheme.params.Cost
+}
+
+// matches returns true if hash is bcrypt hash.
+func (scheme bcryptScheme) matches(encoded []byte) bool {
+	return bytes.HasPrefix(encoded, []byte("$2a$")) || bytes.HasPrefix(encoded, []byte("$2b$")) || bytes.HasPrefix(encoded, []byte("$2y$"))
+}
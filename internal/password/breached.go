@@ -0,0 +1,376 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password
+
+// breached contains commonly used passwords from public breach compilations.
+// Passwords are stored in lower case.
+var breached = map[string]struct{}{
+	"!qaz2wsx":         {},
+	"0000":             {},
+	"000000":           {},
+	"0000000000":       {},
+	"0987654321":       {},
+	"1029384756":       {},
+	"1111":             {},
+	"11111":            {},
+	"111111":           {},
+	"11111111":         {},
+	"1111111111":       {},
+	"11111111111":      {},
+	"112233":           {},
+	"121212":           {},
+	"1212121212":       {},
+	"123123":           {},
+	"123123123":        {},
+	"123321":           {},
+	"1234":             {},
+	"12344321":         {},
+	"12345":            {},
+	"1234554321":       {},
+	"123456":           {},
+	"1234567":          {},
+	"12345678":         {},
+	"123456789":        {},
+	"1234567890":       {},
+	"12345678910":      {},
+	"123456789a":       {},
+	"123456789q":       {},
+	"1234qwer":         {},
+	"123654":           {},
+	"123abc123":        {},
+	"123qwe":           {},
+	"123qweasd":        {},
+	"123qweasdzxc":     {},
+	"131313":           {},
+	"1357924680":       {},
+	"159753":           {},
+	"1q2w3e":           {},
+	"1q2w3e4r":         {},
+	"1q2w3e4r5":        {},
+	"1q2w3e4r5t":       {},
+	"1q2w3e4r5t6y":     {},
+	"1qaz2wsx":         {},
+	"1qaz2wsx3edc":     {},
+	"1qazxsw2":         {},
+	"2000":             {},
+	"222222":           {},
+	"232323":           {},
+	"333333":           {},
+	"555555":           {},
+	"5555555555":       {},
+	"654321":           {},
+	"666666":           {},
+	"6969":             {},
+	"696969":           {},
+	"777777":           {},
+	"7777777":          {},
+	"7777777777":       {},
+	"8675309":          {},
+	"87654321":         {},
+	"888888":           {},
+	"88888888":         {},
+	"987654":           {},
+	"987654321":        {},
+	"999999":           {},
+	"9999999999":       {},
+	"a123456789":       {},
+	"aaaaaa":           {},
+	"aaaaaaaaaa":       {},
+	"abc123":           {},
+	"abc123456":        {},
+	"abcd1234":         {},
+	"abcdefg":          {},
+	"abcdefgh":         {},
+	"abcdefghij":       {},
+	"access":           {},
+	"adidas":           {},
+	"admin":            {},
+	"admin123":         {},
+	"admin1234":        {},
+	"administrator":    {},
+	"amanda":           {},
+	"andrea":           {},
+	"andrew":           {},
+	"angel":            {},
+	"anthony":          {},
+	"arsenal":          {},
+	"asd123":           {},
+	"asdfasdf":         {},
+	"asdfgh":           {},
+	"asdfghjkl":        {},
+	"asdfghjkl1":       {},
+	"ashley":           {},
+	"austin":           {},
+	"autumn2021":       {},
+	"badboy":           {},
+	"bailey":           {},
+	"banana":           {},
+	"barney":           {},
+	"baseball":         {},
+	"baseball1":        {},
+	"batman":           {},
+	"batman123":        {},
+	"bigdaddy":         {},
+	"bigdick":          {},
+	"bigdog":           {},
+	"biteme":           {},
+	"booboo":           {},
+	"boomer":           {},
+	"boston":           {},
+	"brandon":          {},
+	"brandy":           {},
+	"bulldog":          {},
+	"buster":           {},
+	"camaro":           {},
+	"casper":           {},
+	"changeme":         {},
+	"changeme123":      {},
+	"charles":          {},
+	"charlie":          {},
+	"cheese":           {},
+	"chelsea":          {},
+	"chester":          {},
+	"chicago":          {},
+	"chicken":          {},
+	"chris":            {},
+	"cleanmasters":     {},
+	"cleanmasters1":    {},
+	"cleanmasters123":  {},
+	"cocacola":         {},
+	"coffee":           {},
+	"compaq":           {},
+	"computer":         {},
+	"computer1":        {},
+	"cookie":           {},
+	"corvette":         {},
+	"cowboy":           {},
+	"cowboys":          {},
+	"crystal":          {},
+	"dakota":           {},
+	"dallas":           {},
+	"daniel":           {},
+	"default":          {},
+	"diablo":           {},
+	"diamond":          {},
+	"dragon":           {},
+	"dragon123":        {},
+	"eagles":           {},
+	"edward":           {},
+	"enter":            {},
+	"falcon":           {},
+	"fender":           {},
+	"ferrari":          {},
+	"fishing":          {},
+	"flower":           {},
+	"football":         {},
+	"football1":        {},
+	"forever":          {},
+	"freedom":          {},
+	"freedom1":         {},
+	"fucker":           {},
+	"fuckoff":          {},
+	"gandalf":          {},
+	"gateway":          {},
+	"george":           {},
+	"gfhjkm":           {},
+	"ghbdtn":           {},
+	"ginger":           {},
+	"golden":           {},
+	"golfer":           {},
+	"guest":            {},
+	"guitar":           {},
+	"hammer":           {},
+	"hannah":           {},
+	"hardcore":         {},
+	"harley":           {},
+	"heather":          {},
+	"hello":            {},
+	"hockey":           {},
+	"hunter":           {},
+	"iceman":           {},
+	"iloveu":           {},
+	"iloveyou":         {},
+	"iloveyou1":        {},
+	"iloveyou123":      {},
+	"internet":         {},
+	"internet1":        {},
+	"iwantu":           {},
+	"jackson":          {},
+	"james":            {},
+	"jasmine":          {},
+	"jasper":           {},
+	"jennifer":         {},
+	"jennifer1":        {},
+	"jessica":          {},
+	"johnny":           {},
+	"jordan":           {},
+	"jordan23":         {},
+	"joseph":           {},
+	"joshua":           {},
+	"junior":           {},
+	"justin":           {},
+	"killer":           {},
+	"klaster":          {},
+	"knight":           {},
+	"lakers":           {},
+	"letmein":          {},
+	"letmein123":       {},
+	"login":            {},
+	"london":           {},
+	"love":             {},
+	"maggie":           {},
+	"marina":           {},
+	"marine":           {},
+	"marlboro":         {},
+	"martin":           {},
+	"master":           {},
+	"master123":        {},
+	"matrix":           {},
+	"matthew":          {},
+	"maverick":         {},
+	"melissa":          {},
+	"mercedes":         {},
+	"merlin":           {},
+	"michael":          {},
+	"michael1":         {},
+	"michelle":         {},
+	"mickey":           {},
+	"midnight":         {},
+	"miller":           {},
+	"minecraft":        {},
+	"money":            {},
+	"monkey":           {},
+	"monkey123":        {},
+	"monster":          {},
+	"morgan":           {},
+	"mother":           {},
+	"mustang":          {},
+	"mustang1":         {},
+	"mypassword":       {},
+	"mypassword1":      {},
+	"nascar":           {},
+	"natasha":          {},
+	"ncc1701":          {},
+	"nicole":           {},
+	"nikita":           {},
+	"oliver":           {},
+	"orange":           {},
+	"p@ssw0rd":         {},
+	"p@ssw0rd1":        {},
+	"p@ssword":         {},
+	"p@ssword1":        {},
+	"panties":          {},
+	"pass":             {},
+	"passw0rd":         {},
+	"password":         {},
+	"password01":       {},
+	"password1":        {},
+	"password12":       {},
+	"password123":      {},
+	"password1234":     {},
+	"password12345":    {},
+	"password2":        {},
+	"passwordpassword": {},
+	"patrick":          {},
+	"peanut":           {},
+	"pepper":           {},
+	"phoenix":          {},
+	"player":           {},
+	"please":           {},
+	"porsche":          {},
+	"prince":           {},
+	"princess":         {},
+	"princess1":        {},
+	"purple":           {},
+	"q1w2e3r4":         {},
+	"q1w2e3r4t5":       {},
+	"q1w2e3r4t5y6":     {},
+	"qazwsx":           {},
+	"qazwsxedc":        {},
+	"qazwsxedcrfv":     {},
+	"qqqqqqqqqq":       {},
+	"qwe123":           {},
+	"qwe123qwe":        {},
+	"qweasdzxc":        {},
+	"qweasdzxc123":     {},
+	"qwer1234":         {},
+	"qwerty":           {},
+	"qwerty1":          {},
+	"qwerty12":         {},
+	"qwerty123":        {},
+	"qwerty1234":       {},
+	"qwerty12345":      {},
+	"qwertyuiop":       {},
+	"qwertyuiop123":    {},
+	"rabbit":           {},
+	"rachel":           {},
+	"raiders":          {},
+	"ranger":           {},
+	"rangers":          {},
+	"redsox":           {},
+	"richard":          {},
+	"robert":           {},
+	"root":             {},
+	"samantha":         {},
+	"samsung":          {},
+	"scooby":           {},
+	"scooter":          {},
+	"secret":           {},
+	"secret123":        {},
+	"sexy":             {},
+	"shadow":           {},
+	"shadow123":        {},
+	"silver":           {},
+	"slayer":           {},
+	"smokey":           {},
+	"snoopy":           {},
+	"soccer":           {},
+	"sparky":           {},
+	"spider":           {},
+	"spring2021":       {},
+	"starwars":         {},
+	"starwars1":        {},
+	"steelers":         {},
+	"steven":           {},
+	"summer":           {},
+	"summer2020":       {},
+	"summer2021":       {},
+	"sunshine":         {},
+	"sunshine1":        {},
+	"superman":         {},
+	"superman1":        {},
+	"taylor":           {},
+	"tennis":           {},
+	"test":             {},
+	"thomas":           {},
+	"thunder":          {},
+	"tigers":           {},
+	"tigger":           {},
+	"toor":             {},
+	"trustno1":         {},
+	"trustno11":        {},
+	"victoria":         {},
+	"welcome":          {},
+	"welcome1":         {},
+	"welcome123":       {},
+	"welcome2021":      {},
+	"whatever":         {},
+	"whatever1":        {},
+	"william":          {},
+	"winner":           {},
+	"winter":           {},
+	"winter2020":       {},
+	"winter2021":       {},
+	"wizard":           {},
+	"xxxxxx":           {},
+	"yamaha":           {},
+	"yankees":          {},
+	"yellow":           {},
+	"zaq12wsx":         {},
+	"zaq1zaq1":         {},
+	"zxc123":           {},
+	"zxcvbn":           {},
+	"zxcvbnm":          {},
+	"zxcvbnm123":       {},
+}
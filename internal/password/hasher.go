@@ -0,0 +1,131 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password
+
+import (
+	"github.com/zeebo/errs"
+)
+
+var (
+	// ErrHasher is an error class for password hashing errors.
+	ErrHasher = errs.Class("password hasher error")
+	// ErrMismatch indicates that password does not match the hash.
+	ErrMismatch = errs.Class("password does not match")
+)
+
+// Algorithm is a name of password hashing algorithm.
+type Algorithm string
+
+const (
+	// AlgorithmArgon2id is a memory-hard argon2id algorithm, it is used by default.
+	AlgorithmArgon2id Algorithm = "argon2id"
+	// AlgorithmBcrypt is a bcrypt algorithm.
+	AlgorithmBcrypt Algorithm = "bcrypt"
+)
+
+// HasherConfig defines algorithm and cost of new password hashes.
+type HasherConfig struct {
+	// Algorithm of new hashes, argon2id is used if it is empty.
+	Algorithm Algorithm
+	Argon2id  Argon2idParams
+	Bcrypt    BcryptParams
+}
+
+// DefaultHasherConfig is used for fields which are not configured.
+var DefaultHasherConfig = HasherConfig{
+	Algorithm: AlgorithmArgon2id,
+	Argon2id: Argon2idParams{
+		Time:       3,
+		Memory:     64 * 1024,
+		Threads:    2,
+		SaltLength: 16,
+		KeyLength:  32,
+	},
+	Bcrypt: BcryptParams{
+		Cost: 10,
+	},
+}
+
+// scheme hashes passwords with single algorithm.
+// Hashes encode algorithm and parameters, so they could be verified after configuration changes.
+type scheme interface {
+	// hash hashes password with configured parameters.
+	hash(password string) ([]byte, error)
+	// compare returns ErrMismatch if password does not match encoded hash.
+	compare(encoded []byte, password string) error
+	// outdated returns true if hash was created with other parameters than configured.
+	outdated(encoded []byte) bool
+	// matches returns true if hash is encoded by this scheme.
+	matches(encoded []byte) bool
+}
+
+// Hasher hashes passwords with configured algorithm and verifies hashes created by any supported algorithm.
+type Hasher struct {
+	current Algorithm
+	schemes map[Algorithm]scheme
+}
+
+// NewHasher is a constructor for Hasher, DefaultHasherConfig is used for empty fields.
+func NewHasher(config HasherConfig) *Hasher {
+	if config.Algorithm == "" {
+		config.Algorithm = DefaultHasherConfig.Algorithm
+	}
+	if config.Argon2id == (Argon2idParams{}) {
+		config.Argon2id = DefaultHasherConfig.Argon2id
+	}
+	if config.Bcrypt == (BcryptParams{}) {
+		config.Bcrypt = DefaultHasherConfig.Bcrypt
+	}
+
+	return &Hasher{
+		current: config.Algorithm,
+		schemes: map[Algorithm]scheme{
+			AlgorithmArgon2id: argon2idScheme{params: config.Argon2id},
+			AlgorithmBcrypt:   bcryptScheme{params: config.Bcrypt},
+		},
+	}
+}
+
+// Hash hashes password with configured algorithm.
+func (hasher *Hasher) Hash(password string) ([]byte, error) {
+	scheme, ok := hasher.schemes[hasher.current]
+	if !ok {
+		return nil, ErrHasher.New("unknown algorithm %q", hasher.current)
+	}
+
+	hash, err := scheme.hash(password)
+
+	return hash, ErrHasher.Wrap(err)
+}
+
+// Compare returns ErrMismatch if password does not match the hash.
+func (hasher *Hasher) Compare(hash []byte, password string) error {
+	scheme, ok := hasher.scheme(hash)
+	if !ok {
+		return ErrMismatch.New("unknown hash format")
+	}
+
+	return scheme.compare(hash, password)
+}
+
+// NeedsRehash returns true if hash was created with other algorithm or parameters than configured.
+func (hasher *Hasher) NeedsRehash(hash []byte) bool {
+	scheme, ok := hasher.scheme(hash)
+	if !ok {
+		return true
+	}
+
+	return scheme != hasher.schemes[hasher.current] || scheme.outdated(hash)
+}
+
+// scheme returns scheme which encoded the hash.
+func (hasher *Hasher) scheme(hash []byte) (scheme, bool) {
+	for _, scheme := range hasher.schemes {
+		if scheme.matches(hash) {
+			return scheme, true
+		}
+	}
+
+	return nil, false
+}
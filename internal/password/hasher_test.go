@@ -0,0 +1,47 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/password"
+)
+
+// cheapArgon2id keeps tests fast.
+var cheapArgon2id = password.Argon2idParams{Time: 1, Memory: 64, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher(t *testing.T) {
+	argon2id := password.NewHasher(password.HasherConfig{Argon2id: cheapArgon2id})
+	bcrypt := password.NewHasher(password.HasherConfig{Algorithm: password.AlgorithmBcrypt, Bcrypt: password.BcryptParams{Cost: 4}})
+
+	argon2idHash, err := argon2id.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(argon2idHash), "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	bcryptHash, err := bcrypt.Hash("correct horse")
+	require.NoError(t, err)
+
+	for _, hasher := range []*password.Hasher{argon2id, bcrypt} {
+		assert.NoError(t, hasher.Compare(argon2idHash, "correct horse"))
+		assert.NoError(t, hasher.Compare(bcryptHash, "correct horse"))
+		assert.True(t, password.ErrMismatch.Has(hasher.Compare(argon2idHash, "battery staple")))
+		assert.True(t, password.ErrMismatch.Has(hasher.Compare(bcryptHash, "battery staple")))
+		assert.True(t, password.ErrMismatch.Has(hasher.Compare(nil, "")))
+	}
+
+	assert.False(t, argon2id.NeedsRehash(argon2idHash))
+	assert.True(t, argon2id.NeedsRehash(bcryptHash))
+	assert.False(t, bcrypt.NeedsRehash(bcryptHash))
+	assert.True(t, bcrypt.NeedsRehash(argon2idHash))
+
+	stronger := cheapArgon2id
+	stronger.Time = 2
+	assert.True(t, password.NewHasher(password.HasherConfig{Argon2id: stronger}).NeedsRehash(argon2idHash))
+	assert.True(t, password.NewHasher(password.HasherConfig{Algorithm: password.AlgorithmBcrypt, Bcrypt: password.BcryptParams{Cost: 5}}).NeedsRehash(bcryptHash))
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zeebo/errs"
+)
+
+// ErrPolicy indicates that password does not satisfy password policy.
+var ErrPolicy = errs.Class("password policy violation")
+
+// Policy defines requirements for passwords.
+type Policy struct {
+	// MinLength is a minimal number of characters in password.
+	MinLength int
+	// MaxLength is a maximal number of characters in password, bcrypt ignores everything after 72 bytes.
+	MaxLength int
+}
+
+// DefaultPolicy is used when password policy is not configured.
+var DefaultPolicy = Policy{
+	MinLength: 10,
+	MaxLength: 72,
+}
+
+// Validate checks that password satisfies policy and is not in the list of breached passwords.
+func (policy Policy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+
+	if length < policy.MinLength {
+		return ErrPolicy.New("password must be at least %d characters long", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && len(password) > policy.MaxLength {
+		return ErrPolicy.New("password must be at most %d bytes long", policy.MaxLength)
+	}
+	if IsBreached(password) {
+		return ErrPolicy.New("password is too common, it was found in a list of breached passwords")
+	}
+
+	return nil
+}
+
+// IsBreached checks password against the bundled list of breached passwords.
+func IsBreached(password string) bool {
+	_, ok := breached[strings.ToLower(password)]
+	return ok
+}
@@ -0,0 +1,29 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cleanmasters/internal/password"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := password.DefaultPolicy
+
+	assert.NoError(t, policy.Validate("correct horse battery staple"))
+
+	err := policy.Validate("short")
+	assert.True(t, password.ErrPolicy.Has(err))
+
+	err = policy.Validate(strings.Repeat("a", policy.MaxLength+1))
+	assert.True(t, password.ErrPolicy.Has(err))
+
+	err = policy.Validate("Password1234")
+	assert.True(t, password.ErrPolicy.Has(err))
+	assert.True(t, password.IsBreached("QWERTYUIOP"))
+}
@@ -6,14 +6,31 @@ package postgres
 import (
 	"errors"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
 const (
 	// pgErrorClassIntegrityConstraintViolation is the class of PostgreSQL errors indicating
 	// integrity constraint violations.
 	pgErrorClassIntegrityConstraintViolation = "23"
+
+	// CodeNotNullViolation is the PostgreSQL error code of not-null constraint violation.
+	CodeNotNullViolation = "23502"
+	// CodeForeignKeyViolation is the PostgreSQL error code of foreign key constraint violation.
+	CodeForeignKeyViolation = "23503"
+	// CodeUniqueViolation is the PostgreSQL error code of unique constraint violation.
+	CodeUniqueViolation = "23505"
 )
 
+// ConstraintViolation describes violated integrity constraint.
+type ConstraintViolation struct {
+	Code       string
+	Constraint string
+	// Column is reported for not-null violations only.
+	Column string
+}
+
 // FromError returns the 5-character PostgreSQL error code string associated
 // with the given error, if any.
 func FromError(err error) string {
@@ -21,9 +38,27 @@ func FromError(err error) string {
 	if errors.As(err, &sqlStateErr) {
 		return sqlStateErr.SQLState()
 	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
 	return ""
 }
 
+// AsConstraintViolation returns details of integrity constraint violation if error is about it.
+func AsConstraintViolation(err error) (ConstraintViolation, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || !strings.HasPrefix(string(pqErr.Code), pgErrorClassIntegrityConstraintViolation) {
+		return ConstraintViolation{}, false
+	}
+
+	return ConstraintViolation{
+		Code:       string(pqErr.Code),
+		Constraint: pqErr.Constraint,
+		Column:     pqErr.Column,
+	}, true
+}
+
 // IsConstraintError checks if given error is about constraint violation.
 func IsConstraintError(err error) bool {
 	errCode := FromError(err)
@@ -0,0 +1,27 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/postgres"
+)
+
+func TestAsConstraintViolation(t *testing.T) {
+	err := errs.Wrap(&pq.Error{Code: postgres.CodeUniqueViolation, Constraint: "clients_phone_key"})
+
+	assert.True(t, postgres.IsConstraintError(err))
+	violation, ok := postgres.AsConstraintViolation(err)
+	require.True(t, ok)
+	assert.Equal(t, postgres.ConstraintViolation{Code: postgres.CodeUniqueViolation, Constraint: "clients_phone_key"}, violation)
+
+	_, ok = postgres.AsConstraintViolation(&pq.Error{Code: "40001"})
+	assert.False(t, ok)
+
+	_, ok = postgres.AsConstraintViolation(errs.New("other"))
+	assert.False(t, ok)
+}
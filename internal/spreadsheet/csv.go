@@ -0,0 +1,59 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// ensures that CSVWriter implements Writer.
+var _ Writer = (*CSVWriter)(nil)
+
+// CSVWriter writes spreadsheet in csv format.
+// Cells which spreadsheet applications would evaluate as formulas are escaped.
+type CSVWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVWriter is a constructor for CSVWriter.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{writer: csv.NewWriter(w)}
+}
+
+// WriteRow writes a row of cells.
+func (writer *CSVWriter) WriteRow(cells []string) error {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = EscapeFormula(cell)
+	}
+
+	return Error.Wrap(writer.writer.Write(escaped))
+}
+
+// Close flushes buffered rows.
+func (writer *CSVWriter) Close() error {
+	writer.writer.Flush()
+	return Error.Wrap(writer.writer.Error())
+}
+
+// EscapeFormula prefixes cell with a quote if spreadsheet application would treat it as formula.
+// Signed numbers, e.g. phone numbers, are kept as is since they could not be formulas.
+func EscapeFormula(cell string) string {
+	if cell == "" {
+		return cell
+	}
+
+	switch cell[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + cell
+	case '+', '-':
+		if strings.Trim(cell[1:], "0123456789 .") != "" || len(cell) == 1 {
+			return "'" + cell
+		}
+	}
+
+	return cell
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package spreadsheet
+
+import (
+	"io"
+
+	"github.com/zeebo/errs"
+)
+
+// Error is a default error type for spreadsheet writers.
+var Error = errs.Class("spreadsheet error")
+
+// Format defines file format of spreadsheet.
+type Format string
+
+const (
+	// FormatCSV is a comma separated values format.
+	FormatCSV Format = "csv"
+	// FormatXLSX is an Office Open XML workbook format.
+	FormatXLSX Format = "xlsx"
+)
+
+// Formats contains all available formats.
+var Formats = []Format{FormatCSV, FormatXLSX}
+
+// IsValid checks that format is one of known formats.
+func (format Format) IsValid() bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentType returns media type of files in the format.
+func (format Format) ContentType() string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv"
+	}
+}
+
+// Writer writes rows of a single sheet one by one, so rows do not have to be kept in memory.
+type Writer interface {
+	// WriteRow writes a row of cells.
+	WriteRow(cells []string) error
+	// Close flushes buffered rows and finishes the file, it does not close underlying writer.
+	Close() error
+}
+
+// NewWriter returns writer of spreadsheet in the format.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w), nil
+	case FormatXLSX:
+		return NewXLSXWriter(w)
+	default:
+		return nil, Error.New("unknown format %q", format)
+	}
+}
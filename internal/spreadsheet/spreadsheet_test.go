@@ -0,0 +1,63 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package spreadsheet_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/spreadsheet"
+)
+
+func TestCSV(t *testing.T) {
+	var buffer bytes.Buffer
+
+	writer, err := spreadsheet.NewWriter(spreadsheet.FormatCSV, &buffer)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.WriteRow([]string{"phone", "name", "note"}))
+	require.NoError(t, writer.WriteRow([]string{"+380931234567", "=HYPERLINK(\"x\")", "-"}))
+	require.NoError(t, writer.WriteRow([]string{"-1 2", "@SUM(A1)", "+cmd"}))
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, "phone,name,note\n+380931234567,\"'=HYPERLINK(\"\"x\"\")\",'-\n-1 2,'@SUM(A1),'+cmd\n", buffer.String())
+}
+
+func TestXLSX(t *testing.T) {
+	var buffer bytes.Buffer
+
+	writer, err := spreadsheet.NewWriter(spreadsheet.FormatXLSX, &buffer)
+	require.NoError(t, err)
+
+	cells := make([]string, 28)
+	cells[0], cells[27] = "<Ivan & Co>", "=1+1\x01"
+	require.NoError(t, writer.WriteRow(cells))
+	require.NoError(t, writer.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.NoError(t, err)
+
+	var names []string
+	var sheet []byte
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			reader, err := file.Open()
+			require.NoError(t, err)
+			sheet, err = ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+		}
+	}
+
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	assert.Contains(t, string(sheet), `<c r="A1" t="inlineStr"><is><t xml:space="preserve">&lt;Ivan &amp; Co&gt;</t></is></c>`)
+	assert.Contains(t, string(sheet), `<c r="AB1" t="inlineStr"><is><t xml:space="preserve">=1+1</t></is></c>`)
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ensures that XLSXWriter implements Writer.
+var _ Writer = (*XLSXWriter)(nil)
+
+// xlsxParts are static parts of single sheet workbook.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// XLSXWriter writes single sheet workbook in xlsx format.
+// Sheet is the last part of zip archive, so rows are compressed and written as they come.
+// All cells are inline strings, so they are never evaluated as formulas.
+type XLSXWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	row     int
+}
+
+// NewXLSXWriter is a constructor for XLSXWriter.
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	archive := zip.NewWriter(w)
+
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+		if _, err = io.WriteString(file, part.content); err != nil {
+			return nil, Error.Wrap(err)
+		}
+	}
+
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	writer := &XLSXWriter{
+		archive: archive,
+		sheet:   bufio.NewWriter(file),
+	}
+
+	_, err = writer.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return writer, Error.Wrap(err)
+}
+
+// WriteRow writes a row of cells.
+func (writer *XLSXWriter) WriteRow(cells []string) error {
+	writer.row++
+	row := strconv.Itoa(writer.row)
+
+	var builder strings.Builder
+	builder.WriteString(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		builder.WriteString(`<c r="` + columnName(i) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(&builder, []byte(stripInvalidXML(cell))); err != nil {
+			return Error.Wrap(err)
+		}
+		builder.WriteString(`</t></is></c>`)
+	}
+	builder.WriteString(`</row>`)
+
+	_, err := writer.sheet.WriteString(builder.String())
+
+	return Error.Wrap(err)
+}
+
+// Close finishes the sheet and writes zip archive directory.
+func (writer *XLSXWriter) Close() error {
+	_, err := writer.sheet.WriteString(`</sheetData></worksheet>`)
+	if err != nil {
+		return Error.Wrap(err)
+	}
+
+	if err = writer.sheet.Flush(); err != nil {
+		return Error.Wrap(err)
+	}
+
+	return Error.Wrap(writer.archive.Close())
+}
+
+// columnName returns spreadsheet column name of zero based index: A, B, ..., Z, AA, AB, ...
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+
+	return name
+}
+
+// stripInvalidXML removes characters which are not allowed in XML documents.
+func stripInvalidXML(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20 || r == 0xFFFE || r == 0xFFFF:
+			return -1
+		default:
+			return r
+		}
+	}, value)
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // #nosec RFC 6238 defaults to HMAC-SHA1 and authenticator apps expect it.
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// Error is an error class for totp errors.
+var Error = errs.Class("totp error")
+
+// SecretLength is a length of generated secrets in bytes, as recommended by RFC 4226.
+const SecretLength = 20
+
+// Config defines parameters of time-based one-time passwords.
+type Config struct {
+	// Period is a duration of one time step.
+	Period time.Duration
+	// Digits is a number of digits in code.
+	Digits int
+	// Skew is a number of time steps before and after the current one in which code is still accepted.
+	Skew int
+}
+
+// DefaultConfig is a configuration supported by all common authenticator apps.
+var DefaultConfig = Config{
+	Period: 30 * time.Second,
+	Digits: 6,
+	Skew:   1,
+}
+
+// TOTP generates and validates time-based one-time passwords as described in RFC 6238.
+type TOTP struct {
+	config Config
+	now    func() time.Time
+}
+
+// New is a constructor for TOTP. If now is nil, system clock is used.
+func New(config Config, now func() time.Time) *TOTP {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &TOTP{
+		config: config,
+		now:    now,
+	}
+}
+
+// Code returns one-time password for the given secret at the given moment.
+func (totp *TOTP) Code(secret []byte, at time.Time) string {
+	return totp.code(secret, totp.counter(at))
+}
+
+// Validate checks code against current time step and allowed skew.
+// Returns matched time step counter, so caller could reject reuse of the same code.
+func (totp *TOTP) Validate(secret []byte, code string) (counter int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.config.Digits {
+		return 0, false
+	}
+
+	current := totp.counter(totp.now())
+	for step := -totp.config.Skew; step <= totp.config.Skew; step++ {
+		candidate := current + int64(step)
+		if candidate < 0 {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totp.code(secret, candidate)), []byte(code)) == 1 {
+			return candidate, true
+		}
+	}
+
+	return 0, false
+}
+
+// KeyURI returns otpauth URI understood by authenticator apps, usually rendered as QR code.
+func (totp *TOTP) KeyURI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totp.config.Digits))
+	query.Set("period", strconv.Itoa(int(totp.config.Period/time.Second)))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
+
+// counter returns number of time steps passed since unix epoch.
+func (totp *TOTP) counter(at time.Time) int64 {
+	return at.Unix() / int64(totp.config.Period/time.Second)
+}
+
+// code computes HOTP value for the given counter as described in RFC 4226.
+func (totp *TOTP) code(secret []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	_, _ = mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totp.config.Digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totp.config.Digits, value%modulo)
+}
+
+// GenerateSecret generates new random secret.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretLength)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	return secret, nil
+}
+
+// EncodeSecret encodes secret to base32 without padding, a format used for manual entry in authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
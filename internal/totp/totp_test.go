@@ -0,0 +1,74 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/totp"
+)
+
+func TestCodeRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	generator := totp.New(totp.Config{
+		Period: 30 * time.Second,
+		Digits: 8,
+	}, nil)
+
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, vector := range vectors {
+		assert.Equal(t, vector.code, generator.Code(secret, time.Unix(vector.unix, 0)), vector.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	generator := totp.New(totp.DefaultConfig, func() time.Time { return now })
+
+	code := generator.Code(secret, now)
+	counter, ok := generator.Validate(secret, code)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, counter)
+
+	// previous and next time steps are accepted because of skew.
+	_, ok = generator.Validate(secret, generator.Code(secret, now.Add(-30*time.Second)))
+	assert.True(t, ok)
+	_, ok = generator.Validate(secret, generator.Code(secret, now.Add(30*time.Second)))
+	assert.True(t, ok)
+
+	// codes outside of the window are rejected.
+	_, ok = generator.Validate(secret, generator.Code(secret, now.Add(-90*time.Second)))
+	assert.False(t, ok)
+	_, ok = generator.Validate(secret, generator.Code(secret, now.Add(90*time.Second)))
+	assert.False(t, ok)
+
+	_, ok = generator.Validate(secret, "12345")
+	assert.False(t, ok)
+}
+
+func TestKeyURI(t *testing.T) {
+	generator := totp.New(totp.DefaultConfig, nil)
+
+	uri := generator.KeyURI("CleanMasters", "am@qwe.com", []byte("12345678901234567890"))
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/CleanMasters:am@qwe.com?"))
+	assert.Contains(t, uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	assert.Contains(t, uri, "issuer=CleanMasters")
+}
@@ -5,18 +5,27 @@ package cleanmasters
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"net"
 
+	"github.com/zeebo/errs"
 	"golang.org/x/sync/errgroup"
 
 	"cleanmasters/adminportal/adminauth"
 	"cleanmasters/adminportal/adminportalweb"
 	"cleanmasters/adminportal/managers"
+	"cleanmasters/audit"
 	"cleanmasters/clients"
+	"cleanmasters/console/consoleauth"
 	consoleserver "cleanmasters/console/server"
 	"cleanmasters/internal/auth"
+	"cleanmasters/internal/debug"
 	"cleanmasters/internal/logger"
+	"cleanmasters/internal/mail"
+	"cleanmasters/internal/password"
+	"cleanmasters/internal/totp"
+	"cleanmasters/trash"
 )
 
 // DB provides access to all databases and database related functionality.
@@ -27,11 +36,45 @@ type DB interface {
 	Clients() clients.DB
 	// Managers provides access to the managers database.
 	Managers() managers.DB
+	// ConsoleSessions provides access to the console sessions database.
+	ConsoleSessions() consoleauth.DB
+	// AdminAuth provides access to the managers authentication database.
+	AdminAuth() adminauth.DB
+	// Audit provides access to the audit log database.
+	Audit() audit.DB
+
+	// WithTx runs fn atomically: repositories of tx share one transaction, which is committed if fn returns nil
+	// and rolled back if fn returns an error or panics. fn is called again if transaction fails to serialize
+	// with concurrent ones, so it must not have side effects outside of tx.
+	WithTx(ctx context.Context, fn func(tx DB) error) error
+
+	// Ping checks that database is available.
+	Ping(ctx context.Context) error
+	// Stats returns statistics of database connections.
+	Stats() sql.DBStats
 
 	// Close closes underlying db connection.
 	Close() error
-	// CreateSchema create tables.
-	CreateSchema(ctx context.Context) (err error)
+	// MigrateToLatest applies all pending schema migrations.
+	MigrateToLatest(ctx context.Context) error
+}
+
+// ClientsTransaction returns clients.Transaction which runs on top of database transaction.
+func ClientsTransaction(db DB) clients.Transaction {
+	return func(ctx context.Context, fn func(db clients.DB, auditLog *audit.Service) error) error {
+		return db.WithTx(ctx, func(tx DB) error {
+			return fn(tx.Clients(), audit.NewService(tx.Audit()))
+		})
+	}
+}
+
+// ManagersTransaction returns managers.Transaction which runs on top of database transaction.
+func ManagersTransaction(db DB) managers.Transaction {
+	return func(ctx context.Context, fn func(db managers.DB, auditLog *audit.Service) error) error {
+		return db.WithTx(ctx, func(tx DB) error {
+			return fn(tx.Managers(), audit.NewService(tx.Audit()))
+		})
+	}
 }
 
 // Config is the global configuration for cleanmasters service.
@@ -41,9 +84,18 @@ type Config struct {
 		SignerSecret string
 	}
 	AdminPortal struct {
-		Endpoint     adminportalweb.Config
+		Endpoint       adminportalweb.Config
+		Auth           adminauth.Config
+		PasswordPolicy password.Policy
+		PasswordHasher password.HasherConfig
+		// Mail configures mailer of all emails, including the ones sent to clients.
+		Mail         mail.Config
 		SignerSecret string
 	}
+	// Trash defines how long deleted clients and managers could be restored.
+	Trash trash.Config
+	// Debug configures internal server with health check and database statistics.
+	Debug debug.Config
 }
 
 // Peer is the representation of a cleanmasters bank service.
@@ -53,6 +105,16 @@ type Peer struct {
 	Log      logger.Logger
 	Database DB
 
+	// records changes made by managers and clients.
+	Audit struct {
+		Service *audit.Service
+	}
+
+	// sends emails to managers and clients.
+	Mail struct {
+		Mailer mail.Mailer
+	}
+
 	// contains logic of clients domain.
 	Clients struct {
 		Service *clients.Service
@@ -60,9 +122,21 @@ type Peer struct {
 
 	// Web server with web api.
 	Console struct {
+		Listener       net.Listener
+		Endpoint       *consoleserver.Server
+		Signer         *auth.TokenSigner
+		Authentication *consoleauth.Service
+	}
+
+	// internal server with health check and database statistics.
+	Debug struct {
 		Listener net.Listener
-		Endpoint *consoleserver.Server
-		Signer   *auth.TokenSigner
+		Endpoint *debug.Server
+	}
+
+	// purges deleted records after retention period.
+	Trash struct {
+		Chore *trash.Chore
 	}
 
 	// Administrator portal mor managers to manage everything.
@@ -70,6 +144,7 @@ type Peer struct {
 		Signer         *auth.TokenSigner
 		Authentication *adminauth.Service
 		Managers       *managers.Service
+		PasswordHasher *password.Hasher
 		Listener       net.Listener
 		Endpoint       *adminportalweb.Server
 	}
@@ -83,15 +158,21 @@ func NewPeer(log logger.Logger, db DB, config Config) (peer *Peer, err error) {
 		Config:   config,
 	}
 
-	{ // clients setup
-		peer.Clients.Service = clients.NewService(
-			peer.Database.Clients(),
+	{ // audit setup
+		peer.Audit.Service = audit.NewService(
+			peer.Database.Audit(),
 		)
 	}
 
-	{ // managers setup
+	{ // mail setup
+		peer.Mail.Mailer = mail.New(peer.Log, peer.Config.AdminPortal.Mail)
+	}
+
+	{ // clients setup
 		peer.Clients.Service = clients.NewService(
 			peer.Database.Clients(),
+			peer.Mail.Mailer,
+			ClientsTransaction(peer.Database),
 		)
 	}
 
@@ -101,11 +182,20 @@ func NewPeer(log logger.Logger, db DB, config Config) (peer *Peer, err error) {
 			return nil, err
 		}
 
+		peer.Console.Signer = auth.NewTokenSigner(peer.Config.Console.SignerSecret)
+
+		peer.Console.Authentication = consoleauth.NewService(
+			peer.Database.ConsoleSessions(),
+			peer.Clients.Service,
+			peer.Console.Signer,
+			peer.Audit.Service,
+		)
+
 		peer.Console.Endpoint, err = consoleserver.NewServer(
 			peer.Log,
 			config.Console.Endpoint,
 			peer.Clients.Service,
-			nil, // TODO: add auth service
+			peer.Console.Authentication,
 			peer.Console.Listener,
 		)
 		if err != nil {
@@ -121,18 +211,68 @@ func NewPeer(log logger.Logger, db DB, config Config) (peer *Peer, err error) {
 
 		peer.AdminPortal.Signer = auth.NewTokenSigner(peer.Config.AdminPortal.SignerSecret)
 
-		peer.AdminPortal.Managers = managers.NewService(peer.Database.Managers())
+		peer.AdminPortal.PasswordHasher = password.NewHasher(peer.Config.AdminPortal.PasswordHasher)
 
-		peer.AdminPortal.Authentication = adminauth.NewService(peer.AdminPortal.Signer, peer.AdminPortal.Managers)
+		peer.AdminPortal.Managers = managers.NewService(
+			peer.Database.Managers(),
+			peer.Config.AdminPortal.PasswordPolicy,
+			peer.AdminPortal.PasswordHasher,
+			ManagersTransaction(peer.Database),
+		)
+
+		peer.AdminPortal.Authentication = adminauth.NewService(
+			peer.Config.AdminPortal.Auth,
+			peer.Database.AdminAuth(),
+			peer.AdminPortal.Signer,
+			peer.AdminPortal.Managers,
+			totp.New(totp.DefaultConfig, nil),
+			peer.Mail.Mailer,
+			peer.AdminPortal.PasswordHasher,
+		)
 
-		peer.AdminPortal.Endpoint = adminportalweb.NewServer(
+		peer.AdminPortal.Endpoint, err = adminportalweb.NewServer(
 			peer.Log,
 			peer.Config.AdminPortal.Endpoint,
 			peer.AdminPortal.Authentication,
 			peer.Clients.Service,
 			peer.AdminPortal.Managers,
+			peer.Audit.Service,
+			peer.Console.Authentication,
 			peer.AdminPortal.Listener,
 		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // debug setup
+		address := config.Debug.Address
+		if address == "" {
+			address = debug.DefaultConfig.Address
+		}
+
+		peer.Debug.Listener, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+
+		peer.Debug.Endpoint = debug.NewServer(
+			peer.Log,
+			config.Debug,
+			peer.Database,
+			peer.Debug.Listener,
+		)
+	}
+
+	{ // trash setup
+		peer.Trash.Chore = trash.NewChore(
+			peer.Log,
+			config.Trash,
+			map[string]trash.Purger{
+				"clients":  peer.Clients.Service,
+				"managers": peer.AdminPortal.Managers,
+			},
+		)
 	}
 
 	return peer, nil
@@ -147,6 +287,11 @@ func (peer *Peer) Run(ctx context.Context) error {
 		return ignoreCancel(peer.Console.Endpoint.Run(ctx))
 	})
 
+	// serve health check and database statistics.
+	group.Go(func() error {
+		return ignoreCancel(peer.Debug.Endpoint.Run(ctx))
+	})
+
 	return group.Wait()
 }
 
@@ -159,20 +304,36 @@ func (peer *Peer) RunAdmin(ctx context.Context) error {
 		return ignoreCancel(peer.AdminPortal.Endpoint.Run(ctx))
 	})
 
+	// serve health check and database statistics.
+	group.Go(func() error {
+		return ignoreCancel(peer.Debug.Endpoint.Run(ctx))
+	})
+
+	// purge trash in background.
+	group.Go(func() error {
+		return ignoreCancel(peer.Trash.Chore.Run(ctx))
+	})
+
 	return group.Wait()
 }
 
 // Close closes all the resources.
 func (peer *Peer) Close() error {
+	var group errs.Group
+
 	if peer.Console.Endpoint != nil {
-		return peer.Console.Endpoint.Close()
+		group.Add(peer.Console.Endpoint.Close())
 	}
 
 	if peer.AdminPortal.Endpoint != nil {
-		return peer.AdminPortal.Endpoint.Close()
+		group.Add(peer.AdminPortal.Endpoint.Close())
+	}
+
+	if peer.Debug.Endpoint != nil {
+		group.Add(peer.Debug.Endpoint.Close())
 	}
 
-	return nil
+	return group.Err()
 }
 
 // we ignore cancellation and stopping errors since they are expected.
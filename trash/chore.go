@@ -0,0 +1,100 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package trash
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"cleanmasters/internal/logger"
+)
+
+// Error is an error class for trash chore.
+var Error = errs.Class("trash chore error")
+
+// Config defines how long deleted records are kept in trash.
+type Config struct {
+	// Retention is a period after which deleted records are purged.
+	Retention time.Duration
+	// Interval is a period between purges.
+	Interval time.Duration
+}
+
+// DefaultConfig is used when trash is not configured.
+var DefaultConfig = Config{
+	Retention: 30 * 24 * time.Hour,
+	Interval:  time.Hour,
+}
+
+// Purger permanently deletes records which were deleted before the time.
+type Purger interface {
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+}
+
+// Chore periodically purges records which are in trash longer than retention period.
+//
+// architecture: Chore
+type Chore struct {
+	log     logger.Logger
+	config  Config
+	purgers map[string]Purger
+}
+
+// NewChore is a constructor for trash chore, purgers are keyed by name of records they purge.
+// DefaultConfig values are used for empty config fields.
+func NewChore(log logger.Logger, config Config, purgers map[string]Purger) *Chore {
+	if config.Retention <= 0 {
+		config.Retention = DefaultConfig.Retention
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+
+	return &Chore{
+		log:     log,
+		config:  config,
+		purgers: purgers,
+	}
+}
+
+// Run purges trash every interval until context is canceled.
+// Failed purge is logged and retried on the next interval.
+func (chore *Chore) Run(ctx context.Context) error {
+	ticker := time.NewTicker(chore.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := chore.RunOnce(ctx); err != nil {
+			chore.log.Error("could not purge trash", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges records which were deleted more than retention period ago.
+func (chore *Chore) RunOnce(ctx context.Context) error {
+	deletedBefore := time.Now().UTC().Add(-chore.config.Retention)
+
+	var group errs.Group
+	for name, purger := range chore.purgers {
+		purged, err := purger.Purge(ctx, deletedBefore)
+		if err != nil {
+			group.Add(Error.New("could not purge %s: %v", name, err))
+			continue
+		}
+		if purged > 0 {
+			chore.log.Debug("purged " + strconv.Itoa(purged) + " " + name + " from trash")
+		}
+	}
+
+	return group.Err()
+}
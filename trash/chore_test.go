@@ -0,0 +1,45 @@
+// Copyright (C) 2021 Creditor Corp. Group.
+// See LICENSE for copying information.
+
+package trash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cleanmasters/internal/logger/zaplog"
+	"cleanmasters/trash"
+)
+
+// purgerFunc adapts function to trash.Purger.
+type purgerFunc func(ctx context.Context, deletedBefore time.Time) (int, error)
+
+func (fn purgerFunc) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return fn(ctx, deletedBefore)
+}
+
+func TestChoreRunOnce(t *testing.T) {
+	ctx := context.Background()
+	retention := 48 * time.Hour
+
+	var purgedBefore time.Time
+	chore := trash.NewChore(zaplog.NewLog(), trash.Config{Retention: retention}, map[string]trash.Purger{
+		"clients": purgerFunc(func(ctx context.Context, deletedBefore time.Time) (int, error) {
+			purgedBefore = deletedBefore
+			return 2, nil
+		}),
+		"managers": purgerFunc(func(ctx context.Context, deletedBefore time.Time) (int, error) {
+			return 0, errors.New("failed")
+		}),
+	})
+
+	err := chore.RunOnce(ctx)
+	require.Error(t, err)
+	assert.True(t, trash.Error.Has(err))
+	assert.WithinDuration(t, time.Now().Add(-retention), purgedBefore, time.Minute)
+}